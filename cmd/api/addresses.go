@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/config"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/shipping"
+	"github.com/hamorrar/bookstore/internal/tax"
+)
+
+// newShippingCalculator builds the shipping calculator selected by the
+// configuration.
+func newShippingCalculator(cfg *config.Config) shipping.RateCalculator {
+	zones := shipping.Zones{}
+	for country, rate := range cfg.Shipping.Rates {
+		zones[country] = shipping.Rate{
+			Base:     money.New(rate.Base, cfg.Shipping.Currency),
+			Per_Unit: money.New(rate.PerUnit, cfg.Shipping.Currency),
+		}
+	}
+
+	if cfg.Shipping.Calculator == "weight" {
+		return shipping.ByWeight{Zones: zones}
+	}
+	return shipping.ByItemCount{Zones: zones}
+}
+
+// shippingUnavailable responds 422 for an address that cannot be shipped to.
+func (app *application) shippingUnavailable(c *gin.Context, err *shipping.UnavailableError) {
+	app.errorResponse(c, http.StatusUnprocessableEntity, codeShippingUnavailable, fmt.Sprintf("Orders cannot be shipped to %s.", err.Country))
+}
+
+// addressTaxRegion returns the tax region of an address: its country and
+// region when that makes a subdivision code such as US-CA, or else just its
+// country.
+func addressTaxRegion(a *database.Address) string {
+	if region := a.Country + "-" + strings.ToUpper(a.Region); tax.IsRegion(region) {
+		return region
+	}
+	return a.Country
+}
+
+// requestedAddresses reads the shipping_address and billing_address query
+// parameters, which are ids of addresses in the user's address book. The
+// shipping address defaults to the user's default address, if any, and the
+// billing address to the shipping address. It responds and returns false if
+// an id is malformed or names an address the user does not have.
+func (app *application) requestedAddresses(c *gin.Context, userId int) (*database.Address, *database.Address, bool) {
+	load := func(param string) (*database.Address, bool) {
+		value := c.Query(param)
+		if value == "" {
+			return nil, true
+		}
+
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, param+" must be an address id.")
+			return nil, false
+		}
+
+		a, err := app.models.Addresses.GetAddress(id)
+		if err != nil {
+			app.serverError(c, err)
+			return nil, false
+		}
+
+		if a == nil || a.User_Id != userId {
+			app.errorResponse(c, http.StatusNotFound, codeAddressNotFound, fmt.Sprintf("No address exists with id %d.", id))
+			return nil, false
+		}
+		return a, true
+	}
+
+	shippingAddress, ok := load("shipping_address")
+	if !ok {
+		return nil, nil, false
+	}
+	billingAddress, ok := load("billing_address")
+	if !ok {
+		return nil, nil, false
+	}
+
+	if shippingAddress == nil {
+		var err error
+		if shippingAddress, err = app.models.Addresses.GetDefaultAddress(userId); err != nil {
+			app.serverError(c, err)
+			return nil, nil, false
+		}
+	}
+	if billingAddress == nil {
+		billingAddress = shippingAddress
+	}
+	return shippingAddress, billingAddress, true
+}
+
+// bindAddress binds an address from the request body and checks its postal
+// code against its country, responding 400 and returning false if it is not
+// valid.
+func (app *application) bindAddress(c *gin.Context, a *database.Address) bool {
+	if err := c.ShouldBindJSON(a); err != nil {
+		app.bindingError(c, err)
+		return false
+	}
+
+	a.Postal_Code = strings.ToUpper(strings.TrimSpace(a.Postal_Code))
+	if err := shipping.CheckPostalCode(a.Country, a.Postal_Code); err != nil {
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "The request body failed validation.")
+		p.Errors = []fieldError{{
+			Field:   "postal_code",
+			Rule:    "postal_code",
+			Message: "must be a valid postal code for " + a.Country,
+		}}
+		writeProblem(c, p)
+		return false
+	}
+	return true
+}
+
+// getOwnAddress loads the address named by the id path parameter. It responds
+// and returns nil if the id is malformed or the address is not the user's.
+func (app *application) getOwnAddress(c *gin.Context) *database.Address {
+	user := app.GetUserFromContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The address id must be an integer.")
+		return nil
+	}
+
+	a, err := app.models.Addresses.GetAddress(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if a == nil || a.User_Id != user.Id {
+		app.errorResponse(c, http.StatusNotFound, codeAddressNotFound, fmt.Sprintf("No address exists with id %d.", id))
+		return nil
+	}
+	return a
+}
+
+// getMyAddresses gets the user's addresses
+//
+//	@Summary		get my addresses
+//	@Description	get the addresses in the logged in user's address book with the default first
+//	@Tags			address
+//	@Produce		json
+//	@Success		200	{array}		database.Address	"successfully got addresses"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/users/me/addresses [get]
+//	@Security		CookieAuth
+func (app *application) getMyAddresses(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+
+	addresses, err := app.models.Addresses.GetAddresses(user.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, addresses)
+}
+
+// getMyAddress gets one of the user's addresses
+//
+//	@Summary		get my address
+//	@Description	get an address in the logged in user's address book by id
+//	@Tags			address
+//	@Produce		json
+//	@Param			id	query		int					true	"id of address"
+//	@Success		200	{object}	database.Address	"successfully got an address"
+//	@Header			200	{string}	ETag				"version of the address"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		404	{object}	problem				"address_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/users/me/addresses/:id [get]
+//	@Security		CookieAuth
+func (app *application) getMyAddress(c *gin.Context) {
+	a := app.getOwnAddress(c)
+	if a == nil {
+		return
+	}
+
+	if app.notModified(c, a.Version) {
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// createMyAddress adds an address
+//
+//	@Summary		add an address
+//	@Description	add an address to the logged in user's address book. The postal code is checked against the country's format. The first address, or one with is_default set, becomes the default.
+//	@Tags			address
+//	@Accept			json
+//	@Produce		json
+//	@Param			address			body		database.Address	true	"new address"
+//	@Param			Idempotency-Key	header		string				false	"key that makes retries of this request safe"
+//	@Success		201				{object}	database.Address	"successfully added an address"
+//	@Header			201				{string}	ETag				"version of the address"
+//	@Failure		400				{object}	problem				"malformed_body or validation_failed"
+//	@Failure		409				{object}	problem				"idempotency_key_in_use"
+//	@Failure		422				{object}	problem				"idempotency_key_reused"
+//	@Failure		500				{object}	problem				"internal_error"
+//	@Router			/api/v1/users/me/addresses [post]
+//	@Security		CookieAuth
+func (app *application) createMyAddress(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+
+	var a database.Address
+
+	if !app.bindAddress(c, &a) {
+		return
+	}
+
+	a.User_Id = user.Id
+
+	if err := app.models.Addresses.CreateAddress(&a); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "address.create", Target_Type: auditTargetAddress, Target_Id: a.Id}, nil, &a)
+
+	setETag(c, a.Version)
+	c.JSON(http.StatusCreated, a)
+}
+
+// updateMyAddress updates an address
+//
+//	@Summary		update an address
+//	@Description	update an address in the logged in user's address book by id. Orders already placed keep their copy of it.
+//	@Tags			address
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int					true	"id of address to update"
+//	@Param			If-Match	header		string				true	"current ETag of the address"
+//	@Param			address		body		database.Address	true	"updated address"
+//	@Success		200			{object}	database.Address	"successfully updated an address"
+//	@Header			200			{string}	ETag				"new version of the address"
+//	@Failure		400			{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		404			{object}	problem				"address_not_found"
+//	@Failure		412			{object}	problem				"precondition_failed"
+//	@Failure		428			{object}	problem				"precondition_required"
+//	@Failure		500			{object}	problem				"internal_error"
+//	@Router			/api/v1/users/me/addresses/:id [put]
+//	@Security		CookieAuth
+func (app *application) updateMyAddress(c *gin.Context) {
+	existing := app.getOwnAddress(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	updated := &database.Address{}
+
+	if !app.bindAddress(c, updated) {
+		return
+	}
+
+	updated.Id, updated.User_Id, updated.Version = existing.Id, existing.User_Id, existing.Version
+
+	if err := app.models.Addresses.UpdateAddress(updated); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "address.update", Target_Type: auditTargetAddress, Target_Id: updated.Id}, existing, updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// deleteMyAddress deletes an address
+//
+//	@Summary		delete an address
+//	@Description	delete an address from the logged in user's address book by id. Orders already placed keep their copy of it.
+//	@Tags			address
+//	@Produce		json
+//	@Param			id			query	int		true	"id of address to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the address"
+//	@Success		204			"successfully deleted"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		404			{object}	problem	"address_not_found"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/users/me/addresses/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deleteMyAddress(c *gin.Context) {
+	existing := app.getOwnAddress(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	if err := app.models.Addresses.DeleteAddress(existing.Id, existing.Version); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "address.delete", Target_Type: auditTargetAddress, Target_Id: existing.Id}, existing, nil)
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckout_ShipsToAddress(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	makeStockedBook(admin, ts.URL+"/api/v1", "1000", "5")
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+
+	resp, body := doRequest(customer, http.MethodPost, ts.URL+"/api/v1/users/me/addresses",
+		`{"name":"Ada","line1":"1 Market St","city":"San Francisco","region":"CA","postal_code":"ABC","country":"US"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "postal_code", testutils.StringToJSON(body)["errors"].([]any)[0].(map[string]any)["field"])
+
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/users/me/addresses",
+		`{"name":"Ada","line1":"1 Market St","city":"San Francisco","region":"CA","postal_code":"94103","country":"US"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, true, testutils.StringToJSON(body)["is_default"])
+
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":2}`)
+
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	got := testutils.StringToJSON(body)
+	assert.Equal(t, map[string]any{"amount": float64(598), "currency": "USD"}, got["shipping_total"]) // 4.99 + 0.99
+	assert.Equal(t, map[string]any{"amount": float64(2598), "currency": "USD"}, got["total_price"])
+	assert.Equal(t, "US-CA", got["tax_region"])
+	assert.Equal(t, "San Francisco", got["shipping_address"].(map[string]any)["city"])
+
+	// Editing the address leaves the order's copy alone.
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/users/me/addresses/1",
+		strings.NewReader(`{"name":"Ada","line1":"2 Main St","city":"Oakland","region":"CA","postal_code":"94607","country":"US","is_default":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp, err := customer.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "San Francisco", testutils.StringToJSON(body)["shipping_address"].(map[string]any)["city"])
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/audit-events?target_type=address", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var actions []string
+	for _, event := range testutils.StringToJSONArray(body) {
+		actions = append(actions, event["action"].(string))
+	}
+	assert.Equal(t, []string{"address.update", "address.create"}, actions)
+
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?shipping_address=99", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeAddressNotFound, testutils.StringToJSON(body)["code"])
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/export"
+)
+
+// Audit target types.
+const (
+	auditTargetBook         = "book"
+	auditTargetUser         = "user"
+	auditTargetOrder        = "order"
+	auditTargetPromotion    = "promotion"
+	auditTargetAuthor       = "author"
+	auditTargetPublisher    = "publisher"
+	auditTargetCategory     = "category"
+	auditTargetImport       = "import"
+	auditTargetJob          = "job"
+	auditTargetWebhook      = "webhook"
+	auditTargetPayment      = "payment"
+	auditTargetReturn       = "return"
+	auditTargetShipment     = "shipment"
+	auditTargetExchangeRate = "exchange_rate"
+	auditTargetTaxRate      = "tax_rate"
+	auditTargetAddress      = "address"
+	auditTargetCart         = "cart"
+)
+
+const defaultAuditPageSize = 50
+
+// auditChange is the before and after value of one changed field.
+type auditChange struct {
+	From any `json:"from,omitempty"`
+	To   any `json:"to,omitempty"`
+}
+
+// auditChanges diffs the JSON representations of before and after, either of
+// which may be nil, by top-level field. Fields hidden from JSON, like
+// passwords and versions, never appear. It returns nil when nothing changed.
+func auditChanges(before, after any) (json.RawMessage, error) {
+	from, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]auditChange{}
+	for field, value := range from {
+		if !reflect.DeepEqual(value, to[field]) {
+			changes[field] = auditChange{From: value, To: to[field]}
+		}
+	}
+	for field, value := range to {
+		if _, ok := from[field]; !ok {
+			changes[field] = auditChange{To: value}
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(changes)
+}
+
+func auditFields(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// audit appends event to the audit log with the difference between before and
+// after and the details of the request. The actor defaults to the logged in
+// user. Failures are logged rather than failing a change that already
+// happened.
+func (app *application) audit(c *gin.Context, event *database.AuditEvent, before, after any) {
+	changes, err := auditChanges(before, after)
+	if err != nil {
+		log.Printf("diffing audit event %s for %s %d: %v", event.Action, event.Target_Type, event.Target_Id, err)
+	}
+	event.Changes = changes
+
+	if event.Actor_Id == 0 {
+		event.Actor_Id = app.GetUserFromContext(c).Id
+	}
+	event.IP = c.ClientIP()
+	event.User_Agent = c.Request.UserAgent()
+	event.Request_Id = requestIdFromContext(c)
+
+	if err := app.models.AuditEvents.CreateAuditEvent(event); err != nil {
+		log.Printf("recording audit event %s for %s %d: %v", event.Action, event.Target_Type, event.Target_Id, err)
+	}
+}
+
+// auditFilter reads the audit query parameters. It responds 400 and returns
+// false if one of them is malformed.
+func (app *application) auditFilter(c *gin.Context) (database.AuditFilter, bool) {
+	filter := database.AuditFilter{Target_Type: c.Query("target_type")}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"actor_id", &filter.Actor_Id},
+		{"target_id", &filter.Target_Id},
+		{"limit", &filter.Limit},
+		{"page", &filter.Page},
+	}
+	for _, param := range ints {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%s must be a non-negative integer.", param.name))
+			return filter, false
+		}
+		*param.dst = n
+	}
+
+	times := []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	}
+	for _, param := range times {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%s must be an RFC 3339 time such as 2024-01-02T15:04:05Z.", param.name))
+			return filter, false
+		}
+		*param.dst = t
+	}
+
+	return filter, true
+}
+
+// getAuditEvents gets a page of audit events
+//
+//	@Summary		gets a page of audit events
+//	@Description	gets a page of audit events, newest first, filtered by actor, target and time range
+//	@Tags			audit
+//	@Accept			json
+//	@Produce		json
+//	@Param			actor_id	query		int					false	"id of the user who made the change"
+//	@Param			target_type	query		string				false	"type of target, such as book, order, payment or return"
+//	@Param			target_id	query		int					false	"id of the changed resource"
+//	@Param			from		query		string				false	"earliest time, RFC 3339"
+//	@Param			to			query		string				false	"time before which events happened, RFC 3339"
+//	@Param			page		query		int					false	"page number to request"
+//	@Param			limit		query		int					false	"max number of events to return per page"
+//	@Success		200			{array}		database.AuditEvent	"successfully got audit events"
+//	@Failure		400			{object}	problem				"invalid_query"
+//	@Failure		403			{object}	problem				"forbidden"
+//	@Failure		500			{object}	problem				"internal_error"
+//	@Router			/api/v1/audit-events [get]
+//	@Security		CookieAuth
+func (app *application) getAuditEvents(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can read the audit log.")
+		return
+	}
+
+	filter, ok := app.auditFilter(c)
+	if !ok {
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+
+	events, err := app.models.AuditEvents.GetAuditEvents(filter)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// exportAuditEvents exports audit events as CSV
+//
+//	@Summary		export audit events
+//	@Description	export every audit event matching the filter as CSV, newest first
+//	@Tags			audit
+//	@Produce		text/csv
+//	@Param			actor_id	query		int		false	"id of the user who made the change"
+//	@Param			target_type	query		string	false	"type of target, such as book, order, payment or return"
+//	@Param			target_id	query		int		false	"id of the changed resource"
+//	@Param			from		query		string	false	"earliest time, RFC 3339"
+//	@Param			to			query		string	false	"time before which events happened, RFC 3339"
+//	@Success		200			{string}	string	"CSV file of audit events"
+//	@Failure		400			{object}	problem	"invalid_query"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/audit-events/export [get]
+//	@Security		CookieAuth
+func (app *application) exportAuditEvents(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can read the audit log.")
+		return
+	}
+
+	filter, ok := app.auditFilter(c)
+	if !ok {
+		return
+	}
+
+	// large exports take longer than the server's write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("clearing write deadline of audit export: %v", err)
+	}
+
+	out := &exportResponse{c: c, format: export.CSV, filename: "audit-events"}
+	w := csv.NewWriter(out)
+	w.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip", "user_agent", "request_id", "changes"})
+
+	err := app.models.AuditEvents.StreamAuditEvents(c.Request.Context(), filter, func(event *database.AuditEvent) error {
+		return w.Write([]string{
+			strconv.FormatInt(event.Id, 10),
+			event.Created_At.UTC().Format(time.RFC3339),
+			strconv.Itoa(event.Actor_Id),
+			event.Action,
+			event.Target_Type,
+			strconv.Itoa(event.Target_Id),
+			event.IP,
+			event.User_Agent,
+			event.Request_Id,
+			string(event.Changes),
+		})
+	})
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		if !out.started {
+			app.serverError(c, err)
+			return
+		}
+		// the response is under way, so all that can be done is cut it short
+		log.Printf("streaming audit export: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditChanges(t *testing.T) {
+	before := &database.Book{Id: 1, Title: "Title1", Author: "First", Price: money.New(1, "USD"), Version: 1}
+	after := &database.Book{Id: 1, Title: "Title1", Author: "First", Price: money.New(5, "USD"), Version: 2}
+
+	changes, err := auditChanges(before, after)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price":{"from":{"amount":1,"currency":"USD"},"to":{"amount":5,"currency":"USD"}}}`, string(changes))
+
+	changes, err = auditChanges(nil, after)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":{"to":1},"title":{"to":"Title1"},"author":{"to":"First"},"price":{"to":{"amount":5,"currency":"USD"}},"stock":{"to":0}}`, string(changes))
+
+	var deleted *database.Book
+	changes, err = auditChanges(before, deleted)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":{"from":1},"title":{"from":"Title1"},"author":{"from":"First"},"price":{"from":{"amount":1,"currency":"USD"}},"stock":{"from":0}}`, string(changes))
+
+	changes, err = auditChanges(before, before)
+	require.NoError(t, err)
+	assert.Nil(t, changes)
+
+	// hidden fields never reach the log
+	changes, err = auditChanges(&database.User{Password: "old"}, &database.User{Password: "new"})
+	require.NoError(t, err)
+	assert.Nil(t, changes)
+}
+
+func TestAuditEvents(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
+	testutils.LoginAdmin(client, ts.URL+"/api/v1")
+	testutils.MakeABook(client, ts.URL+"/api/v1")
+
+	req, _ := http.NewRequest(http.MethodPatch, ts.URL+"/api/v1/books/1", strings.NewReader(`{"price":{"amount":5,"currency":"USD"}}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("User-Agent", "audit-test")
+	req.Header.Set(requestIdHeader, "audit-request-1")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body := doRequest(client, http.MethodGet, ts.URL+"/api/v1/audit-events?target_type=book&target_id=1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	got := testutils.StringToJSONArray(body)
+	require.Len(t, got, 2)
+	assert.Equal(t, "book.patch", got[0]["action"])
+	assert.Equal(t, float64(1), got[0]["actor_id"])
+	assert.Equal(t, "audit-test", got[0]["user_agent"])
+	assert.Equal(t, "audit-request-1", got[0]["request_id"])
+	assert.Equal(t, map[string]any{"price": map[string]any{
+		"from": map[string]any{"amount": float64(1), "currency": "USD"},
+		"to":   map[string]any{"amount": float64(5), "currency": "USD"},
+	}}, got[0]["changes"])
+	assert.Equal(t, "book.create", got[1]["action"])
+
+	resp, body = doRequest(client, http.MethodGet, ts.URL+"/api/v1/audit-events?actor_id=1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, testutils.StringToJSONArray(body), 4) // register, login, create, patch
+
+	resp, body = doRequest(client, http.MethodGet, ts.URL+"/api/v1/audit-events?from=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidQuery, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(client, http.MethodGet, ts.URL+"/api/v1/audit-events/export?target_type=book", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "id,created_at,actor_id,action"))
+}
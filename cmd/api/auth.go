@@ -30,21 +30,21 @@ type registerRequest struct {
 //	@Produce		json
 //	@Param			user	body		registerRequest	true	"user registration info"
 //	@Success		201		{object}	database.User
-//	@Failure		400		{object}	gin.H	"error binding JSON"
-//	@Failure		500		{object}	gin.H	"error generating password"
-//	@Failure		500		{object}	gin.H	"error creating user"
+//	@Failure		400		{object}	problem	"malformed_body or validation_failed"
+//	@Failure		409		{object}	problem	"email_already_registered"
+//	@Failure		500		{object}	problem	"internal_error"
 //	@Router			/api/v1/auth/register [post]
 func (app *application) registerUser(c *gin.Context) {
 	var register registerRequest
 
 	if err := c.ShouldBindJSON(&register); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.bindingError(c, err)
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(register.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate password"})
+		app.serverError(c, err)
 		return
 	}
 
@@ -57,48 +57,55 @@ func (app *application) registerUser(c *gin.Context) {
 
 	err = app.models.Users.CreateUser(&user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create registered user"})
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeEmailAlreadyRegistered, "A user with this email is already registered.")
+			return
+		}
+		app.serverError(c, err)
 		return
 	}
+	app.audit(c, &database.AuditEvent{Actor_Id: user.Id, Action: "auth.register", Target_Type: auditTargetUser, Target_Id: user.Id}, nil, user)
+
+	setETag(c, user.Version)
 	c.JSON(http.StatusCreated, user)
 }
 
 // Login logins in a user
 //
 //	@Summary		logins a user
-//	@Description	logins a user
+//	@Description	logins a user and merges the anonymous cart of the cart cookie into their cart
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			user	body		loginRequest	true	"user login info"
 //	@Success		200		{object}	gin.H			"Successfully logged in user"
-//	@Failure		400		{object}	gin.H			"error binding JSON"
-//	@Failure		401		{object}	gin.H			"error finding user with email"
-//	@Failure		500		{object}	gin.H			"error getting user by email"
-//	@Failure		401		{object}	gin.H			"invalid email or password"
-//	@Failure		500		{object}	gin.H			"error generating token"
+//	@Failure		400		{object}	problem			"malformed_body or validation_failed"
+//	@Failure		401		{object}	problem			"invalid_credentials"
+//	@Failure		500		{object}	problem			"internal_error"
 //	@Router			/api/v1/auth/login [post]
 func (app *application) login(c *gin.Context) {
 	var auth loginRequest
 	if err := c.ShouldBindJSON(&auth); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.bindingError(c, err)
 		return
 	}
 
 	existingUser, err := app.models.Users.GetUserByEmail(auth.Email)
-	if existingUser == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found with this email"})
+	if err != nil {
+		app.serverError(c, err)
 		return
 	}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get user to login"})
+	if existingUser == nil {
+		app.audit(c, &database.AuditEvent{Action: "auth.login_failed", Target_Type: auditTargetUser}, nil, nil)
+		app.errorResponse(c, http.StatusUnauthorized, codeInvalidCredentials, "Invalid email or password.")
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(auth.Password))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		app.audit(c, &database.AuditEvent{Action: "auth.login_failed", Target_Type: auditTargetUser, Target_Id: existingUser.Id}, nil, nil)
+		app.errorResponse(c, http.StatusUnauthorized, codeInvalidCredentials, "Invalid email or password.")
 		return
 	}
 
@@ -107,13 +114,17 @@ func (app *application) login(c *gin.Context) {
 		"exp":    time.Now().Add(time.Hour).Unix(),
 	})
 
-	tokenString, err := token.SignedString([]byte(app.jwtSecret))
+	tokenString, err := token.SignedString([]byte(app.config.SecretKey))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		app.serverError(c, err)
 		return
 	}
 
 	c.SetCookie("auth_token", tokenString, 3600, "/", "", false, true)
 
+	app.mergeAnonymousCart(c, existingUser)
+
+	app.audit(c, &database.AuditEvent{Actor_Id: existingUser.Id, Action: "auth.login", Target_Type: auditTargetUser, Target_Id: existingUser.Id}, nil, nil)
+
 	c.JSON(http.StatusOK, gin.H{"userId": existingUser.Id})
 }
@@ -130,12 +130,13 @@ func TestRegister_Two_Customers_Same(t *testing.T) {
 
 	defer resp.Body.Close()
 
-	expected = `{"error": "could not create registered user"}`
+	expected = `{"type":"about:blank","title":"Conflict","status":409,"detail":"A user with this email is already registered.","instance":"/api/v1/auth/register","code":"email_already_registered"}`
 	got = testutils.StringToJSON(string(bodyBytes))
 	want = testutils.StringToJSON(expected)
 
 	assert.Equal(t, want, got)
-	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, problemContentType, resp.Header.Get("Content-Type"))
 }
 
 func TestLogin(t *testing.T) {
@@ -229,7 +230,7 @@ func TestLogin_Wrong_Password(t *testing.T) {
 
 	defer resp.Body.Close()
 
-	expected := `{"error": "Invalid email or password"}`
+	expected := `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"Invalid email or password.","instance":"/api/v1/auth/login","code":"invalid_credentials"}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -250,7 +251,7 @@ func TestLogin_Wrong_Password(t *testing.T) {
 	}
 	defer resp.Body.Close()
 
-	expected = `{"error": "Invalid email or password"}`
+	expected = `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"Invalid email or password.","instance":"/api/v1/auth/login","code":"invalid_credentials"}`
 	got = testutils.StringToJSON(string(bodyBytes))
 	want = testutils.StringToJSON(expected)
 
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+)
+
+type bookAuthorsRequest struct {
+	Author_Ids []int `json:"author_ids" binding:"required,min=1,unique,dive,min=1"`
+}
+
+// getAuthorFromParam loads the author named by the id path parameter. It
+// responds and returns nil if there is no such author.
+func (app *application) getAuthorFromParam(c *gin.Context) *database.Author {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The author id must be an integer.")
+		return nil
+	}
+
+	author, err := app.models.Authors.GetAuthor(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if author == nil {
+		app.errorResponse(c, http.StatusNotFound, codeAuthorNotFound, fmt.Sprintf("No author exists with id %d.", id))
+		return nil
+	}
+	return author
+}
+
+// getAuthors gets a page of authors
+//
+//	@Summary		gets a page of authors
+//	@Description	gets a page of authors ordered by name
+//	@Tags			author
+//	@Produce		json
+//	@Param			page	query		int				false	"page number to request"
+//	@Param			limit	query		int				false	"max number of authors to return per page, at most 100"
+//	@Success		200		{array}		database.Author	"successfully got a page of authors"
+//	@Failure		400		{object}	problem			"invalid_query"
+//	@Failure		500		{object}	problem			"internal_error"
+//	@Router			/api/v1/authors [get]
+func (app *application) getAuthors(c *gin.Context) {
+	limit, page, ok := app.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	authors, err := app.models.Authors.GetPageOfAuthors(limit, page)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, authors)
+}
+
+// getAuthor gets an author
+//
+//	@Summary		get author
+//	@Description	get an author by id
+//	@Tags			author
+//	@Produce		json
+//	@Param			id				query		int				true	"id of author"
+//	@Param			If-None-Match	header		string			false	"ETag from a previous response"
+//	@Success		200				{object}	database.Author	"successfully got an author"
+//	@Header			200				{string}	ETag			"version of the author"
+//	@Success		304				"author has not changed"
+//	@Failure		400				{object}	problem	"invalid_id"
+//	@Failure		404				{object}	problem	"author_not_found"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Router			/api/v1/authors/:id [get]
+func (app *application) getAuthor(c *gin.Context) {
+	author := app.getAuthorFromParam(c)
+	if author == nil {
+		return
+	}
+
+	if app.notModified(c, author.Version) {
+		return
+	}
+
+	c.JSON(http.StatusOK, author)
+}
+
+// getAuthorBooks gets a page of an author's books
+//
+//	@Summary		get author's books
+//	@Description	gets a page of the books credited to an author
+//	@Tags			author
+//	@Produce		json
+//	@Param			id			query		int				true	"id of author"
+//	@Param			page		query		int				false	"page number to request"
+//	@Param			limit		query		int				false	"max number of books to return per page, at most 100"
+//	@Param			currency	query		string			false	"currency to price the books in"
+//	@Success		200			{array}		database.Book	"successfully got a page of books"
+//	@Failure		400			{object}	problem			"invalid_id or invalid_query"
+//	@Failure		404			{object}	problem			"author_not_found"
+//	@Failure		422			{object}	problem			"exchange_rate_unavailable"
+//	@Failure		500			{object}	problem			"internal_error"
+//	@Router			/api/v1/authors/:id/books [get]
+func (app *application) getAuthorBooks(c *gin.Context) {
+	author := app.getAuthorFromParam(c)
+	if author == nil {
+		return
+	}
+
+	app.listBooks(c, func(limit int, page int) ([]*database.Book, error) {
+		return app.models.Books.GetBooksByAuthor(author.Id, limit, page)
+	})
+}
+
+// createAuthor creates an author
+//
+//	@Summary		creates an author
+//	@Description	adds an author, who can then be credited on books
+//	@Tags			author
+//	@Accept			json
+//	@Produce		json
+//	@Param			author			body		database.Author	true	"new author"
+//	@Param			Idempotency-Key	header		string			false	"key that makes retries of this request safe"
+//	@Success		201				{object}	database.Author	"successfully created an author"
+//	@Header			201				{string}	ETag			"version of the author"
+//	@Failure		400				{object}	problem			"malformed_body or validation_failed"
+//	@Failure		403				{object}	problem			"forbidden"
+//	@Failure		409				{object}	problem			"idempotency_key_in_use"
+//	@Failure		422				{object}	problem			"idempotency_key_reused"
+//	@Failure		500				{object}	problem			"internal_error"
+//	@Router			/api/v1/authors [post]
+//	@Security		CookieAuth
+func (app *application) createAuthor(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage authors.")
+		return
+	}
+
+	var author database.Author
+
+	if err := c.ShouldBindJSON(&author); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if err := app.models.Authors.CreateAuthor(&author); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "author.create", Target_Type: auditTargetAuthor, Target_Id: author.Id}, nil, author)
+
+	setETag(c, author.Version)
+	c.JSON(http.StatusCreated, author)
+}
+
+// updateAuthor updates an author
+//
+//	@Summary		update an author
+//	@Description	update an author by id. Renaming an author rewrites the author byline of their books.
+//	@Tags			author
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int				true	"id of author to update"
+//	@Param			If-Match	header		string			true	"current ETag of the author"
+//	@Param			author		body		database.Author	true	"updated author"
+//	@Success		200			{object}	database.Author	"successfully updated an author"
+//	@Header			200			{string}	ETag			"new version of the author"
+//	@Failure		400			{object}	problem			"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem			"forbidden"
+//	@Failure		404			{object}	problem			"author_not_found"
+//	@Failure		412			{object}	problem			"precondition_failed"
+//	@Failure		428			{object}	problem			"precondition_required"
+//	@Failure		500			{object}	problem			"internal_error"
+//	@Router			/api/v1/authors/:id [put]
+//	@Security		CookieAuth
+func (app *application) updateAuthor(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage authors.")
+		return
+	}
+
+	existing := app.getAuthorFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	updated := &database.Author{}
+
+	if err := c.ShouldBindJSON(updated); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	updated.Id = existing.Id
+	updated.Version = existing.Version
+
+	if err := app.models.Authors.UpdateAuthor(updated); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "author.update", Target_Type: auditTargetAuthor, Target_Id: updated.Id}, existing, updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// deleteAuthor deletes an author
+//
+//	@Summary		delete author
+//	@Description	delete an author by id. Authors credited on books cannot be deleted.
+//	@Tags			author
+//	@Produce		json
+//	@Param			id			query	int		true	"id of author to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the author"
+//	@Success		204			"successfully deleted"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		404			{object}	problem	"author_not_found"
+//	@Failure		409			{object}	problem	"author_in_use"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/authors/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deleteAuthor(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage authors.")
+		return
+	}
+
+	existing := app.getAuthorFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	if err := app.models.Authors.DeleteAuthor(existing.Id, existing.Version); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.errorResponse(c, http.StatusConflict, codeAuthorInUse, "The author is credited on books and cannot be deleted.")
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "author.delete", Target_Type: auditTargetAuthor, Target_Id: existing.Id}, existing, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// getBookAuthors gets the authors of a book
+//
+//	@Summary		get book authors
+//	@Description	get the authors of a book in the order they are credited
+//	@Tags			book
+//	@Produce		json
+//	@Param			id	query		int				true	"id of book"
+//	@Success		200	{array}		database.Author	"successfully got the authors"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		404	{object}	problem			"book_not_found"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/books/:id/authors [get]
+func (app *application) getBookAuthors(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	book, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if book == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	authors, err := app.models.Authors.GetBookAuthors(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, authors)
+}
+
+// setBookAuthors sets the authors of a book
+//
+//	@Summary		set book authors
+//	@Description	replace the authors of a book, credited in the order given. The book's author byline becomes their names.
+//	@Tags			book
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int					true	"id of book"
+//	@Param			If-Match	header		string				true	"current ETag of the book"
+//	@Param			authors		body		bookAuthorsRequest	true	"ids of the authors"
+//	@Success		200			{array}		database.Author		"successfully set the authors"
+//	@Header			200			{string}	ETag				"new version of the book"
+//	@Failure		400			{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem				"forbidden"
+//	@Failure		404			{object}	problem				"book_not_found"
+//	@Failure		412			{object}	problem				"precondition_failed"
+//	@Failure		422			{object}	problem				"author_not_found"
+//	@Failure		428			{object}	problem				"precondition_required"
+//	@Failure		500			{object}	problem				"internal_error"
+//	@Router			/api/v1/books/:id/authors [put]
+//	@Security		CookieAuth
+func (app *application) setBookAuthors(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can update books.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	book, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if book == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, book.Version) {
+		return
+	}
+
+	var request bookAuthorsRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	before, err := app.models.Authors.GetBookAuthors(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	_, version, err := app.models.Authors.SetBookAuthors(id, book.Version, request.Author_Ids)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.errorResponse(c, http.StatusUnprocessableEntity, codeAuthorNotFound, "Every author id must name an existing author.")
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	authors, err := app.models.Authors.GetBookAuthors(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "book.set_authors", Target_Type: auditTargetBook, Target_Id: id}, map[string]any{"authors": before}, map[string]any{"authors": authors})
+
+	setETag(c, version)
+	c.JSON(http.StatusOK, authors)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doIfMatch is doRequest with an If-Match header of the given ETag.
+func doIfMatch(client *http.Client, method, url, etag, payload string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(payload))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", etag)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return resp, string(bodyBytes)
+}
+
+func TestAuthors_BookLinksAndByline(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "3", "5")
+
+	// creating the book added its byline as an author
+	resp, body := doRequest(admin, http.MethodGet, url+"/books/1/authors", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	authors := testutils.StringToJSONArray(body)
+	require.Len(t, authors, 1)
+	assert.Equal(t, "First", authors[0]["name"])
+
+	resp, _ = doRequest(admin, http.MethodPost, url+"/authors", `{"name":"Second", "bio":"Writes."}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body = doIfMatch(admin, http.MethodPut, url+"/books/1/authors", `"1"`, `{"author_ids":[2, 1]}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	authors = testutils.StringToJSONArray(body)
+	require.Len(t, authors, 2)
+	assert.Equal(t, "Second", authors[0]["name"])
+
+	_, body = doRequest(admin, http.MethodGet, url+"/books/1", "")
+	assert.Equal(t, "Second, First", testutils.StringToJSON(body)["author"])
+
+	resp, body = doIfMatch(admin, http.MethodPut, url+"/books/1/authors", `"2"`, `{"author_ids":[9]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeAuthorNotFound, testutils.StringToJSON(body)["code"])
+
+	resp, body = doIfMatch(admin, http.MethodPut, url+"/books/1/authors", `"2"`, `{"author_ids":[1, 1]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeValidationFailed, testutils.StringToJSON(body)["code"])
+
+	// renaming an author rewrites the byline
+	resp, _ = doIfMatch(admin, http.MethodPut, url+"/authors/2", `"1"`, `{"name":"Secundus"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, body = doRequest(admin, http.MethodGet, url+"/books/1", "")
+	assert.Equal(t, "Secundus, First", testutils.StringToJSON(body)["author"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/authors/2/books", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, testutils.StringToJSONArray(body), 1)
+
+	resp, body = doIfMatch(admin, http.MethodDelete, url+"/authors/2", `"2"`, "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeAuthorInUse, testutils.StringToJSON(body)["code"])
+
+	// setting the byline directly links the book to that one author again
+	resp, _ = doIfMatch(admin, http.MethodPatch, url+"/books/1", `"3"`, `{"author":"Third"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, body = doRequest(admin, http.MethodGet, url+"/books/1/authors", "")
+	authors = testutils.StringToJSONArray(body)
+	require.Len(t, authors, 1)
+	assert.Equal(t, "Third", authors[0]["name"])
+
+	resp, _ = doIfMatch(admin, http.MethodDelete, url+"/authors/2", `"2"`, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/authors/2", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeAuthorNotFound, testutils.StringToJSON(body)["code"])
+}
+
+func TestAuthors_OnlyAdminsWrite(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+
+	resp, _ := doRequest(customer, http.MethodPost, ts.URL+"/api/v1/authors", `{"name":"Someone"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, body := doRequest(customer, http.MethodGet, ts.URL+"/api/v1/authors", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, testutils.StringToJSONArray(body))
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/isbn"
+	"github.com/hamorrar/bookstore/internal/money"
 )
 
 // createBook creates a book
@@ -16,33 +22,50 @@ import (
 //	@Tags			book
 //	@Accept			json
 //	@Produce		json
-//	@Param			book	body		database.Book	true	"new book to add to db"
-//	@Success		201		{object}	database.Book	"successfully created a book"
-//	@Failure		403		{object}	gin.H			"wrong role"
-//	@Failure		400		{object}	gin.H			"error binding JSON"
-//	@Failure		500		{object}	gin.H			"error creating books"
+//	@Param			book			body		database.Book	true	"new book to add to db"
+//	@Param			Idempotency-Key	header		string			false	"key that makes retries of this request safe"
+//	@Success		201				{object}	database.Book	"successfully created a book"
+//	@Failure		403				{object}	problem			"forbidden"
+//	@Failure		400				{object}	problem			"malformed_body or validation_failed"
+//	@Failure		409				{object}	problem			"isbn_exists or idempotency_key_in_use"
+//	@Failure		422				{object}	problem			"publisher_not_found or idempotency_key_reused"
+//	@Failure		500				{object}	problem			"internal_error"
 //	@Router			/api/v1/books [post]
 //	@Security		CookieAuth
 func (app *application) createBook(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unathorized to create book"})
+		app.forbidden(c, "Only admins can create books.")
 		return
 	}
 
 	var book database.Book
 
 	if err := c.ShouldBindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.bindingError(c, err)
+		return
+	}
+
+	if !app.normalizeIsbn(c, &book) {
 		return
 	}
 
 	err := app.models.Books.CreateBook(&book)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create book"})
+		switch {
+		case database.IsForeignKeyViolation(err):
+			app.publisherNotFound(c, book.Publisher_Id)
+		case database.IsUniqueViolation(err):
+			app.isbnExists(c, &book)
+		default:
+			app.serverError(c, err)
+		}
 		return
 	}
 
+	app.audit(c, &database.AuditEvent{Action: "book.create", Target_Type: auditTargetBook, Target_Id: book.Id}, nil, book)
+
+	setETag(c, book.Version)
 	c.JSON(http.StatusCreated, book)
 }
 
@@ -53,62 +76,191 @@ func (app *application) createBook(c *gin.Context) {
 //	@Tags			book
 //	@Accept			json
 //	@Produce		json
-//	@Param			page	query		int				false	"page number to request"
-//	@Param			limit	query		int				false	"max number of books to return per page"
-//	@Success		200		{array}		database.Book	"successfully got a page of books"
-//	@Failure		500		{object}	gin.H			"error getting a page"
+//	@Param			page		query		int				false	"page number to request"
+//	@Param			limit		query		int				false	"max number of books to return per page"
+//	@Param			currency	query		string			false	"currency to price the books in"
+//	@Success		200			{array}		database.Book	"successfully got a page of books"
+//	@Failure		400			{object}	problem			"invalid_query"
+//	@Failure		422			{object}	problem			"exchange_rate_unavailable"
+//	@Failure		500			{object}	problem			"internal_error"
 //	@Router			/api/v1/books [get]
 func (app *application) getPageOfBooks(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "2"))
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 
+	currency, ok := app.requestedCurrency(c)
+	if !ok {
+		return
+	}
+
 	books, err := app.models.Books.GetPageOfBooks(limit, page)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get books on page %d and limit %d", page, limit), "error msg": err.Error()})
+		app.serverError(c, fmt.Errorf("getting books on page %d with limit %d: %w", page, limit, err))
+		return
+	}
+
+	if currency != "" && !app.priceBooks(c, books, currency) {
 		return
 	}
 	c.JSON(http.StatusOK, books)
 }
 
-// getAllBooks gets all books
+// requestedPage reads the limit and page query parameters, capping limit at
+// 100. It responds 400 and returns false if either is not a non-negative
+// integer.
+func (app *application) requestedPage(c *gin.Context) (int, int, bool) {
+	var limit, page int
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"limit", &limit},
+		{"page", &page},
+	}
+	for _, param := range ints {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%s must be a non-negative integer.", param.name))
+			return 0, 0, false
+		}
+		*param.dst = n
+	}
+	return min(limit, 100), page, true
+}
+
+// listBooks responds with the page of books that list returns for the
+// requested limit and page, priced in the requested currency.
+func (app *application) listBooks(c *gin.Context, list func(limit int, page int) ([]*database.Book, error)) {
+	limit, page, ok := app.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	currency, ok := app.requestedCurrency(c)
+	if !ok {
+		return
+	}
+
+	books, err := list(limit, page)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if currency != "" && !app.priceBooks(c, books, currency) {
+		return
+	}
+	c.JSON(http.StatusOK, books)
+}
+
+// normalizeIsbn stores the book's ISBNs without hyphens and fills in its
+// ISBN-13 from its ISBN-10 or the other way round. The ISBNs must already be
+// validated. It responds 400 and returns false if both are given but belong
+// to different books.
+func (app *application) normalizeIsbn(c *gin.Context, book *database.Book) bool {
+	isbn13 := isbn.Clean(book.Isbn_13)
+	if book.Isbn_10 != "" {
+		from10, err := isbn.To13(book.Isbn_10)
+		if err != nil {
+			app.serverError(c, err)
+			return false
+		}
+		if isbn13 != "" && isbn13 != from10 {
+			p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "The request body failed validation.")
+			p.Errors = []fieldError{{
+				Field:   "isbn_10",
+				Rule:    "isbn",
+				Message: "must be the same book as isbn_13",
+			}}
+			writeProblem(c, p)
+			return false
+		}
+		isbn13 = from10
+	}
+	book.Isbn_13 = isbn13
+	book.Isbn_10, _ = isbn.To10(isbn13)
+	return true
+}
+
+// isbnExists responds 409 for a book whose ISBN another book already has.
+func (app *application) isbnExists(c *gin.Context, book *database.Book) {
+	app.errorResponse(c, http.StatusConflict, codeIsbnExists, fmt.Sprintf("A book with ISBN %s already exists.", book.Isbn_13))
+}
+
+// publisherNotFound responds 422 for a book naming a publisher that does not
+// exist.
+func (app *application) publisherNotFound(c *gin.Context, id int) {
+	app.errorResponse(c, http.StatusUnprocessableEntity, codePublisherNotFound, fmt.Sprintf("No publisher exists with id %d.", id))
+}
+
+// priceBooks replaces the prices of the books with their prices in currency.
+// It responds and returns false if that fails.
+func (app *application) priceBooks(c *gin.Context, books []*database.Book, currency string) bool {
+	err := app.models.Books.PriceIn(books, currency, time.Now())
+	if err != nil {
+		var rateErr *database.ExchangeRateError
+		if errors.As(err, &rateErr) {
+			app.exchangeRateUnavailable(c, rateErr)
+			return false
+		}
+		app.serverError(c, err)
+		return false
+	}
+	return true
+}
+
+// getAllBooks exports all books
 //
-//	@Summary		gets all books
-//	@Description	gets all books
+//	@Summary		exports all books
+//	@Description	streams every book as a JSON array, JSON Lines, CSV or Parquet, chosen by the format parameter or else the Accept header. JSON and JSON Lines carry books as the API returns them; CSV and Parquet carry flat rows with amounts in minor units.
 //	@Tags			book
-//	@Accept			json
-//	@Produce		json
-//	@Success		200	{array}		database.Book	"successfully got all books"
-//	@Failure		500	{object}	gin.H			"error getting all books"
+//	@Produce		json,text/csv,application/x-ndjson,application/vnd.apache.parquet
+//	@Param			format			query		string			false	"json, ndjson, csv or parquet"
+//	@Param			publisher_id	query		int				false	"only books named by this publisher"
+//	@Param			category_id		query		int				false	"only books filed under this category or below it"
+//	@Success		200				{array}		database.Book	"successfully exported the books"
+//	@Failure		400				{object}	problem			"invalid_query"
+//	@Failure		403				{object}	problem			"forbidden"
+//	@Failure		500				{object}	problem			"internal_error"
 //	@Router			/api/v2/books/all [get]
 //	@Security		CookieAuth
 func (app *application) getAllBooks(c *gin.Context) {
-
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to get all books"})
+		app.forbidden(c, "Only admins can list all books.")
 		return
 	}
 
-	limit := 3
-	page := 1
-	var allBooks []*database.Book
-	for {
-		books, err := app.models.Books.GetPageOfBooks(limit, page)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to get all books page by page."})
-			return
-		}
+	var filter database.BookFilter
 
-		allBooks = append(allBooks, books...)
-		if len(books) < limit {
-			break
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"publisher_id", &filter.Publisher_Id},
+		{"category_id", &filter.Category_Id},
+	}
+	for _, param := range ints {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
 		}
-		page++
-
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%s must be a non-negative integer.", param.name))
+			return
+		}
+		*param.dst = n
 	}
 
-	c.JSON(http.StatusOK, allBooks)
+	streamExport(app, c, "books", func(ctx context.Context, fn func(*database.Book) error) error {
+		return app.models.Books.StreamBooks(ctx, filter, fn)
+	}, newBookRecord)
 }
 
 // getBook get one book
@@ -118,28 +270,100 @@ func (app *application) getAllBooks(c *gin.Context) {
 //	@Tags			book
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	query		int				true	"id of book to get"
-//	@Success		200	{object}	database.Book	"successfully got a book"
-//	@Failure		400	{object}	gin.H			"invalid book id"
-//	@Failure		404	{object}	gin.H			"book not found with this id"
-//	@Failure		500	{object}	gin.H			"error getting book"
+//	@Param			id				query		int				true	"id of book to get"
+//	@Param			currency		query		string			false	"currency to price the book in"
+//	@Param			If-None-Match	header		string			false	"ETag from a previous response"
+//	@Success		200				{object}	database.Book	"successfully got a book"
+//	@Header			200				{string}	ETag			"version of the book"
+//	@Success		304				"book has not changed"
+//	@Failure		400				{object}	problem	"invalid_id or invalid_query"
+//	@Failure		404				{object}	problem	"book_not_found"
+//	@Failure		422				{object}	problem	"exchange_rate_unavailable"
+//	@Failure		500				{object}	problem	"internal_error"
 //	@Router			/api/v1/books/:id [get]
 func (app *application) getBook(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	currency, ok := app.requestedCurrency(c)
+	if !ok {
 		return
 	}
 
 	book, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
 	if book == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	app.respondWithBook(c, book, currency)
+}
+
+// getBookByIsbn gets one book by its ISBN
+//
+//	@Summary		get one book by ISBN
+//	@Description	get one book by its ISBN-13 or ISBN-10, with or without hyphens
+//	@Tags			book
+//	@Produce		json
+//	@Param			isbn			query		string			true	"ISBN of book to get"
+//	@Param			currency		query		string			false	"currency to price the book in"
+//	@Param			If-None-Match	header		string			false	"ETag from a previous response"
+//	@Success		200				{object}	database.Book	"successfully got a book"
+//	@Header			200				{string}	ETag			"version of the book"
+//	@Success		304				"book has not changed"
+//	@Failure		400				{object}	problem	"invalid_isbn or invalid_query"
+//	@Failure		404				{object}	problem	"book_not_found"
+//	@Failure		422				{object}	problem	"exchange_rate_unavailable"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Router			/api/v1/books/isbn/:isbn [get]
+func (app *application) getBookByIsbn(c *gin.Context) {
+	isbn13, err := isbn.To13(c.Param("isbn"))
+	if err != nil {
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidIsbn, "The ISBN must be an ISBN-10 or ISBN-13 with a correct check digit.")
 		return
 	}
 
+	currency, ok := app.requestedCurrency(c)
+	if !ok {
+		return
+	}
+
+	book, err := app.models.Books.GetBookByIsbn(isbn13)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get book"})
+		app.serverError(c, err)
+		return
+	}
+
+	if book == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with ISBN %s.", isbn13))
+		return
+	}
+
+	app.respondWithBook(c, book, currency)
+}
+
+// respondWithBook responds with the book, priced in currency if it is not
+// empty.
+func (app *application) respondWithBook(c *gin.Context, book *database.Book, currency string) {
+	// A converted price changes with the exchange rates, not just the
+	// book's version, so it is never answered with 304.
+	if currency != "" {
+		if app.priceBooks(c, []*database.Book{book}, currency) {
+			c.JSON(http.StatusOK, book)
+		}
+		return
+	}
+
+	if app.notModified(c, book.Version) {
 		return
 	}
 
@@ -153,34 +377,111 @@ func (app *application) getBook(c *gin.Context) {
 //	@Tags			book
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	query	int	true	"id of book to delete"
-//	@Success		204	"successfully deleted"
-//	@Failure		403	{object}	gin.H	"wrong role"
-//	@Failure		400	{object}	gin.H	"invalid id"
-//	@Failure		500	{object}	gin.H	"error deleting book"
+//	@Param			id			query	int		true	"id of book to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the book"
+//	@Success		204			"successfully deleted"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		404			{object}	problem	"book_not_found"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
 //	@Router			/api/v1/books/:id [delete]
 //	@Security		CookieAuth
 func (app *application) deleteBook(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to delete a book"})
+		app.forbidden(c, "Only admins can delete books.")
 		return
 	}
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	existingBook, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if existingBook == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, existingBook.Version) {
 		return
 	}
 
-	if err := app.models.Books.DeleteBook(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+	if err := app.models.Books.DeleteBook(id, existingBook.Version); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
 		return
 	}
 
+	app.audit(c, &database.AuditEvent{Action: "book.delete", Target_Type: auditTargetBook, Target_Id: id}, existingBook, nil)
+
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// restoreBook restores a deleted book
+//
+//	@Summary		restore book
+//	@Description	restore a deleted book by id
+//	@Tags			book
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	query		int				true	"id of book to restore"
+//	@Success		200	{object}	database.Book	"successfully restored a book"
+//	@Header			200	{string}	ETag			"new version of the book"
+//	@Failure		403	{object}	problem			"forbidden"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		404	{object}	problem			"book_not_found"
+//	@Failure		409	{object}	problem			"isbn_exists"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/books/:id/restore [post]
+//	@Security		CookieAuth
+func (app *application) restoreBook(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can restore books.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	book, err := app.models.Books.RestoreBook(id)
+	if err != nil {
+		// the ISBN was given to another book while this one was deleted
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeIsbnExists, "Another book has been given this book's ISBN since it was deleted.")
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	if book == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No deleted book exists with id %d.", id))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "book.restore", Target_Type: auditTargetBook, Target_Id: id}, nil, book)
+
+	setETag(c, book.Version)
+	c.JSON(http.StatusOK, book)
+}
+
 // updateBook updates a book
 //
 //	@Summary		update a book
@@ -188,40 +489,48 @@ func (app *application) deleteBook(c *gin.Context) {
 //	@Tags			book
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		query		int				true	"id of book to update"
-//	@Param			book	body		database.Book	true	"updated book data"
-//	@Success		200		{object}	database.Book	"successfully updated a book"
-//	@Failure		403		{object}	gin.H			"wrong role"
-//	@Failure		400		{object}	gin.H			"invalid id"
-//	@Failure		500		{object}	gin.H			"error getting book"
-//	@Failure		404		{object}	gin.H			"book to update not found"
-//	@Failure		400		{object}	gin.H			"error binding JSON"
-//	@Failure		500		{object}	gin.H			"failed to update book"
+//	@Param			id			query		int				true	"id of book to update"
+//	@Param			If-Match	header		string			true	"current ETag of the book"
+//	@Param			book		body		database.Book	true	"updated book data"
+//	@Success		200			{object}	database.Book	"successfully updated a book"
+//	@Header			200			{string}	ETag			"new version of the book"
+//	@Failure		403			{object}	problem			"forbidden"
+//	@Failure		400			{object}	problem			"invalid_id, malformed_body or validation_failed"
+//	@Failure		404			{object}	problem			"book_not_found"
+//	@Failure		409			{object}	problem			"isbn_exists"
+//	@Failure		412			{object}	problem			"precondition_failed"
+//	@Failure		422			{object}	problem			"publisher_not_found"
+//	@Failure		428			{object}	problem			"precondition_required"
+//	@Failure		500			{object}	problem			"internal_error"
 //	@Router			/api/v1/books/:id [put]
 //	@Security		CookieAuth
 func (app *application) updateBook(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to update book"})
+		app.forbidden(c, "Only admins can update books.")
 		return
 	}
 
 	id, err := strconv.Atoi(c.Param("id"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		app.invalidId(c, "The book id must be an integer.")
 		return
 	}
 
 	existingBook, err := app.models.Books.GetBook(id)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get book"})
+		app.serverError(c, err)
 		return
 	}
 
 	if existingBook == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, existingBook.Version) {
 		return
 	}
 
@@ -229,17 +538,268 @@ func (app *application) updateBook(c *gin.Context) {
 	updatedBook.Id = id
 
 	if err := c.ShouldBindJSON(updatedBook); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.bindingError(c, err)
 		return
 	}
 
 	updatedBook.Id = id
+	updatedBook.Version = existingBook.Version
+
+	if !app.normalizeIsbn(c, updatedBook) {
+		return
+	}
 
 	if err := app.models.Books.UpdateBook(updatedBook); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update book"})
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.publisherNotFound(c, updatedBook.Publisher_Id)
+		case database.IsUniqueViolation(err):
+			app.isbnExists(c, updatedBook)
+		default:
+			app.serverError(c, err)
+		}
 		return
 	}
 
+	app.audit(c, &database.AuditEvent{Action: "book.update", Target_Type: auditTargetBook, Target_Id: id}, existingBook, updatedBook)
+
+	setETag(c, updatedBook.Version)
 	c.JSON(http.StatusOK, updatedBook)
 
 }
+
+// patchBook partially updates a book
+//
+//	@Summary		partially update a book
+//	@Description	partially update a book by id with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902)
+//	@Tags			book
+//	@Accept			application/merge-patch+json,application/json-patch+json
+//	@Produce		json
+//	@Param			id			query		int				true	"id of book to update"
+//	@Param			If-Match	header		string			true	"current ETag of the book"
+//	@Param			patch		body		object			true	"merge patch or JSON patch document"
+//	@Success		200			{object}	database.Book	"successfully updated a book"
+//	@Header			200			{string}	ETag			"new version of the book"
+//	@Failure		403			{object}	problem			"forbidden"
+//	@Failure		400			{object}	problem			"invalid_id, malformed_body, invalid_patch or validation_failed"
+//	@Failure		404			{object}	problem			"book_not_found"
+//	@Failure		409			{object}	problem			"patch_test_failed or isbn_exists"
+//	@Failure		412			{object}	problem			"precondition_failed"
+//	@Failure		415			{object}	problem			"unsupported_media_type"
+//	@Failure		422			{object}	problem			"publisher_not_found"
+//	@Failure		428			{object}	problem			"precondition_required"
+//	@Failure		500			{object}	problem			"internal_error"
+//	@Router			/api/v1/books/:id [patch]
+//	@Security		CookieAuth
+func (app *application) patchBook(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can update books.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	existingBook, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if existingBook == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, existingBook.Version) {
+		return
+	}
+
+	patchedBook := &database.Book{}
+	if !app.applyPatch(c, existingBook, patchedBook) {
+		return
+	}
+
+	patchedBook.Id = id
+
+	// The patched document still holds the ISBN the client left alone, which
+	// is derived again from the one it changed.
+	switch {
+	case patchedBook.Isbn_13 != existingBook.Isbn_13 && patchedBook.Isbn_10 == existingBook.Isbn_10:
+		patchedBook.Isbn_10 = ""
+	case patchedBook.Isbn_10 != existingBook.Isbn_10 && patchedBook.Isbn_13 == existingBook.Isbn_13:
+		patchedBook.Isbn_13 = ""
+	}
+
+	if !app.normalizeIsbn(c, patchedBook) {
+		return
+	}
+
+	if err := app.models.Books.PatchBook(existingBook, patchedBook); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.publisherNotFound(c, patchedBook.Publisher_Id)
+		case database.IsUniqueViolation(err):
+			app.isbnExists(c, patchedBook)
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "book.patch", Target_Type: auditTargetBook, Target_Id: id}, existingBook, patchedBook)
+
+	setETag(c, patchedBook.Version)
+	c.JSON(http.StatusOK, patchedBook)
+}
+
+// getBookPrices gets the list prices of a book
+//
+//	@Summary		get book list prices
+//	@Description	get the list prices of a book in currencies other than its own, which are used instead of converting its price
+//	@Tags			book
+//	@Produce		json
+//	@Param			id	query		int			true	"id of book"
+//	@Success		200	{array}		money.Money	"successfully got the list prices"
+//	@Failure		400	{object}	problem		"invalid_id"
+//	@Failure		404	{object}	problem		"book_not_found"
+//	@Failure		500	{object}	problem		"internal_error"
+//	@Router			/api/v1/books/:id/prices [get]
+func (app *application) getBookPrices(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	book, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if book == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	prices, err := app.models.Books.GetBookPrices(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, prices)
+}
+
+// setBookPrice sets a list price of a book
+//
+//	@Summary		set book list price
+//	@Description	add or replace the list price of a book in one currency
+//	@Tags			book
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		query		int			true	"id of book"
+//	@Param			price	body		money.Money	true	"list price"
+//	@Success		200		{array}		money.Money	"successfully set the list price"
+//	@Failure		400		{object}	problem		"invalid_id, malformed_body or validation_failed"
+//	@Failure		403		{object}	problem		"forbidden"
+//	@Failure		404		{object}	problem		"book_not_found"
+//	@Failure		500		{object}	problem		"internal_error"
+//	@Router			/api/v1/books/:id/prices [put]
+//	@Security		CookieAuth
+func (app *application) setBookPrice(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can set book prices.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	var price money.Money
+
+	if err := c.ShouldBindJSON(&price); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	found, err := app.models.Books.SetBookPrice(id, price)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if !found {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "book.set_price", Target_Type: auditTargetBook, Target_Id: id}, nil, price)
+
+	prices, err := app.models.Books.GetBookPrices(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, prices)
+}
+
+// deleteBookPrice deletes a list price of a book
+//
+//	@Summary		delete book list price
+//	@Description	delete the list price of a book in one currency, after which its price is converted again
+//	@Tags			book
+//	@Produce		json
+//	@Param			id			query	int		true	"id of book"
+//	@Param			currency	query	string	true	"currency of the list price"
+//	@Success		204			"successfully deleted"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		404			{object}	problem	"book_price_not_found"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/books/:id/prices/:currency [delete]
+//	@Security		CookieAuth
+func (app *application) deleteBookPrice(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can set book prices.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	currency := strings.ToUpper(c.Param("currency"))
+
+	deleted, err := app.models.Books.DeleteBookPrice(id, currency)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if !deleted {
+		app.errorResponse(c, http.StatusNotFound, codeBookPriceNotFound, fmt.Sprintf("The book with id %d has no list price in %s.", id, currency))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "book.delete_price", Target_Type: auditTargetBook, Target_Id: id}, map[string]string{"currency": currency}, nil)
+
+	c.Status(http.StatusNoContent)
+}
@@ -15,6 +15,7 @@ import (
 	_ "github.com/golang-migrate/migrate/source/file"
 	_ "github.com/golang-migrate/migrate/v4"
 	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
 	"github.com/hamorrar/bookstore/internal/testutils"
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
@@ -39,7 +40,7 @@ func TestCreateBook(t *testing.T) {
 	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
 	testutils.LoginAdmin(client, ts.URL+"/api/v1")
 
-	payload := `{"title":"Title1", "author":"First","price":1}`
+	payload := `{"title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}}`
 
 	resp, err := client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
@@ -54,7 +55,7 @@ func TestCreateBook(t *testing.T) {
 
 	defer resp.Body.Close()
 
-	expected := `{"id":1, "title":"Title1", "author":"First","price":1}`
+	expected := `{"id":1, "title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -100,7 +101,7 @@ func TestGetBook(t *testing.T) {
 
 	defer resp.Body.Close()
 
-	expected := `{"id":1, "title":"Title1", "author":"First","price":1}`
+	expected := `{"id":1, "title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -129,12 +130,13 @@ func TestUpdateBook(t *testing.T) {
 	testutils.LoginAdmin(client, ts.URL+"/api/v1")
 	testutils.MakeABook(client, ts.URL+"/api/v1")
 
-	payload := `{"id":1, "title":"Title11", "author":"First","price":1}`
+	payload := `{"id":1, "title":"Title11", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/books/1", strings.NewReader(payload))
 	if err != nil {
 		fmt.Printf("Error creating request: %v\n", err)
 		return
 	}
+	req.Header.Set("If-Match", `"1"`)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -148,7 +150,7 @@ func TestUpdateBook(t *testing.T) {
 	}
 	defer resp.Body.Close()
 
-	expected := `{"id":1, "title":"Title11", "author":"First","price":1}`
+	expected := `{"id":1, "title":"Title11", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -180,7 +182,7 @@ func TestUpdateBook_Wrong_Role(t *testing.T) {
 	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
 	testutils.LoginCustomer(client, ts.URL+"/api/v1")
 
-	payload := `{"id":1, "title":"Title11", "author":"First","price":1}`
+	payload := `{"id":1, "title":"Title11", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/books/1", strings.NewReader(payload))
 	if err != nil {
 		fmt.Printf("Error creating request: %v\n", err)
@@ -199,7 +201,7 @@ func TestUpdateBook_Wrong_Role(t *testing.T) {
 	}
 	defer resp.Body.Close()
 
-	expected := `{"error":"Unauthorized to update book"}`
+	expected := `{"type":"about:blank","title":"Forbidden","status":403,"detail":"Only admins can update books.","instance":"/api/v1/books/1","code":"forbidden"}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -228,25 +230,25 @@ func TestGetPageofBooks(t *testing.T) {
 	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
 	testutils.LoginAdmin(client, ts.URL+"/api/v1")
 
-	payload := `{"title":"Title1", "author":"First","price":1}`
+	payload := `{"title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err := client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title2", "author":"First","price":1}`
+	payload = `{"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title3", "author":"First","price":1}`
+	payload = `{"title":"Title3", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title4", "author":"First","price":1}`
+	payload = `{"title":"Title4", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -270,7 +272,7 @@ func TestGetPageofBooks(t *testing.T) {
 		fmt.Println("unmarshalling error while test getting page", err.Error())
 	}
 
-	expected := `[{"id":1, "title":"Title1", "author":"First","price":1}, {"id":2, "title":"Title2", "author":"First","price":1}]`
+	expected := `[{"id":1, "title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}, {"id":2, "title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}]`
 
 	var want []database.Book
 	if err := json.Unmarshal([]byte(expected), &want); err != nil {
@@ -302,25 +304,25 @@ func TestGetPage_Params(t *testing.T) {
 	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
 	testutils.LoginAdmin(client, ts.URL+"/api/v1")
 
-	payload := `{"title":"Title1", "author":"First","price":1}`
+	payload := `{"title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err := client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title2", "author":"First","price":1}`
+	payload = `{"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title3", "author":"First","price":1}`
+	payload = `{"title":"Title3", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title4", "author":"First","price":1}`
+	payload = `{"title":"Title4", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -344,7 +346,7 @@ func TestGetPage_Params(t *testing.T) {
 		fmt.Println("unmarshalling error while test getting page", err.Error())
 	}
 
-	expected := `[{"id":3, "title":"Title3", "author":"First","price":1}, {"id":4, "title":"Title4", "author":"First","price":1}]`
+	expected := `[{"id":3, "title":"Title3", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}, {"id":4, "title":"Title4", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}]`
 
 	var want []database.Book
 	if err := json.Unmarshal([]byte(expected), &want); err != nil {
@@ -382,6 +384,7 @@ func TestDeleteBook(t *testing.T) {
 		fmt.Printf("Error creating request: %v\n", err)
 		return
 	}
+	req.Header.Set("If-Match", `"1"`)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -404,6 +407,43 @@ func TestDeleteBook(t *testing.T) {
 
 }
 
+func TestRestoreBook(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
+	testutils.LoginAdmin(client, ts.URL+"/api/v1")
+	testutils.MakeABook(client, ts.URL+"/api/v1")
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/books/1", nil)
+	req.Header.Set("If-Match", `"1"`)
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatalln("fatal request", err.Error())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = doRequest(client, http.MethodGet, ts.URL+"/api/v1/books/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body := doRequest(client, http.MethodPost, ts.URL+"/api/v1/books/1/restore", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Title1", testutils.StringToJSON(body)["title"])
+	assert.Equal(t, `"3"`, resp.Header.Get("ETag"))
+
+	resp, _ = doRequest(client, http.MethodGet, ts.URL+"/api/v1/books/1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the book is no longer deleted
+	resp, body = doRequest(client, http.MethodPost, ts.URL+"/api/v1/books/1/restore", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeBookNotFound, testutils.StringToJSON(body)["code"])
+}
+
 func TestGetAllBooks(t *testing.T) {
 	app := SetupTest()
 	router := gin.Default()
@@ -430,25 +470,25 @@ func TestGetAllBooks(t *testing.T) {
 	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
 	testutils.LoginAdmin(client, ts.URL+"/api/v1")
 
-	payload := `{"title":"Title1", "author":"First","price":1}`
+	payload := `{"title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err := client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title2", "author":"First","price":1}`
+	payload = `{"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title3", "author":"First","price":1}`
+	payload = `{"title":"Title3", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"title":"Title4", "author":"First","price":1}`
+	payload = `{"title":"Title4", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -471,7 +511,7 @@ func TestGetAllBooks(t *testing.T) {
 		fmt.Println("unmarshalling error while test getting all books", err.Error())
 	}
 
-	expected := `[{"Id":1,"title":"Title1", "author":"First","price":1},{"Id":2,"title":"Title2", "author":"First","price":1},{"Id":3,"title":"Title3", "author":"First","price":1},{"Id":4,"title":"Title4", "author":"First","price":1}]`
+	expected := `[{"Id":1,"title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0},{"Id":2,"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0},{"Id":3,"title":"Title3", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0},{"Id":4,"title":"Title4", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}]`
 	var want []database.Book
 	if err := json.Unmarshal([]byte(expected), &want); err != nil {
 		fmt.Println("unmarshalling error while test getting all books", err.Error())
@@ -480,3 +520,226 @@ func TestGetAllBooks(t *testing.T) {
 	assert.Equal(t, want, got)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
+
+func TestPatchBook(t *testing.T) {
+	app := SetupTest()
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", app.registerUser)
+	v1.POST("/auth/login", app.login)
+
+	authGroup := v1.Group("/")
+	authGroup.Use(app.AuthMiddleware())
+	authGroup.POST("/books", app.createBook)
+	authGroup.PATCH("/books/:id", app.patchBook)
+
+	ts := httptest.NewServer(router)
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
+	testutils.LoginAdmin(client, ts.URL+"/api/v1")
+	testutils.MakeABook(client, ts.URL+"/api/v1")
+
+	// merge patch only touches the fields it names
+	payload := `{"title":"Title11"}`
+	req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/v1/books/1", strings.NewReader(payload))
+	if err != nil {
+		fmt.Printf("Error creating request: %v\n", err)
+		return
+	}
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatalln("fatal request", err.Error())
+	}
+	defer ts.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	defer resp.Body.Close()
+
+	expected := `{"id":1, "title":"Title11", "author":"First","price":{"amount":1,"currency":"USD"}, "stock":0}`
+	got := testutils.StringToJSON(string(bodyBytes))
+	want := testutils.StringToJSON(expected)
+
+	assert.Equal(t, want, got)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// JSON patch
+	payload = `[{"op":"test","path":"/author","value":"First"},{"op":"replace","path":"/price/amount","value":5}]`
+	req, err = http.NewRequest(http.MethodPatch, ts.URL+"/api/v1/books/1", strings.NewReader(payload))
+	if err != nil {
+		fmt.Printf("Error creating request: %v\n", err)
+		return
+	}
+	req.Header.Set("If-Match", `"2"`)
+	req.Header.Set("Content-Type", "application/json-patch+json")
+
+	resp, err = client.Do(req)
+	if err != nil {
+		log.Fatalln("fatal request", err.Error())
+	}
+
+	bodyBytes, err = io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	defer resp.Body.Close()
+
+	expected = `{"id":1, "title":"Title11", "author":"First","price":{"amount":5,"currency":"USD"}, "stock":0}`
+	got = testutils.StringToJSON(string(bodyBytes))
+	want = testutils.StringToJSON(expected)
+
+	assert.Equal(t, want, got)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	book, err := app.models.Books.GetBook(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &database.Book{Id: 1, Title: "Title11", Author: "First", Price: money.New(5, "USD"), Version: 3}, book)
+}
+
+func TestUpdateBook_Stale_ETag(t *testing.T) {
+	app := SetupTest()
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", app.registerUser)
+	v1.POST("/auth/login", app.login)
+	v1.GET("/books/:id", app.getBook)
+
+	authGroup := v1.Group("/")
+	authGroup.Use(app.AuthMiddleware())
+	authGroup.POST("/books", app.createBook)
+	authGroup.PUT("/books/:id", app.updateBook)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
+	testutils.LoginAdmin(client, ts.URL+"/api/v1")
+	testutils.MakeABook(client, ts.URL+"/api/v1")
+
+	resp, err := client.Get(ts.URL + "/api/v1/books/1")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	firstETag := resp.Header.Get("ETag")
+	assert.Equal(t, `"1"`, firstETag)
+
+	// an unchanged book is revalidated without a body
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/books/1", nil)
+	req.Header.Set("If-None-Match", firstETag)
+	resp, err = client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// first admin saves
+	payload := `{"title":"Title11", "author":"First","price":{"amount":1,"currency":"USD"}}`
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/books/1", strings.NewReader(payload))
+	req.Header.Set("If-Match", firstETag)
+	resp, err = client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	// second admin still holds the first version
+	payload = `{"title":"Title12", "author":"First","price":{"amount":1,"currency":"USD"}}`
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/books/1", strings.NewReader(payload))
+	req.Header.Set("If-Match", firstETag)
+	resp, err = client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	// writes without a precondition are refused
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/books/1", strings.NewReader(payload))
+	resp, err = client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	book, err := app.models.Books.GetBook(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Title11", book.Title)
+}
+
+func TestBookIsbn(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	testutils.RegisterAdmin(admin, url)
+	testutils.LoginAdmin(admin, url)
+
+	resp, body := doRequest(admin, http.MethodPost, url+"/books", `{"title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}, "isbn_10":"0-306-40615-2"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	got := testutils.StringToJSON(body)
+	assert.Equal(t, "9780306406157", got["isbn_13"])
+	assert.Equal(t, "0306406152", got["isbn_10"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/books", `{"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}, "isbn_13":"978-0-306-40615-7"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeIsbnExists, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/books", `{"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}, "isbn_13":"9780306406158"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "isbn_13", testutils.StringToJSON(body)["errors"].([]any)[0].(map[string]any)["field"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/books", `{"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}, "isbn_10":"080442957X", "isbn_13":"9791034304578"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeValidationFailed, testutils.StringToJSON(body)["code"])
+
+	for _, isbn := range []string{"9780306406157", "0306406152", "978-0-306-40615-7"} {
+		resp, body = doRequest(admin, http.MethodGet, url+"/books/isbn/"+isbn, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, float64(1), testutils.StringToJSON(body)["id"])
+	}
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/books/isbn/12345", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidIsbn, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(admin, http.MethodGet, url+"/books/isbn/9791034304578", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// changing the ISBN-13 alone drops the ISBN-10 of the old one
+	resp, body = doIfMatch(admin, http.MethodPatch, url+"/books/1", `"1"`, `{"isbn_13":"9791034304578"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	got = testutils.StringToJSON(body)
+	assert.Equal(t, "9791034304578", got["isbn_13"])
+	assert.Nil(t, got["isbn_10"])
+
+	// a deleted book's ISBN can be given to a new book, and then the deleted
+	// one cannot come back
+	resp, _ = doIfMatch(admin, http.MethodDelete, url+"/books/1", `"2"`, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = doRequest(admin, http.MethodPost, url+"/books", `{"title":"Title2", "author":"First","price":{"amount":1,"currency":"USD"}, "isbn_13":"9791034304578"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/books/1/restore", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeIsbnExists, testutils.StringToJSON(body)["code"])
+}
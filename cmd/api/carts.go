@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/promotion"
+	"github.com/hamorrar/bookstore/internal/shipping"
+)
+
+const (
+	cartCookie       = "cart_token"
+	cartCookieMaxAge = 30 * 24 * 60 * 60
+)
+
+type addCartItemRequest struct {
+	Book_Id  int `json:"book_id" binding:"required"`
+	Quantity int `json:"quantity" binding:"required,min=1,max=100"`
+}
+
+type updateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1,max=100"`
+}
+
+// cartOwner works out whose cart the request is for. Logged in customers use
+// their own cart and anonymous visitors the cart named by their cart cookie.
+// When create is set an anonymous visitor without a cookie is given one.
+// It returns false if the request was aborted.
+func (app *application) cartOwner(c *gin.Context, create bool) (database.CartOwner, bool) {
+	user := app.GetUserFromContext(c)
+	if user.Id != 0 {
+		if user.Role != "Customer" {
+			app.forbidden(c, "Only customers can use a cart.")
+			return database.CartOwner{}, false
+		}
+		return database.CartOwner{User_Id: user.Id}, true
+	}
+
+	token, err := c.Cookie(cartCookie)
+	if err == nil && token != "" {
+		return database.CartOwner{Token: token}, true
+	}
+
+	if !create {
+		return database.CartOwner{}, true
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		app.serverError(c, err)
+		return database.CartOwner{}, false
+	}
+	token = hex.EncodeToString(buf)
+	c.SetCookie(cartCookie, token, cartCookieMaxAge, "/", "", false, true)
+
+	return database.CartOwner{Token: token}, true
+}
+
+// writeCart responds with the current contents of the cart.
+func (app *application) writeCart(c *gin.Context, cartId int) {
+	cart, err := app.models.Carts.GetCart(cartId)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cart)
+}
+
+// getCart gets the cart
+//
+//	@Summary		get cart
+//	@Description	get the cart of the logged in customer, or the anonymous cart of the cart cookie, priced at current book prices
+//	@Tags			cart
+//	@Produce		json
+//	@Success		200	{object}	database.Cart	"successfully got the cart"
+//	@Failure		403	{object}	problem			"forbidden"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/cart [get]
+func (app *application) getCart(c *gin.Context) {
+	owner, ok := app.cartOwner(c, false)
+	if !ok {
+		return
+	}
+
+	if owner.User_Id == 0 && owner.Token == "" {
+		c.JSON(http.StatusOK, database.Cart{Items: []*database.CartItem{}})
+		return
+	}
+
+	cartId, err := app.models.Carts.GetCartId(owner)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if cartId == 0 {
+		c.JSON(http.StatusOK, database.Cart{Items: []*database.CartItem{}})
+		return
+	}
+
+	app.writeCart(c, cartId)
+}
+
+// addCartItem adds a book to the cart
+//
+//	@Summary		add book to cart
+//	@Description	add copies of a book to the cart, on top of any already in it
+//	@Tags			cart
+//	@Accept			json
+//	@Produce		json
+//	@Param			item	body		addCartItemRequest	true	"book and quantity to add"
+//	@Success		200		{object}	database.Cart		"successfully added to the cart"
+//	@Failure		400		{object}	problem				"malformed_body or validation_failed"
+//	@Failure		403		{object}	problem				"forbidden"
+//	@Failure		404		{object}	problem				"book_not_found"
+//	@Failure		500		{object}	problem				"internal_error"
+//	@Router			/api/v1/cart/items [post]
+func (app *application) addCartItem(c *gin.Context) {
+	var item addCartItemRequest
+
+	if err := c.ShouldBindJSON(&item); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	owner, ok := app.cartOwner(c, true)
+	if !ok {
+		return
+	}
+
+	cartId, err := app.models.Carts.EnsureCart(owner)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	added, err := app.models.Carts.AddCartItem(cartId, item.Book_Id, item.Quantity)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if !added {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", item.Book_Id))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "cart.add_item", Target_Type: auditTargetCart, Target_Id: cartId}, nil, item)
+
+	app.writeCart(c, cartId)
+}
+
+// updateCartItem changes the quantity of a book in the cart
+//
+//	@Summary		update cart item
+//	@Description	set the quantity of a book already in the cart
+//	@Tags			cart
+//	@Accept			json
+//	@Produce		json
+//	@Param			book_id	query		int						true	"id of the book in the cart"
+//	@Param			item	body		updateCartItemRequest	true	"new quantity"
+//	@Success		200		{object}	database.Cart			"successfully updated the cart"
+//	@Failure		400		{object}	problem					"invalid_id, malformed_body or validation_failed"
+//	@Failure		403		{object}	problem					"forbidden"
+//	@Failure		404		{object}	problem					"cart_item_not_found"
+//	@Failure		500		{object}	problem					"internal_error"
+//	@Router			/api/v1/cart/items/:book_id [put]
+func (app *application) updateCartItem(c *gin.Context) {
+	bookId, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	var item updateCartItemRequest
+
+	if err := c.ShouldBindJSON(&item); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	cartId, ok := app.existingCartId(c)
+	if !ok {
+		return
+	}
+
+	updated := false
+	if cartId != 0 {
+		updated, err = app.models.Carts.SetCartItemQuantity(cartId, bookId, item.Quantity)
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+	}
+
+	if !updated {
+		app.errorResponse(c, http.StatusNotFound, codeCartItemNotFound, fmt.Sprintf("The book with id %d is not in the cart.", bookId))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "cart.update_item", Target_Type: auditTargetCart, Target_Id: cartId}, nil, addCartItemRequest{Book_Id: bookId, Quantity: item.Quantity})
+
+	app.writeCart(c, cartId)
+}
+
+// removeCartItem removes a book from the cart
+//
+//	@Summary		remove cart item
+//	@Description	remove a book from the cart
+//	@Tags			cart
+//	@Produce		json
+//	@Param			book_id	query		int				true	"id of the book in the cart"
+//	@Success		200		{object}	database.Cart	"successfully removed from the cart"
+//	@Failure		400		{object}	problem			"invalid_id"
+//	@Failure		403		{object}	problem			"forbidden"
+//	@Failure		404		{object}	problem			"cart_item_not_found"
+//	@Failure		500		{object}	problem			"internal_error"
+//	@Router			/api/v1/cart/items/:book_id [delete]
+func (app *application) removeCartItem(c *gin.Context) {
+	bookId, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	cartId, ok := app.existingCartId(c)
+	if !ok {
+		return
+	}
+
+	removed := false
+	if cartId != 0 {
+		removed, err = app.models.Carts.RemoveCartItem(cartId, bookId)
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+	}
+
+	if !removed {
+		app.errorResponse(c, http.StatusNotFound, codeCartItemNotFound, fmt.Sprintf("The book with id %d is not in the cart.", bookId))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "cart.remove_item", Target_Type: auditTargetCart, Target_Id: cartId}, map[string]int{"book_id": bookId}, nil)
+
+	app.writeCart(c, cartId)
+}
+
+// existingCartId returns the id of the request's cart without creating one,
+// or 0 if there is none. It returns false if the request was aborted.
+func (app *application) existingCartId(c *gin.Context) (int, bool) {
+	owner, ok := app.cartOwner(c, false)
+	if !ok {
+		return 0, false
+	}
+
+	if owner.User_Id == 0 && owner.Token == "" {
+		return 0, true
+	}
+
+	cartId, err := app.models.Carts.GetCartId(owner)
+	if err != nil {
+		app.serverError(c, err)
+		return 0, false
+	}
+	return cartId, true
+}
+
+// checkout turns the cart into an order
+//
+//	@Summary		checkout cart
+//	@Description	turn the customer's cart into a pending order, taking the books from stock and emptying the cart. The order is taxed in the region of its shipping address, which is required once tax rates exist.
+//	@Tags			cart
+//	@Produce		json
+//	@Param			currency			query		string			false	"currency to place the order in, at list prices or converted at the current rate"
+//	@Param			code				query		[]string		false	"promotion codes to apply"	collectionFormat(multi)
+//	@Param			shipping_address	query		int				false	"id of the address to ship to; defaults to the default address"
+//	@Param			billing_address		query		int				false	"id of the billing address; defaults to the shipping address"
+//	@Param			Idempotency-Key		header		string			false	"key that makes retries of this request safe"
+//	@Success		201					{object}	database.Order	"successfully created an order"
+//	@Failure		400					{object}	problem			"invalid_query"
+//	@Failure		403					{object}	problem			"forbidden"
+//	@Failure		404					{object}	problem			"address_not_found"
+//	@Failure		409					{object}	problem			"cart_empty, cart_prices_changed, cart_mixed_currencies, insufficient_stock or idempotency_key_in_use"
+//	@Failure		422					{object}	problem			"idempotency_key_reused, exchange_rate_unavailable, promotion_not_applicable, shipping_unavailable or address_required"
+//	@Failure		500					{object}	problem			"internal_error"
+//	@Router			/api/v1/cart/checkout [post]
+//	@Security		CookieAuth
+func (app *application) checkout(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Customer" {
+		app.forbidden(c, "Only customers can check out.")
+		return
+	}
+
+	currency, ok := app.requestedCurrency(c)
+	if !ok {
+		return
+	}
+
+	codes, ok := app.requestedPromotionCodes(c)
+	if !ok {
+		return
+	}
+
+	shippingAddress, billingAddress, ok := app.requestedAddresses(c, user.Id)
+	if !ok {
+		return
+	}
+
+	// The order is taxed where it is shipped, so an order without an address
+	// cannot escape tax.
+	var region string
+	if shippingAddress != nil {
+		region = addressTaxRegion(shippingAddress)
+	} else if taxed, err := app.models.TaxRates.HasTaxRates(); err != nil {
+		app.serverError(c, err)
+		return
+	} else if taxed {
+		app.errorResponse(c, http.StatusUnprocessableEntity, codeAddressRequired, "A shipping address is needed to work out the tax on the order.")
+		return
+	}
+
+	cartId, err := app.models.Carts.GetCartId(database.CartOwner{User_Id: user.Id})
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if cartId == 0 {
+		app.errorResponse(c, http.StatusConflict, codeCartEmpty, "The cart is empty.")
+		return
+	}
+
+	opts := database.CheckoutOptions{
+		Currency:         currency,
+		Promotion_Codes:  codes,
+		Tax_Region:       region,
+		Shipping_Address: shippingAddress,
+		Billing_Address:  billingAddress,
+		Shipping:         app.shipping,
+	}
+	if region != "" {
+		if opts.Tax, err = app.models.TaxRates.GetTaxTable(region); err != nil {
+			app.serverError(c, err)
+			return
+		}
+	}
+
+	order, err := app.models.Carts.Checkout(cartId, user.Id, opts)
+	if err != nil {
+		var stockErr *database.StockError
+		var rateErr *database.ExchangeRateError
+		var promoErr *promotion.NotApplicableError
+		var shippingErr *shipping.UnavailableError
+		switch {
+		case errors.Is(err, database.ErrCartEmpty):
+			app.errorResponse(c, http.StatusConflict, codeCartEmpty, "The cart is empty.")
+		case errors.Is(err, database.ErrCartPriceChanged):
+			app.errorResponse(c, http.StatusConflict, codeCartPricesChanged, "Some prices in the cart have changed. Review the cart and check out again.")
+		case errors.Is(err, database.ErrCartMixedCurrencies):
+			app.errorResponse(c, http.StatusConflict, codeCartMixedCurrencies, "The cart holds books priced in different currencies that cannot be combined in one order.")
+		case errors.As(err, &rateErr):
+			app.exchangeRateUnavailable(c, rateErr)
+		case errors.As(err, &promoErr):
+			app.promotionNotApplicable(c, promoErr)
+		case errors.As(err, &shippingErr):
+			app.shippingUnavailable(c, shippingErr)
+		case errors.As(err, &stockErr):
+			app.errorResponse(c, http.StatusConflict, codeInsufficientStock,
+				fmt.Sprintf("Only %d of the book with id %d are in stock.", stockErr.Available, stockErr.Book_Id))
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "order.checkout", Target_Type: auditTargetOrder, Target_Id: order.Id}, nil, order)
+
+	setETag(c, order.Version)
+	c.JSON(http.StatusCreated, order)
+}
+
+// mergeAnonymousCart moves the cart of the cart cookie into the user's cart
+// after login. A failure is logged rather than failing the login; the cookie
+// is kept so the merge is tried again on the next login.
+func (app *application) mergeAnonymousCart(c *gin.Context, user *database.User) {
+	token, err := c.Cookie(cartCookie)
+	if err != nil || token == "" || user.Role != "Customer" {
+		return
+	}
+
+	if err := app.models.Carts.MergeCarts(token, user.Id); err != nil {
+		log.Printf("request_id=%s merging cart: %v", requestIdFromContext(c), err)
+		return
+	}
+
+	c.SetCookie(cartCookie, "", -1, "/", "", false, true)
+}
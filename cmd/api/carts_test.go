@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCartRouter(app *application) *gin.Engine {
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", app.registerUser)
+	v1.POST("/auth/login", app.login)
+
+	cartGroup := v1.Group("/cart")
+	cartGroup.Use(app.OptionalAuthMiddleware())
+	cartGroup.GET("", app.getCart)
+	cartGroup.POST("/items", app.addCartItem)
+	cartGroup.PUT("/items/:book_id", app.updateCartItem)
+	cartGroup.DELETE("/items/:book_id", app.removeCartItem)
+
+	authGroup := v1.Group("/")
+	authGroup.Use(app.AuthMiddleware())
+	authGroup.POST("/books", app.createBook)
+	authGroup.POST("/cart/checkout", app.checkout)
+
+	return router
+}
+
+func doRequest(client *http.Client, method, url, payload string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(payload))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return resp, string(bodyBytes)
+}
+
+// makeStockedBook creates a book as admin with the given price and stock.
+func makeStockedBook(client *http.Client, url string, price string, stock string) {
+	testutils.RegisterAdmin(client, url)
+	testutils.LoginAdmin(client, url)
+	doRequest(client, http.MethodPost, url+"/books", `{"title":"Title1", "author":"First","price":{"amount":`+price+`,"currency":"USD"},"stock":`+stock+`}`)
+}
+
+func TestCheckout(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(setupCartRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	makeStockedBook(client, ts.URL+"/api/v1", "3", "5")
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+
+	resp, body := doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":1}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body = doRequest(client, http.MethodPut, ts.URL+"/api/v1/cart/items/1", `{"quantity":2}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	expected := `{"items":[{"book_id":1,"title":"Title1","quantity":2,"unit_price":{"amount":3,"currency":"USD"},"line_price":{"amount":6,"currency":"USD"},"price_changed":false,"in_stock":true}],"total_price":{"amount":6,"currency":"USD"}}`
+	assert.Equal(t, testutils.StringToJSON(expected), testutils.StringToJSON(body))
+
+	resp, body = doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	expected = `{"id":1,"user_id":2,"status":"Pending","total_price":{"amount":6,"currency":"USD"}}`
+	assert.Equal(t, testutils.StringToJSON(expected), testutils.StringToJSON(body))
+
+	resp, body = doRequest(client, http.MethodGet, ts.URL+"/api/v1/cart", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, testutils.StringToJSON(`{"items":[],"total_price":{"amount":0,"currency":"USD"}}`), testutils.StringToJSON(body))
+
+	book, err := app.models.Books.GetBook(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, 3, book.Stock)
+
+	resp, body = doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeCartEmpty, testutils.StringToJSON(body)["code"])
+}
+
+func TestCheckout_Insufficient_Stock(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(setupCartRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	makeStockedBook(client, ts.URL+"/api/v1", "3", "1")
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+
+	doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":2}`)
+
+	resp, body := doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeInsufficientStock, testutils.StringToJSON(body)["code"])
+
+	orders, err := app.models.Orders.GetPageOfOrders(10, 1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, 0, len(orders))
+}
+
+func TestCheckout_Price_Changed(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(setupCartRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	makeStockedBook(client, ts.URL+"/api/v1", "3", "5")
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+
+	doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":1}`)
+
+	book, err := app.models.Books.GetBook(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	book.Price = money.New(4, "USD")
+	if err := app.models.Books.UpdateBook(book); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	_, body := doRequest(client, http.MethodGet, ts.URL+"/api/v1/cart", "")
+	expected := `{"items":[{"book_id":1,"title":"Title1","quantity":1,"unit_price":{"amount":4,"currency":"USD"},"line_price":{"amount":4,"currency":"USD"},"price_changed":true,"in_stock":true}],"total_price":{"amount":4,"currency":"USD"}}`
+	assert.Equal(t, testutils.StringToJSON(expected), testutils.StringToJSON(body))
+
+	resp, body := doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeCartPricesChanged, testutils.StringToJSON(body)["code"])
+
+	// the failed checkout accepted the new prices, so a second one succeeds
+	resp, body = doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, map[string]any{"amount": float64(4), "currency": "USD"}, testutils.StringToJSON(body)["total_price"])
+}
+
+func TestCart_Merge_On_Login(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(setupCartRouter(app))
+	defer ts.Close()
+
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	makeStockedBook(admin, ts.URL+"/api/v1", "3", "5")
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	// anonymous visitor fills a cart before having an account
+	resp, _ := doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":2}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+
+	_, body := doRequest(client, http.MethodGet, ts.URL+"/api/v1/cart", "")
+	expected := `{"items":[{"book_id":1,"title":"Title1","quantity":2,"unit_price":{"amount":3,"currency":"USD"},"line_price":{"amount":6,"currency":"USD"},"price_changed":false,"in_stock":true}],"total_price":{"amount":6,"currency":"USD"}}`
+	assert.Equal(t, testutils.StringToJSON(expected), testutils.StringToJSON(body))
+
+	resp, _ = doRequest(client, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestRemoveCartItem_Not_In_Cart(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(setupCartRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	resp, body := doRequest(client, http.MethodDelete, ts.URL+"/api/v1/cart/items/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeCartItemNotFound, testutils.StringToJSON(body)["code"])
+}
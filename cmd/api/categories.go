@@ -0,0 +1,406 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+)
+
+type bookCategoriesRequest struct {
+	Category_Ids []int `json:"category_ids" binding:"required,unique,dive,min=1"`
+}
+
+// getCategoryFromParam loads the category named by the id path parameter. It
+// responds and returns nil if there is no such category.
+func (app *application) getCategoryFromParam(c *gin.Context) *database.Category {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The category id must be an integer.")
+		return nil
+	}
+
+	cat, err := app.models.Categories.GetCategory(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if cat == nil {
+		app.errorResponse(c, http.StatusNotFound, codeCategoryNotFound, fmt.Sprintf("No category exists with id %d.", id))
+		return nil
+	}
+	return cat
+}
+
+// categoryWriteError responds to an error from creating or updating cat.
+func (app *application) categoryWriteError(c *gin.Context, cat *database.Category, err error) {
+	switch {
+	case errors.Is(err, database.ErrEditConflict):
+		app.editConflict(c)
+	case errors.Is(err, database.ErrCategoryCycle):
+		app.errorResponse(c, http.StatusUnprocessableEntity, codeInvalidCategoryParent, "A category cannot be placed below itself or one of its subcategories.")
+	case database.IsForeignKeyViolation(err):
+		app.errorResponse(c, http.StatusUnprocessableEntity, codeInvalidCategoryParent, fmt.Sprintf("No category exists with id %d.", cat.Parent_Id))
+	case database.IsUniqueViolation(err):
+		app.errorResponse(c, http.StatusConflict, codeCategoryExists, fmt.Sprintf("A category with slug %s already exists.", cat.Slug))
+	default:
+		app.serverError(c, err)
+	}
+}
+
+// getCategories gets the categories
+//
+//	@Summary		gets categories
+//	@Description	gets every category ordered by name. The tree is built from their parent ids.
+//	@Tags			category
+//	@Produce		json
+//	@Success		200	{array}		database.Category	"successfully got the categories"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/categories [get]
+func (app *application) getCategories(c *gin.Context) {
+	categories, err := app.models.Categories.GetCategories()
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// getCategory gets a category
+//
+//	@Summary		get category
+//	@Description	get a category by id
+//	@Tags			category
+//	@Produce		json
+//	@Param			id				query		int					true	"id of category"
+//	@Param			If-None-Match	header		string				false	"ETag from a previous response"
+//	@Success		200				{object}	database.Category	"successfully got a category"
+//	@Header			200				{string}	ETag				"version of the category"
+//	@Success		304				"category has not changed"
+//	@Failure		400				{object}	problem	"invalid_id"
+//	@Failure		404				{object}	problem	"category_not_found"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Router			/api/v1/categories/:id [get]
+func (app *application) getCategory(c *gin.Context) {
+	cat := app.getCategoryFromParam(c)
+	if cat == nil {
+		return
+	}
+
+	if app.notModified(c, cat.Version) {
+		return
+	}
+
+	c.JSON(http.StatusOK, cat)
+}
+
+// getCategoryBooks gets a page of the books in a category
+//
+//	@Summary		get category's books
+//	@Description	gets a page of the books filed under a category or any of its subcategories
+//	@Tags			category
+//	@Produce		json
+//	@Param			id			query		int				true	"id of category"
+//	@Param			page		query		int				false	"page number to request"
+//	@Param			limit		query		int				false	"max number of books to return per page, at most 100"
+//	@Param			currency	query		string			false	"currency to price the books in"
+//	@Success		200			{array}		database.Book	"successfully got a page of books"
+//	@Failure		400			{object}	problem			"invalid_id or invalid_query"
+//	@Failure		404			{object}	problem			"category_not_found"
+//	@Failure		422			{object}	problem			"exchange_rate_unavailable"
+//	@Failure		500			{object}	problem			"internal_error"
+//	@Router			/api/v1/categories/:id/books [get]
+func (app *application) getCategoryBooks(c *gin.Context) {
+	cat := app.getCategoryFromParam(c)
+	if cat == nil {
+		return
+	}
+
+	app.listBooks(c, func(limit int, page int) ([]*database.Book, error) {
+		return app.models.Books.GetBooksInCategory(cat.Id, limit, page)
+	})
+}
+
+// createCategory creates a category
+//
+//	@Summary		creates a category
+//	@Description	adds a category, below parent_id if it is given
+//	@Tags			category
+//	@Accept			json
+//	@Produce		json
+//	@Param			category		body		database.Category	true	"new category"
+//	@Param			Idempotency-Key	header		string				false	"key that makes retries of this request safe"
+//	@Success		201				{object}	database.Category	"successfully created a category"
+//	@Header			201				{string}	ETag				"version of the category"
+//	@Failure		400				{object}	problem				"malformed_body or validation_failed"
+//	@Failure		403				{object}	problem				"forbidden"
+//	@Failure		409				{object}	problem				"category_exists or idempotency_key_in_use"
+//	@Failure		422				{object}	problem				"invalid_category_parent or idempotency_key_reused"
+//	@Failure		500				{object}	problem				"internal_error"
+//	@Router			/api/v1/categories [post]
+//	@Security		CookieAuth
+func (app *application) createCategory(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage categories.")
+		return
+	}
+
+	var cat database.Category
+
+	if err := c.ShouldBindJSON(&cat); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if err := app.models.Categories.CreateCategory(&cat); err != nil {
+		app.categoryWriteError(c, &cat, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "category.create", Target_Type: auditTargetCategory, Target_Id: cat.Id}, nil, cat)
+
+	setETag(c, cat.Version)
+	c.JSON(http.StatusCreated, cat)
+}
+
+// updateCategory updates a category
+//
+//	@Summary		update a category
+//	@Description	update a category by id, which may move it below another parent
+//	@Tags			category
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int					true	"id of category to update"
+//	@Param			If-Match	header		string				true	"current ETag of the category"
+//	@Param			category	body		database.Category	true	"updated category"
+//	@Success		200			{object}	database.Category	"successfully updated a category"
+//	@Header			200			{string}	ETag				"new version of the category"
+//	@Failure		400			{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem				"forbidden"
+//	@Failure		404			{object}	problem				"category_not_found"
+//	@Failure		409			{object}	problem				"category_exists"
+//	@Failure		412			{object}	problem				"precondition_failed"
+//	@Failure		422			{object}	problem				"invalid_category_parent"
+//	@Failure		428			{object}	problem				"precondition_required"
+//	@Failure		500			{object}	problem				"internal_error"
+//	@Router			/api/v1/categories/:id [put]
+//	@Security		CookieAuth
+func (app *application) updateCategory(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage categories.")
+		return
+	}
+
+	existing := app.getCategoryFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	updated := &database.Category{}
+
+	if err := c.ShouldBindJSON(updated); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	updated.Id = existing.Id
+	updated.Version = existing.Version
+
+	if err := app.models.Categories.UpdateCategory(updated); err != nil {
+		app.categoryWriteError(c, updated, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "category.update", Target_Type: auditTargetCategory, Target_Id: updated.Id}, existing, updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// deleteCategory deletes a category
+//
+//	@Summary		delete category
+//	@Description	delete a category by id. Categories with subcategories or books cannot be deleted.
+//	@Tags			category
+//	@Produce		json
+//	@Param			id			query	int		true	"id of category to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the category"
+//	@Success		204			"successfully deleted"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		404			{object}	problem	"category_not_found"
+//	@Failure		409			{object}	problem	"category_in_use"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/categories/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deleteCategory(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage categories.")
+		return
+	}
+
+	existing := app.getCategoryFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	if err := app.models.Categories.DeleteCategory(existing.Id, existing.Version); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.errorResponse(c, http.StatusConflict, codeCategoryInUse, "The category has subcategories or books and cannot be deleted.")
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "category.delete", Target_Type: auditTargetCategory, Target_Id: existing.Id}, existing, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// getBookCategories gets the categories of a book
+//
+//	@Summary		get book categories
+//	@Description	get the categories a book is filed under
+//	@Tags			book
+//	@Produce		json
+//	@Param			id	query		int					true	"id of book"
+//	@Success		200	{array}		database.Category	"successfully got the categories"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		404	{object}	problem				"book_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/books/:id/categories [get]
+func (app *application) getBookCategories(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	book, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if book == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	categories, err := app.models.Categories.GetBookCategories(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// setBookCategories sets the categories of a book
+//
+//	@Summary		set book categories
+//	@Description	replace the categories a book is filed under. An empty list removes it from every category.
+//	@Tags			book
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int						true	"id of book"
+//	@Param			If-Match	header		string					true	"current ETag of the book"
+//	@Param			categories	body		bookCategoriesRequest	true	"ids of the categories"
+//	@Success		200			{array}		database.Category		"successfully set the categories"
+//	@Header			200			{string}	ETag					"new version of the book"
+//	@Failure		400			{object}	problem					"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem					"forbidden"
+//	@Failure		404			{object}	problem					"book_not_found"
+//	@Failure		412			{object}	problem					"precondition_failed"
+//	@Failure		422			{object}	problem					"category_not_found"
+//	@Failure		428			{object}	problem					"precondition_required"
+//	@Failure		500			{object}	problem					"internal_error"
+//	@Router			/api/v1/books/:id/categories [put]
+//	@Security		CookieAuth
+func (app *application) setBookCategories(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can update books.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The book id must be an integer.")
+		return
+	}
+
+	book, err := app.models.Books.GetBook(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if book == nil {
+		app.errorResponse(c, http.StatusNotFound, codeBookNotFound, fmt.Sprintf("No book exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, book.Version) {
+		return
+	}
+
+	var request bookCategoriesRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	before, err := app.models.Categories.GetBookCategories(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	version, err := app.models.Categories.SetBookCategories(id, book.Version, request.Category_Ids)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.errorResponse(c, http.StatusUnprocessableEntity, codeCategoryNotFound, "Every category id must name an existing category.")
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	categories, err := app.models.Categories.GetBookCategories(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "book.set_categories", Target_Type: auditTargetBook, Target_Id: id}, map[string]any{"categories": before}, map[string]any{"categories": categories})
+
+	setETag(c, version)
+	c.JSON(http.StatusOK, categories)
+}
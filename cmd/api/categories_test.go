@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategories(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "3", "5")
+
+	resp, _ := doRequest(admin, http.MethodPost, url+"/categories", `{"name":"Fiction", "slug":"fiction"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = doRequest(admin, http.MethodPost, url+"/categories", `{"parent_id":1, "name":"Science Fiction", "slug":"science-fiction"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body := doRequest(admin, http.MethodPost, url+"/categories", `{"name":"Bad", "slug":"Not A Slug"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeValidationFailed, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/categories", `{"name":"Fiction again", "slug":"fiction"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeCategoryExists, testutils.StringToJSON(body)["code"])
+
+	resp, body = doIfMatch(admin, http.MethodPut, url+"/categories/1", `"1"`, `{"parent_id":2, "name":"Fiction", "slug":"fiction"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeInvalidCategoryParent, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(admin, http.MethodPut, url+"/books/1/categories", `{"category_ids":[2]}`)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp, _ = doIfMatch(admin, http.MethodPut, url+"/books/1/categories", `"1"`, `{"category_ids":[2]}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	resp, _ = doIfMatch(admin, http.MethodPut, url+"/books/1/categories", `"1"`, `{"category_ids":[1]}`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	// books in a subcategory are listed under its parent too
+	resp, body = doRequest(admin, http.MethodGet, url+"/categories/1/books", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	books := testutils.StringToJSONArray(body)
+	require.Len(t, books, 1)
+	assert.Equal(t, float64(1), books[0]["id"])
+
+	resp, body = doIfMatch(admin, http.MethodDelete, url+"/categories/1", `"1"`, "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeCategoryInUse, testutils.StringToJSON(body)["code"])
+
+	resp, body = doIfMatch(admin, http.MethodPut, url+"/books/1/categories", `"2"`, `{"category_ids":[5]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeCategoryNotFound, testutils.StringToJSON(body)["code"])
+
+	resp, body = doIfMatch(admin, http.MethodPut, url+"/books/1/categories", `"2"`, `{"category_ids":[]}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, testutils.StringToJSONArray(body))
+
+	resp, _ = doIfMatch(admin, http.MethodDelete, url+"/categories/2", `"1"`, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -17,3 +17,7 @@ func (app *application) GetUserFromContext(c *gin.Context) *database.User {
 
 	return user
 }
+
+func requestIdFromContext(c *gin.Context) string {
+	return c.GetString("requestId")
+}
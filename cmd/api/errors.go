@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/isbn"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/promotion"
+	"github.com/hamorrar/bookstore/internal/tax"
+)
+
+// Error codes are part of the API contract. Clients match on them instead of
+// on the human readable title or detail, so existing codes must not change.
+const (
+	codeMalformedBody             = "malformed_body"
+	codeValidationFailed          = "validation_failed"
+	codeInvalidId                 = "invalid_id"
+	codeUnauthenticated           = "unauthenticated"
+	codeInvalidToken              = "invalid_token"
+	codeInvalidCredentials        = "invalid_credentials"
+	codeForbidden                 = "forbidden"
+	codeBookNotFound              = "book_not_found"
+	codeOrderNotFound             = "order_not_found"
+	codeUserNotFound              = "user_not_found"
+	codeEmailAlreadyRegistered    = "email_already_registered"
+	codeIncorrectPassword         = "incorrect_password"
+	codeBodyTooLarge              = "body_too_large"
+	codeUnsupportedMediaType      = "unsupported_media_type"
+	codeInvalidPatch              = "invalid_patch"
+	codePatchTestFailed           = "patch_test_failed"
+	codePreconditionRequired      = "precondition_required"
+	codePreconditionFailed        = "precondition_failed"
+	codeInvalidIdempotencyKey     = "invalid_idempotency_key"
+	codeIdempotencyKeyReused      = "idempotency_key_reused"
+	codeIdempotencyKeyInUse       = "idempotency_key_in_use"
+	codeCartItemNotFound          = "cart_item_not_found"
+	codeCartEmpty                 = "cart_empty"
+	codeCartPricesChanged         = "cart_prices_changed"
+	codeInsufficientStock         = "insufficient_stock"
+	codeOrderNotPayable           = "order_not_payable"
+	codeOrderReadOnly             = "order_read_only"
+	codeOrderNotCancellable       = "order_not_cancellable"
+	codePaymentNotFound           = "payment_not_found"
+	codePaymentDeclined           = "payment_declined"
+	codePaymentProviderTimeout    = "payment_provider_timeout"
+	codePaymentNotRefundable      = "payment_not_refundable"
+	codePaymentNotVoidable        = "payment_not_voidable"
+	codeInvalidWebhookSignature   = "invalid_webhook_signature"
+	codeOrderNotReturnable        = "order_not_returnable"
+	codeInvalidReturnItems        = "invalid_return_items"
+	codeReturnNotFound            = "return_not_found"
+	codeInvalidReturnTransition   = "invalid_return_transition"
+	codeInvalidQuery              = "invalid_query"
+	codeCurrencyMismatch          = "currency_mismatch"
+	codeCartMixedCurrencies       = "cart_mixed_currencies"
+	codeBookPriceNotFound         = "book_price_not_found"
+	codeExchangeRateNotFound      = "exchange_rate_not_found"
+	codeExchangeRateExists        = "exchange_rate_exists"
+	codeExchangeRateInEffect      = "exchange_rate_in_effect"
+	codeExchangeRateUnavailable   = "exchange_rate_unavailable"
+	codeTaxRateNotFound           = "tax_rate_not_found"
+	codeTaxRateExists             = "tax_rate_exists"
+	codeTaxRateInEffect           = "tax_rate_in_effect"
+	codePromotionNotFound         = "promotion_not_found"
+	codePromotionExists           = "promotion_exists"
+	codePromotionNotApplicable    = "promotion_not_applicable"
+	codeAddressNotFound           = "address_not_found"
+	codeAddressRequired           = "address_required"
+	codeShippingUnavailable       = "shipping_unavailable"
+	codeOrderNotShippable         = "order_not_shippable"
+	codeInvalidShipmentItems      = "invalid_shipment_items"
+	codeShipmentNotFound          = "shipment_not_found"
+	codeShipmentExists            = "shipment_exists"
+	codeInvalidShipmentTransition = "invalid_shipment_transition"
+	codeAuthorNotFound            = "author_not_found"
+	codeAuthorInUse               = "author_in_use"
+	codePublisherNotFound         = "publisher_not_found"
+	codePublisherExists           = "publisher_exists"
+	codePublisherInUse            = "publisher_in_use"
+	codeCategoryNotFound          = "category_not_found"
+	codeCategoryExists            = "category_exists"
+	codeCategoryInUse             = "category_in_use"
+	codeInvalidCategoryParent     = "invalid_category_parent"
+	codeInvalidIsbn               = "invalid_isbn"
+	codeIsbnExists                = "isbn_exists"
+	codeImportNotFound            = "import_not_found"
+	codeInvalidImport             = "invalid_import"
+	codeJobNotFound               = "job_not_found"
+	codeJobNotCancellable         = "job_not_cancellable"
+	codeJobNotRetryable           = "job_not_retryable"
+	codeWebhookNotFound           = "webhook_not_found"
+	codeWebhookDeliveryNotFound   = "webhook_delivery_not_found"
+	codeWebhookDisabled           = "webhook_disabled"
+	codeInternal                  = "internal_error"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is an RFC 7807 problem details body.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestId string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError describes why one field of a request body was rejected.
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// Report validation errors with the JSON field names clients actually send.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+		v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+			return money.IsCurrency(fl.Field().String())
+		})
+		v.RegisterValidation("positive_money", func(fl validator.FieldLevel) bool {
+			m, ok := fl.Field().Interface().(money.Money)
+			return ok && m.IsPositive()
+		})
+		v.RegisterValidation("rate", func(fl validator.FieldLevel) bool {
+			_, err := money.ParseRate(fl.Field().String())
+			return err == nil
+		})
+		v.RegisterValidation("tax_rate", func(fl validator.FieldLevel) bool {
+			_, err := tax.ParseRate(fl.Field().String())
+			return err == nil
+		})
+		v.RegisterValidation("tax_region", func(fl validator.FieldLevel) bool {
+			return tax.IsRegion(fl.Field().String())
+		})
+		v.RegisterValidation("promo_code", func(fl validator.FieldLevel) bool {
+			return promotion.IsCode(fl.Field().String())
+		})
+		// Replace the built-in ISBN rules, which reject some hyphenated ISBNs.
+		v.RegisterValidation("isbn10", func(fl validator.FieldLevel) bool {
+			return isbn.Valid10(fl.Field().String())
+		})
+		v.RegisterValidation("isbn13", func(fl validator.FieldLevel) bool {
+			return isbn.Valid13(fl.Field().String())
+		})
+		v.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+			return database.IsSlug(fl.Field().String())
+		})
+		v.RegisterValidation("event_type", func(fl validator.FieldLevel) bool {
+			return slices.Contains(database.EventTypes, fl.Field().String())
+		})
+	}
+}
+
+func newProblem(c *gin.Context, status int, code, detail string) *problem {
+	return &problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestId: requestIdFromContext(c),
+	}
+}
+
+func writeProblem(c *gin.Context, p *problem) {
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// errorResponse aborts the request with a problem details body.
+func (app *application) errorResponse(c *gin.Context, status int, code, detail string) {
+	writeProblem(c, newProblem(c, status, code, detail))
+}
+
+// serverError logs err and aborts with a generic 500. The underlying error is
+// never sent to the client.
+func (app *application) serverError(c *gin.Context, err error) {
+	log.Printf("request_id=%s method=%s path=%s error=%v", requestIdFromContext(c), c.Request.Method, c.Request.URL.Path, err)
+	app.errorResponse(c, http.StatusInternalServerError, codeInternal, "The server encountered an error and could not complete the request.")
+}
+
+func (app *application) forbidden(c *gin.Context, detail string) {
+	app.errorResponse(c, http.StatusForbidden, codeForbidden, detail)
+}
+
+func (app *application) invalidId(c *gin.Context, detail string) {
+	app.errorResponse(c, http.StatusBadRequest, codeInvalidId, detail)
+}
+
+// bindingError turns an error from ShouldBindJSON into a 400 problem. Field
+// level validation failures are listed individually in "errors".
+func (app *application) bindingError(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "The request body failed validation.")
+		for _, fe := range validationErrs {
+			p.Errors = append(p.Errors, fieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Message: validationMessage(fe),
+			})
+		}
+		writeProblem(c, p)
+		return
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "The request body failed validation.")
+		p.Errors = []fieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type.String()),
+		}}
+		writeProblem(c, p)
+		return
+	}
+
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		p := newProblem(c, http.StatusBadRequest, codeValidationFailed, "The request body failed validation.")
+		p.Errors = []fieldError{{
+			Field:   strings.Trim(field, `"`),
+			Rule:    "unknown",
+			Message: "is not a known field",
+		}}
+		writeProblem(c, p)
+		return
+	}
+
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.Is(err, io.EOF):
+		app.errorResponse(c, http.StatusBadRequest, codeMalformedBody, "The request body must not be empty.")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		app.errorResponse(c, http.StatusBadRequest, codeMalformedBody, "The request body is not valid JSON.")
+	default:
+		app.errorResponse(c, http.StatusBadRequest, codeMalformedBody, "The request body could not be read.")
+	}
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	case "currency":
+		return "must be a supported ISO 4217 currency code"
+	case "positive_money":
+		return "must be a positive amount"
+	case "rate":
+		return "must be a positive decimal number"
+	case "tax_rate":
+		return "must be a decimal fraction between 0 and 1"
+	case "tax_region":
+		return "must be an ISO 3166 country code, optionally with a subdivision such as US-CA"
+	case "promo_code":
+		return "must be 3 to 32 upper case letters, digits, dashes or underscores"
+	case "isbn10":
+		return "must be an ISBN-10 with a correct check digit"
+	case "isbn13":
+		return "must be an ISBN-13 with a correct check digit"
+	case "slug":
+		return "must be lower case letters and digits, with words joined by dashes"
+	case "unique":
+		return "must not contain duplicates"
+	case "url":
+		return "must be a URL"
+	case "http_url":
+		return "must be an http or https URL"
+	case "event_type":
+		return "must be one of: " + strings.Join(database.EventTypes, ", ")
+	case "nefield":
+		return fmt.Sprintf("must differ from %s", strings.ToLower(fe.Param()))
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
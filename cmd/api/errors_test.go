@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindingError_Validation(t *testing.T) {
+	app := &application{}
+	router := gin.Default()
+	router.Use(app.RequestIdMiddleware())
+	router.POST("/api/v1/auth/register", app.registerUser)
+
+	payload := `{"email":"not-an-email", "password":"short"}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/auth/register", strings.NewReader(payload))
+	req.Header.Set("X-Request-ID", "test-request-id")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	expected := `{
+		"type":"about:blank",
+		"title":"Bad Request",
+		"status":400,
+		"detail":"The request body failed validation.",
+		"instance":"/api/v1/auth/register",
+		"code":"validation_failed",
+		"request_id":"test-request-id",
+		"errors":[
+			{"field":"email","rule":"email","message":"must be a valid email address"},
+			{"field":"password","rule":"min","message":"must be at least 8 characters long"},
+			{"field":"role","rule":"required","message":"is required"}
+		]
+	}`
+	got := testutils.StringToJSON(w.Body.String())
+	want := testutils.StringToJSON(expected)
+
+	assert.Equal(t, want, got)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "test-request-id", w.Header().Get("X-Request-ID"))
+}
+
+func TestBindingError_MalformedBody(t *testing.T) {
+	app := &application{}
+	router := gin.Default()
+	router.POST("/api/v1/auth/login", app.login)
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	expected := `{"type":"about:blank","title":"Bad Request","status":400,"detail":"The request body is not valid JSON.","instance":"/api/v1/auth/login","code":"malformed_body"}`
+	got := testutils.StringToJSON(w.Body.String())
+	want := testutils.StringToJSON(expected)
+
+	assert.Equal(t, want, got)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServerError_DoesNotLeakError(t *testing.T) {
+	app := &application{}
+	router := gin.Default()
+	router.Use(app.RequestIdMiddleware())
+	router.GET("/fail", func(c *gin.Context) {
+		app.serverError(c, errors.New(`pq: relation "books" does not exist`))
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/fail", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	got := testutils.StringToJSON(w.Body.String())
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "internal_error", got["code"])
+	assert.Equal(t, w.Header().Get("X-Request-ID"), got["request_id"])
+	assert.NotEmpty(t, got["request_id"])
+	assert.NotContains(t, w.Body.String(), "books")
+}
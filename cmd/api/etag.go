@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag is the entity tag for a row version. Versions only grow, so the tag is
+// unique for the lifetime of a resource URL.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", etag(version))
+}
+
+// notModified sets the ETag for version and, if the request's If-None-Match
+// already has it, responds 304 and returns true.
+func (app *application) notModified(c *gin.Context, version int) bool {
+	setETag(c, version)
+
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		// If-None-Match uses the weak comparison
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			c.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces the If-Match precondition required on every write.
+// It responds 428 when the header is missing and 412 when none of the listed
+// tags is the current version, returning false in both cases.
+func (app *application) checkIfMatch(c *gin.Context, version int) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		app.errorResponse(c, http.StatusPreconditionRequired, codePreconditionRequired,
+			"Send the resource's ETag in an If-Match header to modify it.")
+		return false
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		// If-Match uses the strong comparison, weak tags never match
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+
+	app.editConflict(c)
+	return false
+}
+
+func (app *application) editConflict(c *gin.Context) {
+	app.errorResponse(c, http.StatusPreconditionFailed, codePreconditionFailed,
+		"The resource was modified since it was read. Fetch it again and retry with the new ETag.")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	app := &application{}
+	router := gin.Default()
+	router.PUT("/books/1", func(c *gin.Context) {
+		if !app.checkIfMatch(c, 3) {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+	}{
+		{"missing", "", http.StatusPreconditionRequired},
+		{"current", `"3"`, http.StatusOK},
+		{"any", `*`, http.StatusOK},
+		{"one of many", `"1", "3"`, http.StatusOK},
+		{"stale", `"2"`, http.StatusPreconditionFailed},
+		{"weak never matches", `W/"3"`, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPut, "/books/1", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	app := &application{}
+	router := gin.Default()
+	router.GET("/books/1", func(c *gin.Context) {
+		if app.notModified(c, 3) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": 1})
+	})
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+	}{
+		{"no header", "", http.StatusOK},
+		{"current", `"3"`, http.StatusNotModified},
+		{"weak current", `W/"3"`, http.StatusNotModified},
+		{"stale", `"2"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/books/1", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+			if tt.status == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
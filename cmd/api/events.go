@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/config"
+	"github.com/hamorrar/bookstore/internal/events"
+	"github.com/hamorrar/bookstore/internal/jobs"
+)
+
+// newEventPublisher returns the publisher domain events are relayed to.
+func newEventPublisher(cfg *config.Config) (events.EventPublisher, error) {
+	switch cfg.Events.Publisher {
+	case "file":
+		file, err := events.NewFile(cfg.Events.File)
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	case "http":
+		return events.NewHTTP(cfg.Events.URL, &http.Client{Timeout: cfg.Events.Timeout}), nil
+	}
+	return events.NewMemory(), nil
+}
+
+// setupEvents creates the relay, which hands each event to the configured
+// publisher and queues its webhook deliveries, and the broker that streams
+// events to clients.
+func (app *application) setupEvents() {
+	app.webhookClient = &http.Client{Timeout: app.config.Webhooks.Timeout}
+	app.relay = events.NewRelay(&app.models.Outbox, events.Multi{app.publisher, webhookPublisher{app}}, app.config.Events.PollInterval)
+	app.broker = events.NewBroker(&app.models.Outbox, app.config.DB.DSN)
+}
+
+// purgeOutboxEvents deletes events that were published longer ago than the
+// configured retention. It runs every hour.
+func (app *application) purgeOutboxEvents(ctx context.Context, job *jobs.Job, _ struct{}) (any, error) {
+	n, err := app.models.Outbox.PurgePublishedOutboxEvents(time.Now().Add(-app.config.Events.Retention))
+	if err != nil {
+		return nil, fmt.Errorf("purging published events: %w", err)
+	}
+	return map[string]int64{"events": n}, nil
+}
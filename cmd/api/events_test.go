@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/events"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(ctx context.Context, event events.Event) error {
+	return errors.New("connection refused")
+}
+
+func TestEvents(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "3", "5")
+	resp, _ := doIfMatch(admin, http.MethodPatch, url+"/books/1", `"1"`, `{"price":{"amount":5,"currency":"USD"}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = doRequest(admin, http.MethodPut, url+"/books/1/prices", `{"amount":899,"currency":"GBP"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+	doRequest(customer, http.MethodPost, url+"/cart/items", `{"book_id":1, "quantity":2}`)
+	resp, _ = doRequest(customer, http.MethodPost, url+"/cart/checkout", "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = doIfMatch(customer, http.MethodPatch, url+"/orders/1", `"1"`, `{"status":"Cancelled"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// cancelling the order put its books back in stock
+	_, body := doRequest(admin, http.MethodGet, url+"/books/1", "")
+	assert.Equal(t, float64(5), testutils.StringToJSON(body)["stock"])
+
+	// nothing is published until the relay runs
+	memory := app.publisher.(*events.Memory)
+	assert.Empty(t, memory.Events())
+
+	n, err := app.relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+
+	published := memory.Events()
+	require.Len(t, published, 6)
+
+	var types []string
+	for _, e := range published {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{"user.registered", "book.price_changed", "book.price_changed", "user.registered", "order.created", "order.status_changed"}, types)
+
+	data := func(i int) map[string]any {
+		var m map[string]any
+		require.NoError(t, json.Unmarshal(published[i].Data, &m))
+		return m
+	}
+	assert.Equal(t, map[string]any{"user_id": float64(1), "email": "user2@gmail.com", "role": "Admin"}, data(0))
+	assert.Equal(t, "book", published[1].Aggregate_Type)
+	assert.Equal(t, 1, published[1].Aggregate_Id)
+	assert.Equal(t, map[string]any{"book_id": float64(1), "old_price": map[string]any{"amount": float64(3), "currency": "USD"},
+		"new_price": map[string]any{"amount": float64(5), "currency": "USD"}}, data(1))
+	assert.Nil(t, data(2)["old_price"])
+	assert.Equal(t, map[string]any{"order_id": float64(1), "user_id": float64(2), "status": "Pending",
+		"total_price": map[string]any{"amount": float64(10), "currency": "USD"}}, data(4))
+	assert.Equal(t, map[string]any{"order_id": float64(1), "user_id": float64(2), "old_status": "Pending", "new_status": "Cancelled"}, data(5))
+
+	// published events are not published again
+	n, err = app.relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Len(t, memory.Events(), 6)
+}
+
+func TestEvents_RetriedUntilPublished(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+
+	failing := events.NewRelay(&app.models.Outbox, failingPublisher{}, time.Second)
+	n, err := failing.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	var attempts int
+	var lastError string
+	err = app.models.Outbox.DB.QueryRow("select outbox_event_attempts, outbox_event_last_error from outbox_events where outbox_event_id = 1").Scan(&attempts, &lastError)
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, "connection refused", lastError)
+
+	// the event waits before it is tried again
+	n, err = app.relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = app.models.Outbox.DB.Exec("update outbox_events set outbox_event_next_attempt_at = now()")
+	require.NoError(t, err)
+	n, err = app.relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	published := app.publisher.(*events.Memory).Events()
+	require.Len(t, published, 1)
+	assert.Equal(t, int64(1), published[0].Id)
+	assert.Equal(t, "user.registered", published[0].Type)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// requestedCurrency reads the optional currency query parameter. It responds
+// 400 and returns false if it is not a supported currency.
+func (app *application) requestedCurrency(c *gin.Context) (string, bool) {
+	currency := strings.ToUpper(c.Query("currency"))
+	if currency != "" && !money.IsCurrency(currency) {
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, "currency must be a supported ISO 4217 currency code.")
+		return "", false
+	}
+	return currency, true
+}
+
+func (app *application) exchangeRateUnavailable(c *gin.Context, err *database.ExchangeRateError) {
+	app.errorResponse(c, http.StatusUnprocessableEntity, codeExchangeRateUnavailable,
+		fmt.Sprintf("There is no exchange rate from %s to %s.", err.From, err.To))
+}
+
+// getExchangeRates gets exchange rates
+//
+//	@Summary		gets exchange rates
+//	@Description	gets the exchange rates, including past and future ones, latest effective first
+//	@Tags			exchange rate
+//	@Produce		json
+//	@Param			from	query		string					false	"currency converted from"
+//	@Param			to		query		string					false	"currency converted to"
+//	@Success		200		{array}		database.ExchangeRate	"successfully got exchange rates"
+//	@Failure		403		{object}	problem					"forbidden"
+//	@Failure		500		{object}	problem					"internal_error"
+//	@Router			/api/v1/exchange-rates [get]
+//	@Security		CookieAuth
+func (app *application) getExchangeRates(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage exchange rates.")
+		return
+	}
+
+	rates, err := app.models.ExchangeRates.GetExchangeRates(strings.ToUpper(c.Query("from")), strings.ToUpper(c.Query("to")))
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+// createExchangeRate creates an exchange rate
+//
+//	@Summary		creates an exchange rate
+//	@Description	adds a rate for a currency pair that applies from effective_at, or from now if it is left out, until a later rate takes over
+//	@Tags			exchange rate
+//	@Accept			json
+//	@Produce		json
+//	@Param			rate			body		database.ExchangeRate	true	"new exchange rate"
+//	@Param			Idempotency-Key	header		string					false	"key that makes retries of this request safe"
+//	@Success		201				{object}	database.ExchangeRate	"successfully created an exchange rate"
+//	@Failure		400				{object}	problem					"malformed_body or validation_failed"
+//	@Failure		403				{object}	problem					"forbidden"
+//	@Failure		409				{object}	problem					"exchange_rate_exists or idempotency_key_in_use"
+//	@Failure		422				{object}	problem					"idempotency_key_reused"
+//	@Failure		500				{object}	problem					"internal_error"
+//	@Router			/api/v1/exchange-rates [post]
+//	@Security		CookieAuth
+func (app *application) createExchangeRate(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage exchange rates.")
+		return
+	}
+
+	var rate database.ExchangeRate
+
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if rate.Effective_At.IsZero() {
+		rate.Effective_At = time.Now()
+	}
+
+	if err := app.models.ExchangeRates.CreateExchangeRate(&rate); err != nil {
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeExchangeRateExists,
+				fmt.Sprintf("A rate from %s to %s already takes effect at that time.", rate.From, rate.To))
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "exchange_rate.create", Target_Type: auditTargetExchangeRate, Target_Id: int(rate.Id)}, nil, rate)
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// deleteExchangeRate deletes an exchange rate
+//
+//	@Summary		delete exchange rate
+//	@Description	delete an exchange rate that has not taken effect yet; rates that did are kept as history
+//	@Tags			exchange rate
+//	@Produce		json
+//	@Param			id	query	int	true	"id of exchange rate to delete"
+//	@Success		204	"successfully deleted"
+//	@Failure		400	{object}	problem	"invalid_id"
+//	@Failure		403	{object}	problem	"forbidden"
+//	@Failure		404	{object}	problem	"exchange_rate_not_found"
+//	@Failure		409	{object}	problem	"exchange_rate_in_effect"
+//	@Failure		500	{object}	problem	"internal_error"
+//	@Router			/api/v1/exchange-rates/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deleteExchangeRate(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage exchange rates.")
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		app.invalidId(c, "The exchange rate id must be an integer.")
+		return
+	}
+
+	rate, err := app.models.ExchangeRates.GetExchangeRate(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if rate == nil {
+		app.errorResponse(c, http.StatusNotFound, codeExchangeRateNotFound, fmt.Sprintf("No exchange rate exists with id %d.", id))
+		return
+	}
+
+	deleted, err := app.models.ExchangeRates.DeleteExchangeRate(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if !deleted {
+		app.errorResponse(c, http.StatusConflict, codeExchangeRateInEffect, "The exchange rate has already taken effect and is kept as history.")
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "exchange_rate.delete", Target_Type: auditTargetExchangeRate, Target_Id: int(rate.Id)}, rate, nil)
+
+	c.Status(http.StatusNoContent)
+}
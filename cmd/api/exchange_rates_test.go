@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckout_InCurrency(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	makeStockedBook(admin, ts.URL+"/api/v1", "1000", "5")
+
+	resp, body := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/exchange-rates", `{"from":"USD","to":"EUR","rate":"0.92","effective_at":"2024-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "0.92", testutils.StringToJSON(body)["rate"])
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/books?currency=eur", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]any{"amount": float64(920), "currency": "EUR"}, testutils.StringToJSONArray(body)[0]["price"])
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/books?currency=GBP", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeExchangeRateUnavailable, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(admin, http.MethodPut, ts.URL+"/api/v1/books/1/prices", `{"amount":899,"currency":"GBP"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/books/1?currency=GBP", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]any{"amount": float64(899), "currency": "GBP"}, testutils.StringToJSON(body)["price"])
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":2}`)
+
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?currency=EUR", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	expected := `{"id":1,"user_id":2,"status":"Pending","total_price":{"amount":1840,"currency":"EUR"},"exchange_rate_from":"USD","exchange_rate":"0.92"}`
+	assert.Equal(t, testutils.StringToJSON(expected), testutils.StringToJSON(body))
+
+	// a later rate does not change the order
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/exchange-rates", `{"from":"USD","to":"EUR","rate":"0.95"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	order, err := app.models.Orders.GetOrder(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, money.New(1840, "EUR"), order.Total_Price)
+	assert.Equal(t, "0.92", order.Exchange_Rate)
+
+	resp, body = doRequest(admin, http.MethodDelete, ts.URL+"/api/v1/exchange-rates/1", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeExchangeRateInEffect, testutils.StringToJSON(body)["code"])
+}
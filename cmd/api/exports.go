@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/export"
+)
+
+// bookRecord is a book as a row of a CSV or Parquet export. Amounts are in
+// the minor units of the currency.
+type bookRecord struct {
+	Id             int    `parquet:"id"`
+	Title          string `parquet:"title"`
+	Author         string `parquet:"author"`
+	Price_Amount   int64  `parquet:"price_amount"`
+	Price_Currency string `parquet:"price_currency"`
+	Stock          int    `parquet:"stock"`
+	Tax_Category   string `parquet:"tax_category,optional"`
+	Weight_Grams   int    `parquet:"weight_grams,optional"`
+	Publisher_Id   int    `parquet:"publisher_id,optional"`
+	Isbn_13        string `parquet:"isbn_13,optional"`
+	Isbn_10        string `parquet:"isbn_10,optional"`
+}
+
+func newBookRecord(book *database.Book) bookRecord {
+	return bookRecord{
+		Id:             book.Id,
+		Title:          book.Title,
+		Author:         book.Author,
+		Price_Amount:   book.Price.Amount,
+		Price_Currency: book.Price.Currency,
+		Stock:          book.Stock,
+		Tax_Category:   book.Tax_Category,
+		Weight_Grams:   book.Weight_Grams,
+		Publisher_Id:   book.Publisher_Id,
+		Isbn_13:        book.Isbn_13,
+		Isbn_10:        book.Isbn_10,
+	}
+}
+
+// orderRecord is an order as a row of a CSV or Parquet export. All amounts
+// are in the minor units of the order's currency.
+type orderRecord struct {
+	Id                    int       `parquet:"id"`
+	User_Id               int       `parquet:"user_id"`
+	Status                string    `parquet:"status"`
+	Currency              string    `parquet:"currency"`
+	Total_Amount          int64     `parquet:"total_amount"`
+	Tax_Total_Amount      int64     `parquet:"tax_total_amount,optional"`
+	Discount_Total_Amount int64     `parquet:"discount_total_amount,optional"`
+	Shipping_Total_Amount int64     `parquet:"shipping_total_amount,optional"`
+	Free_Shipping         bool      `parquet:"free_shipping"`
+	Tax_Region            string    `parquet:"tax_region,optional"`
+	Shipping_Country      string    `parquet:"shipping_country,optional"`
+	Exchange_Rate_From    string    `parquet:"exchange_rate_from,optional"`
+	Exchange_Rate         string    `parquet:"exchange_rate,optional"`
+	Created_At            time.Time `parquet:"created_at,timestamp(millisecond)"`
+}
+
+func newOrderRecord(order *database.Order) orderRecord {
+	r := orderRecord{
+		Id:                    order.Id,
+		User_Id:               order.User_Id,
+		Status:                order.Status,
+		Currency:              order.Total_Price.Currency,
+		Total_Amount:          order.Total_Price.Amount,
+		Tax_Total_Amount:      order.Tax_Total.Amount,
+		Discount_Total_Amount: order.Discount_Total.Amount,
+		Shipping_Total_Amount: order.Shipping_Total.Amount,
+		Free_Shipping:         order.Free_Shipping,
+		Tax_Region:            order.Tax_Region,
+		Exchange_Rate_From:    order.Exchange_Rate_From,
+		Exchange_Rate:         order.Exchange_Rate,
+		Created_At:            order.Created_At,
+	}
+	if order.Shipping_Address != nil {
+		r.Shipping_Country = order.Shipping_Address.Country
+	}
+	return r
+}
+
+// exportFormat returns the format asked for by the format query parameter or
+// else the Accept header. It responds and returns false if the format
+// parameter names no supported format.
+func (app *application) exportFormat(c *gin.Context) (string, bool) {
+	format := c.Query("format")
+	if format == "" {
+		return export.Negotiate(c.GetHeader("Accept")), true
+	}
+	if !export.IsFormat(format) {
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, "format must be json, ndjson, csv or parquet.")
+		return "", false
+	}
+	return format, true
+}
+
+// exportResponse sends the headers of an export with its first byte, so an
+// error before anything was written can still be answered with a problem.
+type exportResponse struct {
+	c        *gin.Context
+	format   string
+	filename string
+	started  bool
+}
+
+func (r *exportResponse) Write(p []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		r.c.Header("Content-Type", export.ContentType(r.format))
+		if r.format != export.JSON {
+			r.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, r.filename, r.format))
+		}
+		r.c.Status(http.StatusOK)
+	}
+	return r.c.Writer.Write(p)
+}
+
+// streamExport writes the records that stream produces in the requested
+// format as they come. JSON and NDJSON carry the records as the API
+// represents them; CSV and Parquet carry the flat rows that flatten returns.
+func streamExport[T any, R any](app *application, c *gin.Context, name string, stream func(context.Context, func(T) error) error, flatten func(T) R) {
+	format, ok := app.exportFormat(c)
+	if !ok {
+		return
+	}
+
+	// large exports take longer than the server's write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("clearing write deadline of %s export: %v", name, err)
+	}
+
+	out := &exportResponse{c: c, format: format, filename: name}
+
+	var write func(T) error
+	var close func() error
+
+	if format == export.JSON || format == export.NDJSON {
+		w, err := export.NewWriter[T](format, out)
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+		write, close = w.Write, w.Close
+	} else {
+		w, err := export.NewWriter[R](format, out)
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+		write = func(record T) error { return w.Write(flatten(record)) }
+		close = w.Close
+	}
+
+	err := stream(c.Request.Context(), write)
+	if err == nil {
+		err = close()
+	}
+	if err != nil {
+		if !out.started {
+			app.serverError(c, err)
+			return
+		}
+		// the response is under way, so all that can be done is cut it short
+		log.Printf("streaming %s export: %v", name, err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doAccept is a GET with the given Accept header.
+func doAccept(client *http.Client, url, accept string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	req.Header.Set("Accept", accept)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return resp, string(bodyBytes)
+}
+
+func TestExportBooks(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "1299", "5")
+	doRequest(admin, http.MethodPost, url+"/books", `{"title":"Title2", "author":"Second","price":{"amount":500,"currency":"EUR"},"stock":1}`)
+	doRequest(admin, http.MethodPost, url+"/publishers", `{"name":"Penguin"}`)
+	resp, _ := doIfMatch(admin, http.MethodPatch, url+"/books/2", `"1"`, `{"publisher_id":1}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body := doAccept(admin, ts.URL+"/api/v2/books/all", "text/csv")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="books.csv"`, resp.Header.Get("Content-Disposition"))
+	assert.Equal(t, "id,title,author,price_amount,price_currency,stock,tax_category,weight_grams,publisher_id,isbn_13,isbn_10\n"+
+		"1,Title1,First,1299,USD,5,,,,,\n"+
+		"2,Title2,Second,500,EUR,1,,,1,,\n", body)
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v2/books/all?format=ndjson&publisher_id=1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(t, lines, 1)
+	var book map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &book))
+	assert.Equal(t, "Title2", book["title"])
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v2/books/all?format=parquet", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	records, err := parquet.Read[bookRecord](bytes.NewReader([]byte(body)), int64(len(body)))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, int64(500), records[1].Price_Amount)
+	assert.Equal(t, 1, records[1].Publisher_Id)
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v2/books/all?category_id=1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "[]\n", body)
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v2/books/all?format=xlsx", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidQuery, testutils.StringToJSON(body)["code"])
+}
+
+func TestExportOrders(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	testutils.RegisterCustomer(client, url)
+	testutils.LoginCustomer(client, url)
+	testutils.MakeAnOrder(client, url)
+	doRequest(client, http.MethodPost, url+"/orders", `{"user_id":1, "status":"Sold","total_price":{"amount":2,"currency":"USD"}}`)
+
+	testutils.RegisterAdmin(client, url)
+	testutils.LoginAdmin(client, url)
+
+	resp, body := doRequest(client, http.MethodGet, ts.URL+"/api/v2/orders/all?format=csv&status=Sold", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "id,user_id,status,currency,total_amount,tax_total_amount,discount_total_amount,shipping_total_amount,free_shipping,tax_region,shipping_country,exchange_rate_from,exchange_rate,created_at", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "2,1,Sold,USD,2,"))
+
+	resp, body = doRequest(client, http.MethodGet, ts.URL+"/api/v2/orders/all?to=2000-01-01T00:00:00Z", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "[]\n", body)
+
+	resp, body = doRequest(client, http.MethodGet, ts.URL+"/api/v2/orders/all?from=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidQuery, testutils.StringToJSON(body)["code"])
+}
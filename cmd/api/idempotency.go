@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/jobs"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// maxIdempotentBodyBytes is the largest body any route accepts, an
+	// uploaded import.
+	maxIdempotentBodyBytes = maxImportBytes
+	// maxBufferedBodyBytes is how much of a body is kept in memory while it
+	// is fingerprinted; the rest goes to a temporary file.
+	maxBufferedBodyBytes = 1 << 20
+)
+
+// replayedHeaders are the response headers stored with a key and sent again
+// when the response is replayed.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// recordingWriter passes the response through while keeping a copy of the
+// body so it can be stored against the idempotency key.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// requestFingerprint identifies what a key was first used for, so the same key
+// cannot be reused for a different request. The body is read as a stream.
+func requestFingerprint(method, path string, body io.Reader) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// spooledBody is a copy of a request body that can be read again. Close
+// removes its temporary file, if it has one.
+type spooledBody struct {
+	io.ReadSeeker
+	file *os.File
+}
+
+func (b *spooledBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// spoolBody copies body so it can be fingerprinted and then handled. Bodies
+// up to maxBufferedBodyBytes are kept in memory and larger ones are written
+// to a temporary file.
+func spoolBody(body io.Reader) (*spooledBody, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(body, maxBufferedBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if n <= maxBufferedBodyBytes {
+		return &spooledBody{ReadSeeker: bytes.NewReader(buf.Bytes())}, nil
+	}
+
+	file, err := os.CreateTemp("", "idempotent-body-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &spooledBody{ReadSeeker: file, file: file}
+	if _, err := io.Copy(file, io.MultiReader(&buf, body)); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	return spooled, nil
+}
+
+// IdempotencyMiddleware makes POST requests that carry an Idempotency-Key
+// safe to retry. The first request with a key is handled normally and its
+// response is stored for the user. A retry with the same key and body gets the
+// stored response back instead of being handled again. Server errors are not
+// stored, and a handler that panics releases its key too, so that the retry
+// can succeed. It must run after AuthMiddleware.
+func (app *application) IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidIdempotencyKey, "The Idempotency-Key header must be at most 255 characters long.")
+			return
+		}
+
+		body, err := spoolBody(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				app.errorResponse(c, http.StatusRequestEntityTooLarge, codeBodyTooLarge, "The request body is too large.")
+				return
+			}
+			app.serverError(c, err)
+			return
+		}
+		defer body.Close()
+
+		fingerprint, err := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+		if err == nil {
+			_, err = body.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+		c.Request.Body = io.NopCloser(body)
+
+		user := app.GetUserFromContext(c)
+		record := &database.IdempotencyKey{
+			User_Id:     user.Id,
+			Key:         key,
+			Fingerprint: fingerprint,
+			Expires_At:  time.Now().Add(app.config.IdempotencyKeyTTL),
+		}
+
+		reserved, err := app.models.IdempotencyKeys.ReserveIdempotencyKey(record)
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+
+		if !reserved {
+			app.replayIdempotentResponse(c, record)
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		handled := false
+		defer func() {
+			// the handler panicked, and the recovery middleware answers
+			if !handled {
+				app.releaseIdempotencyKey(c, record)
+			}
+		}()
+
+		c.Next()
+		handled = true
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			app.releaseIdempotencyKey(c, record)
+			return
+		}
+
+		record.Response_Status = status
+		record.Response_Headers = map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := writer.Header().Get(name); value != "" {
+				record.Response_Headers[name] = value
+			}
+		}
+		record.Response_Body = writer.body.Bytes()
+
+		if err := app.models.IdempotencyKeys.SaveIdempotencyResponse(record); err != nil {
+			log.Printf("request_id=%s saving idempotency response: %v", requestIdFromContext(c), err)
+		}
+	}
+}
+
+// releaseIdempotencyKey deletes the reservation of a key whose request
+// failed, so it can be used again.
+func (app *application) releaseIdempotencyKey(c *gin.Context, record *database.IdempotencyKey) {
+	if err := app.models.IdempotencyKeys.DeleteIdempotencyKey(record.User_Id, record.Key); err != nil {
+		log.Printf("request_id=%s releasing idempotency key: %v", requestIdFromContext(c), err)
+	}
+}
+
+// replayIdempotentResponse answers a request whose key is already taken.
+func (app *application) replayIdempotentResponse(c *gin.Context, record *database.IdempotencyKey) {
+	stored, err := app.models.IdempotencyKeys.GetIdempotencyKey(record.User_Id, record.Key)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if stored == nil {
+		// The first request failed and released the key between our reserve
+		// and this lookup.
+		app.errorResponse(c, http.StatusConflict, codeIdempotencyKeyInUse, "A request with this Idempotency-Key is still being processed. Retry later.")
+		return
+	}
+
+	if stored.Fingerprint != record.Fingerprint {
+		app.errorResponse(c, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "This Idempotency-Key was already used for a different request.")
+		return
+	}
+
+	if stored.Response_Status == 0 {
+		app.errorResponse(c, http.StatusConflict, codeIdempotencyKeyInUse, "A request with this Idempotency-Key is still being processed. Retry later.")
+		return
+	}
+
+	for name, value := range stored.Response_Headers {
+		c.Header(name, value)
+	}
+	c.Header(idempotentReplayedHeader, "true")
+	c.Status(stored.Response_Status)
+	_, _ = c.Writer.Write(stored.Response_Body)
+	c.Abort()
+}
+
+// purgeIdempotencyKeys deletes expired keys. Expired keys are already
+// ignored on lookup; this only keeps the table from growing. It runs every
+// hour.
+func (app *application) purgeIdempotencyKeys(ctx context.Context, job *jobs.Job, _ struct{}) (any, error) {
+	n, err := app.models.IdempotencyKeys.DeleteExpiredIdempotencyKeys()
+	if err != nil {
+		return nil, fmt.Errorf("purging expired idempotency keys: %w", err)
+	}
+	return map[string]int64{"keys": n}, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postWithIdempotencyKey(client *http.Client, url, key, payload string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(payload))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyKeyHeader, key)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return resp, string(bodyBytes)
+}
+
+func TestCreateOrder_Idempotency_Key(t *testing.T) {
+	app := SetupTest()
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", app.registerUser)
+	v1.POST("/auth/login", app.login)
+
+	authGroup := v1.Group("/")
+	authGroup.Use(app.AuthMiddleware(), app.IdempotencyMiddleware())
+	authGroup.POST("/orders", app.createOrder)
+	authGroup.GET("/orders", app.getPageOfOrders)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+
+	payload := `{"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
+
+	first, firstBody := postWithIdempotencyKey(client, ts.URL+"/api/v1/orders", "order-1", payload)
+	assert.Equal(t, http.StatusCreated, first.StatusCode)
+	assert.Equal(t, "", first.Header.Get(idempotentReplayedHeader))
+
+	// a retry gets the original response and does not create another order
+	retry, retryBody := postWithIdempotencyKey(client, ts.URL+"/api/v1/orders", "order-1", payload)
+	assert.Equal(t, http.StatusCreated, retry.StatusCode)
+	assert.Equal(t, "true", retry.Header.Get(idempotentReplayedHeader))
+	assert.Equal(t, first.Header.Get("ETag"), retry.Header.Get("ETag"))
+	assert.Equal(t, testutils.StringToJSON(firstBody), testutils.StringToJSON(retryBody))
+
+	orders, err := app.models.Orders.GetPageOfOrders(10, 1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, 1, len(orders))
+
+	// the same key with a different body is rejected
+	reused, reusedBody := postWithIdempotencyKey(client, ts.URL+"/api/v1/orders", "order-1", `{"user_id":1, "status":"Pending","total_price":{"amount":2,"currency":"USD"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.StatusCode)
+	assert.Equal(t, codeIdempotencyKeyReused, testutils.StringToJSON(reusedBody)["code"])
+
+	// a new key creates a new order
+	second, _ := postWithIdempotencyKey(client, ts.URL+"/api/v1/orders", "order-2", payload)
+	assert.Equal(t, http.StatusCreated, second.StatusCode)
+}
+
+func TestCreateOrder_Expired_Idempotency_Key(t *testing.T) {
+	app := SetupTest()
+	app.config.IdempotencyKeyTTL = -1
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", app.registerUser)
+	v1.POST("/auth/login", app.login)
+
+	authGroup := v1.Group("/")
+	authGroup.Use(app.AuthMiddleware(), app.IdempotencyMiddleware())
+	authGroup.POST("/orders", app.createOrder)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+
+	payload := `{"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
+
+	postWithIdempotencyKey(client, ts.URL+"/api/v1/orders", "order-1", payload)
+
+	// the stored key has already expired so a different body is accepted
+	resp, body := postWithIdempotencyKey(client, ts.URL+"/api/v1/orders", "order-1", `{"user_id":1, "status":"Pending","total_price":{"amount":2,"currency":"USD"}}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, float64(2), testutils.StringToJSON(body)["id"])
+}
+
+func TestIdempotency_PanicsAndLargeBodies(t *testing.T) {
+	app := SetupTest()
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", app.registerUser)
+	v1.POST("/auth/login", app.login)
+
+	panicked := false
+	authGroup := v1.Group("/")
+	authGroup.Use(app.AuthMiddleware(), app.IdempotencyMiddleware())
+	authGroup.POST("/echo", func(c *gin.Context) {
+		if !panicked {
+			panicked = true
+			panic("out of paper")
+		}
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusOK, gin.H{"bytes": len(body)})
+	})
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+
+	// a handler that panics releases its key
+	resp, _ := postWithIdempotencyKey(client, ts.URL+"/api/v1/echo", "echo-1", "{}")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	resp, body := postWithIdempotencyKey(client, ts.URL+"/api/v1/echo", "echo-1", "{}")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(2), testutils.StringToJSON(body)["bytes"])
+
+	// bodies larger than can be kept in memory reach the handler whole
+	large := strings.Repeat("x", 3*maxBufferedBodyBytes)
+	resp, body = postWithIdempotencyKey(client, ts.URL+"/api/v1/echo", "echo-2", large)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(len(large)), testutils.StringToJSON(body)["bytes"])
+	resp, _ = postWithIdempotencyKey(client, ts.URL+"/api/v1/echo", "echo-2", large)
+	assert.Equal(t, "true", resp.Header.Get(idempotentReplayedHeader))
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	fingerprint := func(method, path, body string) string {
+		f, err := requestFingerprint(method, path, strings.NewReader(body))
+		require.NoError(t, err)
+		return f
+	}
+	body := `{"total_price":{"amount":1,"currency":"USD"}}`
+
+	assert.Equal(t, fingerprint("POST", "/api/v1/orders", body), fingerprint("POST", "/api/v1/orders", body))
+	assert.NotEqual(t, fingerprint("POST", "/api/v1/orders", body), fingerprint("POST", "/api/v1/books", body))
+	assert.NotEqual(t, fingerprint("POST", "/api/v1/orders", body), fingerprint("POST", "/api/v1/orders", `{"total_price":{"amount":2,"currency":"USD"}}`))
+}
+
+func TestSpoolBody(t *testing.T) {
+	for _, size := range []int{10, maxBufferedBodyBytes + 10} {
+		body := strings.Repeat("x", size)
+		spooled, err := spoolBody(strings.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, size > maxBufferedBodyBytes, spooled.file != nil)
+
+		got, err := io.ReadAll(spooled)
+		require.NoError(t, err)
+		assert.True(t, body == string(got), "the spooled body differs")
+		require.NoError(t, spooled.Close())
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/bookimport"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/jobs"
+)
+
+// maxImportBytes is the largest catalog file that can be uploaded.
+const maxImportBytes = 32 << 20
+
+// importPayload is the payload of an import job.
+type importPayload struct {
+	Import_Id int `json:"import_id"`
+}
+
+// getImportFromParam loads the import job named by the id path parameter.
+// It responds and returns nil if there is no such job or the user is not an
+// admin.
+func (app *application) getImportFromParam(c *gin.Context) *database.ImportJob {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can import books.")
+		return nil
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The import id must be an integer.")
+		return nil
+	}
+
+	job, err := app.models.ImportJobs.GetImportJob(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if job == nil {
+		app.errorResponse(c, http.StatusNotFound, codeImportNotFound, fmt.Sprintf("No import exists with id %d.", id))
+		return nil
+	}
+	return job
+}
+
+// createImport uploads a catalog file to import
+//
+//	@Summary		imports books
+//	@Description	queues a CSV or ONIX 3.0 file whose books are added, or updated when a book with the same ISBN exists. The import runs in the background; poll the job for progress and download its report. A dry run records what would change without changing anything.
+//	@Tags			import
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file				true	"CSV file with columns isbn, title, author, price and optionally currency, stock, publisher, tax_category and weight_grams, or an ONIX 3.0 message in reference tags"
+//	@Param			format	formData	string				false	"csv or onix, by default inferred from the file name"
+//	@Param			dry_run	formData	bool				false	"only report what would change"
+//	@Success		202		{object}	database.ImportJob	"successfully queued the import"
+//	@Failure		400		{object}	problem				"invalid_import"
+//	@Failure		403		{object}	problem				"forbidden"
+//	@Failure		413		{object}	problem				"body_too_large"
+//	@Failure		500		{object}	problem				"internal_error"
+//	@Router			/api/v1/imports [post]
+//	@Security		CookieAuth
+func (app *application) createImport(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can import books.")
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			app.errorResponse(c, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("The file must be at most %d MiB.", maxImportBytes>>20))
+			return
+		}
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidImport, "Upload the catalog as the file field of a multipart form.")
+		return
+	}
+
+	job := &database.ImportJob{User_Id: user.Id, Filename: filepath.Base(header.Filename)}
+	if len(job.Filename) > 256 {
+		job.Filename = job.Filename[:256]
+	}
+
+	job.Format = c.PostForm("format")
+	switch job.Format {
+	case bookimport.FormatCSV, bookimport.FormatONIX:
+	case "":
+		format, ok := bookimport.FormatFor(header.Filename)
+		if !ok {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidImport, "The format cannot be told from the file name; set format to csv or onix.")
+			return
+		}
+		job.Format = format
+	default:
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidImport, "format must be csv or onix.")
+		return
+	}
+
+	if value := c.PostForm("dry_run"); value != "" {
+		if job.Dry_Run, err = strconv.ParseBool(value); err != nil {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidImport, "dry_run must be true or false.")
+			return
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+	defer file.Close()
+
+	if job.Data, err = io.ReadAll(file); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if err := app.models.ImportJobs.CreateImportJob(job); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "import.create", Target_Type: auditTargetImport, Target_Id: job.Id}, nil, job)
+
+	if _, err := app.jobs.Enqueue(jobTypeImport, importPayload{Import_Id: job.Id}, jobs.CreatedBy(user.Id)); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// getImports gets a page of imports
+//
+//	@Summary		gets a page of imports
+//	@Description	gets a page of import jobs, newest first
+//	@Tags			import
+//	@Produce		json
+//	@Param			page	query		int					false	"page number to request"
+//	@Param			limit	query		int					false	"max number of imports to return per page, at most 100"
+//	@Success		200		{array}		database.ImportJob	"successfully got a page of imports"
+//	@Failure		400		{object}	problem				"invalid_query"
+//	@Failure		403		{object}	problem				"forbidden"
+//	@Failure		500		{object}	problem				"internal_error"
+//	@Router			/api/v1/imports [get]
+//	@Security		CookieAuth
+func (app *application) getImports(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can import books.")
+		return
+	}
+
+	limit, page, ok := app.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	jobs, err := app.models.ImportJobs.GetImportJobs(limit, page)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// getImport gets an import
+//
+//	@Summary		get import
+//	@Description	get an import job and its progress by id
+//	@Tags			import
+//	@Produce		json
+//	@Param			id	query		int					true	"id of import"
+//	@Success		200	{object}	database.ImportJob	"successfully got an import"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		403	{object}	problem				"forbidden"
+//	@Failure		404	{object}	problem				"import_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/imports/:id [get]
+//	@Security		CookieAuth
+func (app *application) getImport(c *gin.Context) {
+	job := app.getImportFromParam(c)
+	if job == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// getImportReport downloads the report of an import
+//
+//	@Summary		download import report
+//	@Description	downloads what happened to each row of an import as CSV with columns row, isbn, action, book_id, changes and error. Rows are reported as they are processed.
+//	@Tags			import
+//	@Produce		text/csv
+//	@Param			id		query		int		true	"id of import"
+//	@Param			action	query		string	false	"only rows that were created, updated, unchanged or failed"
+//	@Success		200		{string}	string	"CSV report"
+//	@Failure		400		{object}	problem	"invalid_id or invalid_query"
+//	@Failure		403		{object}	problem	"forbidden"
+//	@Failure		404		{object}	problem	"import_not_found"
+//	@Failure		500		{object}	problem	"internal_error"
+//	@Router			/api/v1/imports/:id/report [get]
+//	@Security		CookieAuth
+func (app *application) getImportReport(c *gin.Context) {
+	job := app.getImportFromParam(c)
+	if job == nil {
+		return
+	}
+
+	action := c.Query("action")
+	switch action {
+	case "", database.ImportRowCreated, database.ImportRowUpdated, database.ImportRowUnchanged, database.ImportRowFailed:
+	default:
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, "action must be created, updated, unchanged or failed.")
+		return
+	}
+
+	rows, err := app.models.ImportJobs.GetImportRows(job.Id, action)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%d-report.csv"`, job.Id))
+	c.Status(http.StatusOK)
+
+	if err := bookimport.WriteReport(c.Writer, rows); err != nil {
+		log.Printf("writing report of import %d: %v", job.Id, err)
+	}
+}
+
+// runImport runs the import named by the payload and returns it once it has
+// finished. An import cut short by a crash or a shutdown, or given up on and
+// then retried, carries on after the last batch of rows it recorded. Rows of
+// the batch in progress are upserted again, so the ones imported before it was
+// cut short come out unchanged.
+func (app *application) runImport(ctx context.Context, job *jobs.Job, payload importPayload) (any, error) {
+	imp, err := app.models.ImportJobs.ClaimImportJob(payload.Import_Id)
+	if err != nil {
+		return nil, err
+	}
+	if imp == nil {
+		// finished by an earlier attempt
+		return nil, nil
+	}
+
+	err = bookimport.Run(ctx, &app.models, imp, func(imp *database.ImportJob) {
+		err := job.SetProgress(imp.Processed*100/imp.Total, fmt.Sprintf("%d of %d rows", imp.Processed, imp.Total))
+		if err != nil {
+			log.Printf("recording progress of import %d: %v", imp.Id, err)
+		}
+	})
+	if err != nil {
+		cancelled := errors.Is(context.Cause(ctx), jobs.ErrCancelled)
+		if cancelled || (ctx.Err() == nil && job.Attempts >= job.Max_Attempts) {
+			imp.Status = database.ImportFailed
+			imp.Error = "The import stopped unexpectedly."
+			if cancelled {
+				imp.Error = "The import was cancelled."
+			}
+			if err := app.models.ImportJobs.FinishImportJob(imp); err != nil {
+				log.Printf("failing import %d: %v", imp.Id, err)
+			}
+		}
+		return nil, err
+	}
+	return imp, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadImport posts the file as a multipart import with the given form fields.
+func uploadImport(client *http.Client, url, filename, file string, fields map[string]string) (*http.Response, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	part.Write([]byte(file))
+	w.Close()
+
+	resp, err := client.Post(url+"/imports", w.FormDataContentType(), &buf)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return resp, string(bodyBytes)
+}
+
+func TestImports(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "3", "5")
+	resp, _ := doIfMatch(admin, http.MethodPatch, url+"/books/1", `"1"`, `{"isbn_13":"9780306406157"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	file := "isbn,title,author,price,stock,publisher\n" +
+		"9780306406157,Title1,First,0.05,5,\n" +
+		"0-8044-2957-X,Imported,Some Author,12.99,4,Penguin\n" +
+		"9780306406158,Broken,Some Author,1.00,1,\n"
+
+	// a dry run reports the changes without making them
+	resp, body := uploadImport(admin, url, "catalog.csv", file, map[string]string{"dry_run": "true"})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	job := testutils.StringToJSON(body)
+	assert.Equal(t, "queued", job["status"])
+	assert.Equal(t, "csv", job["format"])
+	assert.Equal(t, true, job["dry_run"])
+
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/imports/1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	job = testutils.StringToJSON(body)
+	assert.Equal(t, "succeeded", job["status"])
+	assert.Equal(t, float64(3), job["processed"])
+	assert.Equal(t, float64(1), job["created"])
+	assert.Equal(t, float64(1), job["updated"])
+	assert.Equal(t, float64(1), job["failed"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/imports/1/report", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "row,isbn,action,book_id,changes,error\n"+
+		"2,9780306406157,updated,1,price,\n"+
+		"3,9780804429573,created,,,\n"+
+		"4,9780306406158,failed,,,\"isbn \"\"9780306406158\"\" is not a valid ISBN-10 or ISBN-13\"\n", body)
+
+	resp, _ = doRequest(admin, http.MethodGet, url+"/books/2", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	_, body = doRequest(admin, http.MethodGet, url+"/books/1", "")
+	assert.Equal(t, float64(3), testutils.StringToJSON(body)["price"].(map[string]any)["amount"])
+
+	resp, body = uploadImport(admin, url, "catalog.csv", file, nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	_, body = doRequest(admin, http.MethodGet, url+"/imports/2", "")
+	assert.Equal(t, float64(1), testutils.StringToJSON(body)["created"])
+
+	_, body = doRequest(admin, http.MethodGet, url+"/books/isbn/9780804429573", "")
+	book := testutils.StringToJSON(body)
+	assert.Equal(t, "Imported", book["title"])
+	assert.Equal(t, "080442957X", book["isbn_10"])
+	assert.NotNil(t, book["publisher_id"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/imports/2/report?action=failed", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "\n4,9780306406158,failed,")
+	assert.NotContains(t, body, "created")
+
+	// the same file again changes nothing
+	uploadImport(admin, url, "catalog.csv", file, nil)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+	_, body = doRequest(admin, http.MethodGet, url+"/imports/3", "")
+	assert.Equal(t, float64(2), testutils.StringToJSON(body)["unchanged"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/imports", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	jobs := testutils.StringToJSONArray(body)
+	require.Len(t, jobs, 3)
+	assert.Equal(t, float64(3), jobs[0]["id"])
+
+	// a file that cannot be read fails the job
+	uploadImport(admin, url, "catalog.csv", "isbn,title\n", nil)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+	_, body = doRequest(admin, http.MethodGet, url+"/imports/4", "")
+	job = testutils.StringToJSON(body)
+	assert.Equal(t, "failed", job["status"])
+	assert.Contains(t, job["error"], "missing required column")
+
+	resp, body = uploadImport(admin, url, "catalog.xlsx", file, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidImport, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/imports/9", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeImportNotFound, testutils.StringToJSON(body)["code"])
+}
+
+func TestImports_RetriedImportCarriesOn(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	testutils.RegisterAdmin(admin, url)
+	testutils.LoginAdmin(admin, url)
+
+	file := "isbn,title,author,price\n" +
+		"9780306406157,Title1,First,1.00\n" +
+		"0-8044-2957-X,Imported,Some Author,12.99\n"
+	resp, _ := uploadImport(admin, url, "catalog.csv", file, nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// a worker records the first row and then the import is given up on
+	imp, err := app.models.ImportJobs.ClaimImportJob(1)
+	require.NoError(t, err)
+	imp.Total, imp.Processed, imp.Created = 2, 1, 1
+	require.NoError(t, app.models.ImportJobs.RecordImportRows(imp, []database.ImportRow{{Number: 2, Isbn: "9780306406157", Book_Id: 7, Action: database.ImportRowCreated}}))
+	imp.Status, imp.Error = database.ImportFailed, "The import stopped unexpectedly."
+	require.NoError(t, app.models.ImportJobs.FinishImportJob(imp))
+	job, err := app.models.Jobs.ClaimJob([]string{jobTypeImport}, "crashed", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, app.models.Jobs.FinishJob(job.Id, "crashed", database.JobDead, nil, "gave up"))
+
+	resp, _ = doRequest(admin, http.MethodPost, url+"/jobs/1/retry", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	_, body := doRequest(admin, http.MethodGet, url+"/imports/1", "")
+	got := testutils.StringToJSON(body)
+	assert.Equal(t, "succeeded", got["status"])
+	assert.Nil(t, got["error"])
+	assert.Equal(t, float64(2), got["total"])
+	assert.Equal(t, float64(2), got["processed"])
+	assert.Equal(t, float64(2), got["created"])
+
+	// the row recorded before is not imported again
+	_, body = doRequest(admin, http.MethodGet, url+"/imports/1/report", "")
+	assert.Equal(t, "row,isbn,action,book_id,changes,error\n"+
+		"2,9780306406157,created,7,,\n"+
+		"3,9780804429573,created,1,,\n", body)
+}
+
+func TestImports_DryRunRepeatedIsbn(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	testutils.RegisterAdmin(admin, url)
+	testutils.LoginAdmin(admin, url)
+
+	file := "isbn,title,author,price\n" +
+		"9780306406157,Title1,First,1.00\n" +
+		"0-306-40615-2,Title1,First,2.00\n" +
+		"9780306406157,Title1,First,2.00\n"
+	resp, _ := uploadImport(admin, url, "catalog.csv", file, map[string]string{"dry_run": "true"})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	// later rows see the book the first one would have created
+	_, body := doRequest(admin, http.MethodGet, url+"/imports/1/report", "")
+	assert.Equal(t, "row,isbn,action,book_id,changes,error\n"+
+		"2,9780306406157,created,,,\n"+
+		"3,9780306406157,updated,,price,\n"+
+		"4,9780306406157,unchanged,,,\n", body)
+
+	resp, _ = doRequest(admin, http.MethodGet, url+"/books/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestImports_OnlyAdmins(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+
+	resp, _ := uploadImport(customer, ts.URL+"/api/v1", "catalog.csv", "isbn,title,author,price\n", nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/imports", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/jobs"
+)
+
+// Job types. They are stored with every job, so existing types must not be
+// renamed.
+const (
+	jobTypeImport               = "catalog.import"
+	jobTypePurgeDeletedRows     = "purge.deleted_rows"
+	jobTypePurgeIdempotencyKeys = "purge.idempotency_keys"
+	jobTypePurgeOutboxEvents    = "purge.outbox_events"
+	jobTypeDeliverWebhook       = "webhook.deliver"
+)
+
+// setupJobs creates the job queue and registers the handler of every job type
+// and the schedules.
+func (app *application) setupJobs() {
+	app.jobs = jobs.NewQueue(&app.models.Jobs, jobs.Config{
+		Workers:      app.config.Jobs.Workers,
+		PollInterval: app.config.Jobs.PollInterval,
+		Lease:        app.config.Jobs.Lease,
+	})
+
+	jobs.Handle(app.jobs, jobTypeImport, app.runImport)
+	jobs.Handle(app.jobs, jobTypePurgeDeletedRows, app.purgeDeletedRows)
+	jobs.Handle(app.jobs, jobTypePurgeIdempotencyKeys, app.purgeIdempotencyKeys)
+	jobs.Handle(app.jobs, jobTypePurgeOutboxEvents, app.purgeOutboxEvents)
+	jobs.Handle(app.jobs, jobTypeDeliverWebhook, app.deliverWebhook, jobs.MaxAttempts(app.config.Webhooks.MaxAttempts))
+
+	schedules := []struct {
+		spec    string
+		jobType string
+	}{
+		{"@hourly", jobTypePurgeDeletedRows},
+		{"@hourly", jobTypePurgeIdempotencyKeys},
+		{"@hourly", jobTypePurgeOutboxEvents},
+	}
+	for _, s := range schedules {
+		if err := app.jobs.Schedule(s.jobType, s.spec, s.jobType, struct{}{}); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// getJobFromParam loads the job named by the id path parameter. It responds
+// and returns nil if there is no such job or the user is neither an admin nor
+// the one who queued it.
+func (app *application) getJobFromParam(c *gin.Context) *database.Job {
+	user := app.GetUserFromContext(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		app.invalidId(c, "The job id must be an integer.")
+		return nil
+	}
+
+	job, err := app.models.Jobs.GetJob(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if job == nil || (user.Role != "Admin" && job.Created_By != user.Id) {
+		app.errorResponse(c, http.StatusNotFound, codeJobNotFound, fmt.Sprintf("No job exists with id %d.", id))
+		return nil
+	}
+	return job
+}
+
+// getJobs gets a page of background jobs
+//
+//	@Summary		gets a page of jobs
+//	@Description	gets a page of background jobs, newest first, optionally filtered by type and status
+//	@Tags			jobs
+//	@Produce		json
+//	@Param			type	query		string			false	"only jobs of this type"
+//	@Param			status	query		string			false	"only jobs that are queued, running, succeeded, cancelled or dead"
+//	@Param			page	query		int				false	"page number to request"
+//	@Param			limit	query		int				false	"max number of jobs to return per page, at most 100"
+//	@Success		200		{array}		database.Job	"successfully got a page of jobs"
+//	@Failure		400		{object}	problem			"invalid_query"
+//	@Failure		403		{object}	problem			"forbidden"
+//	@Failure		500		{object}	problem			"internal_error"
+//	@Router			/api/v1/jobs [get]
+//	@Security		CookieAuth
+func (app *application) getJobs(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can list jobs.")
+		return
+	}
+
+	filter := database.JobFilter{Type: c.Query("type"), Status: c.Query("status")}
+
+	switch filter.Status {
+	case "", database.JobQueued, database.JobRunning, database.JobSucceeded, database.JobCancelled, database.JobDead:
+	default:
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, "status must be queued, running, succeeded, cancelled or dead.")
+		return
+	}
+
+	var ok bool
+	filter.Limit, filter.Page, ok = app.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	found, err := app.models.Jobs.GetJobs(filter)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// getJob gets a background job
+//
+//	@Summary		get job
+//	@Description	get a background job with its progress, and its result or error once it has finished. Users can get the jobs they queued; admins can get any job.
+//	@Tags			jobs
+//	@Produce		json
+//	@Param			id	query		int				true	"id of job"
+//	@Success		200	{object}	database.Job	"successfully got a job"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		404	{object}	problem			"job_not_found"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/jobs/:id [get]
+//	@Security		CookieAuth
+func (app *application) getJob(c *gin.Context) {
+	job := app.getJobFromParam(c)
+	if job == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// cancelJob cancels a background job
+//
+//	@Summary		cancel job
+//	@Description	cancels a queued job at once, or asks the worker running a running job to stop, which it does within about a third of the job lease. Users can cancel the jobs they queued; admins can cancel any job.
+//	@Tags			jobs
+//	@Produce		json
+//	@Param			id	query		int				true	"id of job"
+//	@Success		200	{object}	database.Job	"successfully cancelled the job or asked for it to stop"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		404	{object}	problem			"job_not_found"
+//	@Failure		409	{object}	problem			"job_not_cancellable"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/jobs/:id/cancel [post]
+//	@Security		CookieAuth
+func (app *application) cancelJob(c *gin.Context) {
+	job := app.getJobFromParam(c)
+	if job == nil {
+		return
+	}
+
+	cancelled, err := app.models.Jobs.CancelJob(job.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if cancelled == nil {
+		app.errorResponse(c, http.StatusConflict, codeJobNotCancellable, fmt.Sprintf("The job has already %s.", finishedJobVerb(job.Status)))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "job.cancel", Target_Type: auditTargetJob, Target_Id: int(job.Id)}, job, cancelled)
+
+	c.JSON(http.StatusOK, cancelled)
+}
+
+// retryJob runs a dead or cancelled background job again
+//
+//	@Summary		retry job
+//	@Description	queues a dead or cancelled job to run again now, with a fresh set of attempts
+//	@Tags			jobs
+//	@Produce		json
+//	@Param			id	query		int				true	"id of job"
+//	@Success		200	{object}	database.Job	"successfully queued the job again"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		403	{object}	problem			"forbidden"
+//	@Failure		404	{object}	problem			"job_not_found"
+//	@Failure		409	{object}	problem			"job_not_retryable"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/jobs/:id/retry [post]
+//	@Security		CookieAuth
+func (app *application) retryJob(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can retry jobs.")
+		return
+	}
+
+	job := app.getJobFromParam(c)
+	if job == nil {
+		return
+	}
+
+	requeued, err := app.models.Jobs.RequeueJob(job.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if requeued == nil {
+		app.errorResponse(c, http.StatusConflict, codeJobNotRetryable, fmt.Sprintf("Only dead or cancelled jobs can be retried; the job is %s.", job.Status))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "job.retry", Target_Type: auditTargetJob, Target_Id: int(job.Id)}, job, requeued)
+
+	c.JSON(http.StatusOK, requeued)
+}
+
+// finishedJobVerb describes how a job with a final status ended.
+func finishedJobVerb(status string) string {
+	switch status {
+	case database.JobDead:
+		return "failed"
+	case database.JobQueued, database.JobRunning:
+		return "finished"
+	}
+	return status
+}
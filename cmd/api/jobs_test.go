@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/jobs"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobs(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	testutils.RegisterAdmin(admin, url)
+	testutils.LoginAdmin(admin, url)
+
+	// uploading an import queues a job for it
+	resp, _ := uploadImport(admin, url, "catalog.csv", "isbn,title,author,price\n0-306-40615-2,Imported,Some Author,12.99\n", nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	resp, body := doRequest(admin, http.MethodGet, url+"/jobs/1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	job := testutils.StringToJSON(body)
+	assert.Equal(t, jobTypeImport, job["type"])
+	assert.Equal(t, "queued", job["status"])
+	assert.Equal(t, map[string]any{"import_id": float64(1)}, job["payload"])
+
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	_, body = doRequest(admin, http.MethodGet, url+"/jobs/1", "")
+	job = testutils.StringToJSON(body)
+	assert.Equal(t, "succeeded", job["status"])
+	assert.Equal(t, float64(1), job["attempts"])
+	assert.Equal(t, float64(100), job["progress"])
+	assert.Equal(t, "succeeded", job["result"].(map[string]any)["status"])
+	assert.NotNil(t, job["finished_at"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/jobs/1/cancel", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeJobNotCancellable, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/jobs/1/retry", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeJobNotRetryable, testutils.StringToJSON(body)["code"])
+
+	// a job that keeps failing is dead once it runs out of attempts
+	jobs.Handle(app.jobs, "test.fail", func(ctx context.Context, job *jobs.Job, _ struct{}) (any, error) {
+		return nil, jobs.Permanent(errors.New("out of paper"))
+	})
+	_, err := app.jobs.Enqueue("test.fail", struct{}{})
+	require.NoError(t, err)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	_, body = doRequest(admin, http.MethodGet, url+"/jobs/2", "")
+	job = testutils.StringToJSON(body)
+	assert.Equal(t, "dead", job["status"])
+	assert.Equal(t, "out of paper", job["error"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/jobs/2/retry", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	job = testutils.StringToJSON(body)
+	assert.Equal(t, "queued", job["status"])
+	assert.Equal(t, float64(0), job["attempts"])
+
+	// a queued job is cancelled at once
+	resp, body = doRequest(admin, http.MethodPost, url+"/jobs/2/cancel", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "cancelled", testutils.StringToJSON(body)["status"])
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/jobs?status=cancelled", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	found := testutils.StringToJSONArray(body)
+	require.Len(t, found, 1)
+	assert.Equal(t, float64(2), found[0]["id"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/jobs?type="+jobTypeImport, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, testutils.StringToJSONArray(body), 1)
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/jobs?status=lost", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidQuery, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/jobs/9", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeJobNotFound, testutils.StringToJSON(body)["code"])
+}
+
+func TestJobs_Retries(t *testing.T) {
+	app := SetupTest()
+
+	attempts := 0
+	jobs.Handle(app.jobs, "test.flaky", func(ctx context.Context, job *jobs.Job, payload struct{ Fail int }) (any, error) {
+		attempts++
+		if attempts <= payload.Fail {
+			return nil, errors.New("try again")
+		}
+		return map[string]int{"attempts": attempts}, nil
+	}, jobs.MaxAttempts(2))
+
+	queued, err := app.jobs.Enqueue("test.flaky", struct{ Fail int }{Fail: 1})
+	require.NoError(t, err)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	// the failed attempt is retried later, not straight away
+	job, err := app.models.Jobs.GetJob(queued.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "queued", job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "try again", job.Error)
+	assert.True(t, job.Run_At.After(job.Created_At))
+
+	_, err = app.models.Jobs.DB.Exec("update jobs set job_run_at = now() where job_id = $1", job.Id)
+	require.NoError(t, err)
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	job, err = app.models.Jobs.GetJob(queued.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "succeeded", job.Status)
+	assert.JSONEq(t, `{"attempts":2}`, string(job.Result))
+
+	_, err = app.jobs.Enqueue("test.missing", nil)
+	assert.ErrorIs(t, err, jobs.ErrUnknownType)
+}
+
+func TestJobs_RecoversAbandonedJobs(t *testing.T) {
+	app := SetupTest()
+
+	job, err := app.jobs.Enqueue(jobTypePurgeIdempotencyKeys, struct{}{})
+	require.NoError(t, err)
+
+	// a worker that claims the job and crashes never renews its lease
+	claimed, err := app.models.Jobs.ClaimJob([]string{jobTypePurgeIdempotencyKeys}, "crashed", -time.Second)
+	require.NoError(t, err)
+	require.Equal(t, job.Id, claimed.Id)
+
+	n, err := app.models.Jobs.RecoverJobs()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, app.jobs.RunPending(context.Background()))
+
+	job, err = app.models.Jobs.GetJob(job.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "succeeded", job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.JSONEq(t, `{"keys":0}`, string(job.Result))
+}
+
+func TestJobs_OnlyOwnerOrAdmin(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+
+	_, err := app.jobs.Enqueue(jobTypePurgeDeletedRows, struct{}{})
+	require.NoError(t, err)
+
+	resp, _ := doRequest(customer, http.MethodGet, url+"/jobs", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodGet, url+"/jobs/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodPost, url+"/jobs/1/cancel", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodPost, url+"/jobs/1/retry", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
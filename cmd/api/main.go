@@ -2,18 +2,21 @@ package main
 
 import (
 	"log"
+	"net/http"
 	"os"
-	"strconv"
 
 	"database/sql"
 
 	_ "github.com/lib/pq"
 
-	"github.com/joho/godotenv"
-
 	_ "github.com/hamorrar/bookstore/docs"
 
+	"github.com/hamorrar/bookstore/internal/config"
 	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/events"
+	"github.com/hamorrar/bookstore/internal/jobs"
+	"github.com/hamorrar/bookstore/internal/payment"
+	"github.com/hamorrar/bookstore/internal/shipping"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -27,46 +30,65 @@ import (
 //	@name						auth_token
 
 type application struct {
-	port      int
-	jwtSecret string
-	models    database.Models
+	config   *config.Config
+	models   database.Models
+	payments payment.Provider
+	shipping shipping.RateCalculator
+	carrier  shipping.CarrierClient
+	jobs     *jobs.Queue
+
+	publisher     events.EventPublisher
+	relay         *events.Relay
+	broker        *events.Broker
+	webhookClient *http.Client
 }
 
 func main() {
-
-	err := godotenv.Load(".env")
+	cfg, err := config.Load(config.API)
 	if err != nil {
-		log.Printf("Error loading .env file for API: %v\n", err)
-		log.Println("No .env file found, relying on system environment for API.")
+		log.Fatal(err)
 	}
 
-	app := setupApp()
+	log.Println("Effective configuration:")
+	if err := cfg.Dump(os.Stderr); err != nil {
+		log.Fatal(err)
+	}
+
+	app := setupApp(cfg)
 
 	if err := app.serve(); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func setupApp() *application {
-	server_Port, _ := strconv.Atoi(os.Getenv("PORT"))
-	DB_DSN := os.Getenv("DB_DSN")
-
-	db, err := sql.Open("postgres", DB_DSN)
+func setupApp(cfg *config.Config) *application {
+	db, err := sql.Open("postgres", cfg.DB.DSN)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	err = db.Ping()
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
+	}
+
+	publisher, err := newEventPublisher(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	models := database.NewModels(db)
 	app := &application{
-		port:      server_Port,
-		jwtSecret: os.Getenv("SECRET_KEY"),
-		models:    models,
+		config:   cfg,
+		models:   models,
+		payments: newPaymentProvider(cfg),
+		shipping: newShippingCalculator(cfg),
+		carrier:  newCarrierClient(cfg),
+
+		publisher: publisher,
 	}
+	app.setupEvents()
+	app.setupJobs()
 
 	return app
 }
@@ -4,21 +4,34 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 	"testing"
 
+	"github.com/hamorrar/bookstore/internal/config"
+	"github.com/hamorrar/bookstore/internal/events"
+	"github.com/hamorrar/bookstore/internal/payment"
+	"github.com/hamorrar/bookstore/internal/shipping"
 	"github.com/hamorrar/bookstore/internal/testutils"
 	"github.com/joho/godotenv"
 )
 
 func SetupTest() *application {
-	models := testutils.SetupDB()
-	server_Port, _ := strconv.Atoi(os.Getenv("PORT"))
+	cfg, err := config.Load(config.API)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	models := testutils.SetupDB(cfg.DB.DSN)
 	app := &application{
-		port:      server_Port,
-		jwtSecret: os.Getenv("SECRET_KEY"),
-		models:    models,
+		config:   cfg,
+		models:   models,
+		payments: payment.NewFake("test-webhook-secret"),
+		shipping: newShippingCalculator(cfg),
+		carrier:  shipping.NewFakeCarrier(),
+
+		publisher: events.NewMemory(),
 	}
+	app.setupEvents()
+	app.setupJobs()
 	return app
 }
 
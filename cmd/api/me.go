@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type emailChangeRequest struct {
+	Email            string `json:"email" binding:"required,email"`
+	Current_Password string `json:"current_password" binding:"required"`
+}
+
+type passwordChangeRequest struct {
+	Current_Password string `json:"current_password" binding:"required"`
+	New_Password     string `json:"new_password" binding:"required,min=8"`
+}
+
+// checkCurrentPassword compares password with the user's, responding 403 and
+// returning false if it does not match.
+func (app *application) checkCurrentPassword(c *gin.Context, user *database.User, password string) bool {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		app.errorResponse(c, http.StatusForbidden, codeIncorrectPassword, "The current password is incorrect.")
+		return false
+	}
+	return true
+}
+
+// getMe gets the logged in user
+//
+//	@Summary		get my profile
+//	@Description	get the account of the logged in user
+//	@Tags			me
+//	@Produce		json
+//	@Success		200	{object}	database.User	"successfully got the user"
+//	@Header			200	{string}	ETag			"version of the user"
+//	@Success		304	"user has not changed"
+//	@Router			/api/v1/me [get]
+//	@Security		CookieAuth
+func (app *application) getMe(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+
+	if app.notModified(c, user.Version) {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// getMyOrders gets a page of the logged in user's orders
+//
+//	@Summary		get my orders
+//	@Description	get a page of the logged in user's orders, newest first, optionally filtered by status and by when they were placed
+//	@Tags			me
+//	@Produce		json
+//	@Param			status	query		string			false	"only orders with this status"
+//	@Param			from	query		string			false	"earliest time the order was placed, RFC 3339"
+//	@Param			to		query		string			false	"time before which the order was placed, RFC 3339"
+//	@Param			page	query		int				false	"page number to request"
+//	@Param			limit	query		int				false	"max number of orders to return per page, at most 100"
+//	@Success		200		{array}		database.Order	"successfully got a page of orders"
+//	@Failure		400		{object}	problem			"invalid_query"
+//	@Failure		500		{object}	problem			"internal_error"
+//	@Router			/api/v1/me/orders [get]
+//	@Security		CookieAuth
+func (app *application) getMyOrders(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+
+	filter := database.OrderFilter{Status: c.Query("status")}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"limit", &filter.Limit},
+		{"page", &filter.Page},
+	}
+	for _, param := range ints {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%s must be a non-negative integer.", param.name))
+			return
+		}
+		*param.dst = n
+	}
+	filter.Limit = min(filter.Limit, 100)
+
+	times := []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	}
+	for _, param := range times {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%s must be an RFC 3339 time such as 2024-01-02T15:04:05Z.", param.name))
+			return
+		}
+		*param.dst = t
+	}
+
+	orders, err := app.models.Orders.GetOrdersForUser(user.Id, filter)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// changeMyEmail changes the logged in user's email
+//
+//	@Summary		change my email
+//	@Description	change the email the logged in user logs in with. The current password must be given.
+//	@Tags			me
+//	@Accept			json
+//	@Produce		json
+//	@Param			change	body		emailChangeRequest	true	"new email and current password"
+//	@Success		200		{object}	database.User		"successfully changed the email"
+//	@Header			200		{string}	ETag				"new version of the user"
+//	@Failure		400		{object}	problem				"malformed_body or validation_failed"
+//	@Failure		403		{object}	problem				"incorrect_password"
+//	@Failure		409		{object}	problem				"email_already_registered"
+//	@Failure		412		{object}	problem				"precondition_failed"
+//	@Failure		500		{object}	problem				"internal_error"
+//	@Router			/api/v1/me/email [post]
+//	@Security		CookieAuth
+func (app *application) changeMyEmail(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+
+	var request emailChangeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if !app.checkCurrentPassword(c, user, request.Current_Password) {
+		return
+	}
+
+	updated := *user
+	updated.Email = request.Email
+
+	if err := app.models.Users.UpdateUser(&updated); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeEmailAlreadyRegistered, "A user with this email is already registered.")
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "user.email_change", Target_Type: auditTargetUser, Target_Id: user.Id}, user, &updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// changeMyPassword changes the logged in user's password
+//
+//	@Summary		change my password
+//	@Description	change the logged in user's password. The current password must be given.
+//	@Tags			me
+//	@Accept			json
+//	@Param			change	body	passwordChangeRequest	true	"current and new password"
+//	@Success		204		"successfully changed the password"
+//	@Failure		400		{object}	problem	"malformed_body or validation_failed"
+//	@Failure		403		{object}	problem	"incorrect_password"
+//	@Failure		412		{object}	problem	"precondition_failed"
+//	@Failure		500		{object}	problem	"internal_error"
+//	@Router			/api/v1/me/password [post]
+//	@Security		CookieAuth
+func (app *application) changeMyPassword(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+
+	var request passwordChangeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if !app.checkCurrentPassword(c, user, request.Current_Password) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.New_Password), bcrypt.DefaultCost)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	updated := *user
+	updated.Password = string(hashedPassword)
+
+	if err := app.models.Users.UpdateUser(&updated); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "user.password_change", Target_Type: auditTargetUser, Target_Id: user.Id}, nil, nil)
+
+	setETag(c, updated.Version)
+	c.Status(http.StatusNoContent)
+}
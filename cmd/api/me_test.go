@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMe_Orders(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	makeStockedBook(admin, ts.URL+"/api/v1", "3", "5")
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+
+	for range 2 {
+		doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":1}`)
+		resp, _ := doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	resp, body := doRequest(customer, http.MethodGet, ts.URL+"/api/v1/me", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "user1@gmail.com", testutils.StringToJSON(body)["email"])
+
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/me/orders?status=Pending", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	orders := testutils.StringToJSONArray(body)
+	require.Len(t, orders, 2)
+	assert.Equal(t, float64(2), orders[0]["id"])
+	assert.NotEmpty(t, orders[0]["created_at"])
+
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/me/orders?limit=1&page=2", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	orders = testutils.StringToJSONArray(body)
+	require.Len(t, orders, 1)
+	assert.Equal(t, float64(1), orders[0]["id"])
+
+	_, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/me/orders?status=Paid", "")
+	assert.Empty(t, testutils.StringToJSONArray(body))
+
+	_, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/me/orders?from=2999-01-01T00:00:00Z", "")
+	assert.Empty(t, testutils.StringToJSONArray(body))
+
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/me/orders?from=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidQuery, testutils.StringToJSON(body)["code"])
+
+	// the admin has no orders of their own and cannot see the customer's here
+	_, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/me/orders", "")
+	assert.Empty(t, testutils.StringToJSONArray(body))
+}
+
+func TestMe_ChangeEmailAndPassword(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+
+	resp, body := doRequest(customer, http.MethodPost, ts.URL+"/api/v1/me/email", `{"email":"new@gmail.com", "current_password":"wrong"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, codeIncorrectPassword, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/me/email", `{"email":"new@gmail.com", "current_password":"password1"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "new@gmail.com", testutils.StringToJSON(body)["email"])
+
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/me/password", `{"current_password":"password1", "new_password":"short"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/me/password", `{"current_password":"password1", "new_password":"password2"}`)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/auth/login", `{"email":"new@gmail.com", "password":"password1"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/auth/login", `{"email":"new@gmail.com", "password":"password2"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
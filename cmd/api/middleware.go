@@ -1,52 +1,102 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const requestIdHeader = "X-Request-ID"
+
+// RequestIdMiddleware tags every request with an id, reusing the caller's
+// X-Request-ID when present, so client reports can be matched to server logs.
+func (app *application) RequestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(requestIdHeader)
+		if requestId == "" || len(requestId) > 128 {
+			buf := make([]byte, 16)
+			_, _ = rand.Read(buf)
+			requestId = hex.EncodeToString(buf)
+		}
+
+		c.Set("requestId", requestId)
+		c.Header(requestIdHeader, requestId)
+
+		c.Next()
+	}
+}
+
 func (app *application) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		cookie, err := c.Cookie("auth_token")
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
-			c.Abort()
+			app.errorResponse(c, http.StatusUnauthorized, codeUnauthenticated, "Authentication is required to access this resource.")
 			return
 		}
 
-		token, err := jwt.Parse(cookie, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(app.jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
+		if app.authenticate(c, cookie) {
+			c.Next()
 		}
+	}
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
+// OptionalAuthMiddleware sets the user like AuthMiddleware when an auth token
+// is sent but lets anonymous requests through.
+func (app *application) OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cookie, err := c.Cookie("auth_token")
+		if err != nil {
+			c.Next()
 			return
 		}
 
-		userId := claims["userId"].(float64)
-		user, err := app.models.Users.GetUserById(int(userId))
+		if app.authenticate(c, cookie) {
+			c.Next()
+		}
+	}
+}
 
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unathorized access"})
-			c.Abort()
-			return
+// authenticate validates the auth token and stores its user in the context.
+// It aborts the request and returns false if the token is not usable.
+func (app *application) authenticate(c *gin.Context, cookie string) bool {
+	token, err := jwt.Parse(cookie, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
 		}
+		return []byte(app.config.SecretKey), nil
+	})
 
-		c.Set("user", user)
+	if err != nil || !token.Valid {
+		app.errorResponse(c, http.StatusUnauthorized, codeInvalidToken, "The auth token is invalid or has expired.")
+		return false
+	}
 
-		c.Next()
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		app.errorResponse(c, http.StatusUnauthorized, codeInvalidToken, "The auth token is invalid or has expired.")
+		return false
 	}
+
+	userId, ok := claims["userId"].(float64)
+	if !ok {
+		app.errorResponse(c, http.StatusUnauthorized, codeInvalidToken, "The auth token is invalid or has expired.")
+		return false
+	}
+
+	user, err := app.models.Users.GetUserById(int(userId))
+	if err != nil {
+		app.serverError(c, err)
+		return false
+	}
+
+	if user == nil {
+		app.errorResponse(c, http.StatusUnauthorized, codeInvalidToken, "The user for this auth token no longer exists.")
+		return false
+	}
+
+	c.Set("user", user)
+	return true
 }
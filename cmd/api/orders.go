@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/promotion"
 )
 
 // createOrder creates an order
@@ -15,33 +21,82 @@ import (
 //	@Tags			order
 //	@Accept			json
 //	@Produce		json
-//	@Param			order	body		database.Order	true	"new order to add to db"
-//	@Success		201		{object}	database.Order	"successfully created an order"
-//	@Failure		403		{object}	gin.H			"wrong role"
-//	@Failure		400		{object}	gin.H			"error binding JSON"
-//	@Failure		500		{object}	gin.H			"error creating order"
+//	@Param			order				body		database.Order	true	"new order to add to db"
+//	@Param			currency			query		string			false	"currency to place the order in, converting the total at the current rate"
+//	@Param			code				query		[]string		false	"promotion codes to apply to the total"	collectionFormat(multi)
+//	@Param			shipping_address	query		int				false	"id of the address to ship to; defaults to the default address"
+//	@Param			billing_address		query		int				false	"id of the billing address; defaults to the shipping address"
+//	@Param			Idempotency-Key		header		string			false	"key that makes retries of this request safe"
+//	@Success		201					{object}	database.Order	"successfully created an order"
+//	@Failure		403					{object}	problem			"forbidden"
+//	@Failure		400					{object}	problem			"malformed_body, validation_failed or invalid_query"
+//	@Failure		404					{object}	problem			"address_not_found"
+//	@Failure		409					{object}	problem			"idempotency_key_in_use"
+//	@Failure		422					{object}	problem			"idempotency_key_reused, exchange_rate_unavailable or promotion_not_applicable"
+//	@Failure		500					{object}	problem			"internal_error"
 //	@Router			/api/v1/orders [post]
 //	@Security		CookieAuth
 func (app *application) createOrder(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Customer" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to create an order"})
+		app.forbidden(c, "Only customers can create orders.")
+		return
+	}
+
+	currency, ok := app.requestedCurrency(c)
+	if !ok {
+		return
+	}
+
+	codes, ok := app.requestedPromotionCodes(c)
+	if !ok {
 		return
 	}
 
 	var order database.Order
 
 	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.bindingError(c, err)
 		return
 	}
 
-	err := app.models.Orders.CreateOrder(&order)
+	order.KeepComputedFields(&database.Order{})
+	if order.Shipping_Address, order.Billing_Address, ok = app.requestedAddresses(c, user.Id); !ok {
+		return
+	}
+	if currency != "" && currency != order.Total_Price.Currency {
+		rate, err := app.models.ExchangeRates.FindExchangeRate(order.Total_Price.Currency, currency, time.Now())
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+		if rate == nil {
+			app.exchangeRateUnavailable(c, &database.ExchangeRateError{From: order.Total_Price.Currency, To: currency})
+			return
+		}
+		if order.Total_Price, err = rate.Convert(order.Total_Price); err != nil {
+			app.serverError(c, err)
+			return
+		}
+		order.Exchange_Rate_From, order.Exchange_Rate = rate.From, rate.Rate
+	}
+
+	err := app.models.Orders.CreateOrder(&order, codes)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create order"})
+		var promoErr *promotion.NotApplicableError
+		if errors.As(err, &promoErr) {
+			app.promotionNotApplicable(c, promoErr)
+			return
+		}
+		app.serverError(c, err)
 		return
 	}
 
+	app.recordOrderEvent(c, &database.OrderEvent{Order_Id: order.Id, Type: database.OrderEventCreated})
+
+	app.audit(c, &database.AuditEvent{Action: "order.create", Target_Type: auditTargetOrder, Target_Id: order.Id}, nil, order)
+
+	setETag(c, order.Version)
 	c.JSON(http.StatusCreated, order)
 }
 
@@ -55,14 +110,14 @@ func (app *application) createOrder(c *gin.Context) {
 //	@Param			page	query		int				false	"page number to request"
 //	@Param			limit	query		int				false	"max number of orders to return per page"
 //	@Success		200		{array}		database.Order	"successfully got a page of orders"
-//	@Failure		500		{object}	gin.H			"error getting a page"
-//	@Failure		403		{object}	gin.H			"wrong role"
+//	@Failure		500		{object}	problem			"internal_error"
+//	@Failure		403		{object}	problem			"forbidden"
 //	@Router			/api/v1/orders [get]
 //	@Security		CookieAuth
 func (app *application) getPageOfOrders(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to get a page of orders"})
+		app.forbidden(c, "Only admins can list orders.")
 		return
 	}
 
@@ -72,50 +127,60 @@ func (app *application) getPageOfOrders(c *gin.Context) {
 	orders, err := app.models.Orders.GetPageOfOrders(limit, page)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to get all orders page by page."})
+		app.serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, orders)
 }
 
-// getAllOrders gets all orders
+// getAllOrders exports all orders
 //
-//	@Summary		gets all orders
-//	@Description	gets all orders
+//	@Summary		exports all orders
+//	@Description	streams every order as a JSON array, JSON Lines, CSV or Parquet, chosen by the format parameter or else the Accept header. JSON and JSON Lines carry orders as the API returns them; CSV and Parquet carry flat rows with amounts in minor units.
 //	@Tags			order
-//	@Accept			json
-//	@Produce		json
-//	@Success		200	{array}		database.Order	"successfully got all Orders"
-//	@Failure		500	{object}	gin.H			"error getting all Orders"
-//	@Failure		403	{object}	gin.H			"wrong role"
+//	@Produce		json,text/csv,application/x-ndjson,application/vnd.apache.parquet
+//	@Param			format	query		string			false	"json, ndjson, csv or parquet"
+//	@Param			status	query		string			false	"only orders with this status"
+//	@Param			from	query		string			false	"only orders placed at or after this time, RFC 3339"
+//	@Param			to		query		string			false	"only orders placed before this time, RFC 3339"
+//	@Success		200		{array}		database.Order	"successfully exported the orders"
+//	@Failure		400		{object}	problem			"invalid_query"
+//	@Failure		403		{object}	problem			"forbidden"
+//	@Failure		500		{object}	problem			"internal_error"
 //	@Router			/api/v2/orders/all [get]
 //	@Security		CookieAuth
 func (app *application) getAllOrders(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to get all orders"})
+		app.forbidden(c, "Only admins can list all orders.")
 		return
 	}
 
-	limit := 3
-	page := 1
-	var allOrders []*database.Order
-	for {
-		orders, err := app.models.Orders.GetPageOfOrders(limit, page)
+	filter := database.OrderFilter{Status: c.Query("status")}
+
+	times := []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	}
+	for _, param := range times {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to get all orders page by page."})
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%s must be an RFC 3339 time such as 2024-01-02T15:04:05Z.", param.name))
 			return
 		}
-
-		allOrders = append(allOrders, orders...)
-		if len(orders) < limit {
-			break
-		}
-		page++
-
+		*param.dst = t
 	}
 
-	c.JSON(http.StatusOK, allOrders)
+	streamExport(app, c, "orders", func(ctx context.Context, fn func(*database.Order) error) error {
+		return app.models.Orders.StreamOrders(ctx, filter, fn)
+	}, newOrderRecord)
 }
 
 // getOrder get one order
@@ -125,43 +190,59 @@ func (app *application) getAllOrders(c *gin.Context) {
 //	@Tags			order
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	query		int				true	"id of order to get"
-//	@Success		200	{object}	database.Order	"successfully got an order"
-//	@Failure		400	{object}	gin.H			"invalid order id"
-//	@Failure		404	{object}	gin.H			"order not found with this id"
-//	@Failure		500	{object}	gin.H			"error getting order"
-//	@Failure		403	{object}	gin.H			"wrong role/unauthorized"
+//	@Param			id				query		int				true	"id of order to get"
+//	@Param			If-None-Match	header		string			false	"ETag from a previous response"
+//	@Success		200				{object}	database.Order	"successfully got an order"
+//	@Header			200				{string}	ETag			"version of the order"
+//	@Success		304				"order has not changed"
+//	@Failure		400				{object}	problem	"invalid_id"
+//	@Failure		404				{object}	problem	"order_not_found"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Failure		403				{object}	problem	"forbidden"
 //	@Router			/api/v1/orders/:id [get]
 //	@Security		CookieAuth
 func (app *application) getOrder(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Customer" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to get an order"})
+		app.forbidden(c, "Only customers can get their orders.")
 		return
 	}
 	id, err := strconv.Atoi(c.Param("id"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		app.invalidId(c, "The order id must be an integer.")
 		return
 	}
 
-	order, err := app.models.Orders.GetOrder(id)
+	order, err := app.models.Orders.GetOrderForUser(id, user.Id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get this user's order"})
+		app.serverError(c, err)
 		return
 	}
 
 	if order == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found to get"})
+		app.errorResponse(c, http.StatusNotFound, codeOrderNotFound, fmt.Sprintf("No order exists with id %d.", id))
 		return
 	}
 
-	if order.User_Id != user.Id {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to get this order"})
+	if app.notModified(c, order.Version) {
 		return
 	}
 
+	if order.Tax_Region != "" {
+		if order.Tax_Lines, err = app.models.Orders.GetOrderTaxLines(order.Id); err != nil {
+			app.serverError(c, err)
+			return
+		}
+	}
+
+	if order.Discount_Total.Currency != "" {
+		if order.Discounts, err = app.models.Orders.GetOrderDiscounts(order.Id); err != nil {
+			app.serverError(c, err)
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, order)
 
 }
@@ -173,107 +254,345 @@ func (app *application) getOrder(c *gin.Context) {
 //	@Tags			order
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	query	int	true	"id of order to delete"
-//	@Success		204	"successfully deleted"
-//	@Failure		403	{object}	gin.H	"wrong role"
-//	@Failure		400	{object}	gin.H	"invalid id"
-//	@Failure		500	{object}	gin.H	"error deleting order"
+//	@Param			id			query	int		true	"id of order to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the order"
+//	@Success		204			"successfully deleted"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		404			{object}	problem	"order_not_found"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
 //	@Router			/api/v1/orders/:id [delete]
 //	@Security		CookieAuth
 func (app *application) deleteOrder(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to create an order"})
+		app.forbidden(c, "Only admins can delete orders.")
 		return
 	}
 	id, err := strconv.Atoi(c.Param("id"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		app.invalidId(c, "The order id must be an integer.")
 		return
 	}
 
 	existingOrder, err := app.models.Orders.GetOrder(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order to delete"})
+		app.serverError(c, err)
 		return
 	}
 
 	if existingOrder == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found to delete"})
+		app.errorResponse(c, http.StatusNotFound, codeOrderNotFound, fmt.Sprintf("No order exists with id %d.", id))
 		return
 	}
 
-	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to delete this order"})
+	if !app.checkIfMatch(c, existingOrder.Version) {
 		return
 	}
 
-	if err := app.models.Orders.DeleteOrder(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete order"})
+	if err := app.models.Orders.DeleteOrder(id, existingOrder.Version); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
 		return
 	}
 
+	app.audit(c, &database.AuditEvent{Action: "order.delete", Target_Type: auditTargetOrder, Target_Id: id}, existingOrder, nil)
+
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// restoreOrder restores a deleted order
+//
+//	@Summary		restore order
+//	@Description	restore a deleted order by id
+//	@Tags			order
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	query		int				true	"id of order to restore"
+//	@Success		200	{object}	database.Order	"successfully restored a order"
+//	@Header			200	{string}	ETag			"new version of the order"
+//	@Failure		403	{object}	problem			"forbidden"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		404	{object}	problem			"order_not_found"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/orders/:id/restore [post]
+//	@Security		CookieAuth
+func (app *application) restoreOrder(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can restore orders.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The order id must be an integer.")
+		return
+	}
+
+	order, err := app.models.Orders.RestoreOrder(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if order == nil {
+		app.errorResponse(c, http.StatusNotFound, codeOrderNotFound, fmt.Sprintf("No deleted order exists with id %d.", id))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "order.restore", Target_Type: auditTargetOrder, Target_Id: id}, nil, order)
+
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
 // updateOrder updates an order
 //
 //	@Summary		update an order
-//	@Description	update an order by id
+//	@Description	cancel one of the customer's pending orders by setting its status to Cancelled, which puts its books back in stock. The user and total price cannot be changed, and other statuses are set by payments, shipments and refunds.
 //	@Tags			order
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		query		int				true	"id of order to update"
-//	@Param			order	body		database.Order	true	"updated order data"
-//	@Success		200		{object}	database.Order	"successfully updated a order"
-//	@Failure		403		{object}	gin.H			"wrong role/unauthorized"
-//	@Failure		400		{object}	gin.H			"invalid id"
-//	@Failure		500		{object}	gin.H			"error getting order"
-//	@Failure		404		{object}	gin.H			"order to update not found"
-//	@Failure		400		{object}	gin.H			"error binding JSON"
-//	@Failure		500		{object}	gin.H			"failed to update order"
+//	@Param			id			query		int				true	"id of order to update"
+//	@Param			If-Match	header		string			true	"current ETag of the order"
+//	@Param			order		body		database.Order	true	"updated order data"
+//	@Success		200			{object}	database.Order	"successfully updated a order"
+//	@Header			200			{string}	ETag			"new version of the order"
+//	@Failure		403			{object}	problem			"forbidden"
+//	@Failure		400			{object}	problem			"invalid_id, malformed_body or validation_failed"
+//	@Failure		404			{object}	problem			"order_not_found"
+//	@Failure		409			{object}	problem			"order_not_cancellable"
+//	@Failure		412			{object}	problem			"precondition_failed"
+//	@Failure		422			{object}	problem			"order_read_only"
+//	@Failure		428			{object}	problem			"precondition_required"
+//	@Failure		500			{object}	problem			"internal_error"
 //	@Router			/api/v1/orders/:id [put]
 //	@Security		CookieAuth
 func (app *application) updateOrder(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Customer" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to update an order"})
+		app.forbidden(c, "Only customers can update their orders.")
 		return
 	}
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		app.invalidId(c, "The order id must be an integer.")
 		return
 	}
 
 	existingOrder, err := app.models.Orders.GetOrder(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order to update"})
+		app.serverError(c, err)
 		return
 	}
 
 	if existingOrder == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found to update"})
+		app.errorResponse(c, http.StatusNotFound, codeOrderNotFound, fmt.Sprintf("No order exists with id %d.", id))
 		return
 	}
 
 	if existingOrder.User_Id != user.Id {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to update this order"})
+		app.forbidden(c, "This order belongs to another user.")
+		return
+	}
+
+	if !app.checkIfMatch(c, existingOrder.Version) {
 		return
 	}
 
 	updatedOrder := &database.Order{}
 	if err := c.ShouldBindJSON(updatedOrder); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.bindingError(c, err)
+		return
+	}
+
+	app.changeOrder(c, existingOrder, updatedOrder, "order.update")
+}
+
+// patchOrder partially updates an order
+//
+//	@Summary		partially update an order
+//	@Description	cancel one of the customer's pending orders with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902) that sets its status to Cancelled. The user and total price cannot be changed, and other statuses are set by payments, shipments and refunds.
+//	@Tags			order
+//	@Accept			application/merge-patch+json,application/json-patch+json
+//	@Produce		json
+//	@Param			id			query		int				true	"id of order to update"
+//	@Param			If-Match	header		string			true	"current ETag of the order"
+//	@Param			patch		body		object			true	"merge patch or JSON patch document"
+//	@Success		200			{object}	database.Order	"successfully updated an order"
+//	@Header			200			{string}	ETag			"new version of the order"
+//	@Failure		403			{object}	problem			"forbidden"
+//	@Failure		400			{object}	problem			"invalid_id, malformed_body, invalid_patch or validation_failed"
+//	@Failure		404			{object}	problem			"order_not_found"
+//	@Failure		409			{object}	problem			"patch_test_failed or order_not_cancellable"
+//	@Failure		412			{object}	problem			"precondition_failed"
+//	@Failure		415			{object}	problem			"unsupported_media_type"
+//	@Failure		422			{object}	problem			"order_read_only"
+//	@Failure		428			{object}	problem			"precondition_required"
+//	@Failure		500			{object}	problem			"internal_error"
+//	@Router			/api/v1/orders/:id [patch]
+//	@Security		CookieAuth
+func (app *application) patchOrder(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Customer" {
+		app.forbidden(c, "Only customers can update their orders.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The order id must be an integer.")
+		return
+	}
+
+	existingOrder, err := app.models.Orders.GetOrder(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if existingOrder == nil {
+		app.errorResponse(c, http.StatusNotFound, codeOrderNotFound, fmt.Sprintf("No order exists with id %d.", id))
+		return
+	}
+
+	if existingOrder.User_Id != user.Id {
+		app.forbidden(c, "This order belongs to another user.")
+		return
+	}
+
+	if !app.checkIfMatch(c, existingOrder.Version) {
+		return
+	}
+
+	patchedOrder := &database.Order{}
+	if !app.applyPatch(c, existingOrder, patchedOrder) {
+		return
+	}
+
+	app.changeOrder(c, existingOrder, patchedOrder, "order.patch")
+}
+
+// changeOrder applies a customer's change to their order and responds with
+// the order. The only change a customer can make is to cancel a pending
+// order; the user and total are set at checkout and every other status
+// follows from payments, shipments and refunds.
+func (app *application) changeOrder(c *gin.Context, existing *database.Order, changed *database.Order, action string) {
+	if changed.User_Id != existing.User_Id || changed.Total_Price != existing.Total_Price {
+		app.errorResponse(c, http.StatusUnprocessableEntity, codeOrderReadOnly, "The user and total price of an order cannot be changed.")
+		return
+	}
+
+	if changed.Status == existing.Status {
+		setETag(c, existing.Version)
+		c.JSON(http.StatusOK, existing)
 		return
 	}
 
-	updatedOrder.Id = id
+	if changed.Status != database.OrderCancelled {
+		app.errorResponse(c, http.StatusUnprocessableEntity, codeOrderReadOnly, "An order can only be cancelled; its other statuses follow from payments, shipments and refunds.")
+		return
+	}
 
-	if err := app.models.Orders.UpdateOrder(updatedOrder); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+	if existing.Status != database.OrderPending {
+		app.errorResponse(c, http.StatusConflict, codeOrderNotCancellable, fmt.Sprintf("Only pending orders can be cancelled; the order is %s.", existing.Status))
 		return
 	}
-	c.JSON(http.StatusOK, updatedOrder)
+
+	cancelled := *existing
+	cancelled.Status = database.OrderCancelled
+
+	var err error
+	if cancelled.Version, err = app.models.Orders.CancelOrder(existing.Id, existing.Version); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: action, Target_Type: auditTargetOrder, Target_Id: existing.Id}, existing, &cancelled)
+
+	setETag(c, cancelled.Version)
+	c.JSON(http.StatusOK, cancelled)
+}
+
+// getOrderHistory gets the history of an order
+//
+//	@Summary		get order history
+//	@Description	get the timeline of an order: creation, payments, refunds and returns, oldest first
+//	@Tags			order
+//	@Produce		json
+//	@Param			id	query		int					true	"id of order"
+//	@Success		200	{array}		database.OrderEvent	"successfully got the history"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		403	{object}	problem				"forbidden"
+//	@Failure		404	{object}	problem				"order_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/orders/:id/history [get]
+//	@Security		CookieAuth
+func (app *application) getOrderHistory(c *gin.Context) {
+	order := app.getVisibleOrder(c)
+	if order == nil {
+		return
+	}
+
+	events, err := app.models.OrderEvents.GetOrderEvents(order.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// getVisibleOrder loads the order for an admin or for the customer it belongs
+// to. It returns nil if the request was aborted.
+func (app *application) getVisibleOrder(c *gin.Context) *database.Order {
+	user := app.GetUserFromContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The order id must be an integer.")
+		return nil
+	}
+
+	var order *database.Order
+	if user.Role == "Admin" {
+		order, err = app.models.Orders.GetOrder(id)
+	} else {
+		order, err = app.models.Orders.GetOrderForUser(id, user.Id)
+	}
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if order == nil {
+		app.errorResponse(c, http.StatusNotFound, codeOrderNotFound, fmt.Sprintf("No order exists with id %d.", id))
+		return nil
+	}
+
+	return order
+}
+
+// recordOrderEvent adds an event to the order's history on behalf of the
+// current user. History is informational, so a failure is logged rather than
+// failing a request whose change has already been made.
+func (app *application) recordOrderEvent(c *gin.Context, event *database.OrderEvent) {
+	if event.Actor_Id == 0 {
+		event.Actor_Id = app.GetUserFromContext(c).Id
+	}
+
+	if err := app.models.OrderEvents.CreateOrderEvent(event); err != nil {
+		log.Printf("request_id=%s recording %s for order %d: %v", requestIdFromContext(c), event.Type, event.Order_Id, err)
+	}
 }
@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/golang-migrate/migrate/source/file"
@@ -18,6 +19,7 @@ import (
 	"github.com/hamorrar/bookstore/internal/testutils"
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateOrder(t *testing.T) {
@@ -39,7 +41,7 @@ func TestCreateOrder(t *testing.T) {
 	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
 	testutils.LoginCustomer(client, ts.URL+"/api/v1")
 
-	payload := `{"user_id":1, "status":"Pending","total_price":1}`
+	payload := `{"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
 
 	resp, err := client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
@@ -54,7 +56,7 @@ func TestCreateOrder(t *testing.T) {
 
 	defer resp.Body.Close()
 
-	expected := `{"id":1,"user_id":1, "status":"Pending","total_price":1}`
+	expected := `{"id":1,"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -98,7 +100,7 @@ func TestGetOrder(t *testing.T) {
 
 	defer resp.Body.Close()
 
-	expected := `{"id":1,"user_id":1, "status":"Pending","total_price":1}`
+	expected := `{"id":1,"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -118,40 +120,48 @@ func TestUpdateOrder(t *testing.T) {
 	authGroup.Use(app.AuthMiddleware())
 	authGroup.POST("/orders", app.createOrder)
 	authGroup.PUT("/orders/:id", app.updateOrder)
+	authGroup.PATCH("/orders/:id", app.patchOrder)
 
 	ts := httptest.NewServer(router)
+	defer ts.Close()
 	jar, _ := cookiejar.New(nil)
 	client := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
 
-	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
-	testutils.LoginCustomer(client, ts.URL+"/api/v1")
-	testutils.MakeAnOrder(client, ts.URL+"/api/v1")
-
-	payload := `{"user_id":1, "status":"Sold","total_price":1}`
-	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/orders/1", strings.NewReader(payload))
-	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return
-	}
+	testutils.RegisterCustomer(client, url)
+	testutils.LoginCustomer(client, url)
+	testutils.MakeAnOrder(client, url)
 
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalln("fatal request", err.Error())
-	}
-	defer ts.Close()
+	// customers cannot mark their orders paid or sold, or change the total
+	resp, body := doIfMatch(client, http.MethodPut, url+"/orders/1", `"1"`, `{"user_id":1, "status":"Sold","total_price":{"amount":1,"currency":"USD"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeOrderReadOnly, testutils.StringToJSON(body)["code"])
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-	defer resp.Body.Close()
+	resp, body = doIfMatch(client, http.MethodPatch, url+"/orders/1", `"1"`, `{"total_price":{"amount":0,"currency":"USD"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeOrderReadOnly, testutils.StringToJSON(body)["code"])
 
-	expected := `{"id":1,"user_id":1, "status":"Sold","total_price":1}`
-	got := testutils.StringToJSON(string(bodyBytes))
-	want := testutils.StringToJSON(expected)
+	resp, body = doIfMatch(client, http.MethodPatch, url+"/orders/1", `"1"`, `{"user_id":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeOrderReadOnly, testutils.StringToJSON(body)["code"])
 
-	assert.Equal(t, want, got)
+	// but they can cancel a pending order
+	resp, body = doIfMatch(client, http.MethodPut, url+"/orders/1", `"1"`, `{"user_id":1, "status":"Cancelled","total_price":{"amount":1,"currency":"USD"}}`)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	expected := `{"id":1,"user_id":1, "status":"Cancelled","total_price":{"amount":1,"currency":"USD"}}`
+	assert.Equal(t, testutils.StringToJSON(expected), testutils.StringToJSON(body))
+
+	resp, body = doIfMatch(client, http.MethodPatch, url+"/orders/1", `"2"`, `{"status":"Pending"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeOrderReadOnly, testutils.StringToJSON(body)["code"])
+
+	testutils.MakeAnOrder(client, url)
+	_, err := app.models.Orders.DB.Exec("update orders set order_status = 'Paid' where order_id = 2")
+	require.NoError(t, err)
+	resp, body = doIfMatch(client, http.MethodPatch, url+"/orders/2", `"1"`, `{"status":"Cancelled"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeOrderNotCancellable, testutils.StringToJSON(body)["code"])
 }
 
 func TestUpdateOrder_Wrong_Role(t *testing.T) {
@@ -178,7 +188,7 @@ func TestUpdateOrder_Wrong_Role(t *testing.T) {
 	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
 	testutils.LoginAdmin(client, ts.URL+"/api/v1")
 
-	payload := `{"user_id":1, "status":"Sold","total_price":1}`
+	payload := `{"user_id":1, "status":"Sold","total_price":{"amount":1,"currency":"USD"}}`
 	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/orders/1", strings.NewReader(payload))
 	if err != nil {
 		fmt.Printf("Error creating request: %v\n", err)
@@ -197,7 +207,7 @@ func TestUpdateOrder_Wrong_Role(t *testing.T) {
 	}
 	defer resp.Body.Close()
 
-	expected := `{"error":"Unauthorized to update an order"}`
+	expected := `{"type":"about:blank","title":"Forbidden","status":403,"detail":"Only customers can update their orders.","instance":"/api/v1/orders/1","code":"forbidden"}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -225,25 +235,25 @@ func TestGetPageofOrders(t *testing.T) {
 	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
 	testutils.LoginCustomer(client, ts.URL+"/api/v1")
 
-	payload := `{"user_id":1, "status":"Pending","total_price":1}`
+	payload := `{"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
 	_, err := client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":2}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":2,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":3}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":3,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":4}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":4,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -270,7 +280,7 @@ func TestGetPageofOrders(t *testing.T) {
 		fmt.Println("unmarshalling error while test getting page", err.Error())
 	}
 
-	expected := `[{"id":1, "user_id":1, "status":"Pending","total_price":1}, {"id":2, "user_id":1, "status":"Pending","total_price":2}]`
+	expected := `[{"id":1, "user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}, {"id":2, "user_id":1, "status":"Pending","total_price":{"amount":2,"currency":"USD"}}]`
 
 	var want []database.Order
 	if err := json.Unmarshal([]byte(expected), &want); err != nil {
@@ -301,25 +311,25 @@ func TestGetOrder_Params(t *testing.T) {
 	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
 	testutils.LoginCustomer(client, ts.URL+"/api/v1")
 
-	payload := `{"user_id":1, "status":"Pending","total_price":1}`
+	payload := `{"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
 	_, err := client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":2}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":2,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":3}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":3,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":4}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":4,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -346,7 +356,7 @@ func TestGetOrder_Params(t *testing.T) {
 		fmt.Println("unmarshalling error while test getting page", err.Error())
 	}
 
-	expected := `[{"id":3, "user_id":1, "status":"Pending","total_price":3}, {"id":4, "user_id":1, "status":"Pending","total_price":4}]`
+	expected := `[{"id":3, "user_id":1, "status":"Pending","total_price":{"amount":3,"currency":"USD"}}, {"id":4, "user_id":1, "status":"Pending","total_price":{"amount":4,"currency":"USD"}}]`
 
 	var want []database.Order
 	if err := json.Unmarshal([]byte(expected), &want); err != nil {
@@ -386,6 +396,7 @@ func TestDeleteOrder(t *testing.T) {
 		fmt.Printf("Error creating request: %v\n", err)
 		return
 	}
+	req.Header.Set("If-Match", `"1"`)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -431,25 +442,25 @@ func TestGetAllOrders(t *testing.T) {
 	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
 	testutils.LoginCustomer(client, ts.URL+"/api/v1")
 
-	payload := `{"user_id":1, "status":"Pending","total_price":1}`
+	payload := `{"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
 	_, err := client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":2}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":2,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":3}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":3,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	payload = `{"user_id":1, "status":"Pending","total_price":4}`
+	payload = `{"user_id":1, "status":"Pending","total_price":{"amount":4,"currency":"USD"}}`
 	_, err = client.Post(ts.URL+"/api/v1/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -476,13 +487,18 @@ func TestGetAllOrders(t *testing.T) {
 		fmt.Println("unmarshalling error while test getting page", err.Error())
 	}
 
-	expected := `[{"id":1, "user_id":1, "status":"Pending","total_price":1}, {"id":2, "user_id":1, "status":"Pending","total_price":2}, {"id":3, "user_id":1, "status":"Pending","total_price":3}, {"id":4, "user_id":1, "status":"Pending","total_price":4}]`
+	expected := `[{"id":1, "user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}, {"id":2, "user_id":1, "status":"Pending","total_price":{"amount":2,"currency":"USD"}}, {"id":3, "user_id":1, "status":"Pending","total_price":{"amount":3,"currency":"USD"}}, {"id":4, "user_id":1, "status":"Pending","total_price":{"amount":4,"currency":"USD"}}]`
 
 	var want []database.Order
 	if err := json.Unmarshal([]byte(expected), &want); err != nil {
 		fmt.Println("unmarshalling error while test getting page", err.Error())
 	}
 
+	// the export includes when each order was placed
+	for i := range got {
+		assert.False(t, got[i].Created_At.IsZero())
+		got[i].Created_At = time.Time{}
+	}
 	assert.Equal(t, want, got)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// maxPatchBodyBytes bounds PATCH documents, which are read in full before
+// they are applied.
+const maxPatchBodyBytes = 1 << 20
+
+// applyPatch applies the request body to current and decodes the patched
+// document into target, which is then validated with the same binding rules
+// as a full update. Merge patches (RFC 7396) are used for
+// application/merge-patch+json and application/json, and JSON patches
+// (RFC 6902) for application/json-patch+json. It writes the error response
+// and returns false if the patch can not be applied.
+func (app *application) applyPatch(c *gin.Context, current any, target any) bool {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPatchBodyBytes+1))
+	if err != nil {
+		app.bindingError(c, err)
+		return false
+	}
+	if len(body) > maxPatchBodyBytes {
+		app.errorResponse(c, http.StatusRequestEntityTooLarge, codeBodyTooLarge, "The patch document is too large.")
+		return false
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		app.bindingError(c, io.EOF)
+		return false
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		app.serverError(c, err)
+		return false
+	}
+
+	var patched []byte
+	switch c.ContentType() {
+	case mergePatchContentType, binding.MIMEJSON:
+		if !json.Valid(body) {
+			app.errorResponse(c, http.StatusBadRequest, codeMalformedBody, "The request body is not valid JSON.")
+			return false
+		}
+		patched, err = jsonpatch.MergePatch(original, body)
+	case jsonPatchContentType:
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.DecodePatch(body)
+		if err == nil {
+			patched, err = patch.Apply(original)
+		}
+	default:
+		app.errorResponse(c, http.StatusUnsupportedMediaType, codeUnsupportedMediaType,
+			"PATCH requests must use "+mergePatchContentType+" or "+jsonPatchContentType+".")
+		return false
+	}
+
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			app.errorResponse(c, http.StatusConflict, codePatchTestFailed, "A test operation in the patch did not match the current resource.")
+			return false
+		}
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidPatch, "The patch document could not be applied: "+err.Error())
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		app.bindingError(c, err)
+		return false
+	}
+
+	if err := binding.Validator.ValidateStruct(target); err != nil {
+		app.bindingError(c, err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func patchBookRouter(app *application, existing *database.Book) *gin.Engine {
+	router := gin.Default()
+	router.PATCH("/books/1", func(c *gin.Context) {
+		patched := &database.Book{}
+		if !app.applyPatch(c, existing, patched) {
+			return
+		}
+		c.JSON(http.StatusOK, patched)
+	})
+	return router
+}
+
+func doPatch(router *gin.Engine, contentType string, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPatch, "/books/1", strings.NewReader(payload))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestApplyPatch(t *testing.T) {
+	app := &application{}
+	existing := &database.Book{Id: 1, Title: "Title1", Author: "First", Price: money.New(1, "USD")}
+	router := patchBookRouter(app, existing)
+
+	tests := []struct {
+		name        string
+		contentType string
+		payload     string
+		status      int
+		want        string
+	}{
+		{
+			name:        "merge patch",
+			contentType: mergePatchContentType,
+			payload:     `{"title":"Title11"}`,
+			status:      http.StatusOK,
+			want:        `{"id":1,"title":"Title11","author":"First","price":{"amount":1,"currency":"USD"},"stock":0}`,
+		},
+		{
+			name:        "plain json is a merge patch",
+			contentType: "application/json",
+			payload:     `{"price":{"amount":7,"currency":"USD"}}`,
+			status:      http.StatusOK,
+			want:        `{"id":1,"title":"Title1","author":"First","price":{"amount":7,"currency":"USD"},"stock":0}`,
+		},
+		{
+			name:        "json patch",
+			contentType: jsonPatchContentType,
+			payload:     `[{"op":"replace","path":"/author","value":"Second"}]`,
+			status:      http.StatusOK,
+			want:        `{"id":1,"title":"Title1","author":"Second","price":{"amount":1,"currency":"USD"},"stock":0}`,
+		},
+		{
+			name:        "merged result is validated",
+			contentType: mergePatchContentType,
+			payload:     `{"title":null}`,
+			status:      http.StatusBadRequest,
+			want:        `{"type":"about:blank","title":"Bad Request","status":400,"detail":"The request body failed validation.","instance":"/books/1","code":"validation_failed","errors":[{"field":"title","rule":"required","message":"is required"}]}`,
+		},
+		{
+			name:        "unknown field",
+			contentType: mergePatchContentType,
+			payload:     `{"isbn":"123"}`,
+			status:      http.StatusBadRequest,
+			want:        `{"type":"about:blank","title":"Bad Request","status":400,"detail":"The request body failed validation.","instance":"/books/1","code":"validation_failed","errors":[{"field":"isbn","rule":"unknown","message":"is not a known field"}]}`,
+		},
+		{
+			name:        "failed test operation",
+			contentType: jsonPatchContentType,
+			payload:     `[{"op":"test","path":"/title","value":"Other"},{"op":"replace","path":"/price/amount","value":2}]`,
+			status:      http.StatusConflict,
+			want:        `{"type":"about:blank","title":"Conflict","status":409,"detail":"A test operation in the patch did not match the current resource.","instance":"/books/1","code":"patch_test_failed"}`,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			payload:     `title=Title11`,
+			status:      http.StatusUnsupportedMediaType,
+			want:        `{"type":"about:blank","title":"Unsupported Media Type","status":415,"detail":"PATCH requests must use application/merge-patch+json or application/json-patch+json.","instance":"/books/1","code":"unsupported_media_type"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doPatch(router, tt.contentType, tt.payload)
+
+			got := testutils.StringToJSON(w.Body.String())
+			want := testutils.StringToJSON(tt.want)
+
+			assert.Equal(t, want, got)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	// the original is never modified
+	assert.Equal(t, &database.Book{Id: 1, Title: "Title1", Author: "First", Price: money.New(1, "USD")}, existing)
+}
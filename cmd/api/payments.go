@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/config"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/payment"
+)
+
+const maxWebhookBodyBytes = 64 << 10
+
+type payOrderRequest struct {
+	Payment_Method string `json:"payment_method" binding:"required,max=128"`
+}
+
+type refundPaymentRequest struct {
+	Amount money.Money `json:"amount" binding:"positive_money"`
+}
+
+// newPaymentProvider builds the provider named in the configuration.
+func newPaymentProvider(cfg *config.Config) payment.Provider {
+	secret := cfg.Payment.WebhookSecret
+	if secret == "" {
+		buf := make([]byte, 32)
+		_, _ = rand.Read(buf)
+		secret = hex.EncodeToString(buf)
+	}
+
+	fake := payment.NewFake(secret)
+	fake.WebhookURL = cfg.BaseURL + "/api/v1/payments/webhook"
+	return fake
+}
+
+// getOrderForCustomer loads the order if it belongs to the customer making
+// the request; other customers' orders are not found. It returns nil if the
+// request was aborted.
+func (app *application) getOrderForCustomer(c *gin.Context) *database.Order {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Customer" {
+		app.forbidden(c, "Only customers can pay for their orders.")
+		return nil
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The order id must be an integer.")
+		return nil
+	}
+
+	order, err := app.models.Orders.GetOrderForUser(id, user.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if order == nil {
+		app.errorResponse(c, http.StatusNotFound, codeOrderNotFound, fmt.Sprintf("No order exists with id %d.", id))
+		return nil
+	}
+
+	return order
+}
+
+// payOrder pays for an order
+//
+//	@Summary		pay for an order
+//	@Description	authorize and capture the order total with the payment provider. The order becomes Paid when the provider confirms the capture by webhook.
+//	@Tags			payment
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				query		int					true	"id of order to pay for"
+//	@Param			payment			body		payOrderRequest		true	"payment method from the provider"
+//	@Param			Idempotency-Key	header		string				false	"key that makes retries of this request safe"
+//	@Success		201				{object}	database.Payment	"successfully captured the payment"
+//	@Failure		400				{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		402				{object}	problem				"payment_declined"
+//	@Failure		403				{object}	problem				"forbidden"
+//	@Failure		404				{object}	problem				"order_not_found"
+//	@Failure		409				{object}	problem				"order_not_payable or idempotency_key_in_use"
+//	@Failure		422				{object}	problem				"idempotency_key_reused"
+//	@Failure		500				{object}	problem				"internal_error"
+//	@Failure		504				{object}	problem				"payment_provider_timeout"
+//	@Router			/api/v1/orders/:id/payments [post]
+//	@Security		CookieAuth
+func (app *application) payOrder(c *gin.Context) {
+	order := app.getOrderForCustomer(c)
+	if order == nil {
+		return
+	}
+
+	var request payOrderRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if order.Status != database.OrderPending {
+		app.errorResponse(c, http.StatusConflict, codeOrderNotPayable, fmt.Sprintf("The order is %s and cannot be paid for.", order.Status))
+		return
+	}
+
+	record := &database.Payment{
+		Order_Id: order.Id,
+		Provider: app.payments.Name(),
+		Amount:   order.Total_Price,
+	}
+
+	// The pending payment holds the order while the provider is asked, so a
+	// concurrent request cannot pay for it too.
+	if err := app.models.Payments.StartPayment(record, app.config.Payment.Timeout); err != nil {
+		if errors.Is(err, database.ErrOrderNotPayable) {
+			app.errorResponse(c, http.StatusConflict, codeOrderNotPayable, "The order has already been paid for or is being paid for.")
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.config.Payment.Timeout)
+	defer cancel()
+
+	result, err := app.payments.Authorize(ctx, payment.AuthorizeRequest{
+		Reference:      strconv.Itoa(order.Id),
+		Amount:         order.Total_Price,
+		Payment_Method: request.Payment_Method,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, payment.ErrDeclined):
+			record.Status = database.PaymentDeclined
+		default:
+			record.Status = database.PaymentFailed
+		}
+
+		record.Failure_Reason = err.Error()
+		if err := app.models.Payments.UpdatePayment(record); err != nil {
+			app.serverError(c, err)
+			return
+		}
+		app.audit(c, &database.AuditEvent{Action: "payment.create", Target_Type: auditTargetPayment, Target_Id: record.Id}, nil, record)
+		eventType := database.OrderEventPaymentDeclined
+		if record.Status == database.PaymentFailed {
+			eventType = database.OrderEventPaymentFailed
+		}
+		app.recordOrderEvent(c, &database.OrderEvent{Order_Id: order.Id, Type: eventType, Detail: record.Failure_Reason})
+		app.paymentError(c, err)
+		return
+	}
+
+	record.Provider_Payment_Id = result.Provider_Payment_Id
+	record.Status = string(result.Status)
+	if err := app.models.Payments.UpdatePayment(record); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	result, err = app.payments.Capture(ctx, record.Provider_Payment_Id, record.Amount)
+	if err != nil {
+		// The authorization stays in place and can be voided by an admin.
+		record.Failure_Reason = err.Error()
+		if err := app.models.Payments.UpdatePayment(record); err != nil {
+			log.Printf("request_id=%s saving payment %d: %v", requestIdFromContext(c), record.Id, err)
+		}
+		app.audit(c, &database.AuditEvent{Action: "payment.create", Target_Type: auditTargetPayment, Target_Id: record.Id}, nil, record)
+		app.paymentError(c, err)
+		return
+	}
+
+	record.Status = string(result.Status)
+	if err := app.models.Payments.UpdatePayment(record); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.recordOrderEvent(c, &database.OrderEvent{
+		Order_Id: order.Id,
+		Type:     database.OrderEventPaymentCaptured,
+		Detail:   fmt.Sprintf("captured %s with payment %d", record.Amount, record.Id),
+	})
+	app.audit(c, &database.AuditEvent{Action: "payment.create", Target_Type: auditTargetPayment, Target_Id: record.Id}, nil, record)
+	c.JSON(http.StatusCreated, record)
+}
+
+// paymentError responds to a failed provider call.
+func (app *application) paymentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, payment.ErrDeclined):
+		app.errorResponse(c, http.StatusPaymentRequired, codePaymentDeclined, "The payment was declined.")
+	case errors.Is(err, payment.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		app.errorResponse(c, http.StatusGatewayTimeout, codePaymentProviderTimeout, "The payment provider did not respond in time. Check the order's payments before retrying.")
+	default:
+		app.serverError(c, err)
+	}
+}
+
+// getOrderPayments lists the payments of an order
+//
+//	@Summary		get order payments
+//	@Description	list every payment attempt for an order
+//	@Tags			payment
+//	@Produce		json
+//	@Param			id	query		int					true	"id of order"
+//	@Success		200	{array}		database.Payment	"successfully got the payments"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		403	{object}	problem				"forbidden"
+//	@Failure		404	{object}	problem				"order_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/orders/:id/payments [get]
+//	@Security		CookieAuth
+func (app *application) getOrderPayments(c *gin.Context) {
+	order := app.getOrderForCustomer(c)
+	if order == nil {
+		return
+	}
+
+	payments, err := app.models.Payments.GetPaymentsForOrder(order.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payments)
+}
+
+// getPaymentForAdmin loads the payment for an admin only endpoint. It returns
+// nil if the request was aborted.
+func (app *application) getPaymentForAdmin(c *gin.Context, action string) *database.Payment {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, fmt.Sprintf("Only admins can %s payments.", action))
+		return nil
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The payment id must be an integer.")
+		return nil
+	}
+
+	record, err := app.models.Payments.GetPayment(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if record == nil {
+		app.errorResponse(c, http.StatusNotFound, codePaymentNotFound, fmt.Sprintf("No payment exists with id %d.", id))
+		return nil
+	}
+
+	return record
+}
+
+// refundPayment refunds a payment
+//
+//	@Summary		refund payment
+//	@Description	refund part or all of a captured payment. The order becomes Refunded when the provider confirms a full refund by webhook.
+//	@Tags			payment
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		query		int						true	"id of payment to refund"
+//	@Param			refund	body		refundPaymentRequest	true	"amount to refund"
+//	@Success		200		{object}	database.Payment		"successfully refunded"
+//	@Failure		400		{object}	problem					"invalid_id, malformed_body or validation_failed"
+//	@Failure		403		{object}	problem					"forbidden"
+//	@Failure		404		{object}	problem					"payment_not_found"
+//	@Failure		409		{object}	problem					"payment_not_refundable"
+//	@Failure		422		{object}	problem					"currency_mismatch"
+//	@Failure		500		{object}	problem					"internal_error"
+//	@Failure		504		{object}	problem					"payment_provider_timeout"
+//	@Router			/api/v1/payments/:id/refund [post]
+//	@Security		CookieAuth
+func (app *application) refundPayment(c *gin.Context) {
+	record := app.getPaymentForAdmin(c, "refund")
+	if record == nil {
+		return
+	}
+
+	var request refundPaymentRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	// a retried request refunds only once
+	var key string
+	if header := c.GetHeader(idempotencyKeyHeader); header != "" {
+		key = fmt.Sprintf("payment-%d-%s", record.Id, header)
+	}
+
+	if !app.issueRefund(c, record, request.Amount, key) {
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+// issueRefund refunds amount of the captured payment with the provider,
+// saves the payment and adds the refund to the order's history. The provider
+// makes refunds with the same non-empty key only once. It returns false if
+// the request was aborted.
+func (app *application) issueRefund(c *gin.Context, record *database.Payment, amount money.Money, key string) bool {
+	if record.Status != database.PaymentCaptured {
+		app.errorResponse(c, http.StatusConflict, codePaymentNotRefundable, fmt.Sprintf("A %s payment cannot be refunded.", record.Status))
+		return false
+	}
+
+	if record.Amount.Currency != amount.Currency {
+		app.errorResponse(c, http.StatusUnprocessableEntity, codeCurrencyMismatch, fmt.Sprintf("The payment was made in %s.", record.Amount.Currency))
+		return false
+	}
+
+	// Reserve the amount before moving money, so concurrent refunds cannot
+	// together refund more than was paid.
+	before := *record
+	if err := app.models.Payments.ReserveRefund(record, amount); err != nil {
+		if !errors.Is(err, database.ErrPaymentNotRefundable) {
+			app.serverError(c, err)
+			return false
+		}
+		if record.Status != database.PaymentCaptured {
+			app.errorResponse(c, http.StatusConflict, codePaymentNotRefundable, fmt.Sprintf("A %s payment cannot be refunded.", record.Status))
+			return false
+		}
+		remaining, _ := record.Amount.Sub(record.Refunded_Amount)
+		app.errorResponse(c, http.StatusConflict, codePaymentNotRefundable, fmt.Sprintf("Only %s of the payment is left to refund.", remaining))
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.config.Payment.Timeout)
+	defer cancel()
+
+	result, err := app.payments.Refund(ctx, record.Provider_Payment_Id, amount, key)
+	if err != nil {
+		if err := app.models.Payments.ReleaseRefund(record, amount); err != nil {
+			log.Printf("request_id=%s releasing refund of payment %d: %v", requestIdFromContext(c), record.Id, err)
+		}
+		app.paymentError(c, err)
+		return false
+	}
+
+	record.Status = string(result.Status)
+	if err := app.models.Payments.UpdatePayment(record); err != nil {
+		app.serverError(c, err)
+		return false
+	}
+
+	app.recordOrderEvent(c, &database.OrderEvent{
+		Order_Id: record.Order_Id,
+		Type:     database.OrderEventRefundIssued,
+		Detail:   fmt.Sprintf("refunded %s of payment %d", amount, record.Id),
+	})
+	app.audit(c, &database.AuditEvent{Action: "payment.refund", Target_Type: auditTargetPayment, Target_Id: record.Id}, &before, record)
+	return true
+}
+
+// voidPayment voids a payment
+//
+//	@Summary		void payment
+//	@Description	cancel an authorized payment that was never captured
+//	@Tags			payment
+//	@Produce		json
+//	@Param			id	query		int					true	"id of payment to void"
+//	@Success		200	{object}	database.Payment	"successfully voided"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		403	{object}	problem				"forbidden"
+//	@Failure		404	{object}	problem				"payment_not_found"
+//	@Failure		409	{object}	problem				"payment_not_voidable"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Failure		504	{object}	problem				"payment_provider_timeout"
+//	@Router			/api/v1/payments/:id/void [post]
+//	@Security		CookieAuth
+func (app *application) voidPayment(c *gin.Context) {
+	record := app.getPaymentForAdmin(c, "void")
+	if record == nil {
+		return
+	}
+
+	if record.Status != database.PaymentAuthorized {
+		app.errorResponse(c, http.StatusConflict, codePaymentNotVoidable, fmt.Sprintf("A %s payment cannot be voided.", record.Status))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.config.Payment.Timeout)
+	defer cancel()
+
+	result, err := app.payments.Void(ctx, record.Provider_Payment_Id)
+	if err != nil {
+		app.paymentError(c, err)
+		return
+	}
+
+	before := *record
+	record.Status = string(result.Status)
+	if err := app.models.Payments.UpdatePayment(record); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "payment.void", Target_Type: auditTargetPayment, Target_Id: record.Id}, &before, record)
+
+	c.JSON(http.StatusOK, record)
+}
+
+// paymentEventStatuses maps provider webhook events to payment statuses.
+var paymentEventStatuses = map[payment.EventType]string{
+	payment.EventCaptured: database.PaymentCaptured,
+	payment.EventRefunded: database.PaymentRefunded,
+	payment.EventVoided:   database.PaymentVoided,
+	payment.EventFailed:   database.PaymentFailed,
+}
+
+// paymentWebhook receives payment provider webhooks
+//
+//	@Summary		payment provider webhook
+//	@Description	receives signed events from the payment provider. Each event is applied once; redelivered events are acknowledged without effect.
+//	@Tags			payment
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	gin.H	"event processed, duplicate or ignored"
+//	@Failure		400	{object}	problem	"invalid_webhook_signature or malformed_body"
+//	@Failure		500	{object}	problem	"internal_error"
+//	@Router			/api/v1/payments/webhook [post]
+func (app *application) paymentWebhook(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodyBytes))
+	if err != nil {
+		app.errorResponse(c, http.StatusRequestEntityTooLarge, codeBodyTooLarge, "The request body is too large.")
+		return
+	}
+
+	event, err := app.payments.VerifyWebhook(c.Request.Header, body)
+	if err != nil {
+		if errors.Is(err, payment.ErrInvalidSignature) {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidWebhookSignature, "The webhook signature is invalid.")
+			return
+		}
+		app.errorResponse(c, http.StatusBadRequest, codeMalformedBody, "The webhook body could not be read.")
+		return
+	}
+
+	status, ok := paymentEventStatuses[event.Type]
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
+
+	before, err := app.models.Payments.GetProviderPayment(app.payments.Name(), event.Provider_Payment_Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	applied, err := app.models.Payments.ApplyPaymentEvent(&database.PaymentEvent{
+		Provider:            app.payments.Name(),
+		Event_Id:            event.Id,
+		Type:                string(event.Type),
+		Provider_Payment_Id: event.Provider_Payment_Id,
+		Status:              status,
+		Refunded_Amount:     refundedAmount(event),
+	})
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if !applied {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
+	}
+
+	if before != nil {
+		after, err := app.models.Payments.GetPayment(before.Id)
+		if err != nil {
+			log.Printf("request_id=%s loading payment %d for audit: %v", requestIdFromContext(c), before.Id, err)
+		} else {
+			app.audit(c, &database.AuditEvent{Action: "payment.webhook", Target_Type: auditTargetPayment, Target_Id: before.Id}, before, after)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "processed"})
+}
+
+func refundedAmount(event *payment.Event) int64 {
+	if event.Type == payment.EventRefunded {
+		return event.Amount.Amount
+	}
+	return 0
+}
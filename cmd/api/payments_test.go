@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/payment"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPaymentRouter(app *application) *gin.Engine {
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	v1.POST("/auth/register", app.registerUser)
+	v1.POST("/auth/login", app.login)
+	v1.POST("/payments/webhook", app.paymentWebhook)
+
+	authGroup := v1.Group("/")
+	authGroup.Use(app.AuthMiddleware())
+	authGroup.POST("/orders", app.createOrder)
+	authGroup.GET("/orders/:id", app.getOrder)
+	authGroup.GET("/orders/:id/payments", app.getOrderPayments)
+	authGroup.POST("/orders/:id/payments", app.payOrder)
+
+	return router
+}
+
+func postWebhook(url string, webhook payment.Webhook) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(webhook.Body))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	req.Header = webhook.Header.Clone()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return resp, string(bodyBytes)
+}
+
+func TestPayOrder(t *testing.T) {
+	app := SetupTest()
+	fake := payment.NewFake("test-webhook-secret")
+	app.payments = fake
+
+	ts := httptest.NewServer(setupPaymentRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+	testutils.MakeAnOrder(client, ts.URL+"/api/v1")
+
+	resp, body := doRequest(client, http.MethodPost, ts.URL+"/api/v1/orders/1/payments", `{"payment_method":"fake_duplicate_webhook"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	got := testutils.StringToJSON(body)
+	assert.Equal(t, "captured", got["status"])
+	assert.Equal(t, "fake_pay_1", got["provider_payment_id"])
+
+	// the order is only paid once the provider confirms the capture
+	_, body = doRequest(client, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, "Pending", testutils.StringToJSON(body)["status"])
+
+	webhooks := fake.Webhooks()
+	assert.Equal(t, 2, len(webhooks))
+
+	resp, body = postWebhook(ts.URL+"/api/v1/payments/webhook", webhooks[0])
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, testutils.StringToJSON(`{"status":"processed"}`), testutils.StringToJSON(body))
+
+	resp, body = postWebhook(ts.URL+"/api/v1/payments/webhook", webhooks[1])
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, testutils.StringToJSON(`{"status":"duplicate"}`), testutils.StringToJSON(body))
+
+	_, body = doRequest(client, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	expected := `{"id":1,"user_id":1,"status":"Paid","total_price":{"amount":1,"currency":"USD"}}`
+	assert.Equal(t, testutils.StringToJSON(expected), testutils.StringToJSON(body))
+
+	// a paid order cannot be paid again
+	resp, body = doRequest(client, http.MethodPost, ts.URL+"/api/v1/orders/1/payments", `{"payment_method":"fake_ok"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeOrderNotPayable, testutils.StringToJSON(body)["code"])
+}
+
+func TestPayOrder_Declined(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(setupPaymentRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+	testutils.MakeAnOrder(client, ts.URL+"/api/v1")
+
+	resp, body := doRequest(client, http.MethodPost, ts.URL+"/api/v1/orders/1/payments", `{"payment_method":"fake_decline"}`)
+	assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode)
+	assert.Equal(t, codePaymentDeclined, testutils.StringToJSON(body)["code"])
+
+	// the declined attempt is recorded and a new one is allowed
+	payments, err := app.models.Payments.GetPaymentsForOrder(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, 1, len(payments))
+	assert.Equal(t, "declined", payments[0].Status)
+
+	resp, _ = doRequest(client, http.MethodPost, ts.URL+"/api/v1/orders/1/payments", `{"payment_method":"fake_ok"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestPayOrder_Timeout(t *testing.T) {
+	app := SetupTest()
+	app.config.Payment.Timeout = 50 * time.Millisecond
+	ts := httptest.NewServer(setupPaymentRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+	testutils.MakeAnOrder(client, ts.URL+"/api/v1")
+
+	resp, body := doRequest(client, http.MethodPost, ts.URL+"/api/v1/orders/1/payments", `{"payment_method":"fake_timeout"}`)
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Equal(t, codePaymentProviderTimeout, testutils.StringToJSON(body)["code"])
+}
+
+func TestPayOrder_Concurrent(t *testing.T) {
+	app := SetupTest()
+	app.payments = payment.NewFake("test-webhook-secret")
+	ts := httptest.NewServer(setupPaymentRouter(app))
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+	testutils.LoginCustomer(client, ts.URL+"/api/v1")
+	testutils.MakeAnOrder(client, ts.URL+"/api/v1")
+
+	// only one of the requests reaches the provider
+	statuses := make(chan int, 5)
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := doRequest(client, http.MethodPost, ts.URL+"/api/v1/orders/1/payments", `{"payment_method":"fake_ok"}`)
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		if status == http.StatusCreated {
+			created++
+		} else {
+			assert.Equal(t, http.StatusConflict, status)
+		}
+	}
+	assert.Equal(t, 1, created)
+
+	payments, err := app.models.Payments.GetPaymentsForOrder(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, 1, len(payments))
+}
+
+func TestPaymentWebhook_Invalid_Signature(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(setupPaymentRouter(app))
+	defer ts.Close()
+
+	webhook := payment.NewFake("wrong-secret").SignedWebhook(payment.Event{Id: "evt_1", Type: payment.EventCaptured, Provider_Payment_Id: "fake_pay_1"})
+
+	resp, body := postWebhook(ts.URL+"/api/v1/payments/webhook", webhook)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidWebhookSignature, testutils.StringToJSON(body)["code"])
+}
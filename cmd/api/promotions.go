@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/promotion"
+)
+
+// requestedPromotionCodes reads the promotion codes from the code query
+// parameter, which may be repeated or hold a comma separated list. Codes are
+// matched case insensitively and duplicates are dropped. It responds 400 and
+// returns false if a code is malformed.
+func (app *application) requestedPromotionCodes(c *gin.Context) ([]string, bool) {
+	var codes []string
+	seen := map[string]bool{}
+	for _, value := range c.QueryArray("code") {
+		for _, code := range strings.Split(value, ",") {
+			code = promotion.NormalizeCode(code)
+			if code == "" || seen[code] {
+				continue
+			}
+			if !promotion.IsCode(code) {
+				app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, fmt.Sprintf("%q is not a valid promotion code.", code))
+				return nil, false
+			}
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	return codes, true
+}
+
+// promotionNotApplicable responds 422 for a code that cannot be used.
+func (app *application) promotionNotApplicable(c *gin.Context, err *promotion.NotApplicableError) {
+	app.errorResponse(c, http.StatusUnprocessableEntity, codePromotionNotApplicable,
+		fmt.Sprintf("The promotion code %s %s.", err.Code, err.Reason))
+}
+
+// bindPromotion binds and validates a promotion from the request body,
+// responding 400 and returning false if it is not valid.
+func (app *application) bindPromotion(c *gin.Context, p *promotion.Promotion) bool {
+	if err := c.ShouldBindJSON(p); err != nil {
+		app.bindingError(c, err)
+		return false
+	}
+	if err := p.Validate(); err != nil {
+		app.errorResponse(c, http.StatusBadRequest, codeValidationFailed, fmt.Sprintf("The promotion is not valid: %s.", err))
+		return false
+	}
+	return true
+}
+
+// getPromotionForAdmin loads the promotion named by the id path parameter.
+// It responds and returns nil if the user is not an admin or there is no such
+// promotion.
+func (app *application) getPromotionForAdmin(c *gin.Context) *promotion.Promotion {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage promotions.")
+		return nil
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		app.invalidId(c, "The promotion id must be an integer.")
+		return nil
+	}
+
+	p, err := app.models.Promotions.GetPromotion(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if p == nil {
+		app.errorResponse(c, http.StatusNotFound, codePromotionNotFound, fmt.Sprintf("No promotion exists with id %d.", id))
+		return nil
+	}
+	return p
+}
+
+// getPromotions gets promotions
+//
+//	@Summary		gets promotions
+//	@Description	gets every promotion by code, including expired and used up ones
+//	@Tags			promotion
+//	@Produce		json
+//	@Success		200	{array}		promotion.Promotion	"successfully got promotions"
+//	@Failure		403	{object}	problem				"forbidden"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/promotions [get]
+//	@Security		CookieAuth
+func (app *application) getPromotions(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage promotions.")
+		return
+	}
+
+	promotions, err := app.models.Promotions.GetPromotions()
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, promotions)
+}
+
+// getPromotion gets a promotion
+//
+//	@Summary		get promotion
+//	@Description	get a promotion by id with how often it has been used
+//	@Tags			promotion
+//	@Produce		json
+//	@Param			id	query		int					true	"id of promotion"
+//	@Success		200	{object}	promotion.Promotion	"successfully got a promotion"
+//	@Header			200	{string}	ETag				"version of the promotion"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		403	{object}	problem				"forbidden"
+//	@Failure		404	{object}	problem				"promotion_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/promotions/:id [get]
+//	@Security		CookieAuth
+func (app *application) getPromotion(c *gin.Context) {
+	p := app.getPromotionForAdmin(c)
+	if p == nil {
+		return
+	}
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusOK, p)
+}
+
+// createPromotion creates a promotion
+//
+//	@Summary		creates a promotion
+//	@Description	adds a promotion code. percent_off needs percent_off, fixed_amount needs amount_off and buy_x_get_y needs buy_quantity and get_quantity; book_id limits percent_off and buy_x_get_y to one book. A max_uses or max_uses_per_customer of 0 means no limit.
+//	@Tags			promotion
+//	@Accept			json
+//	@Produce		json
+//	@Param			promotion		body		promotion.Promotion	true	"new promotion"
+//	@Param			Idempotency-Key	header		string				false	"key that makes retries of this request safe"
+//	@Success		201				{object}	promotion.Promotion	"successfully created a promotion"
+//	@Header			201				{string}	ETag				"version of the promotion"
+//	@Failure		400				{object}	problem				"malformed_body or validation_failed"
+//	@Failure		403				{object}	problem				"forbidden"
+//	@Failure		409				{object}	problem				"promotion_exists or idempotency_key_in_use"
+//	@Failure		422				{object}	problem				"idempotency_key_reused"
+//	@Failure		500				{object}	problem				"internal_error"
+//	@Router			/api/v1/promotions [post]
+//	@Security		CookieAuth
+func (app *application) createPromotion(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage promotions.")
+		return
+	}
+
+	var p promotion.Promotion
+
+	if !app.bindPromotion(c, &p) {
+		return
+	}
+
+	if err := app.models.Promotions.CreatePromotion(&p); err != nil {
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codePromotionExists, fmt.Sprintf("A promotion with code %s already exists.", p.Code))
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "promotion.create", Target_Type: auditTargetPromotion, Target_Id: int(p.Id)}, nil, p)
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusCreated, p)
+}
+
+// updatePromotion updates a promotion
+//
+//	@Summary		update a promotion
+//	@Description	update a promotion by id. Orders already placed keep the discounts they got.
+//	@Tags			promotion
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int					true	"id of promotion to update"
+//	@Param			If-Match	header		string				true	"current ETag of the promotion"
+//	@Param			promotion	body		promotion.Promotion	true	"updated promotion"
+//	@Success		200			{object}	promotion.Promotion	"successfully updated a promotion"
+//	@Header			200			{string}	ETag				"new version of the promotion"
+//	@Failure		400			{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem				"forbidden"
+//	@Failure		404			{object}	problem				"promotion_not_found"
+//	@Failure		409			{object}	problem				"promotion_exists"
+//	@Failure		412			{object}	problem				"precondition_failed"
+//	@Failure		428			{object}	problem				"precondition_required"
+//	@Failure		500			{object}	problem				"internal_error"
+//	@Router			/api/v1/promotions/:id [put]
+//	@Security		CookieAuth
+func (app *application) updatePromotion(c *gin.Context) {
+	existing := app.getPromotionForAdmin(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	updated := &promotion.Promotion{}
+
+	if !app.bindPromotion(c, updated) {
+		return
+	}
+
+	updated.Id = existing.Id
+	updated.Version = existing.Version
+
+	if err := app.models.Promotions.UpdatePromotion(updated); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsUniqueViolation(err):
+			app.errorResponse(c, http.StatusConflict, codePromotionExists, fmt.Sprintf("A promotion with code %s already exists.", updated.Code))
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "promotion.update", Target_Type: auditTargetPromotion, Target_Id: int(updated.Id)}, existing, updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// deletePromotion deletes a promotion
+//
+//	@Summary		delete promotion
+//	@Description	delete a promotion by id so its code can no longer be used. Orders keep the discounts they got from it.
+//	@Tags			promotion
+//	@Produce		json
+//	@Param			id			query	int		true	"id of promotion to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the promotion"
+//	@Success		204			"successfully deleted"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		404			{object}	problem	"promotion_not_found"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/promotions/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deletePromotion(c *gin.Context) {
+	existing := app.getPromotionForAdmin(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	if err := app.models.Promotions.DeletePromotion(existing.Id, existing.Version); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "promotion.delete", Target_Type: auditTargetPromotion, Target_Id: int(existing.Id)}, existing, nil)
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckout_WithPromotions(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	makeStockedBook(admin, ts.URL+"/api/v1", "1000", "10")
+
+	resp, _ := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/promotions", `{"code":"BOGO","type":"buy_x_get_y","buy_quantity":2,"get_quantity":1}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/promotions", `{"code":"TENOFF","type":"percent_off","percent_off":10,"max_uses_per_customer":1}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/promotions", `{"code":"TENOFF","type":"percent_off","percent_off":10}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codePromotionExists, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/promotions", `{"code":"FIVE","type":"fixed_amount"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeValidationFailed, testutils.StringToJSON(body)["code"])
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":3}`)
+
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?code=nope", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codePromotionNotApplicable, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?code=tenoff&code=bogo", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	got := testutils.StringToJSON(body)
+	assert.Equal(t, map[string]any{"amount": float64(1800), "currency": "USD"}, got["total_price"]) // 3000 - 1000 - 200
+	assert.Equal(t, map[string]any{"amount": float64(1200), "currency": "USD"}, got["discount_total"])
+
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1/invoice", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	got = testutils.StringToJSON(body)
+	assert.Equal(t, map[string]any{"amount": float64(3000), "currency": "USD"}, got["subtotal"])
+	discounts := got["discounts"].([]any)
+	assert.Len(t, discounts, 2)
+	assert.Equal(t, "BOGO", discounts[0].(map[string]any)["code"])
+	assert.Equal(t, "TENOFF", discounts[1].(map[string]any)["code"])
+
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":1}`)
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?code=TENOFF", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codePromotionNotApplicable, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/promotions/2", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), testutils.StringToJSON(body)["uses"])
+}
+
+func TestPurgeDeletedOrders_KeepsRedemptions(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	makeStockedBook(admin, ts.URL+"/api/v1", "1000", "10")
+	resp, _ := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/promotions", `{"code":"ONCE","type":"percent_off","percent_off":10,"max_uses":1}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":1}`)
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?code=ONCE", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = doIfMatch(admin, http.MethodDelete, ts.URL+"/api/v1/orders/1", `"1"`, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	purged, err := app.models.Orders.PurgeDeletedOrders(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	// the purged order still used the code up
+	resp, body := doRequest(admin, http.MethodGet, ts.URL+"/api/v1/promotions/1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), testutils.StringToJSON(body)["uses"])
+
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":1}`)
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?code=ONCE", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codePromotionNotApplicable, testutils.StringToJSON(body)["code"])
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+)
+
+// getPublisherFromParam loads the publisher named by the id path parameter.
+// It responds and returns nil if there is no such publisher.
+func (app *application) getPublisherFromParam(c *gin.Context) *database.Publisher {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The publisher id must be an integer.")
+		return nil
+	}
+
+	p, err := app.models.Publishers.GetPublisher(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if p == nil {
+		app.errorResponse(c, http.StatusNotFound, codePublisherNotFound, fmt.Sprintf("No publisher exists with id %d.", id))
+		return nil
+	}
+	return p
+}
+
+// getPublishers gets a page of publishers
+//
+//	@Summary		gets a page of publishers
+//	@Description	gets a page of publishers ordered by name
+//	@Tags			publisher
+//	@Produce		json
+//	@Param			page	query		int					false	"page number to request"
+//	@Param			limit	query		int					false	"max number of publishers to return per page, at most 100"
+//	@Success		200		{array}		database.Publisher	"successfully got a page of publishers"
+//	@Failure		400		{object}	problem				"invalid_query"
+//	@Failure		500		{object}	problem				"internal_error"
+//	@Router			/api/v1/publishers [get]
+func (app *application) getPublishers(c *gin.Context) {
+	limit, page, ok := app.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	publishers, err := app.models.Publishers.GetPageOfPublishers(limit, page)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, publishers)
+}
+
+// getPublisher gets a publisher
+//
+//	@Summary		get publisher
+//	@Description	get a publisher by id
+//	@Tags			publisher
+//	@Produce		json
+//	@Param			id				query		int					true	"id of publisher"
+//	@Param			If-None-Match	header		string				false	"ETag from a previous response"
+//	@Success		200				{object}	database.Publisher	"successfully got a publisher"
+//	@Header			200				{string}	ETag				"version of the publisher"
+//	@Success		304				"publisher has not changed"
+//	@Failure		400				{object}	problem	"invalid_id"
+//	@Failure		404				{object}	problem	"publisher_not_found"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Router			/api/v1/publishers/:id [get]
+func (app *application) getPublisher(c *gin.Context) {
+	p := app.getPublisherFromParam(c)
+	if p == nil {
+		return
+	}
+
+	if app.notModified(c, p.Version) {
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// getPublisherBooks gets a page of a publisher's books
+//
+//	@Summary		get publisher's books
+//	@Description	gets a page of the books a publisher published
+//	@Tags			publisher
+//	@Produce		json
+//	@Param			id			query		int				true	"id of publisher"
+//	@Param			page		query		int				false	"page number to request"
+//	@Param			limit		query		int				false	"max number of books to return per page, at most 100"
+//	@Param			currency	query		string			false	"currency to price the books in"
+//	@Success		200			{array}		database.Book	"successfully got a page of books"
+//	@Failure		400			{object}	problem			"invalid_id or invalid_query"
+//	@Failure		404			{object}	problem			"publisher_not_found"
+//	@Failure		422			{object}	problem			"exchange_rate_unavailable"
+//	@Failure		500			{object}	problem			"internal_error"
+//	@Router			/api/v1/publishers/:id/books [get]
+func (app *application) getPublisherBooks(c *gin.Context) {
+	p := app.getPublisherFromParam(c)
+	if p == nil {
+		return
+	}
+
+	app.listBooks(c, func(limit int, page int) ([]*database.Book, error) {
+		return app.models.Books.GetBooksByPublisher(p.Id, limit, page)
+	})
+}
+
+// createPublisher creates a publisher
+//
+//	@Summary		creates a publisher
+//	@Description	adds a publisher, which books can then name
+//	@Tags			publisher
+//	@Accept			json
+//	@Produce		json
+//	@Param			publisher		body		database.Publisher	true	"new publisher"
+//	@Param			Idempotency-Key	header		string				false	"key that makes retries of this request safe"
+//	@Success		201				{object}	database.Publisher	"successfully created a publisher"
+//	@Header			201				{string}	ETag				"version of the publisher"
+//	@Failure		400				{object}	problem				"malformed_body or validation_failed"
+//	@Failure		403				{object}	problem				"forbidden"
+//	@Failure		409				{object}	problem				"publisher_exists or idempotency_key_in_use"
+//	@Failure		422				{object}	problem				"idempotency_key_reused"
+//	@Failure		500				{object}	problem				"internal_error"
+//	@Router			/api/v1/publishers [post]
+//	@Security		CookieAuth
+func (app *application) createPublisher(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage publishers.")
+		return
+	}
+
+	var p database.Publisher
+
+	if err := c.ShouldBindJSON(&p); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if err := app.models.Publishers.CreatePublisher(&p); err != nil {
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codePublisherExists, fmt.Sprintf("A publisher named %s already exists.", p.Name))
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "publisher.create", Target_Type: auditTargetPublisher, Target_Id: p.Id}, nil, p)
+
+	setETag(c, p.Version)
+	c.JSON(http.StatusCreated, p)
+}
+
+// updatePublisher updates a publisher
+//
+//	@Summary		update a publisher
+//	@Description	update a publisher by id
+//	@Tags			publisher
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int					true	"id of publisher to update"
+//	@Param			If-Match	header		string				true	"current ETag of the publisher"
+//	@Param			publisher	body		database.Publisher	true	"updated publisher"
+//	@Success		200			{object}	database.Publisher	"successfully updated a publisher"
+//	@Header			200			{string}	ETag				"new version of the publisher"
+//	@Failure		400			{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem				"forbidden"
+//	@Failure		404			{object}	problem				"publisher_not_found"
+//	@Failure		409			{object}	problem				"publisher_exists"
+//	@Failure		412			{object}	problem				"precondition_failed"
+//	@Failure		428			{object}	problem				"precondition_required"
+//	@Failure		500			{object}	problem				"internal_error"
+//	@Router			/api/v1/publishers/:id [put]
+//	@Security		CookieAuth
+func (app *application) updatePublisher(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage publishers.")
+		return
+	}
+
+	existing := app.getPublisherFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	updated := &database.Publisher{}
+
+	if err := c.ShouldBindJSON(updated); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	updated.Id = existing.Id
+	updated.Version = existing.Version
+
+	if err := app.models.Publishers.UpdatePublisher(updated); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsUniqueViolation(err):
+			app.errorResponse(c, http.StatusConflict, codePublisherExists, fmt.Sprintf("A publisher named %s already exists.", updated.Name))
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "publisher.update", Target_Type: auditTargetPublisher, Target_Id: updated.Id}, existing, updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// deletePublisher deletes a publisher
+//
+//	@Summary		delete publisher
+//	@Description	delete a publisher by id. Publishers named by books cannot be deleted.
+//	@Tags			publisher
+//	@Produce		json
+//	@Param			id			query	int		true	"id of publisher to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the publisher"
+//	@Success		204			"successfully deleted"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		404			{object}	problem	"publisher_not_found"
+//	@Failure		409			{object}	problem	"publisher_in_use"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/publishers/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deletePublisher(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage publishers.")
+		return
+	}
+
+	existing := app.getPublisherFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	if err := app.models.Publishers.DeletePublisher(existing.Id, existing.Version); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.errorResponse(c, http.StatusConflict, codePublisherInUse, "The publisher is named by books and cannot be deleted.")
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "publisher.delete", Target_Type: auditTargetPublisher, Target_Id: existing.Id}, existing, nil)
+
+	c.Status(http.StatusNoContent)
+}
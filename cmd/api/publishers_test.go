@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishers(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "3", "5")
+
+	resp, _ := doRequest(admin, http.MethodPost, url+"/publishers", `{"name":"Penguin", "website":"https://penguin.example"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body := doRequest(admin, http.MethodPost, url+"/publishers", `{"name":"Penguin"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codePublisherExists, testutils.StringToJSON(body)["code"])
+
+	resp, body = doIfMatch(admin, http.MethodPatch, url+"/books/1", `"1"`, `{"publisher_id":7}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codePublisherNotFound, testutils.StringToJSON(body)["code"])
+
+	resp, body = doIfMatch(admin, http.MethodPatch, url+"/books/1", `"1"`, `{"publisher_id":1}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), testutils.StringToJSON(body)["publisher_id"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/publishers/1/books", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	books := testutils.StringToJSONArray(body)
+	require.Len(t, books, 1)
+	assert.Equal(t, float64(1), books[0]["id"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/publishers/1/books?limit=x", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeInvalidQuery, testutils.StringToJSON(body)["code"])
+
+	resp, body = doIfMatch(admin, http.MethodDelete, url+"/publishers/1", `"1"`, "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codePublisherInUse, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doIfMatch(admin, http.MethodPatch, url+"/books/1", `"2"`, `{"publisher_id":0}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = doIfMatch(admin, http.MethodDelete, url+"/publishers/1", `"1"`, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/jobs"
+)
+
+// purgeDeletedRows removes books, users and orders that were soft deleted
+// longer ago than the configured retention, and returns how many of each were
+// removed. Orders go first so users whose last orders were purged can be
+// purged in the same pass. It runs every hour.
+func (app *application) purgeDeletedRows(ctx context.Context, job *jobs.Job, _ struct{}) (any, error) {
+	before := time.Now().Add(-app.config.DeletedRetention)
+
+	purges := []struct {
+		name  string
+		purge func(time.Time) (int64, error)
+	}{
+		{"orders", app.models.Orders.PurgeDeletedOrders},
+		{"users", app.models.Users.PurgeDeletedUsers},
+		{"books", app.models.Books.PurgeDeletedBooks},
+	}
+
+	purged := map[string]int64{}
+	var errs []error
+	for _, p := range purges {
+		n, err := p.purge(before)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("purging deleted %s: %w", p.name, err))
+			continue
+		}
+		purged[p.name] = n
+	}
+	return purged, errors.Join(errs...)
+}
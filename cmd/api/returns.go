@@ -0,0 +1,410 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+type returnRequest struct {
+	Reason string                 `json:"reason" binding:"required,max=1024"`
+	Items  []*database.ReturnItem `json:"items" binding:"required,min=1,dive"`
+}
+
+type returnDecisionRequest struct {
+	Note string `json:"note" binding:"max=1024"`
+}
+
+type returnRefundRequest struct {
+	Amount *money.Money `json:"amount" binding:"omitempty,positive_money"`
+}
+
+// requestReturn requests a return
+//
+//	@Summary		request a return
+//	@Description	request a return of some of the books of a paid order
+//	@Tags			return
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		query		int				true	"id of order"
+//	@Param			return	body		returnRequest	true	"books to return and why"
+//	@Success		201		{object}	database.Return	"successfully requested the return"
+//	@Failure		400		{object}	problem			"invalid_id, malformed_body or validation_failed"
+//	@Failure		403		{object}	problem			"forbidden"
+//	@Failure		404		{object}	problem			"order_not_found"
+//	@Failure		409		{object}	problem			"order_not_returnable"
+//	@Failure		422		{object}	problem			"invalid_return_items"
+//	@Failure		500		{object}	problem			"internal_error"
+//	@Router			/api/v1/orders/:id/returns [post]
+//	@Security		CookieAuth
+func (app *application) requestReturn(c *gin.Context) {
+	order := app.getOrderForCustomer(c)
+	if order == nil {
+		return
+	}
+
+	var request returnRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	switch order.Status {
+	case database.OrderPaid, database.OrderPartiallyShipped, database.OrderShipped, database.OrderDelivered:
+	default:
+		app.errorResponse(c, http.StatusConflict, codeOrderNotReturnable, fmt.Sprintf("The order is %s; only paid orders can be returned.", order.Status))
+		return
+	}
+
+	// Merge repeated books so each one is checked against its total.
+	quantities := map[int]int{}
+	r := &database.Return{Order_Id: order.Id, Reason: request.Reason}
+	for _, item := range request.Items {
+		if _, seen := quantities[item.Book_Id]; !seen {
+			r.Items = append(r.Items, &database.ReturnItem{Book_Id: item.Book_Id})
+		}
+		quantities[item.Book_Id] += item.Quantity
+	}
+
+	for _, item := range r.Items {
+		item.Quantity = quantities[item.Book_Id]
+	}
+
+	if err := app.models.Returns.CreateReturn(r, app.GetUserFromContext(c).Id); err != nil {
+		var itemErr *database.ReturnItemError
+		switch {
+		case errors.As(err, &itemErr) && !itemErr.Ordered:
+			app.errorResponse(c, http.StatusUnprocessableEntity, codeInvalidReturnItems, fmt.Sprintf("The book with id %d is not part of this order.", itemErr.Book_Id))
+		case errors.As(err, &itemErr):
+			app.errorResponse(c, http.StatusUnprocessableEntity, codeInvalidReturnItems, fmt.Sprintf("Only %d of the book with id %d can still be returned.", itemErr.Remaining, itemErr.Book_Id))
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "return.create", Target_Type: auditTargetReturn, Target_Id: r.Id}, nil, r)
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// getOrderReturns lists the returns of an order
+//
+//	@Summary		get order returns
+//	@Description	list the returns requested for an order
+//	@Tags			return
+//	@Produce		json
+//	@Param			id	query		int				true	"id of order"
+//	@Success		200	{array}		database.Return	"successfully got the returns"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		403	{object}	problem			"forbidden"
+//	@Failure		404	{object}	problem			"order_not_found"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/orders/:id/returns [get]
+//	@Security		CookieAuth
+func (app *application) getOrderReturns(c *gin.Context) {
+	order := app.getVisibleOrder(c)
+	if order == nil {
+		return
+	}
+
+	returns, err := app.models.Returns.GetReturnsForOrder(order.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, returns)
+}
+
+// getReturnForAdmin loads the return for an admin only endpoint. It returns
+// nil if the request was aborted.
+func (app *application) getReturnForAdmin(c *gin.Context) *database.Return {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can process returns.")
+		return nil
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The return id must be an integer.")
+		return nil
+	}
+
+	r, err := app.models.Returns.GetReturn(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if r == nil {
+		app.errorResponse(c, http.StatusNotFound, codeReturnNotFound, fmt.Sprintf("No return exists with id %d.", id))
+		return nil
+	}
+
+	return r
+}
+
+// transitionReturn moves the return to status if it is currently in one of
+// from, recording eventType in the order's history. It returns false if the
+// request was aborted.
+func (app *application) transitionReturn(c *gin.Context, r *database.Return, status string, eventType string, detail string, from ...string) bool {
+	current := r.Status
+	allowed := false
+	for _, s := range from {
+		if current == s {
+			allowed = true
+		}
+	}
+
+	if !allowed {
+		app.errorResponse(c, http.StatusConflict, codeInvalidReturnTransition, fmt.Sprintf("A %s return cannot be %s.", current, status))
+		return false
+	}
+
+	r.Status = status
+	event := &database.OrderEvent{Order_Id: r.Order_Id, Type: eventType, Detail: detail, Actor_Id: app.GetUserFromContext(c).Id}
+	if err := app.models.Returns.TransitionReturn(r, current, event); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.errorResponse(c, http.StatusConflict, codeInvalidReturnTransition, "The return was changed by another request.")
+			return false
+		}
+		app.serverError(c, err)
+		return false
+	}
+	return true
+}
+
+// approveReturn approves a return
+//
+//	@Summary		approve return
+//	@Description	approve a requested return so the customer can send the books back
+//	@Tags			return
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int						true	"id of return"
+//	@Param			decision	body		returnDecisionRequest	false	"note for the customer"
+//	@Success		200			{object}	database.Return			"successfully approved"
+//	@Failure		400			{object}	problem					"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem					"forbidden"
+//	@Failure		404			{object}	problem					"return_not_found"
+//	@Failure		409			{object}	problem					"invalid_return_transition"
+//	@Failure		500			{object}	problem					"internal_error"
+//	@Router			/api/v1/returns/:id/approve [post]
+//	@Security		CookieAuth
+func (app *application) approveReturn(c *gin.Context) {
+	app.decideReturn(c, database.ReturnApproved, database.OrderEventReturnApproved, "return.approve")
+}
+
+// rejectReturn rejects a return
+//
+//	@Summary		reject return
+//	@Description	reject a requested return
+//	@Tags			return
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int						true	"id of return"
+//	@Param			decision	body		returnDecisionRequest	false	"reason for the customer"
+//	@Success		200			{object}	database.Return			"successfully rejected"
+//	@Failure		400			{object}	problem					"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem					"forbidden"
+//	@Failure		404			{object}	problem					"return_not_found"
+//	@Failure		409			{object}	problem					"invalid_return_transition"
+//	@Failure		500			{object}	problem					"internal_error"
+//	@Router			/api/v1/returns/:id/reject [post]
+//	@Security		CookieAuth
+func (app *application) rejectReturn(c *gin.Context) {
+	app.decideReturn(c, database.ReturnRejected, database.OrderEventReturnRejected, "return.reject")
+}
+
+func (app *application) decideReturn(c *gin.Context, status string, eventType string, action string) {
+	r := app.getReturnForAdmin(c)
+	if r == nil {
+		return
+	}
+	before := *r
+
+	var decision returnDecisionRequest
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&decision); err != nil {
+			app.bindingError(c, err)
+			return
+		}
+	}
+
+	r.Admin_Note = decision.Note
+	if !app.transitionReturn(c, r, status, eventType, decision.Note, database.ReturnRequested) {
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: action, Target_Type: auditTargetReturn, Target_Id: r.Id}, &before, r)
+
+	c.JSON(http.StatusOK, r)
+}
+
+// receiveReturn marks a return as received
+//
+//	@Summary		receive return
+//	@Description	record that the books of an approved return arrived and put them back in stock
+//	@Tags			return
+//	@Produce		json
+//	@Param			id	query		int				true	"id of return"
+//	@Success		200	{object}	database.Return	"successfully received"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		403	{object}	problem			"forbidden"
+//	@Failure		404	{object}	problem			"return_not_found"
+//	@Failure		409	{object}	problem			"invalid_return_transition"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/returns/:id/receive [post]
+//	@Security		CookieAuth
+func (app *application) receiveReturn(c *gin.Context) {
+	r := app.getReturnForAdmin(c)
+	if r == nil {
+		return
+	}
+
+	before := *r
+	if !app.transitionReturn(c, r, database.ReturnReceived, database.OrderEventReturnReceived, "", database.ReturnApproved) {
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "return.receive", Target_Type: auditTargetReturn, Target_Id: r.Id}, &before, r)
+
+	c.JSON(http.StatusOK, r)
+}
+
+// refundReturn refunds a return
+//
+//	@Summary		refund return
+//	@Description	refund a received return against the order's payment. Without an amount the share of what was paid for the returned books, after discounts and with their tax, is refunded.
+//	@Tags			return
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		query		int					true	"id of return"
+//	@Param			refund	body		returnRefundRequest	false	"amount to refund"
+//	@Success		200		{object}	database.Return		"successfully refunded"
+//	@Failure		400		{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		403		{object}	problem				"forbidden"
+//	@Failure		404		{object}	problem				"return_not_found"
+//	@Failure		409		{object}	problem				"invalid_return_transition or payment_not_refundable"
+//	@Failure		422		{object}	problem				"currency_mismatch"
+//	@Failure		500		{object}	problem				"internal_error"
+//	@Failure		504		{object}	problem				"payment_provider_timeout"
+//	@Router			/api/v1/returns/:id/refund [post]
+//	@Security		CookieAuth
+func (app *application) refundReturn(c *gin.Context) {
+	r := app.getReturnForAdmin(c)
+	if r == nil {
+		return
+	}
+
+	var request returnRefundRequest
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			app.bindingError(c, err)
+			return
+		}
+	}
+
+	// only refund books that are back in stock
+	if r.Status != database.ReturnReceived {
+		app.errorResponse(c, http.StatusConflict, codeInvalidReturnTransition, fmt.Sprintf("A %s return cannot be refunded.", r.Status))
+		return
+	}
+
+	var amount money.Money
+	if request.Amount != nil {
+		amount = *request.Amount
+	} else {
+		orderItems, err := app.models.Orders.GetOrderItems(r.Order_Id)
+		if err != nil {
+			app.serverError(c, err)
+			return
+		}
+
+		// give back the share of what was paid for each line, after
+		// discounts and with its tax
+		bought := map[int]*database.OrderItem{}
+		for _, item := range orderItems {
+			bought[item.Book_Id] = item
+		}
+		amount = r.Refund_Amount
+		for _, item := range r.Items {
+			line, ok := bought[item.Book_Id]
+			if !ok {
+				continue
+			}
+			paid, err := line.Total.Add(line.Tax)
+			if err != nil {
+				app.serverError(c, err)
+				return
+			}
+			if amount, err = amount.Add(paid.MulRat(int64(item.Quantity), int64(line.Quantity))); err != nil {
+				app.serverError(c, err)
+				return
+			}
+		}
+	}
+
+	payments, err := app.models.Payments.GetPaymentsForOrder(r.Order_Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	var captured *database.Payment
+	for _, p := range payments {
+		if p.Status == database.PaymentCaptured {
+			captured = p
+		}
+	}
+
+	if captured == nil {
+		app.errorResponse(c, http.StatusConflict, codePaymentNotRefundable, "The order has no captured payment to refund.")
+		return
+	}
+
+	before := *r
+
+	// Claim the return before moving money, so concurrent requests cannot
+	// both refund it.
+	r.Status = database.ReturnRefunding
+	if err := app.models.Returns.TransitionReturn(r, database.ReturnReceived, nil); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.errorResponse(c, http.StatusConflict, codeInvalidReturnTransition, "The return was changed by another request.")
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	// The provider refunds each return once, so retrying after a timeout
+	// that did refund moves no more money.
+	if !app.issueRefund(c, captured, amount, fmt.Sprintf("return-%d", r.Id)) {
+		r.Status = database.ReturnReceived
+		if err := app.models.Returns.TransitionReturn(r, database.ReturnRefunding, nil); err != nil {
+			log.Printf("request_id=%s releasing return %d: %v", requestIdFromContext(c), r.Id, err)
+		}
+		return
+	}
+
+	r.Refund_Amount = amount
+	detail := fmt.Sprintf("refunded %s", amount)
+	if !app.transitionReturn(c, r, database.ReturnRefunded, database.OrderEventReturnRefunded, detail, database.ReturnRefunding) {
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "return.refund", Target_Type: auditTargetReturn, Target_Id: r.Id}, &before, r)
+
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/payment"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// paidOrder has the customer buy two copies of a book priced 3 through the
+// cart and pays for the order, leaving it Paid.
+func paidOrder(fake *payment.Fake, url string, admin *http.Client, customer *http.Client) {
+	makeStockedBook(admin, url, "3", "5")
+
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+	doRequest(customer, http.MethodPost, url+"/cart/items", `{"book_id":1, "quantity":2}`)
+	doRequest(customer, http.MethodPost, url+"/cart/checkout", "")
+	doRequest(customer, http.MethodPost, url+"/orders/1/payments", `{"payment_method":"fake_ok"}`)
+
+	for _, webhook := range fake.Webhooks() {
+		postWebhook(url+"/payments/webhook", webhook)
+	}
+}
+
+func TestReturn_Approve_Receive_Refund(t *testing.T) {
+	app := SetupTest()
+	fake := payment.NewFake("test-webhook-secret")
+	app.payments = fake
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+
+	paidOrder(fake, ts.URL+"/api/v1", admin, customer)
+
+	resp, body := doRequest(customer, http.MethodPost, ts.URL+"/api/v1/orders/1/returns", `{"reason":"damaged", "items":[{"book_id":1, "quantity":1}]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "requested", testutils.StringToJSON(body)["status"])
+
+	// only one copy is left to return
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/orders/1/returns", `{"reason":"damaged", "items":[{"book_id":1, "quantity":2}]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeInvalidReturnItems, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/returns/1/approve", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, body = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/returns/1/receive", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeInvalidReturnTransition, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/returns/1/approve", `{"note":"send it back"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the books must be back before the money goes out
+	resp, body = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/returns/1/refund", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeInvalidReturnTransition, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/returns/1/receive", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	book, err := app.models.Books.GetBook(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, 4, book.Stock)
+
+	resp, body = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/returns/1/refund", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	got := testutils.StringToJSON(body)
+	assert.Equal(t, "refunded", got["status"])
+	assert.Equal(t, map[string]any{"amount": float64(3), "currency": "USD"}, got["refund_amount"])
+
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/returns/1/refund", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	payments, err := app.models.Payments.GetPaymentsForOrder(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	assert.Equal(t, money.New(3, "USD"), payments[0].Refunded_Amount)
+	assert.Equal(t, "captured", payments[0].Status)
+
+	events, err := app.models.OrderEvents.GetOrderEvents(1)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		"order_created", "payment_captured", "order_paid",
+		"return_requested", "return_approved", "return_received", "refund_issued", "return_refunded",
+	}, types)
+
+	// the money moved is audited, not just the order history
+	for target, want := range map[string][]string{
+		"target_type=order&target_id=1":  {"order.checkout"},
+		"target_type=payment":            {"payment.refund", "payment.webhook", "payment.create"},
+		"target_type=cart":               {"cart.add_item"},
+		"target_type=return&target_id=1": {"return.refund", "return.receive", "return.approve", "return.create"},
+	} {
+		resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/audit-events?"+target, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var actions []string
+		for _, event := range testutils.StringToJSONArray(body) {
+			actions = append(actions, event["action"].(string))
+		}
+		assert.Equal(t, want, actions, target)
+	}
+}
+
+func TestReturn_Reject(t *testing.T) {
+	app := SetupTest()
+	fake := payment.NewFake("test-webhook-secret")
+	app.payments = fake
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+
+	paidOrder(fake, ts.URL+"/api/v1", admin, customer)
+
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/orders/1/returns", `{"reason":"changed my mind", "items":[{"book_id":1, "quantity":2}]}`)
+
+	resp, body := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/returns/1/reject", `{"note":"outside the return window"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "rejected", testutils.StringToJSON(body)["status"])
+
+	// rejected items can be asked for again
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/orders/1/returns", `{"reason":"damaged", "items":[{"book_id":1, "quantity":2}]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestReturn_Refund_Discounted(t *testing.T) {
+	app := SetupTest()
+	fake := payment.NewFake("test-webhook-secret")
+	app.payments = fake
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "1000", "5")
+	resp, _ := doRequest(admin, http.MethodPost, url+"/promotions", `{"code":"HALF","type":"percent_off","percent_off":50}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+	doRequest(customer, http.MethodPost, url+"/cart/items", `{"book_id":1, "quantity":2}`)
+	resp, _ = doRequest(customer, http.MethodPost, url+"/cart/checkout?code=HALF", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	doRequest(customer, http.MethodPost, url+"/orders/1/payments", `{"payment_method":"fake_ok"}`)
+	for _, webhook := range fake.Webhooks() {
+		postWebhook(url+"/payments/webhook", webhook)
+	}
+
+	doRequest(customer, http.MethodPost, url+"/orders/1/returns", `{"reason":"damaged", "items":[{"book_id":1, "quantity":1}]}`)
+	doRequest(admin, http.MethodPost, url+"/returns/1/approve", "")
+	doRequest(admin, http.MethodPost, url+"/returns/1/receive", "")
+
+	// the customer gets back what they paid for the book, not its list price
+	resp, body := doRequest(admin, http.MethodPost, url+"/returns/1/refund", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]any{"amount": float64(500), "currency": "USD"}, testutils.StringToJSON(body)["refund_amount"])
+}
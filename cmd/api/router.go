@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"net/http"
-	"os"
 
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -13,6 +12,7 @@ import (
 
 func (app *application) routes() http.Handler {
 	g := gin.Default()
+	g.Use(app.RequestIdMiddleware())
 
 	v1 := g.Group("/api/v1")
 
@@ -24,25 +24,139 @@ func (app *application) routes() http.Handler {
 
 		v1.GET("/books/:id", app.getBook)
 		v1.GET("/books", app.getPageOfBooks)
+		v1.GET("/books/isbn/:isbn", app.getBookByIsbn)
+		v1.GET("/books/:id/prices", app.getBookPrices)
+		v1.GET("/books/:id/authors", app.getBookAuthors)
+		v1.GET("/books/:id/categories", app.getBookCategories)
+
+		v1.GET("/authors", app.getAuthors)
+		v1.GET("/authors/:id", app.getAuthor)
+		v1.GET("/authors/:id/books", app.getAuthorBooks)
+		v1.GET("/publishers", app.getPublishers)
+		v1.GET("/publishers/:id", app.getPublisher)
+		v1.GET("/publishers/:id/books", app.getPublisherBooks)
+		v1.GET("/categories", app.getCategories)
+		v1.GET("/categories/:id", app.getCategory)
+		v1.GET("/categories/:id/books", app.getCategoryBooks)
+
+		v1.POST("/payments/webhook", app.paymentWebhook)
+	}
+
+	cartGroup := v1.Group("/cart")
+	cartGroup.Use(app.OptionalAuthMiddleware())
+
+	{
+		cartGroup.GET("", app.getCart)
+		cartGroup.POST("/items", app.addCartItem)
+		cartGroup.PUT("/items/:book_id", app.updateCartItem)
+		cartGroup.DELETE("/items/:book_id", app.removeCartItem)
 	}
 
 	authGroup := v1.Group("/")
-	authGroup.Use(app.AuthMiddleware())
+	authGroup.Use(app.AuthMiddleware(), app.IdempotencyMiddleware())
 
 	{
+		authGroup.GET("/me", app.getMe)
+		authGroup.GET("/me/orders", app.getMyOrders)
+		authGroup.GET("/me/orders/stream", app.streamMyOrders)
+		authGroup.POST("/me/email", app.changeMyEmail)
+		authGroup.POST("/me/password", app.changeMyPassword)
+
 		authGroup.GET("/users/:id", app.getUser)
 		authGroup.PUT("/users/:id", app.updateUser)
+		authGroup.PATCH("/users/:id", app.patchUser)
 		authGroup.DELETE("/users/:id", app.deleteUser)
+		authGroup.POST("/users/:id/restore", app.restoreUser)
+		authGroup.GET("/users/me/addresses", app.getMyAddresses)
+		authGroup.POST("/users/me/addresses", app.createMyAddress)
+		authGroup.GET("/users/me/addresses/:id", app.getMyAddress)
+		authGroup.PUT("/users/me/addresses/:id", app.updateMyAddress)
+		authGroup.DELETE("/users/me/addresses/:id", app.deleteMyAddress)
 
 		authGroup.POST("/books", app.createBook)
 		authGroup.PUT("/books/:id", app.updateBook)
+		authGroup.PATCH("/books/:id", app.patchBook)
 		authGroup.DELETE("/books/:id", app.deleteBook)
+		authGroup.POST("/books/:id/restore", app.restoreBook)
+		authGroup.PUT("/books/:id/prices", app.setBookPrice)
+		authGroup.DELETE("/books/:id/prices/:currency", app.deleteBookPrice)
+		authGroup.PUT("/books/:id/authors", app.setBookAuthors)
+		authGroup.PUT("/books/:id/categories", app.setBookCategories)
+
+		authGroup.POST("/authors", app.createAuthor)
+		authGroup.PUT("/authors/:id", app.updateAuthor)
+		authGroup.DELETE("/authors/:id", app.deleteAuthor)
+		authGroup.POST("/publishers", app.createPublisher)
+		authGroup.PUT("/publishers/:id", app.updatePublisher)
+		authGroup.DELETE("/publishers/:id", app.deletePublisher)
+		authGroup.POST("/categories", app.createCategory)
+		authGroup.PUT("/categories/:id", app.updateCategory)
+		authGroup.DELETE("/categories/:id", app.deleteCategory)
+
+		authGroup.GET("/exchange-rates", app.getExchangeRates)
+		authGroup.POST("/exchange-rates", app.createExchangeRate)
+		authGroup.DELETE("/exchange-rates/:id", app.deleteExchangeRate)
+
+		authGroup.GET("/tax-rates", app.getTaxRates)
+		authGroup.POST("/tax-rates", app.createTaxRate)
+		authGroup.DELETE("/tax-rates/:id", app.deleteTaxRate)
+
+		authGroup.GET("/promotions", app.getPromotions)
+		authGroup.POST("/promotions", app.createPromotion)
+		authGroup.GET("/promotions/:id", app.getPromotion)
+		authGroup.PUT("/promotions/:id", app.updatePromotion)
+		authGroup.DELETE("/promotions/:id", app.deletePromotion)
 
 		authGroup.GET("/orders", app.getPageOfOrders)
+		authGroup.GET("/orders/stream", app.streamOrders)
 		authGroup.GET("/orders/:id", app.getOrder)
 		authGroup.POST("/orders", app.createOrder)
 		authGroup.PUT("/orders/:id", app.updateOrder)
+		authGroup.PATCH("/orders/:id", app.patchOrder)
 		authGroup.DELETE("/orders/:id", app.deleteOrder)
+		authGroup.POST("/orders/:id/restore", app.restoreOrder)
+
+		authGroup.POST("/cart/checkout", app.checkout)
+
+		authGroup.GET("/orders/:id/payments", app.getOrderPayments)
+		authGroup.POST("/orders/:id/payments", app.payOrder)
+		authGroup.POST("/payments/:id/refund", app.refundPayment)
+		authGroup.POST("/payments/:id/void", app.voidPayment)
+
+		authGroup.GET("/orders/:id/history", app.getOrderHistory)
+		authGroup.GET("/orders/:id/invoice", app.getOrderInvoice)
+		authGroup.GET("/orders/:id/returns", app.getOrderReturns)
+		authGroup.POST("/orders/:id/returns", app.requestReturn)
+		authGroup.POST("/returns/:id/approve", app.approveReturn)
+		authGroup.POST("/returns/:id/reject", app.rejectReturn)
+		authGroup.POST("/returns/:id/receive", app.receiveReturn)
+		authGroup.POST("/returns/:id/refund", app.refundReturn)
+		authGroup.GET("/orders/:id/shipments", app.getOrderShipments)
+		authGroup.POST("/orders/:id/shipments", app.createShipment)
+		authGroup.GET("/shipments/:id", app.getShipment)
+		authGroup.PUT("/shipments/:id", app.updateShipment)
+
+		authGroup.GET("/audit-events", app.getAuditEvents)
+		authGroup.GET("/audit-events/export", app.exportAuditEvents)
+
+		authGroup.GET("/imports", app.getImports)
+		authGroup.POST("/imports", app.createImport)
+		authGroup.GET("/imports/:id", app.getImport)
+		authGroup.GET("/imports/:id/report", app.getImportReport)
+
+		authGroup.GET("/jobs", app.getJobs)
+		authGroup.GET("/jobs/:id", app.getJob)
+		authGroup.POST("/jobs/:id/cancel", app.cancelJob)
+		authGroup.POST("/jobs/:id/retry", app.retryJob)
+
+		authGroup.GET("/webhooks", app.getWebhooks)
+		authGroup.POST("/webhooks", app.createWebhook)
+		authGroup.GET("/webhooks/:id", app.getWebhook)
+		authGroup.PUT("/webhooks/:id", app.updateWebhook)
+		authGroup.DELETE("/webhooks/:id", app.deleteWebhook)
+		authGroup.GET("/webhooks/:id/deliveries", app.getWebhookDeliveries)
+		authGroup.GET("/webhooks/:id/deliveries/:delivery_id", app.getWebhookDelivery)
+		authGroup.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", app.redeliverWebhook)
 	}
 
 	v2 := g.Group("/api/v2")
@@ -58,7 +172,7 @@ func (app *application) routes() http.Handler {
 		if c.Request.RequestURI == "/swagger/" {
 			c.Redirect(http.StatusFound, "/swagger/index.html")
 		}
-		url := fmt.Sprintf("http:%s:%s/swagger/doc.json", os.Getenv("DB_HOST"), os.Getenv("PORT"))
+		url := fmt.Sprintf("%s/swagger/doc.json", app.config.BaseURL)
 		ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL(url))(c)
 	})
 
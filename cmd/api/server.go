@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,13 +10,17 @@ import (
 
 func (app *application) serve() error {
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.port),
+		Addr:         fmt.Sprintf(":%d", app.config.Port),
 		Handler:      app.routes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
-	log.Printf("Starting server on port %d", app.port)
+	go app.jobs.Run(context.Background())
+	go app.relay.Run(context.Background())
+	go app.broker.Run(context.Background())
+
+	log.Printf("Starting server on port %d", app.config.Port)
 
 	return server.ListenAndServe()
 }
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/config"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/shipping"
+)
+
+type shipmentRequest struct {
+	Carrier         string                   `json:"carrier" binding:"required,max=32"`
+	Tracking_Number string                   `json:"tracking_number" binding:"required,max=64"`
+	Items           []*database.ShipmentItem `json:"items" binding:"required,min=1,dive"`
+}
+
+type shipmentUpdateRequest struct {
+	Carrier         string `json:"carrier" binding:"required,max=32"`
+	Tracking_Number string `json:"tracking_number" binding:"required,max=64"`
+	Status          string `json:"status" binding:"omitempty,oneof=in_transit out_for_delivery delivered exception"`
+	Note            string `json:"note" binding:"max=256"`
+	Location        string `json:"location" binding:"max=128"`
+}
+
+// newCarrierClient builds the carrier client selected by the configuration.
+func newCarrierClient(cfg *config.Config) shipping.CarrierClient {
+	return shipping.NewFakeCarrier()
+}
+
+// refreshTracking fetches new tracking events for the shipments that have not
+// been delivered yet. Tracking is informational, so a carrier that fails or
+// does not answer in time is logged and the shipment shown as last known.
+func (app *application) refreshTracking(c *gin.Context, shipments []*database.Shipment) {
+	for _, s := range shipments {
+		if s.Status == shipping.StatusDelivered {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), app.config.Shipping.CarrierTimeout)
+		events, err := app.carrier.Track(ctx, s.Carrier, s.Tracking_Number)
+		cancel()
+		if err == nil {
+			err = app.models.Shipments.ApplyTrackingEvents(s, events)
+		}
+		if err != nil {
+			log.Printf("request_id=%s tracking shipment %d: %v", requestIdFromContext(c), s.Id, err)
+		}
+	}
+}
+
+// createShipment ships books of an order
+//
+//	@Summary		create shipment
+//	@Description	record that some or all of the remaining books of a paid order were handed to a carrier. The order moves to Partially Shipped until all of its books are shipped and then to Shipped.
+//	@Tags			shipment
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int					true	"id of order"
+//	@Param			shipment	body		shipmentRequest		true	"carrier, tracking number and books shipped"
+//	@Success		201			{object}	database.Shipment	"successfully created the shipment"
+//	@Header			201			{string}	ETag				"version of the shipment"
+//	@Failure		400			{object}	problem				"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem				"forbidden"
+//	@Failure		404			{object}	problem				"order_not_found"
+//	@Failure		409			{object}	problem				"order_not_shippable or shipment_exists"
+//	@Failure		422			{object}	problem				"invalid_shipment_items"
+//	@Failure		500			{object}	problem				"internal_error"
+//	@Router			/api/v1/orders/:id/shipments [post]
+//	@Security		CookieAuth
+func (app *application) createShipment(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can ship orders.")
+		return
+	}
+
+	order := app.getVisibleOrder(c)
+	if order == nil {
+		return
+	}
+
+	var request shipmentRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if order.Status != database.OrderPaid && order.Status != database.OrderPartiallyShipped {
+		app.errorResponse(c, http.StatusConflict, codeOrderNotShippable, fmt.Sprintf("The order is %s; only paid orders with books left to ship can be shipped.", order.Status))
+		return
+	}
+
+	// Merge repeated books so each one is checked against its total.
+	quantities := map[int]int{}
+	s := &database.Shipment{Order_Id: order.Id, Carrier: request.Carrier, Tracking_Number: request.Tracking_Number}
+	for _, item := range request.Items {
+		if _, seen := quantities[item.Book_Id]; !seen {
+			s.Items = append(s.Items, &database.ShipmentItem{Book_Id: item.Book_Id})
+		}
+		quantities[item.Book_Id] += item.Quantity
+	}
+	for _, item := range s.Items {
+		item.Quantity = quantities[item.Book_Id]
+	}
+
+	if err := app.models.Shipments.CreateShipment(s, user.Id); err != nil {
+		var itemErr *database.ShipmentItemError
+		switch {
+		case errors.Is(err, database.ErrOrderNotShippable):
+			app.errorResponse(c, http.StatusConflict, codeOrderNotShippable, "The order is no longer paid or has no books left to ship.")
+		case errors.As(err, &itemErr) && !itemErr.Ordered:
+			app.errorResponse(c, http.StatusUnprocessableEntity, codeInvalidShipmentItems, fmt.Sprintf("The book with id %d is not part of this order.", itemErr.Book_Id))
+		case errors.As(err, &itemErr):
+			app.errorResponse(c, http.StatusUnprocessableEntity, codeInvalidShipmentItems, fmt.Sprintf("Only %d of the book with id %d are left to ship.", itemErr.Remaining, itemErr.Book_Id))
+		case database.IsUniqueViolation(err):
+			app.errorResponse(c, http.StatusConflict, codeShipmentExists, fmt.Sprintf("A shipment with %s tracking number %s already exists.", s.Carrier, s.Tracking_Number))
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "shipment.create", Target_Type: auditTargetShipment, Target_Id: s.Id}, nil, s)
+
+	setETag(c, s.Version)
+	c.JSON(http.StatusCreated, s)
+}
+
+// getOrderShipments lists the shipments of an order
+//
+//	@Summary		get order shipments
+//	@Description	list the shipments of an order with their tracking events. Shipments not yet delivered are first refreshed from the carrier.
+//	@Tags			shipment
+//	@Produce		json
+//	@Param			id	query		int					true	"id of order"
+//	@Success		200	{array}		database.Shipment	"successfully got the shipments"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		403	{object}	problem				"forbidden"
+//	@Failure		404	{object}	problem				"order_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/orders/:id/shipments [get]
+//	@Security		CookieAuth
+func (app *application) getOrderShipments(c *gin.Context) {
+	order := app.getVisibleOrder(c)
+	if order == nil {
+		return
+	}
+
+	shipments, err := app.models.Shipments.GetShipmentsForOrder(order.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.refreshTracking(c, shipments)
+
+	c.JSON(http.StatusOK, shipments)
+}
+
+// getVisibleShipment loads the shipment named by the id path parameter if it
+// belongs to an order the user may see; shipments of other customers' orders
+// are not found. It returns nil if the request was aborted.
+func (app *application) getVisibleShipment(c *gin.Context) *database.Shipment {
+	user := app.GetUserFromContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The shipment id must be an integer.")
+		return nil
+	}
+
+	s, err := app.models.Shipments.GetShipment(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if s == nil {
+		app.errorResponse(c, http.StatusNotFound, codeShipmentNotFound, fmt.Sprintf("No shipment exists with id %d.", id))
+		return nil
+	}
+
+	if user.Role != "Admin" {
+		order, err := app.models.Orders.GetOrderForUser(s.Order_Id, user.Id)
+		if err != nil {
+			app.serverError(c, err)
+			return nil
+		}
+		if order == nil {
+			app.errorResponse(c, http.StatusNotFound, codeShipmentNotFound, fmt.Sprintf("No shipment exists with id %d.", id))
+			return nil
+		}
+	}
+
+	return s
+}
+
+// getShipment gets a shipment
+//
+//	@Summary		get shipment
+//	@Description	get a shipment with its tracking events by id, refreshing it from the carrier if it has not been delivered yet
+//	@Tags			shipment
+//	@Produce		json
+//	@Param			id	query		int					true	"id of shipment"
+//	@Success		200	{object}	database.Shipment	"successfully got the shipment"
+//	@Header			200	{string}	ETag				"version of the shipment"
+//	@Failure		400	{object}	problem				"invalid_id"
+//	@Failure		404	{object}	problem				"shipment_not_found"
+//	@Failure		500	{object}	problem				"internal_error"
+//	@Router			/api/v1/shipments/:id [get]
+//	@Security		CookieAuth
+func (app *application) getShipment(c *gin.Context) {
+	s := app.getVisibleShipment(c)
+	if s == nil {
+		return
+	}
+
+	app.refreshTracking(c, []*database.Shipment{s})
+
+	if app.notModified(c, s.Version) {
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+// updateShipment updates a shipment
+//
+//	@Summary		update shipment
+//	@Description	correct a shipment's carrier or tracking number, or move it to a new status when the carrier does not report it. Shipments only move forward, except that one not yet delivered can run into an exception and recover from it. The order moves to Delivered once all of its books are delivered.
+//	@Tags			shipment
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int						true	"id of shipment"
+//	@Param			If-Match	header		string					true	"current ETag of the shipment"
+//	@Param			shipment	body		shipmentUpdateRequest	true	"updated shipment"
+//	@Success		200			{object}	database.Shipment		"successfully updated the shipment"
+//	@Header			200			{string}	ETag					"new version of the shipment"
+//	@Failure		400			{object}	problem					"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem					"forbidden"
+//	@Failure		404			{object}	problem					"shipment_not_found"
+//	@Failure		409			{object}	problem					"invalid_shipment_transition or shipment_exists"
+//	@Failure		412			{object}	problem					"precondition_failed"
+//	@Failure		428			{object}	problem					"precondition_required"
+//	@Failure		500			{object}	problem					"internal_error"
+//	@Router			/api/v1/shipments/:id [put]
+//	@Security		CookieAuth
+func (app *application) updateShipment(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can update shipments.")
+		return
+	}
+
+	s := app.getVisibleShipment(c)
+	if s == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, s.Version) {
+		return
+	}
+	before := *s
+
+	var request shipmentUpdateRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	var event *shipping.TrackingEvent
+	if request.Status != "" && request.Status != s.Status {
+		if !shipping.CanMove(s.Status, request.Status) {
+			app.errorResponse(c, http.StatusConflict, codeInvalidShipmentTransition, fmt.Sprintf("A shipment that is %s cannot move to %s.", s.Status, request.Status))
+			return
+		}
+
+		event = &shipping.TrackingEvent{
+			Status:      request.Status,
+			Description: request.Note,
+			Location:    request.Location,
+			Occurred_At: time.Now().UTC(),
+		}
+		s.Status = request.Status
+	}
+
+	s.Carrier, s.Tracking_Number = request.Carrier, request.Tracking_Number
+
+	if err := app.models.Shipments.UpdateShipment(s, event, user.Id); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsUniqueViolation(err):
+			app.errorResponse(c, http.StatusConflict, codeShipmentExists, fmt.Sprintf("A shipment with %s tracking number %s already exists.", s.Carrier, s.Tracking_Number))
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "shipment.update", Target_Type: auditTargetShipment, Target_Id: s.Id}, &before, s)
+
+	setETag(c, s.Version)
+	c.JSON(http.StatusOK, s)
+}
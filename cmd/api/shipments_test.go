@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/payment"
+	"github.com/hamorrar/bookstore/internal/shipping"
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShipment_SplitAndTrack(t *testing.T) {
+	app := SetupTest()
+	fake := payment.NewFake("test-webhook-secret")
+	app.payments = fake
+	carrier := shipping.NewFakeCarrier()
+	app.carrier = carrier
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+
+	paidOrder(fake, ts.URL+"/api/v1", admin, customer)
+
+	resp, _ := doRequest(customer, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", `{"carrier":"ups", "tracking_number":"1Z1", "items":[{"book_id":1, "quantity":1}]}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, body := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", `{"carrier":"ups", "tracking_number":"1Z1", "items":[{"book_id":1, "quantity":1}]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, shipping.StatusInTransit, testutils.StringToJSON(body)["status"])
+
+	_, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, "Partially Shipped", testutils.StringToJSON(body)["status"])
+
+	// only one copy is left to ship
+	resp, body = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", `{"carrier":"ups", "tracking_number":"1Z2", "items":[{"book_id":1, "quantity":2}]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeInvalidShipmentItems, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", `{"carrier":"ups", "tracking_number":"1Z1", "items":[{"book_id":1, "quantity":1}]}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeShipmentExists, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", `{"carrier":"ups", "tracking_number":"1Z2", "items":[{"book_id":1, "quantity":1}]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	_, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, "Shipped", testutils.StringToJSON(body)["status"])
+
+	resp, body = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", `{"carrier":"ups", "tracking_number":"1Z3", "items":[{"book_id":1, "quantity":1}]}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeOrderNotShippable, testutils.StringToJSON(body)["code"])
+
+	// the customer sees the carrier's tracking events
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1/shipments", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	shipments := testutils.StringToJSONArray(body)
+	require.Len(t, shipments, 2)
+	events := shipments[0]["events"].([]any)
+	require.Len(t, events, 1)
+	assert.Equal(t, "Picked up by ups", events[0].(map[string]any)["description"])
+
+	carrier.Push("ups", "1Z1", shipping.StatusDelivered, "Left at front door")
+	carrier.Push("ups", "1Z2", shipping.StatusDelivered, "Left at front door")
+
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/shipments/1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, shipping.StatusDelivered, testutils.StringToJSON(body)["status"])
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	_, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, "Shipped", testutils.StringToJSON(body)["status"])
+
+	doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1/shipments", "")
+
+	_, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, "Delivered", testutils.StringToJSON(body)["status"])
+
+	// delivered shipments cannot go back
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/shipments/1",
+		strings.NewReader(`{"carrier":"ups", "tracking_number":"1Z1", "status":"in_transit"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"2"`)
+	resp, err := admin.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, body = doRequest(admin, http.MethodGet, ts.URL+"/api/v1/orders/1/history", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "order_shipped")
+	assert.Contains(t, body, "order_delivered")
+}
+
+func TestShipment_Concurrent(t *testing.T) {
+	app := SetupTest()
+	fake := payment.NewFake("test-webhook-secret")
+	app.payments = fake
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+
+	paidOrder(fake, ts.URL+"/api/v1", admin, customer)
+
+	// the order has two copies, so only two of the shipments go out
+	created := make(chan bool, 4)
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := fmt.Sprintf(`{"carrier":"ups", "tracking_number":"1Z%d", "items":[{"book_id":1, "quantity":1}]}`, i)
+			resp, _ := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", payload)
+			created <- resp.StatusCode == http.StatusCreated
+		}()
+	}
+	wg.Wait()
+	close(created)
+
+	count := 0
+	for ok := range created {
+		if ok {
+			count++
+		}
+	}
+	assert.Equal(t, 2, count)
+
+	_, body := doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, "Shipped", testutils.StringToJSON(body)["status"])
+}
+
+func TestShipment_AdminUpdate(t *testing.T) {
+	app := SetupTest()
+	fake := payment.NewFake("test-webhook-secret")
+	app.payments = fake
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+
+	paidOrder(fake, ts.URL+"/api/v1", admin, customer)
+
+	resp, _ := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders/1/shipments", `{"carrier":"dhl", "tracking_number":"JD1", "items":[{"book_id":1, "quantity":2}]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/shipments/1",
+		strings.NewReader(`{"carrier":"dhl", "tracking_number":"JD1", "status":"delivered", "note":"Signed for by A. Lovelace"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp, err := admin.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	_, body := doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, "Delivered", testutils.StringToJSON(body)["status"])
+
+	// delivered orders can still be returned
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/orders/1/returns", `{"reason":"damaged", "items":[{"book_id":1, "quantity":1}]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/events"
+)
+
+// streamBacklogBatchSize is how many missed events are read at once when a
+// client resumes a stream.
+const streamBacklogBatchSize = 100
+
+// streamMyOrders streams status changes of the user's orders
+//
+//	@Summary		stream my order status changes
+//	@Description	streams an order.status_changed Server-Sent Event whenever one of the logged in user's orders changes status. Each event's data is the event as JSON. A comment is sent as a heartbeat while nothing happens. Each event's id is the client's position in the stream: the id of the latest event sent, followed by a colon and the ids of earlier events that were still committing, if any. A client that reconnects with Last-Event-ID first gets the events it missed, each once.
+//	@Tags			me
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"id of the last event received, to resume after"
+//	@Success		200				{string}	string	"stream of events"
+//	@Failure		400				{object}	problem	"invalid_query"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Router			/api/v1/me/orders/stream [get]
+//	@Security		CookieAuth
+func (app *application) streamMyOrders(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+
+	app.streamEvents(c, database.OutboxEventFilter{Types: []string{database.EventOrderStatusChanged}, User_Id: user.Id})
+}
+
+// streamOrders streams new orders
+//
+//	@Summary		stream new orders
+//	@Description	streams an order.created Server-Sent Event whenever any order is placed. Each event's data is the event as JSON. A comment is sent as a heartbeat while nothing happens. Each event's id is the client's position in the stream: the id of the latest event sent, followed by a colon and the ids of earlier events that were still committing, if any. A client that reconnects with Last-Event-ID first gets the events it missed, each once.
+//	@Tags			order
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"id of the last event received, to resume after"
+//	@Success		200				{string}	string	"stream of events"
+//	@Failure		400				{object}	problem	"invalid_query"
+//	@Failure		403				{object}	problem	"forbidden"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Router			/api/v1/orders/stream [get]
+//	@Security		CookieAuth
+func (app *application) streamOrders(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can stream all orders.")
+		return
+	}
+
+	app.streamEvents(c, database.OutboxEventFilter{Types: []string{database.EventOrderCreated}})
+}
+
+// streamEvents sends the events filter matches as Server-Sent Events until
+// the client goes away. Live events come from the broker; on resume, the
+// events the client missed are read from the outbox first and sent a page at
+// a time. Each event's id is the client's cursor after it, which the client
+// sends back as Last-Event-ID.
+func (app *application) streamEvents(c *gin.Context, filter database.OutboxEventFilter) {
+	stream := &eventStream{c: c, outbox: &app.models.Outbox, filter: filter}
+
+	resuming := false
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		cursor, err := parseStreamCursor(header)
+		if err != nil {
+			app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, "Last-Event-ID must be an event id sent by this stream.")
+			return
+		}
+		stream.cursor, stream.checked, resuming = cursor, cursor.high, true
+	}
+
+	// subscribe before reading the backlog so nothing is missed in between
+	sub := app.broker.Subscribe(func(e events.Event) bool { return eventMatches(e, filter) })
+	defer sub.Close()
+
+	var missed []*database.OutboxEvent
+	page := filter
+	page.Limit = streamBacklogBatchSize
+	if resuming {
+		page.After = stream.cursor.high
+		if len(stream.cursor.gaps) > 0 {
+			page.After = stream.cursor.gaps[0] - 1
+		}
+		var err error
+		if missed, err = app.models.Outbox.GetOutboxEvents(page); err != nil {
+			app.serverError(c, err)
+			return
+		}
+	} else if err := stream.start(); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	// streams outlive the server's write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for len(missed) > 0 {
+		last := missed[len(missed)-1].Id
+		for _, e := range missed {
+			if !stream.send(events.NewEvent(e), last) {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		if len(missed) < streamBacklogBatchSize {
+			break
+		}
+		page.After = last
+		var err error
+		if missed, err = app.models.Outbox.GetOutboxEvents(page); err != nil {
+			log.Printf("request_id=%s reading missed events: %v", requestIdFromContext(c), err)
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(app.config.Events.StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.Events():
+			// dropped for falling behind, or the server is stopping; the
+			// client reconnects and resumes
+			if !ok {
+				return
+			}
+			if !stream.send(e, e.Id) {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// maxStreamGaps bounds the gaps a Last-Event-ID may list.
+const maxStreamGaps = 1000
+
+// streamCursor is how far a client got in a stream: it was sent every event
+// the stream matches up to high, except those with the ids in gaps. Those
+// had not committed yet when a later event was sent, as ids are taken when
+// events are recorded rather than when they commit. It is written as high
+// alone or as high, a colon and the gaps separated by commas.
+type streamCursor struct {
+	high int64
+	gaps []int64
+}
+
+func parseStreamCursor(s string) (streamCursor, error) {
+	var cursor streamCursor
+	errInvalid := fmt.Errorf("invalid stream cursor %q", s)
+
+	high, gaps, found := strings.Cut(s, ":")
+	var err error
+	if cursor.high, err = strconv.ParseInt(high, 10, 64); err != nil || cursor.high < 0 {
+		return cursor, errInvalid
+	}
+	if !found {
+		return cursor, nil
+	}
+
+	fields := strings.Split(gaps, ",")
+	if len(fields) > maxStreamGaps {
+		return cursor, errInvalid
+	}
+	for _, field := range fields {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || id <= 0 || id >= cursor.high {
+			return cursor, errInvalid
+		}
+		cursor.gaps = append(cursor.gaps, id)
+	}
+	slices.Sort(cursor.gaps)
+	cursor.gaps = slices.Compact(cursor.gaps)
+	return cursor, nil
+}
+
+func (cursor streamCursor) String() string {
+	if len(cursor.gaps) == 0 {
+		return strconv.FormatInt(cursor.high, 10)
+	}
+	gaps := make([]string, len(cursor.gaps))
+	for i, id := range cursor.gaps {
+		gaps[i] = strconv.FormatInt(id, 10)
+	}
+	return strconv.FormatInt(cursor.high, 10) + ":" + strings.Join(gaps, ",")
+}
+
+// has reports whether the client was sent the event with the given id.
+func (cursor streamCursor) has(id int64) bool {
+	return id <= cursor.high && !slices.Contains(cursor.gaps, id)
+}
+
+// eventStream writes events to a client once each and keeps its cursor.
+type eventStream struct {
+	c      *gin.Context
+	outbox *database.OutboxModel
+	filter database.OutboxEventFilter
+	cursor streamCursor
+	// pending are the ids above the cursor and up to checked that the client
+	// may still be sent, and lookback the id below which events are taken to
+	// have committed.
+	checked  int64
+	pending  []int64
+	lookback int64
+}
+
+// start sets the cursor of a new stream to the latest event, with the
+// events still committing before it as gaps, as those are sent live.
+func (s *eventStream) start() error {
+	latest, err := s.outbox.GetLatestOutboxId()
+	if err != nil {
+		return err
+	}
+	if s.lookback, err = s.outbox.GetOutboxLookbackId(latest, events.Lookback); err != nil {
+		return err
+	}
+	gaps, err := s.outbox.GetOutboxGaps(nil, s.lookback, latest)
+	if err != nil {
+		return err
+	}
+	s.cursor, s.checked = streamCursor{high: latest, gaps: gaps}, latest
+	return nil
+}
+
+// send writes e unless the client has it already, with the cursor after it
+// as its id. upTo is the highest id about to be sent, which lets a page of
+// events share one look at the outbox. It reports whether the stream is
+// still open.
+func (s *eventStream) send(e events.Event, upTo int64) bool {
+	if s.cursor.has(e.Id) {
+		return true
+	}
+
+	if e.Id > s.checked {
+		upTo = max(upTo, e.Id)
+		lookback, err := s.outbox.GetOutboxLookbackId(upTo, events.Lookback)
+		if err != nil {
+			log.Printf("request_id=%s looking back from event %d: %v", requestIdFromContext(s.c), upTo, err)
+			return false
+		}
+		ids, err := s.outbox.GetOutboxGaps(&s.filter, max(s.checked, lookback), upTo)
+		if err != nil {
+			log.Printf("request_id=%s finding gaps before event %d: %v", requestIdFromContext(s.c), upTo, err)
+			return false
+		}
+		s.pending = append(s.pending, ids...)
+		s.checked, s.lookback = upTo, lookback
+	}
+
+	// ids below the new high that the client was not sent become gaps,
+	// unless they are too old to still be committing
+	next := streamCursor{high: max(s.cursor.high, e.Id)}
+	for _, id := range s.cursor.gaps {
+		if id != e.Id && id > s.lookback {
+			next.gaps = append(next.gaps, id)
+		}
+	}
+	pending := s.pending[:0]
+	for _, id := range s.pending {
+		switch {
+		case id == e.Id:
+		case id < next.high:
+			if id > s.lookback {
+				next.gaps = append(next.gaps, id)
+			}
+		default:
+			pending = append(pending, id)
+		}
+	}
+	s.pending = pending
+	slices.Sort(next.gaps)
+
+	if !writeEvent(s.c, next.String(), e) {
+		return false
+	}
+	s.cursor = next
+	return true
+}
+
+// eventMatches reports whether the event is one the filter selects.
+func eventMatches(e events.Event, filter database.OutboxEventFilter) bool {
+	if len(filter.Types) > 0 && !slices.Contains(filter.Types, e.Type) {
+		return false
+	}
+	if filter.User_Id != 0 {
+		var data struct {
+			User_Id int `json:"user_id"`
+		}
+		if err := json.Unmarshal(e.Data, &data); err != nil || data.User_Id != filter.User_Id {
+			return false
+		}
+	}
+	return true
+}
+
+// writeEvent writes the event with the given id in the text/event-stream
+// format and reports whether it could.
+func writeEvent(c *gin.Context, id string, e events.Event) bool {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", id, e.Type, data)
+	return err == nil
+}
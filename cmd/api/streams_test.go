@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is a Server-Sent Event as read by a client.
+type sseEvent struct {
+	id, event, data string
+}
+
+// openStream starts streaming from url, resuming after lastEventId if it is
+// not empty. The stream is closed when the test ends.
+func openStream(t *testing.T, client *http.Client, url, lastEventId string) (*http.Response, *bufio.Reader) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readEvent reads the next event from the stream, skipping heartbeats.
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && e.id != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// cancelledOrder checks out a book for the customer and cancels the order,
+// which changes its status. It returns the order's id.
+func cancelledOrder(t *testing.T, customer *http.Client, url string) float64 {
+	doRequest(customer, http.MethodPost, url+"/cart/items", `{"book_id":1, "quantity":1}`)
+	resp, body := doRequest(customer, http.MethodPost, url+"/cart/checkout", "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	id := testutils.StringToJSON(body)["id"].(float64)
+
+	resp, _ = doIfMatch(customer, http.MethodPatch, fmt.Sprintf("%s/orders/%v", url, id), `"1"`, `{"status":"Cancelled"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return id
+}
+
+func TestStreams(t *testing.T) {
+	app := SetupTest()
+	app.config.Events.StreamHeartbeat = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.broker.Run(ctx)
+	select {
+	case <-app.broker.Ready():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the broker did not start listening")
+	}
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "3", "5")
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+
+	resp, adminStream := openStream(t, admin, url+"/orders/stream", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	resp, customerStream := openStream(t, customer, url+"/me/orders/stream", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// idle streams get heartbeats
+	line, err := customerStream.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": heartbeat\n", line)
+
+	doRequest(customer, http.MethodPost, url+"/cart/items", `{"book_id":1, "quantity":1}`)
+	resp, _ = doRequest(customer, http.MethodPost, url+"/cart/checkout", "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// new orders go to admins; the relay has nothing to do with it
+	e := readEvent(t, adminStream)
+	assert.Equal(t, "order.created", e.event)
+	created := testutils.StringToJSON(e.data)
+	assert.Equal(t, e.id, fmt.Sprint(created["id"]))
+	assert.Equal(t, float64(1), created["data"].(map[string]any)["order_id"])
+
+	resp, _ = doIfMatch(customer, http.MethodPatch, url+"/orders/1", `"1"`, `{"status":"Cancelled"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// status changes go to the order's owner
+	e = readEvent(t, customerStream)
+	assert.Equal(t, "order.status_changed", e.event)
+	changed := testutils.StringToJSON(e.data)
+	assert.Equal(t, map[string]any{"order_id": float64(1), "user_id": float64(2), "old_status": "Pending", "new_status": "Cancelled"}, changed["data"])
+	cancelledId := e.id
+
+	// a client that reconnects gets what it missed first
+	cancelledOrder(t, customer, url)
+	cancelledOrder(t, customer, url)
+
+	resp, resumed := openStream(t, customer, url+"/me/orders/stream", cancelledId)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	e = readEvent(t, resumed)
+	assert.Equal(t, float64(2), testutils.StringToJSON(e.data)["data"].(map[string]any)["order_id"])
+	e = readEvent(t, resumed)
+	assert.Equal(t, float64(3), testutils.StringToJSON(e.data)["data"].(map[string]any)["order_id"])
+
+	// and then live events, once each
+	cancelledOrder(t, customer, url)
+	e = readEvent(t, resumed)
+	assert.Equal(t, float64(4), testutils.StringToJSON(e.data)["data"].(map[string]any)["order_id"])
+}
+
+func TestStreams_LateEvents(t *testing.T) {
+	app := SetupTest()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.broker.Run(ctx)
+	select {
+	case <-app.broker.Ready():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the broker did not start listening")
+	}
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	makeStockedBook(admin, url, "3", "5")
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+
+	resp, stream := openStream(t, customer, url+"/me/orders/stream", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// an event recorded before the next one commits after it
+	tx, err := app.models.Outbox.DB.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	var lateId int64
+	err = tx.QueryRow(`insert into outbox_events (outbox_event_type, outbox_event_aggregate_type, outbox_event_aggregate_id, outbox_event_data)
+		values ('order.status_changed', 'order', 1, '{"order_id":1,"user_id":2,"old_status":"Cancelled","new_status":"Late"}')
+		returning outbox_event_id`).Scan(&lateId)
+	require.NoError(t, err)
+
+	// the cursor sent with the later event leaves a gap for it
+	cancelledOrder(t, customer, url)
+	e := readEvent(t, stream)
+	laterId := int64(testutils.StringToJSON(e.data)["id"].(float64))
+	assert.Equal(t, fmt.Sprintf("%d:%d", laterId, lateId), e.id)
+	resp.Body.Close()
+	require.NoError(t, tx.Commit())
+
+	// resuming sends only the late event, and then live events once each
+	resp, resumed := openStream(t, customer, url+"/me/orders/stream", e.id)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	e = readEvent(t, resumed)
+	assert.Equal(t, "Late", testutils.StringToJSON(e.data)["data"].(map[string]any)["new_status"])
+	assert.Equal(t, fmt.Sprint(laterId), e.id)
+
+	cancelledOrder(t, customer, url)
+	e = readEvent(t, resumed)
+	live := testutils.StringToJSON(e.data)
+	assert.Equal(t, float64(2), live["data"].(map[string]any)["order_id"])
+	assert.Equal(t, fmt.Sprint(live["id"]), e.id)
+}
+
+func TestStreams_Errors(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+
+	resp, body := doRequest(customer, http.MethodGet, url+"/orders/stream", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, codeForbidden, testutils.StringToJSON(body)["code"])
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/me/orders/stream", nil)
+	req.Header.Set("Last-Event-ID", "yesterday")
+	resp, err := customer.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// gaps must lie below the cursor
+	req.Header.Set("Last-Event-ID", "5:7")
+	resp, err = customer.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = doRequest(&http.Client{}, http.MethodGet, url+"/me/orders/stream", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestStreamCursor(t *testing.T) {
+	cursor, err := parseStreamCursor("42:41,40,41")
+	require.NoError(t, err)
+	assert.Equal(t, "42:40,41", cursor.String())
+	assert.True(t, cursor.has(39))
+	assert.False(t, cursor.has(40))
+	assert.True(t, cursor.has(42))
+	assert.False(t, cursor.has(43))
+
+	cursor, err = parseStreamCursor("42")
+	require.NoError(t, err)
+	assert.Equal(t, "42", cursor.String())
+
+	for _, s := range []string{"", "-1", "42:", "42:0", "42:42", "42:x", "x:1"} {
+		_, err := parseStreamCursor(s)
+		assert.Error(t, err, s)
+	}
+}
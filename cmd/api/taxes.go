@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/promotion"
+	"github.com/hamorrar/bookstore/internal/tax"
+)
+
+// getTaxRates gets tax rates
+//
+//	@Summary		gets tax rates
+//	@Description	gets the tax rules, including past and future ones, by region and category with the latest effective first
+//	@Tags			tax
+//	@Produce		json
+//	@Param			region	query		string		false	"region to get the rules of"
+//	@Success		200		{array}		tax.Rule	"successfully got tax rates"
+//	@Failure		403		{object}	problem		"forbidden"
+//	@Failure		500		{object}	problem		"internal_error"
+//	@Router			/api/v1/tax-rates [get]
+//	@Security		CookieAuth
+func (app *application) getTaxRates(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage tax rates.")
+		return
+	}
+
+	var regions []string
+	if region := strings.ToUpper(c.Query("region")); region != "" {
+		regions = append(regions, region)
+	}
+
+	rules, err := app.models.TaxRates.GetTaxRates(regions...)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// createTaxRate creates a tax rate
+//
+//	@Summary		creates a tax rate
+//	@Description	adds a tax rule for a region and book category, or every category if it is left empty, that applies from effective_at, or from now if it is left out. The rate is a fraction, so 0.0725 is 7.25% and 0 exempts the category.
+//	@Tags			tax
+//	@Accept			json
+//	@Produce		json
+//	@Param			rule			body		tax.Rule	true	"new tax rule"
+//	@Param			Idempotency-Key	header		string		false	"key that makes retries of this request safe"
+//	@Success		201				{object}	tax.Rule	"successfully created a tax rate"
+//	@Failure		400				{object}	problem		"malformed_body or validation_failed"
+//	@Failure		403				{object}	problem		"forbidden"
+//	@Failure		409				{object}	problem		"tax_rate_exists or idempotency_key_in_use"
+//	@Failure		422				{object}	problem		"idempotency_key_reused"
+//	@Failure		500				{object}	problem		"internal_error"
+//	@Router			/api/v1/tax-rates [post]
+//	@Security		CookieAuth
+func (app *application) createTaxRate(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage tax rates.")
+		return
+	}
+
+	var rule tax.Rule
+
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	if rule.Effective_At.IsZero() {
+		rule.Effective_At = time.Now()
+	}
+
+	if err := app.models.TaxRates.CreateTaxRate(&rule); err != nil {
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeTaxRateExists,
+				fmt.Sprintf("A tax rate for %s already takes effect at that time.", rule.Region))
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "tax_rate.create", Target_Type: auditTargetTaxRate, Target_Id: int(rule.Id)}, nil, rule)
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// deleteTaxRate deletes a tax rate
+//
+//	@Summary		delete tax rate
+//	@Description	delete a tax rule that has not taken effect yet; rules that did are kept as history
+//	@Tags			tax
+//	@Produce		json
+//	@Param			id	query	int	true	"id of tax rate to delete"
+//	@Success		204	"successfully deleted"
+//	@Failure		400	{object}	problem	"invalid_id"
+//	@Failure		403	{object}	problem	"forbidden"
+//	@Failure		404	{object}	problem	"tax_rate_not_found"
+//	@Failure		409	{object}	problem	"tax_rate_in_effect"
+//	@Failure		500	{object}	problem	"internal_error"
+//	@Router			/api/v1/tax-rates/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deleteTaxRate(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage tax rates.")
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		app.invalidId(c, "The tax rate id must be an integer.")
+		return
+	}
+
+	rule, err := app.models.TaxRates.GetTaxRate(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if rule == nil {
+		app.errorResponse(c, http.StatusNotFound, codeTaxRateNotFound, fmt.Sprintf("No tax rate exists with id %d.", id))
+		return
+	}
+
+	deleted, err := app.models.TaxRates.DeleteTaxRate(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if !deleted {
+		app.errorResponse(c, http.StatusConflict, codeTaxRateInEffect, "The tax rate has already taken effect and is kept as history.")
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "tax_rate.delete", Target_Type: auditTargetTaxRate, Target_Id: int(rule.Id)}, rule, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// invoice is an order laid out for billing: what was bought, the discounts
+// and the tax charged on each line and the totals, so that Total is Subtotal
+// less Discount_Total plus Shipping_Total and Tax_Total.
+type invoice struct {
+	Order_Id           int                   `json:"order_id"`
+	User_Id            int                   `json:"user_id"`
+	Status             string                `json:"status"`
+	Items              []*database.OrderItem `json:"items"`
+	Subtotal           money.Money           `json:"subtotal"`
+	Discounts          []promotion.Discount  `json:"discounts"`
+	Discount_Total     money.Money           `json:"discount_total"`
+	Shipping_Total     money.Money           `json:"shipping_total"`
+	Tax_Region         string                `json:"tax_region,omitempty"`
+	Tax_Lines          []tax.LineTax         `json:"tax_lines"`
+	Tax_Total          money.Money           `json:"tax_total"`
+	Total              money.Money           `json:"total"`
+	Exchange_Rate_From string                `json:"exchange_rate_from,omitempty"`
+	Exchange_Rate      string                `json:"exchange_rate,omitempty"`
+	Shipping_Address   *database.Address     `json:"shipping_address,omitempty"`
+	Billing_Address    *database.Address     `json:"billing_address,omitempty"`
+}
+
+// getOrderInvoice gets the invoice of an order
+//
+//	@Summary		get order invoice
+//	@Description	get the invoice of an order with its items, discounts, the tax on each line, its addresses and the subtotal, discount, shipping, tax and total
+//	@Tags			order
+//	@Produce		json
+//	@Param			id	query		int		true	"id of order"
+//	@Success		200	{object}	invoice	"successfully got the invoice"
+//	@Failure		400	{object}	problem	"invalid_id"
+//	@Failure		403	{object}	problem	"forbidden"
+//	@Failure		404	{object}	problem	"order_not_found"
+//	@Failure		500	{object}	problem	"internal_error"
+//	@Router			/api/v1/orders/:id/invoice [get]
+//	@Security		CookieAuth
+func (app *application) getOrderInvoice(c *gin.Context) {
+	order := app.getVisibleOrder(c)
+	if order == nil {
+		return
+	}
+
+	items, err := app.models.Orders.GetOrderItems(order.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	taxLines, err := app.models.Orders.GetOrderTaxLines(order.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	discounts, err := app.models.Orders.GetOrderDiscounts(order.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	taxTotal := order.Tax_Total
+	if order.Tax_Region == "" {
+		taxTotal = money.New(0, order.Total_Price.Currency)
+	}
+
+	discountTotal := order.Discount_Total
+	if discountTotal.Currency == "" {
+		discountTotal = money.New(0, order.Total_Price.Currency)
+	}
+
+	shippingTotal := order.Shipping_Total
+	if shippingTotal.Currency == "" {
+		shippingTotal = money.New(0, order.Total_Price.Currency)
+	}
+
+	subtotal, err := order.Total_Price.Sub(taxTotal)
+	if err == nil {
+		subtotal, err = subtotal.Sub(shippingTotal)
+	}
+	if err == nil {
+		subtotal, err = subtotal.Add(discountTotal)
+	}
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice{
+		Order_Id:           order.Id,
+		User_Id:            order.User_Id,
+		Status:             order.Status,
+		Items:              items,
+		Subtotal:           subtotal,
+		Discounts:          discounts,
+		Discount_Total:     discountTotal,
+		Shipping_Total:     shippingTotal,
+		Tax_Region:         order.Tax_Region,
+		Tax_Lines:          taxLines,
+		Tax_Total:          taxTotal,
+		Total:              order.Total_Price,
+		Exchange_Rate_From: order.Exchange_Rate_From,
+		Exchange_Rate:      order.Exchange_Rate,
+		Shipping_Address:   order.Shipping_Address,
+		Billing_Address:    order.Billing_Address,
+	})
+}
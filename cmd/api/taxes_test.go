@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckout_WithTax(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	testutils.RegisterAdmin(admin, ts.URL+"/api/v1")
+	testutils.LoginAdmin(admin, ts.URL+"/api/v1")
+	doRequest(admin, http.MethodPost, ts.URL+"/api/v1/books", `{"title":"Title1", "author":"First","price":{"amount":1000,"currency":"USD"},"stock":5,"tax_category":"book"}`)
+	doRequest(admin, http.MethodPost, ts.URL+"/api/v1/books", `{"title":"Title2", "author":"First","price":{"amount":999,"currency":"USD"},"stock":5,"tax_category":"ebook"}`)
+
+	resp, _ := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/tax-rates", `{"region":"US-CA","name":"CA sales tax","rate":"0.0725","effective_at":"2024-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/tax-rates", `{"region":"US-CA","category":"book","name":"CA sales tax","rate":"0","effective_at":"2024-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/tax-rates", `{"region":"California","name":"CA sales tax","rate":"7.25"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeValidationFailed, testutils.StringToJSON(body)["code"])
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":1, "quantity":1}`)
+	doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/items", `{"book_id":2, "quantity":1}`)
+
+	// with tax rates in place an order cannot be placed without an address
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeAddressRequired, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/users/me/addresses", `{"name":"Ada Lovelace","line1":"1 Market St","city":"San Francisco","region":"CA","postal_code":"94103","country":"US"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// the region comes from the address, not the request
+	resp, body = doRequest(customer, http.MethodPost, ts.URL+"/api/v1/cart/checkout?region=DE", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	got := testutils.StringToJSON(body)
+	assert.Equal(t, map[string]any{"amount": float64(2669), "currency": "USD"}, got["total_price"]) // 1999 + 598 shipping + 72
+	assert.Equal(t, map[string]any{"amount": float64(72), "currency": "USD"}, got["tax_total"])
+	assert.Equal(t, "US-CA", got["tax_region"])
+
+	resp, body = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/orders/1/invoice", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	got = testutils.StringToJSON(body)
+	assert.Equal(t, map[string]any{"amount": float64(1999), "currency": "USD"}, got["subtotal"])
+	assert.Equal(t, map[string]any{"amount": float64(2669), "currency": "USD"}, got["total"])
+	taxLines := got["tax_lines"].([]any)
+	assert.Len(t, taxLines, 2)
+	assert.Equal(t, "0", taxLines[0].(map[string]any)["rate"])
+	assert.Equal(t, "0.0725", taxLines[1].(map[string]any)["rate"])
+	assert.Equal(t, map[string]any{"amount": float64(72), "currency": "USD"}, taxLines[1].(map[string]any)["tax_amount"])
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -16,14 +18,14 @@ import (
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{array}		database.User	"successfully got all users"
-//	@Failure		500	{object}	gin.H			"error getting all users"
-//	@Failure		403	{object}	gin.H			"wrong role"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Failure		403	{object}	problem			"forbidden"
 //	@Router			/api/v2/users/all [get]
 //	@Security		CookieAuth
 func (app *application) getAllUsers(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to get all users"})
+		app.forbidden(c, "Only admins can list all users.")
 		return
 	}
 
@@ -33,7 +35,7 @@ func (app *application) getAllUsers(c *gin.Context) {
 	for {
 		users, err := app.models.Users.GetPageOfUsers(limit, page)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to get all users page by page."})
+			app.serverError(c, err)
 			return
 		}
 
@@ -54,35 +56,42 @@ func (app *application) getAllUsers(c *gin.Context) {
 //	@Tags			user
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	query		int				true	"id of user to get"
-//	@Success		200	{object}	database.User	"successfully got a user"
-//	@Failure		400	{object}	gin.H			"invalid user id"
-//	@Failure		404	{object}	gin.H			"user not found with this id"
-//	@Failure		500	{object}	gin.H			"error getting user"
-//	@Failure		403	{object}	gin.H			"wrong role/unauthorized"
+//	@Param			id				query		int				true	"id of user to get"
+//	@Param			If-None-Match	header		string			false	"ETag from a previous response"
+//	@Success		200				{object}	database.User	"successfully got a user"
+//	@Header			200				{string}	ETag			"version of the user"
+//	@Success		304				"user has not changed"
+//	@Failure		400				{object}	problem	"invalid_id"
+//	@Failure		404				{object}	problem	"user_not_found"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Failure		403				{object}	problem	"forbidden"
 //	@Router			/api/v1/users/:id [get]
 //	@Security		CookieAuth
 func (app *application) getUser(c *gin.Context) {
 	userCtx := app.GetUserFromContext(c)
 	if userCtx.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to get users"})
+		app.forbidden(c, "Only admins can get users.")
 		return
 	}
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		app.invalidId(c, "The user id must be an integer.")
 		return
 	}
 
 	user, err := app.models.Users.GetUserById(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
 	if user == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		app.errorResponse(c, http.StatusNotFound, codeUserNotFound, fmt.Sprintf("No user exists with id %d.", id))
 		return
 	}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+	if app.notModified(c, user.Version) {
 		return
 	}
 
@@ -96,34 +105,111 @@ func (app *application) getUser(c *gin.Context) {
 //	@Tags			user
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	query	int	true	"id of user to delete"
-//	@Success		204	"successfully deleted"
-//	@Failure		403	{object}	gin.H	"wrong role"
-//	@Failure		400	{object}	gin.H	"invalid id"
-//	@Failure		500	{object}	gin.H	"error deleting user"
+//	@Param			id			query	int		true	"id of user to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the user"
+//	@Success		204			"successfully deleted"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		404			{object}	problem	"user_not_found"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
 //	@Router			/api/v1/users/:id [delete]
 //	@Security		CookieAuth
 func (app *application) deleteUser(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to delete user"})
+		app.forbidden(c, "Only admins can delete users.")
 		return
 	}
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		app.invalidId(c, "The user id must be an integer.")
+		return
+	}
+
+	existingUser, err := app.models.Users.GetUserById(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if existingUser == nil {
+		app.errorResponse(c, http.StatusNotFound, codeUserNotFound, fmt.Sprintf("No user exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, existingUser.Version) {
 		return
 	}
 
-	if err := app.models.Users.DeleteUser(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+	if err := app.models.Users.DeleteUser(id, existingUser.Version); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
 		return
 	}
 
+	app.audit(c, &database.AuditEvent{Action: "user.delete", Target_Type: auditTargetUser, Target_Id: id}, existingUser, nil)
+
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// restoreUser restores a deleted user
+//
+//	@Summary		restore user
+//	@Description	restore a deleted user by id
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	query		int				true	"id of user to restore"
+//	@Success		200	{object}	database.User	"successfully restored a user"
+//	@Header			200	{string}	ETag			"new version of the user"
+//	@Failure		403	{object}	problem			"forbidden"
+//	@Failure		400	{object}	problem			"invalid_id"
+//	@Failure		404	{object}	problem			"user_not_found"
+//	@Failure		409	{object}	problem			"email_already_registered"
+//	@Failure		500	{object}	problem			"internal_error"
+//	@Router			/api/v1/users/:id/restore [post]
+//	@Security		CookieAuth
+func (app *application) restoreUser(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can restore users.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The user id must be an integer.")
+		return
+	}
+
+	restored, err := app.models.Users.RestoreUser(id)
+	if err != nil {
+		// the email was registered again while the user was deleted
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeEmailAlreadyRegistered, "Another user has registered with this email since the user was deleted.")
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	if restored == nil {
+		app.errorResponse(c, http.StatusNotFound, codeUserNotFound, fmt.Sprintf("No deleted user exists with id %d.", id))
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "user.restore", Target_Type: auditTargetUser, Target_Id: id}, nil, restored)
+
+	setETag(c, restored.Version)
+	c.JSON(http.StatusOK, restored)
+}
+
 // updateUser updates a user
 //
 //	@Summary		update a user
@@ -131,53 +217,150 @@ func (app *application) deleteUser(c *gin.Context) {
 //	@Tags			user
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		query		int				true	"id of user to update"
-//	@Param			user	body		database.User	true	"updated user data"
-//	@Success		200		{object}	database.User	"successfully updated a user"
-//	@Failure		403		{object}	gin.H			"wrong role/unauthorized"
-//	@Failure		400		{object}	gin.H			"invalid id"
-//	@Failure		500		{object}	gin.H			"error getting user"
-//	@Failure		404		{object}	gin.H			"user to update not found"
-//	@Failure		400		{object}	gin.H			"error binding JSON"
-//	@Failure		500		{object}	gin.H			"failed to update user"
+//	@Param			id			query		int				true	"id of user to update"
+//	@Param			If-Match	header		string			true	"current ETag of the user"
+//	@Param			user		body		database.User	true	"updated user data"
+//	@Success		200			{object}	database.User	"successfully updated a user"
+//	@Header			200			{string}	ETag			"new version of the user"
+//	@Failure		403			{object}	problem			"forbidden"
+//	@Failure		400			{object}	problem			"invalid_id, malformed_body or validation_failed"
+//	@Failure		404			{object}	problem			"user_not_found"
+//	@Failure		409			{object}	problem			"email_already_registered"
+//	@Failure		412			{object}	problem			"precondition_failed"
+//	@Failure		428			{object}	problem			"precondition_required"
+//	@Failure		500			{object}	problem			"internal_error"
 //	@Router			/api/v1/users/:id [put]
 //	@Security		CookieAuth
 func (app *application) updateUser(c *gin.Context) {
 	user := app.GetUserFromContext(c)
 	if user.Role != "Admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to update user"})
+		app.forbidden(c, "Only admins can update users.")
 		return
 	}
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		app.invalidId(c, "The user id must be an integer.")
 		return
 	}
 
 	existingUser, err := app.models.Users.GetUserById(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retreive user"})
+		app.serverError(c, err)
 		return
 	}
 
 	if existingUser == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		app.errorResponse(c, http.StatusNotFound, codeUserNotFound, fmt.Sprintf("No user exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, existingUser.Version) {
 		return
 	}
 
 	updatedUser := &database.User{}
 	if err := c.ShouldBindJSON(updatedUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.bindingError(c, err)
 		return
 	}
 
 	updatedUser.Id = id
+	// the password is not part of the request body, keep the stored hash
+	updatedUser.Password = existingUser.Password
+	updatedUser.Version = existingUser.Version
 
 	if err := app.models.Users.UpdateUser(updatedUser); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeEmailAlreadyRegistered, "A user with this email is already registered.")
+			return
+		}
+		app.serverError(c, err)
 		return
 	}
 
+	app.audit(c, &database.AuditEvent{Action: "user.update", Target_Type: auditTargetUser, Target_Id: id}, existingUser, updatedUser)
+
+	setETag(c, updatedUser.Version)
 	c.JSON(http.StatusOK, updatedUser)
 }
+
+// patchUser partially updates a user
+//
+//	@Summary		partially update a user
+//	@Description	partially update a user by id with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902)
+//	@Tags			user
+//	@Accept			application/merge-patch+json,application/json-patch+json
+//	@Produce		json
+//	@Param			id			query		int				true	"id of user to update"
+//	@Param			If-Match	header		string			true	"current ETag of the user"
+//	@Param			patch		body		object			true	"merge patch or JSON patch document"
+//	@Success		200			{object}	database.User	"successfully updated a user"
+//	@Header			200			{string}	ETag			"new version of the user"
+//	@Failure		403			{object}	problem			"forbidden"
+//	@Failure		400			{object}	problem			"invalid_id, malformed_body, invalid_patch or validation_failed"
+//	@Failure		404			{object}	problem			"user_not_found"
+//	@Failure		409			{object}	problem			"patch_test_failed or email_already_registered"
+//	@Failure		412			{object}	problem			"precondition_failed"
+//	@Failure		415			{object}	problem			"unsupported_media_type"
+//	@Failure		428			{object}	problem			"precondition_required"
+//	@Failure		500			{object}	problem			"internal_error"
+//	@Router			/api/v1/users/:id [patch]
+//	@Security		CookieAuth
+func (app *application) patchUser(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can update users.")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The user id must be an integer.")
+		return
+	}
+
+	existingUser, err := app.models.Users.GetUserById(id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	if existingUser == nil {
+		app.errorResponse(c, http.StatusNotFound, codeUserNotFound, fmt.Sprintf("No user exists with id %d.", id))
+		return
+	}
+
+	if !app.checkIfMatch(c, existingUser.Version) {
+		return
+	}
+
+	patchedUser := &database.User{}
+	if !app.applyPatch(c, existingUser, patchedUser) {
+		return
+	}
+
+	patchedUser.Id = id
+
+	if err := app.models.Users.PatchUser(existingUser, patchedUser); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		if database.IsUniqueViolation(err) {
+			app.errorResponse(c, http.StatusConflict, codeEmailAlreadyRegistered, "A user with this email is already registered.")
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "user.patch", Target_Type: auditTargetUser, Target_Id: id}, existingUser, patchedUser)
+
+	setETag(c, patchedUser.Version)
+	c.JSON(http.StatusOK, patchedUser)
+}
@@ -148,7 +148,7 @@ func TestGetUser_Wrong_Role(t *testing.T) {
 	}
 	defer resp.Body.Close()
 
-	expected := `{"error":"Unauthorized to get users"}`
+	expected := `{"type":"about:blank","title":"Forbidden","status":403,"detail":"Only admins can get users.","instance":"/api/v1/users/1","code":"forbidden"}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -182,6 +182,7 @@ func TestUpdateUser(t *testing.T) {
 		fmt.Printf("Error creating request: %v\n", err)
 		return
 	}
+	req.Header.Set("If-Match", `"1"`)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -242,7 +243,7 @@ func TestUpdateUser_Wrong_Role(t *testing.T) {
 	}
 	defer resp.Body.Close()
 
-	expected := `{"error":"Unauthorized to update user"}`
+	expected := `{"type":"about:blank","title":"Forbidden","status":403,"detail":"Only admins can update users.","instance":"/api/v1/users/1","code":"forbidden"}`
 	got := testutils.StringToJSON(string(bodyBytes))
 	want := testutils.StringToJSON(expected)
 
@@ -274,6 +275,7 @@ func TestDeleteUser(t *testing.T) {
 		fmt.Printf("Error creating request: %v\n", err)
 		return
 	}
+	req.Header.Set("If-Match", `"1"`)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -293,3 +295,140 @@ func TestDeleteUser(t *testing.T) {
 	assert.Equal(t, want, got)
 	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
 }
+
+func TestPatchUser_Keeps_Password(t *testing.T) {
+	app := SetupTest()
+	router := gin.Default()
+
+	router.POST("/api/v1/auth/register", app.registerUser)
+	router.POST("/api/v1/auth/login", app.login)
+
+	authGroup := router.Group("/")
+	authGroup.Use(app.AuthMiddleware())
+	authGroup.PATCH("/api/v1/users/:id", app.patchUser)
+	authGroup.PUT("/api/v1/users/:id", app.updateUser)
+
+	ts := httptest.NewServer(router)
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	testutils.RegisterAdmin(client, ts.URL+"/api/v1")
+	testutils.LoginAdmin(client, ts.URL+"/api/v1")
+	testutils.RegisterCustomer(client, ts.URL+"/api/v1")
+
+	payload := `{"role":"Admin"}`
+
+	req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/v1/users/2", strings.NewReader(payload))
+	if err != nil {
+		fmt.Printf("Error creating request: %v\n", err)
+		return
+	}
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatalln("fatal request", err.Error())
+	}
+	defer ts.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	defer resp.Body.Close()
+
+	expected := `{"id":2, "email":"user1@gmail.com", "role":"Admin"}`
+	got := testutils.StringToJSON(string(bodyBytes))
+	want := testutils.StringToJSON(expected)
+
+	assert.Equal(t, want, got)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// a full update must not wipe the password either
+	payload = `{"email":"user1@gmail.com", "role":"Customer"}`
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/users/2", strings.NewReader(payload))
+	if err != nil {
+		fmt.Printf("Error creating request: %v\n", err)
+		return
+	}
+	req.Header.Set("If-Match", `"2"`)
+
+	resp, err = client.Do(req)
+	if err != nil {
+		log.Fatalln("fatal request", err.Error())
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = testutils.LoginCustomer(client, ts.URL+"/api/v1")
+	if err != nil {
+		log.Fatalln("fatal request", err.Error())
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeleteUser_KeepsOrders(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+
+	testutils.RegisterAdmin(admin, ts.URL+"/api/v1")
+	testutils.LoginAdmin(admin, ts.URL+"/api/v1")
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	doRequest(admin, http.MethodPost, ts.URL+"/api/v1/orders", `{"user_id":2, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`)
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/users/2", nil)
+	req.Header.Set("If-Match", `"1"`)
+	resp, err := admin.Do(req)
+	if err != nil {
+		log.Fatalln("fatal request", err.Error())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, body := doRequest(admin, http.MethodGet, ts.URL+"/api/v1/orders/1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(2), testutils.StringToJSON(body)["user_id"])
+
+	resp, _ = doRequest(admin, http.MethodPost, ts.URL+"/api/v1/users/2/restore", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeleteUser_FreesEmail(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	adminJar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: adminJar}
+	customerJar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: customerJar}
+
+	testutils.RegisterAdmin(admin, ts.URL+"/api/v1")
+	testutils.LoginAdmin(admin, ts.URL+"/api/v1")
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+
+	resp, _ := doIfMatch(admin, http.MethodDelete, ts.URL+"/api/v1/users/2", `"1"`, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// the old account cannot come back with the same email
+	resp, body := doRequest(admin, http.MethodPost, ts.URL+"/api/v1/users/2/restore", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeEmailAlreadyRegistered, testutils.StringToJSON(body)["code"])
+}
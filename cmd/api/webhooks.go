@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/events"
+	"github.com/hamorrar/bookstore/internal/jobs"
+	"github.com/hamorrar/bookstore/internal/webhook"
+)
+
+type webhookRequest struct {
+	User_Id     int      `json:"user_id" binding:"required"`
+	Url         string   `json:"url" binding:"required,http_url,max=2048"`
+	Event_Types []string `json:"event_types" binding:"unique,dive,event_type"`
+	Secret      string   `json:"secret" binding:"omitempty,min=16,max=256"`
+	Description string   `json:"description" binding:"max=256"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// webhookCreated is the response to creating a subscription, the only one
+// that includes its secret.
+type webhookCreated struct {
+	*database.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type webhookDeliveryPayload struct {
+	Delivery_Id int64 `json:"delivery_id"`
+}
+
+// webhookPublisher queues a delivery of each event to every webhook
+// subscribed to its type.
+type webhookPublisher struct {
+	app *application
+}
+
+func (p webhookPublisher) Publish(ctx context.Context, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ids, err := p.app.models.Webhooks.CreateWebhookDeliveries(event.Id, event.Type, payload)
+	if err != nil {
+		return fmt.Errorf("creating webhook deliveries: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := p.app.queueWebhookDelivery(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueWebhookDelivery queues the job that sends the delivery. Each delivery
+// is queued once however often it is asked for.
+func (app *application) queueWebhookDelivery(id int64) error {
+	_, err := app.jobs.Enqueue(jobTypeDeliverWebhook, webhookDeliveryPayload{Delivery_Id: id}, jobs.UniqueKey(fmt.Sprintf("%s:%d", jobTypeDeliverWebhook, id)))
+	if err != nil && !errors.Is(err, database.ErrJobExists) {
+		return fmt.Errorf("queueing webhook delivery %d: %w", id, err)
+	}
+	return nil
+}
+
+// deliverWebhook sends a delivery to its subscription once and logs the
+// attempt. A failed attempt returns its error so the job is retried with
+// backoff, unless it was the last one or it got the subscription disabled.
+func (app *application) deliverWebhook(ctx context.Context, job *jobs.Job, payload webhookDeliveryPayload) (any, error) {
+	delivery, err := app.models.Webhooks.GetWebhookDelivery(payload.Delivery_Id)
+	if err != nil {
+		return nil, err
+	}
+	// the subscription, and its deliveries with it, may have been deleted
+	if delivery == nil || delivery.Status != database.WebhookDeliveryPending {
+		return nil, nil
+	}
+
+	sub, err := app.models.Webhooks.GetWebhookSubscription(delivery.Subscription_Id)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, nil
+	}
+
+	if !sub.Enabled {
+		if err := app.models.Webhooks.FailWebhookDelivery(delivery.Id, "the subscription is disabled"); err != nil {
+			return nil, err
+		}
+		return nil, jobs.Permanent(errors.New("the subscription is disabled"))
+	}
+
+	header := http.Header{}
+	header.Set("Event-Id", strconv.FormatInt(delivery.Event_Id, 10))
+	header.Set("Event-Type", delivery.Event_Type)
+
+	result := webhook.Send(ctx, app.webhookClient, webhook.Request{
+		URL:    sub.Url,
+		Secret: sub.Secret,
+		Id:     strconv.FormatInt(delivery.Id, 10),
+		Body:   delivery.Payload,
+		Header: header,
+	})
+	if ctx.Err() != nil {
+		// the job was cancelled or the server is shutting down; this was not
+		// the subscriber's fault
+		return nil, ctx.Err()
+	}
+
+	attempt := &database.WebhookDeliveryAttempt{
+		Response_Status: result.Status,
+		Response_Body:   result.Body,
+		Duration_Ms:     int(result.Duration.Milliseconds()),
+	}
+	if result.Err != nil {
+		attempt.Error = result.Err.Error()
+	}
+
+	final := job.Attempts >= job.Max_Attempts
+	status, err := app.models.Webhooks.RecordWebhookAttempt(delivery.Id, attempt, final, app.config.Webhooks.DisableAfter)
+	if err != nil {
+		return nil, fmt.Errorf("recording webhook delivery attempt: %w", err)
+	}
+
+	switch status {
+	case database.WebhookDeliverySucceeded:
+		return map[string]int{"response_status": result.Status}, nil
+	case database.WebhookDeliveryFailed:
+		if !final {
+			log.Printf("webhook subscription %d was disabled after repeated failures", sub.Id)
+		}
+		return nil, jobs.Permanent(result.Err)
+	}
+	return nil, result.Err
+}
+
+// getWebhookFromParam loads the webhook subscription named by the id path
+// parameter. It responds and returns nil if there is no such subscription.
+func (app *application) getWebhookFromParam(c *gin.Context) *database.WebhookSubscription {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		app.invalidId(c, "The webhook id must be an integer.")
+		return nil
+	}
+
+	sub, err := app.models.Webhooks.GetWebhookSubscription(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if sub == nil {
+		app.errorResponse(c, http.StatusNotFound, codeWebhookNotFound, fmt.Sprintf("No webhook exists with id %d.", id))
+		return nil
+	}
+	return sub
+}
+
+// webhookUserNotFound responds that the partner a webhook is for does not
+// exist.
+func (app *application) webhookUserNotFound(c *gin.Context, id int) {
+	app.errorResponse(c, http.StatusUnprocessableEntity, codeUserNotFound, fmt.Sprintf("No user exists with id %d.", id))
+}
+
+// getWebhookDeliveryFromParam loads the delivery named by the delivery_id
+// path parameter, which must belong to sub. It responds and returns nil if
+// there is no such delivery.
+func (app *application) getWebhookDeliveryFromParam(c *gin.Context, sub *database.WebhookSubscription) *database.WebhookDelivery {
+	id, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		app.invalidId(c, "The delivery id must be an integer.")
+		return nil
+	}
+
+	delivery, err := app.models.Webhooks.GetWebhookDelivery(id)
+	if err != nil {
+		app.serverError(c, err)
+		return nil
+	}
+
+	if delivery == nil || delivery.Subscription_Id != sub.Id {
+		app.errorResponse(c, http.StatusNotFound, codeWebhookDeliveryNotFound, fmt.Sprintf("Webhook %d has no delivery with id %d.", sub.Id, id))
+		return nil
+	}
+	return delivery
+}
+
+// getWebhooks gets a page of webhook subscriptions
+//
+//	@Summary		gets a page of webhooks
+//	@Description	gets a page of webhook subscriptions, oldest first. Secrets are not included.
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			page	query		int								false	"page number to request"
+//	@Param			limit	query		int								false	"max number of webhooks to return per page, at most 100"
+//	@Success		200		{array}		database.WebhookSubscription	"successfully got a page of webhooks"
+//	@Failure		400		{object}	problem							"invalid_query"
+//	@Failure		403		{object}	problem							"forbidden"
+//	@Failure		500		{object}	problem							"internal_error"
+//	@Router			/api/v1/webhooks [get]
+//	@Security		CookieAuth
+func (app *application) getWebhooks(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	limit, page, ok := app.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	subs, err := app.models.Webhooks.GetPageOfWebhookSubscriptions(limit, page)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+// getWebhook gets a webhook subscription
+//
+//	@Summary		get webhook
+//	@Description	get a webhook subscription by id, without its secret
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id				query		int								true	"id of webhook"
+//	@Param			If-None-Match	header		string							false	"ETag from a previous response"
+//	@Success		200				{object}	database.WebhookSubscription	"successfully got a webhook"
+//	@Header			200				{string}	ETag							"version of the webhook"
+//	@Success		304				"webhook has not changed"
+//	@Failure		400				{object}	problem	"invalid_id"
+//	@Failure		403				{object}	problem	"forbidden"
+//	@Failure		404				{object}	problem	"webhook_not_found"
+//	@Failure		500				{object}	problem	"internal_error"
+//	@Router			/api/v1/webhooks/:id [get]
+//	@Security		CookieAuth
+func (app *application) getWebhook(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	sub := app.getWebhookFromParam(c)
+	if sub == nil {
+		return
+	}
+
+	if app.notModified(c, sub.Version) {
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// createWebhook creates a webhook subscription
+//
+//	@Summary		creates a webhook
+//	@Description	subscribes a partner's URL to domain events of the given types, or of every type if none are given. The partner is only sent events about themselves, such as changes to their orders, and events about no user in particular, such as price changes. Each delivery is posted with Webhook-Id, Webhook-Timestamp and Webhook-Signature headers; the signature is "v1=" and the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with the secret. A secret is generated when none is given. The secret is only ever returned here.
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhook			body		webhookRequest	true	"new webhook"
+//	@Param			Idempotency-Key	header		string			false	"key that makes retries of this request safe"
+//	@Success		201				{object}	webhookCreated	"successfully created a webhook"
+//	@Header			201				{string}	ETag			"version of the webhook"
+//	@Failure		400				{object}	problem			"malformed_body or validation_failed"
+//	@Failure		403				{object}	problem			"forbidden"
+//	@Failure		409				{object}	problem			"idempotency_key_in_use"
+//	@Failure		422				{object}	problem			"idempotency_key_reused or user_not_found"
+//	@Failure		500				{object}	problem			"internal_error"
+//	@Router			/api/v1/webhooks [post]
+//	@Security		CookieAuth
+func (app *application) createWebhook(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	var req webhookRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	sub := &database.WebhookSubscription{
+		User_Id:     req.User_Id,
+		Url:         req.Url,
+		Event_Types: req.Event_Types,
+		Secret:      req.Secret,
+		Description: req.Description,
+	}
+	if sub.Event_Types == nil {
+		sub.Event_Types = []string{}
+	}
+	if sub.Secret == "" {
+		buf := make([]byte, 32)
+		_, _ = rand.Read(buf)
+		sub.Secret = hex.EncodeToString(buf)
+	}
+
+	if err := app.models.Webhooks.CreateWebhookSubscription(sub); err != nil {
+		if database.IsForeignKeyViolation(err) {
+			app.webhookUserNotFound(c, sub.User_Id)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "webhook.create", Target_Type: auditTargetWebhook, Target_Id: sub.Id}, nil, sub)
+
+	setETag(c, sub.Version)
+	c.JSON(http.StatusCreated, webhookCreated{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// updateWebhook updates a webhook subscription
+//
+//	@Summary		update a webhook
+//	@Description	replaces a webhook subscription's partner, URL, event types and description. The secret is only changed when one is given and enabled only when it is given. Enabling a subscription, including one disabled after repeated failures, clears its failures.
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			query		int								true	"id of webhook to update"
+//	@Param			If-Match	header		string							true	"current ETag of the webhook"
+//	@Param			webhook		body		webhookRequest					true	"updated webhook"
+//	@Success		200			{object}	database.WebhookSubscription	"successfully updated a webhook"
+//	@Header			200			{string}	ETag							"new version of the webhook"
+//	@Failure		400			{object}	problem							"invalid_id, malformed_body or validation_failed"
+//	@Failure		403			{object}	problem							"forbidden"
+//	@Failure		404			{object}	problem							"webhook_not_found"
+//	@Failure		412			{object}	problem							"precondition_failed"
+//	@Failure		422			{object}	problem							"user_not_found"
+//	@Failure		428			{object}	problem							"precondition_required"
+//	@Failure		500			{object}	problem							"internal_error"
+//	@Router			/api/v1/webhooks/:id [put]
+//	@Security		CookieAuth
+func (app *application) updateWebhook(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	existing := app.getWebhookFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	var req webhookRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		app.bindingError(c, err)
+		return
+	}
+
+	updated := *existing
+	updated.User_Id = req.User_Id
+	updated.Url = req.Url
+	updated.Event_Types = req.Event_Types
+	updated.Description = req.Description
+	if updated.Event_Types == nil {
+		updated.Event_Types = []string{}
+	}
+	if req.Secret != "" {
+		updated.Secret = req.Secret
+	}
+	if req.Enabled != nil {
+		updated.Enabled = *req.Enabled
+	}
+	switch {
+	case updated.Enabled:
+		updated.Disabled_Reason = ""
+	case existing.Enabled:
+		updated.Disabled_Reason = "disabled by an admin"
+	}
+
+	if err := app.models.Webhooks.UpdateWebhookSubscription(&updated); err != nil {
+		switch {
+		case errors.Is(err, database.ErrEditConflict):
+			app.editConflict(c)
+		case database.IsForeignKeyViolation(err):
+			app.webhookUserNotFound(c, updated.User_Id)
+		default:
+			app.serverError(c, err)
+		}
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "webhook.update", Target_Type: auditTargetWebhook, Target_Id: updated.Id}, existing, &updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// deleteWebhook deletes a webhook subscription
+//
+//	@Summary		delete webhook
+//	@Description	delete a webhook subscription by id, with its deliveries and their logs
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id			query	int		true	"id of webhook to delete"
+//	@Param			If-Match	header	string	true	"current ETag of the webhook"
+//	@Success		204			"successfully deleted"
+//	@Failure		400			{object}	problem	"invalid_id"
+//	@Failure		403			{object}	problem	"forbidden"
+//	@Failure		404			{object}	problem	"webhook_not_found"
+//	@Failure		412			{object}	problem	"precondition_failed"
+//	@Failure		428			{object}	problem	"precondition_required"
+//	@Failure		500			{object}	problem	"internal_error"
+//	@Router			/api/v1/webhooks/:id [delete]
+//	@Security		CookieAuth
+func (app *application) deleteWebhook(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	existing := app.getWebhookFromParam(c)
+	if existing == nil {
+		return
+	}
+
+	if !app.checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	if err := app.models.Webhooks.DeleteWebhookSubscription(existing.Id, existing.Version); err != nil {
+		if errors.Is(err, database.ErrEditConflict) {
+			app.editConflict(c)
+			return
+		}
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "webhook.delete", Target_Type: auditTargetWebhook, Target_Id: existing.Id}, existing, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// getWebhookDeliveries gets a page of a webhook's deliveries
+//
+//	@Summary		get webhook deliveries
+//	@Description	gets a page of a webhook subscription's deliveries, newest first, optionally filtered by status and event type. Use the delivery endpoint for the log of attempts.
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id			query		int							true	"id of webhook"
+//	@Param			status		query		string						false	"only deliveries that are pending, succeeded or failed"
+//	@Param			event_type	query		string						false	"only deliveries of events of this type"
+//	@Param			page		query		int							false	"page number to request"
+//	@Param			limit		query		int							false	"max number of deliveries to return per page, at most 100"
+//	@Success		200			{array}		database.WebhookDelivery	"successfully got a page of deliveries"
+//	@Failure		400			{object}	problem						"invalid_id or invalid_query"
+//	@Failure		403			{object}	problem						"forbidden"
+//	@Failure		404			{object}	problem						"webhook_not_found"
+//	@Failure		500			{object}	problem						"internal_error"
+//	@Router			/api/v1/webhooks/:id/deliveries [get]
+//	@Security		CookieAuth
+func (app *application) getWebhookDeliveries(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	sub := app.getWebhookFromParam(c)
+	if sub == nil {
+		return
+	}
+
+	filter := database.WebhookDeliveryFilter{Subscription_Id: sub.Id, Status: c.Query("status"), Event_Type: c.Query("event_type")}
+
+	switch filter.Status {
+	case "", database.WebhookDeliveryPending, database.WebhookDeliverySucceeded, database.WebhookDeliveryFailed:
+	default:
+		app.errorResponse(c, http.StatusBadRequest, codeInvalidQuery, "status must be pending, succeeded or failed.")
+		return
+	}
+
+	var ok bool
+	filter.Limit, filter.Page, ok = app.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.models.Webhooks.GetWebhookDeliveries(filter)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// getWebhookDelivery gets a webhook delivery
+//
+//	@Summary		get webhook delivery
+//	@Description	get a webhook delivery with the payload sent and a log of every attempt, with the response status and the start of the response body
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id			query		int							true	"id of webhook"
+//	@Param			delivery_id	query		int							true	"id of delivery"
+//	@Success		200			{object}	database.WebhookDelivery	"successfully got a delivery"
+//	@Failure		400			{object}	problem						"invalid_id"
+//	@Failure		403			{object}	problem						"forbidden"
+//	@Failure		404			{object}	problem						"webhook_not_found or webhook_delivery_not_found"
+//	@Failure		500			{object}	problem						"internal_error"
+//	@Router			/api/v1/webhooks/:id/deliveries/:delivery_id [get]
+//	@Security		CookieAuth
+func (app *application) getWebhookDelivery(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	sub := app.getWebhookFromParam(c)
+	if sub == nil {
+		return
+	}
+
+	delivery := app.getWebhookDeliveryFromParam(c, sub)
+	if delivery == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// redeliverWebhook sends a webhook delivery again
+//
+//	@Summary		redeliver webhook
+//	@Description	queues a new delivery of the same event to the webhook, with a fresh set of attempts. The new delivery names the one it repeats in redelivery_of and keeps its Event-Id, so receivers can still ignore events they have already handled.
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id			query		int							true	"id of webhook"
+//	@Param			delivery_id	query		int							true	"id of delivery to send again"
+//	@Success		202			{object}	database.WebhookDelivery	"successfully queued a new delivery"
+//	@Failure		400			{object}	problem						"invalid_id"
+//	@Failure		403			{object}	problem						"forbidden"
+//	@Failure		404			{object}	problem						"webhook_not_found or webhook_delivery_not_found"
+//	@Failure		409			{object}	problem						"webhook_disabled"
+//	@Failure		500			{object}	problem						"internal_error"
+//	@Router			/api/v1/webhooks/:id/deliveries/:delivery_id/redeliver [post]
+//	@Security		CookieAuth
+func (app *application) redeliverWebhook(c *gin.Context) {
+	user := app.GetUserFromContext(c)
+	if user.Role != "Admin" {
+		app.forbidden(c, "Only admins can manage webhooks.")
+		return
+	}
+
+	sub := app.getWebhookFromParam(c)
+	if sub == nil {
+		return
+	}
+
+	delivery := app.getWebhookDeliveryFromParam(c, sub)
+	if delivery == nil {
+		return
+	}
+
+	if !sub.Enabled {
+		app.errorResponse(c, http.StatusConflict, codeWebhookDisabled, "The webhook is disabled; enable it before redelivering.")
+		return
+	}
+
+	redelivery, err := app.models.Webhooks.RedeliverWebhookDelivery(delivery.Id)
+	if err != nil {
+		app.serverError(c, err)
+		return
+	}
+	if redelivery == nil {
+		// deleted along with the subscription since it was loaded
+		app.errorResponse(c, http.StatusNotFound, codeWebhookDeliveryNotFound, fmt.Sprintf("Webhook %d has no delivery with id %d.", sub.Id, delivery.Id))
+		return
+	}
+
+	if err := app.queueWebhookDelivery(redelivery.Id); err != nil {
+		app.serverError(c, err)
+		return
+	}
+
+	app.audit(c, &database.AuditEvent{Action: "webhook.redeliver", Target_Type: auditTargetWebhook, Target_Id: sub.Id}, nil,
+		map[string]int64{"delivery_id": delivery.Id, "redelivery_id": redelivery.Id})
+
+	c.JSON(http.StatusAccepted, redelivery)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/testutils"
+	"github.com/hamorrar/bookstore/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "0123456789abcdef0123"
+
+// webhookReceiver records the webhooks posted to it and answers with status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+	w.WriteHeader(r.status)
+	w.Write([]byte("thanks"))
+}
+
+func TestWebhooks(t *testing.T) {
+	app := SetupTest()
+	app.config.Webhooks.DisableAfter = 2
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	receiver := &webhookReceiver{status: http.StatusOK}
+	partner := httptest.NewServer(receiver)
+	defer partner.Close()
+	jar, _ := cookiejar.New(nil)
+	admin := &http.Client{Jar: jar}
+	jar, _ = cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+	url := ts.URL + "/api/v1"
+	ctx := context.Background()
+
+	makeStockedBook(admin, url, "3", "5")
+	testutils.RegisterCustomer(customer, url)
+	testutils.LoginCustomer(customer, url)
+
+	resp, body := doRequest(admin, http.MethodPost, url+"/webhooks", `{"user_id":2,"url":"`+partner.URL+`","event_types":["order.placed"]}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, codeValidationFailed, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/webhooks", `{"user_id":9,"url":"`+partner.URL+`"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, codeUserNotFound, testutils.StringToJSON(body)["code"])
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/webhooks",
+		`{"user_id":2,"url":"`+partner.URL+`","event_types":["order.created","order.status_changed"],"secret":"`+testWebhookSecret+`","description":"partner"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	sub := testutils.StringToJSON(body)
+	assert.Equal(t, testWebhookSecret, sub["secret"])
+	assert.Equal(t, true, sub["enabled"])
+	assert.Equal(t, float64(2), sub["user_id"])
+
+	// the secret is never shown again
+	_, body = doRequest(admin, http.MethodGet, url+"/webhooks/1", "")
+	assert.NotContains(t, testutils.StringToJSON(body), "secret")
+
+	// another partner is not sent the customer's events
+	otherReceiver := &webhookReceiver{status: http.StatusOK}
+	other := httptest.NewServer(otherReceiver)
+	defer other.Close()
+	resp, _ = doRequest(admin, http.MethodPost, url+"/webhooks", `{"user_id":1,"url":"`+other.URL+`"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	doRequest(customer, http.MethodPost, url+"/cart/items", `{"book_id":1, "quantity":1}`)
+	resp, _ = doRequest(customer, http.MethodPost, url+"/cart/checkout", "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	_, err := app.relay.RelayPending(ctx)
+	require.NoError(t, err)
+	require.NoError(t, app.jobs.RunPending(ctx))
+
+	// only the order event is delivered, signed with the secret
+	require.Len(t, receiver.requests, 1)
+	assert.Empty(t, otherReceiver.requests)
+	got := receiver.requests[0]
+	assert.Equal(t, "order.created", got.Header.Get("Event-Type"))
+	assert.Equal(t, "1", got.Header.Get(webhook.IdHeader))
+	assert.NoError(t, webhook.Verify(testWebhookSecret, got.Header, []byte(receiver.bodies[0]), time.Minute, time.Now()))
+	event := testutils.StringToJSON(receiver.bodies[0])
+	assert.Equal(t, "order.created", event["type"])
+	assert.Equal(t, float64(1), event["data"].(map[string]any)["order_id"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/webhooks/1/deliveries", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	deliveries := testutils.StringToJSONArray(body)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "succeeded", deliveries[0]["status"])
+	assert.Equal(t, float64(200), deliveries[0]["response_status"])
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/webhooks/1/deliveries/1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	log := testutils.StringToJSON(body)["log"].([]any)
+	require.Len(t, log, 1)
+	assert.Equal(t, "thanks", log[0].(map[string]any)["response_body"])
+
+	// a redelivery is a new delivery of the same event
+	resp, body = doRequest(admin, http.MethodPost, url+"/webhooks/1/deliveries/1/redeliver", "")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, float64(1), testutils.StringToJSON(body)["redelivery_of"])
+	require.NoError(t, app.jobs.RunPending(ctx))
+	require.Len(t, receiver.requests, 2)
+	assert.Equal(t, "2", receiver.requests[1].Header.Get(webhook.IdHeader))
+	assert.Equal(t, receiver.requests[0].Header.Get("Event-Id"), receiver.requests[1].Header.Get("Event-Id"))
+
+	// publishing the same event again does not deliver it again
+	_, err = app.models.Outbox.DB.Exec("update outbox_events set outbox_event_published_at = null, outbox_event_next_attempt_at = now()")
+	require.NoError(t, err)
+	_, err = app.relay.RelayPending(ctx)
+	require.NoError(t, err)
+	require.NoError(t, app.jobs.RunPending(ctx))
+	assert.Len(t, receiver.requests, 2)
+
+	// failures are retried later, and enough of them disable the webhook
+	receiver.status = http.StatusServiceUnavailable
+	resp, _ = doIfMatch(customer, http.MethodPatch, url+"/orders/1", `"1"`, `{"status":"Cancelled"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = app.relay.RelayPending(ctx)
+	require.NoError(t, err)
+	require.NoError(t, app.jobs.RunPending(ctx))
+	require.Len(t, receiver.requests, 3)
+
+	_, body = doRequest(admin, http.MethodGet, url+"/webhooks/1/deliveries?status=pending", "")
+	deliveries = testutils.StringToJSONArray(body)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "order.status_changed", deliveries[0]["event_type"])
+	assert.Equal(t, float64(1), deliveries[0]["attempts"])
+	assert.Contains(t, deliveries[0]["error"], "503 Service Unavailable")
+
+	_, err = app.models.Jobs.DB.Exec("update jobs set job_run_at = now() where job_status = 'queued'")
+	require.NoError(t, err)
+	require.NoError(t, app.jobs.RunPending(ctx))
+	require.Len(t, receiver.requests, 4)
+
+	_, body = doRequest(admin, http.MethodGet, url+"/webhooks/1", "")
+	sub = testutils.StringToJSON(body)
+	assert.Equal(t, false, sub["enabled"])
+	assert.Equal(t, float64(2), sub["failures"])
+	assert.Contains(t, sub["disabled_reason"], "disabled after 2 failed attempts in a row")
+
+	_, body = doRequest(admin, http.MethodGet, url+"/webhooks/1/deliveries/3", "")
+	delivery := testutils.StringToJSON(body)
+	assert.Equal(t, "failed", delivery["status"])
+	assert.Len(t, delivery["log"], 2)
+
+	resp, body = doRequest(admin, http.MethodPost, url+"/webhooks/1/deliveries/3/redeliver", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, codeWebhookDisabled, testutils.StringToJSON(body)["code"])
+
+	// enabling the webhook clears its failures
+	receiver.status = http.StatusOK
+	// disabling it made a new version
+	resp, body = doIfMatch(admin, http.MethodPut, url+"/webhooks/1", `"2"`,
+		`{"user_id":2,"url":"`+partner.URL+`","event_types":["order.status_changed"],"enabled":true}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	sub = testutils.StringToJSON(body)
+	assert.Equal(t, true, sub["enabled"])
+	assert.Equal(t, float64(0), sub["failures"])
+	assert.Nil(t, sub["disabled_reason"])
+
+	resp, _ = doRequest(admin, http.MethodPost, url+"/webhooks/1/deliveries/3/redeliver", "")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NoError(t, app.jobs.RunPending(ctx))
+	require.Len(t, receiver.requests, 5)
+	// the secret was kept
+	assert.NoError(t, webhook.Verify(testWebhookSecret, receiver.requests[4].Header, []byte(receiver.bodies[4]), time.Minute, time.Now()))
+
+	resp, body = doRequest(admin, http.MethodGet, url+"/webhooks/1/deliveries/9", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeWebhookDeliveryNotFound, testutils.StringToJSON(body)["code"])
+
+	resp, _ = doIfMatch(admin, http.MethodDelete, url+"/webhooks/1", `"3"`, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, body = doRequest(admin, http.MethodGet, url+"/webhooks/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, codeWebhookNotFound, testutils.StringToJSON(body)["code"])
+}
+
+func TestWebhooks_OnlyAdmins(t *testing.T) {
+	app := SetupTest()
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	jar, _ := cookiejar.New(nil)
+	customer := &http.Client{Jar: jar}
+
+	testutils.RegisterCustomer(customer, ts.URL+"/api/v1")
+	testutils.LoginCustomer(customer, ts.URL+"/api/v1")
+
+	resp, _ := doRequest(customer, http.MethodPost, ts.URL+"/api/v1/webhooks", `{"url":"https://partner.example/hooks"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, _ = doRequest(customer, http.MethodGet, ts.URL+"/api/v1/webhooks", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
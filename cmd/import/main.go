@@ -0,0 +1,124 @@
+// Command import adds and updates books from a CSV or ONIX 3.0 file, the same
+// way as an import uploaded to the API, and prints the outcome.
+//
+//	go run ./cmd/import [-format csv|onix] [-dry-run] [-report report.csv] FILE
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	_ "github.com/lib/pq"
+
+	"github.com/hamorrar/bookstore/internal/bookimport"
+	"github.com/hamorrar/bookstore/internal/config"
+	"github.com/hamorrar/bookstore/internal/database"
+)
+
+func main() {
+	format := flag.String("format", "", "csv or onix, by default inferred from the file name")
+	dryRun := flag.Bool("dry-run", false, "only report what would change")
+	report := flag.String("report", "", "write the outcome of every row as CSV to this file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: import [-format csv|onix] [-dry-run] [-report report.csv] FILE\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	if *format == "" {
+		f, ok := bookimport.FormatFor(path)
+		if !ok {
+			log.Fatal("The format cannot be told from the file name; pass -format csv or -format onix.")
+		}
+		*format = f
+	} else if *format != bookimport.FormatCSV && *format != bookimport.FormatONIX {
+		log.Fatal("-format must be csv or onix.")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Load(config.Import)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DB.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+
+	models := database.NewModels(db)
+
+	job := &database.ImportJob{Format: *format, Filename: filepath.Base(path), Dry_Run: *dryRun, Data: data}
+	if err := models.ImportJobs.CreateImportJob(job); err != nil {
+		log.Fatal(err)
+	}
+
+	// servers only run imports queued through the API, so this one is ours
+	job, err = models.ImportJobs.ClaimImportJob(job.Id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if job == nil {
+		log.Fatal("The import could not be claimed.")
+	}
+
+	err = bookimport.Run(context.Background(), &models, job, func(job *database.ImportJob) {
+		log.Printf("import %d: %d of %d rows processed", job.Id, job.Processed, job.Total)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if job.Status == database.ImportFailed {
+		log.Fatalf("import %d failed: %s", job.Id, job.Error)
+	}
+
+	verb := "imported"
+	if job.Dry_Run {
+		verb = "checked (dry run)"
+	}
+	fmt.Printf("import %d %s %d rows: %d created, %d updated, %d unchanged, %d failed\n",
+		job.Id, verb, job.Total, job.Created, job.Updated, job.Unchanged, job.Failed)
+
+	if *report != "" {
+		rows, err := models.ImportJobs.GetImportRows(job.Id, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		f, err := os.Create(*report)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := bookimport.WriteReport(f, rows); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if job.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -11,7 +11,7 @@ import (
 	_ "github.com/golang-migrate/migrate/v4"
 	_ "github.com/lib/pq"
 
-	"github.com/joho/godotenv"
+	"github.com/hamorrar/bookstore/internal/config"
 )
 
 func main() {
@@ -19,17 +19,19 @@ func main() {
 		log.Fatal("Please provide a migration direction: 'up' or 'down'.")
 	}
 
-	err := godotenv.Load(".env")
+	cfg, err := config.Load(config.Migrate)
 	if err != nil {
-		log.Printf("Error loading .env file for migrations: %v\n", err)
-		log.Println("No .env file found, relying on system environment for migrations.")
+		log.Fatal(err)
 	}
 
-	// createDB()
+	log.Println("Effective configuration:")
+	if err := cfg.Dump(os.Stderr); err != nil {
+		log.Fatal(err)
+	}
 
-	DB_URL := os.Getenv("DB_URL")
+	// createDB()
 
-	db, err := sql.Open("postgres", DB_URL)
+	db, err := sql.Open("postgres", cfg.DB.URL)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -44,7 +46,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance("file://cmd/migrate/migrations", "postgres", driver)
+	m, err := migrate.NewWithDatabaseInstance("file://"+cfg.DB.MigrationsPath, "postgres", driver)
 	if err != nil {
 		log.Fatal(err)
 	}
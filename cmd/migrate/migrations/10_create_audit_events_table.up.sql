@@ -0,0 +1,29 @@
+-- Who did what to which resource. Actors and targets are not foreign keys so
+-- the trail survives purged users and rows.
+create table if not exists audit_events (
+    audit_event_id bigserial unique primary key,
+    audit_event_actor_id int,
+    audit_event_action varchar(64) not null,
+    audit_event_target_type varchar(32) not null,
+    audit_event_target_id int,
+    audit_event_changes jsonb,
+    audit_event_ip varchar(64) not null default '',
+    audit_event_user_agent varchar(512) not null default '',
+    audit_event_request_id varchar(128) not null default '',
+    audit_event_created_at timestamptz not null default now()
+);
+
+create index if not exists audit_events_actor_idx on audit_events (audit_event_actor_id, audit_event_created_at);
+create index if not exists audit_events_target_idx on audit_events (audit_event_target_type, audit_event_target_id, audit_event_created_at);
+create index if not exists audit_events_created_at_idx on audit_events (audit_event_created_at);
+
+-- The log is append-only.
+create or replace function audit_events_append_only() returns trigger as $$
+begin
+    raise exception 'audit_events is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists audit_events_append_only on audit_events;
+create trigger audit_events_append_only before update or delete on audit_events
+    for each row execute function audit_events_append_only();
@@ -0,0 +1,18 @@
+alter table returns drop column if exists return_refund_currency;
+alter table returns alter column return_refund_amount type int using round(return_refund_amount / 100.0)::int;
+
+alter table payments drop column if exists payment_currency;
+alter table payments alter column payment_refunded_amount type int using round(payment_refunded_amount / 100.0)::int;
+alter table payments alter column payment_amount type int using round(payment_amount / 100.0)::int;
+
+alter table order_items alter column order_item_unit_price type int using round(order_item_unit_price / 100.0)::int;
+alter table cart_items drop column if exists cart_item_currency;
+alter table cart_items alter column cart_item_unit_price type int using round(cart_item_unit_price / 100.0)::int;
+
+alter table orders drop constraint if exists orders_order_total_price_check;
+alter table orders drop column if exists order_currency;
+alter table orders alter column order_total_price type int using round(order_total_price / 100.0)::int;
+
+alter table books drop constraint if exists books_book_price_check;
+alter table books drop column if exists book_currency;
+alter table books alter column book_price type int using round(book_price / 100.0)::int;
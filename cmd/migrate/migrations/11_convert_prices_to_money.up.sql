@@ -0,0 +1,20 @@
+-- Prices were whole dollars without a unit. Store every amount in minor units
+-- (cents) next to an ISO 4217 currency code instead.
+alter table books alter column book_price type bigint using book_price::bigint * 100;
+alter table books add column if not exists book_currency char(3) not null default 'USD';
+alter table books add constraint books_book_price_check check (book_price >= 0);
+
+alter table orders alter column order_total_price type bigint using order_total_price::bigint * 100;
+alter table orders add column if not exists order_currency char(3) not null default 'USD';
+alter table orders add constraint orders_order_total_price_check check (order_total_price >= 0);
+
+alter table cart_items alter column cart_item_unit_price type bigint using cart_item_unit_price::bigint * 100;
+alter table cart_items add column if not exists cart_item_currency char(3) not null default 'USD';
+alter table order_items alter column order_item_unit_price type bigint using order_item_unit_price::bigint * 100;
+
+alter table payments alter column payment_amount type bigint using payment_amount::bigint * 100;
+alter table payments alter column payment_refunded_amount type bigint using payment_refunded_amount::bigint * 100;
+alter table payments add column if not exists payment_currency char(3) not null default 'USD';
+
+alter table returns alter column return_refund_amount type bigint using return_refund_amount::bigint * 100;
+alter table returns add column if not exists return_refund_currency char(3) not null default 'USD';
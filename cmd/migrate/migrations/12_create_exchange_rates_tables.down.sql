@@ -0,0 +1,4 @@
+alter table orders drop column if exists order_exchange_rate;
+alter table orders drop column if exists order_exchange_rate_from;
+drop table if exists exchange_rates;
+drop table if exists book_prices;
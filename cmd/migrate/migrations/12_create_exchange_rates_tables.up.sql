@@ -0,0 +1,27 @@
+-- List prices for a book in currencies other than its own. They take priority
+-- over converting the book's price.
+create table if not exists book_prices (
+    book_price_book_id int not null,
+    book_price_currency char(3) not null,
+    book_price_amount bigint not null check (book_price_amount >= 0),
+    primary key (book_price_book_id, book_price_currency),
+    foreign key (book_price_book_id) references books(book_id) on delete cascade
+);
+
+-- A rate is the price of one unit of the from currency in the to currency and
+-- applies from its effective time until a later rate for the pair takes over.
+create table if not exists exchange_rates (
+    exchange_rate_id bigserial unique primary key,
+    exchange_rate_from char(3) not null,
+    exchange_rate_to char(3) not null,
+    exchange_rate_rate numeric not null check (exchange_rate_rate > 0),
+    exchange_rate_effective_at timestamptz not null,
+    exchange_rate_created_at timestamptz not null default now(),
+    unique (exchange_rate_from, exchange_rate_to, exchange_rate_effective_at),
+    check (exchange_rate_from <> exchange_rate_to)
+);
+
+-- The rate an order's prices were converted at is copied onto the order so its
+-- total never depends on the rate table again.
+alter table orders add column if not exists order_exchange_rate_from char(3);
+alter table orders add column if not exists order_exchange_rate numeric;
@@ -0,0 +1,5 @@
+drop table if exists order_tax_lines;
+alter table orders drop column if exists order_tax_total;
+alter table orders drop column if exists order_tax_region;
+drop table if exists tax_rates;
+alter table books drop column if exists book_tax_category;
@@ -0,0 +1,35 @@
+-- Books are taxed by category; an empty category gets the general rate.
+alter table books add column if not exists book_tax_category varchar(32) not null default '';
+
+-- A rule applies from its effective time until a later rule for the same
+-- region and category takes over. An empty category covers every category
+-- without a rule of its own.
+create table if not exists tax_rates (
+    tax_rate_id bigserial unique primary key,
+    tax_rate_region varchar(16) not null,
+    tax_rate_category varchar(32) not null default '',
+    tax_rate_name varchar(64) not null,
+    tax_rate_rate numeric not null check (tax_rate_rate >= 0 and tax_rate_rate <= 1),
+    tax_rate_effective_at timestamptz not null,
+    tax_rate_created_at timestamptz not null default now(),
+    unique (tax_rate_region, tax_rate_category, tax_rate_effective_at)
+);
+
+-- The tax charged on each order line is copied from the rule so it never
+-- changes with the table.
+alter table orders add column if not exists order_tax_region varchar(16);
+alter table orders add column if not exists order_tax_total bigint;
+
+create table if not exists order_tax_lines (
+    order_tax_line_order_id int not null,
+    order_tax_line_book_id int not null,
+    order_tax_line_rule_id bigint,
+    order_tax_line_name varchar(64) not null,
+    order_tax_line_region varchar(16) not null,
+    order_tax_line_category varchar(32) not null,
+    order_tax_line_rate numeric not null,
+    order_tax_line_taxable_amount bigint not null,
+    order_tax_line_tax_amount bigint not null,
+    primary key (order_tax_line_order_id, order_tax_line_book_id),
+    foreign key (order_tax_line_order_id) references orders(order_id) on delete cascade
+);
@@ -0,0 +1,5 @@
+drop table if exists order_discounts;
+alter table orders drop column if exists order_free_shipping;
+alter table orders drop column if exists order_discount_total;
+drop table if exists promotion_redemptions;
+drop table if exists promotions;
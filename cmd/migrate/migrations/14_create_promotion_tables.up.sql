@@ -0,0 +1,51 @@
+-- Promotions are looked up by code at checkout. Amounts are in the minor
+-- units of promotion_currency, which is only set for promotions that carry an
+-- amount.
+create table if not exists promotions (
+    promotion_id bigserial unique primary key,
+    promotion_code varchar(32) not null unique,
+    promotion_description varchar(200) not null default '',
+    promotion_type varchar(16) not null check (promotion_type in ('buy_x_get_y', 'percent_off', 'fixed_amount', 'free_shipping')),
+    promotion_percent_off int not null default 0 check (promotion_percent_off between 0 and 100),
+    promotion_amount_off bigint,
+    promotion_min_order_total bigint,
+    promotion_currency char(3),
+    promotion_book_id int,
+    promotion_buy_quantity int not null default 0,
+    promotion_get_quantity int not null default 0,
+    promotion_starts_at timestamptz,
+    promotion_ends_at timestamptz,
+    promotion_max_uses int not null default 0,
+    promotion_max_uses_per_customer int not null default 0,
+    promotion_created_at timestamptz not null default now(),
+    promotion_version int not null default 1
+);
+
+-- One row per order a code was used on; usage limits are counted from here.
+create table if not exists promotion_redemptions (
+    promotion_redemption_promotion_id bigint not null,
+    promotion_redemption_order_id int not null,
+    promotion_redemption_user_id int not null,
+    promotion_redemption_created_at timestamptz not null default now(),
+    primary key (promotion_redemption_promotion_id, promotion_redemption_order_id),
+    foreign key (promotion_redemption_promotion_id) references promotions(promotion_id) on delete cascade,
+    foreign key (promotion_redemption_order_id) references orders(order_id) on delete cascade
+);
+
+-- The discounts on an order are copied from the promotions so they stay
+-- explainable after a promotion is changed or deleted.
+alter table orders add column if not exists order_discount_total bigint;
+alter table orders add column if not exists order_free_shipping boolean not null default false;
+
+create table if not exists order_discounts (
+    order_discount_order_id int not null,
+    order_discount_position int not null,
+    order_discount_promotion_id bigint,
+    order_discount_code varchar(32) not null,
+    order_discount_type varchar(16) not null,
+    order_discount_description varchar(200) not null,
+    order_discount_book_id int,
+    order_discount_amount bigint not null,
+    primary key (order_discount_order_id, order_discount_position),
+    foreign key (order_discount_order_id) references orders(order_id) on delete cascade
+);
@@ -0,0 +1,5 @@
+alter table orders drop column if exists order_shipping_total;
+alter table orders drop column if exists order_billing_address;
+alter table orders drop column if exists order_shipping_address;
+alter table books drop column if exists book_weight_grams;
+drop table if exists addresses;
@@ -0,0 +1,28 @@
+-- A customer's saved addresses. At most one of them is the default.
+create table if not exists addresses (
+    address_id serial unique primary key,
+    address_user_id int not null,
+    address_name varchar(100) not null,
+    address_line1 varchar(100) not null,
+    address_line2 varchar(100) not null default '',
+    address_city varchar(100) not null,
+    address_region varchar(50) not null default '',
+    address_postal_code varchar(16) not null,
+    address_country char(2) not null,
+    address_phone varchar(32) not null default '',
+    address_is_default boolean not null default false,
+    address_created_at timestamptz not null default now(),
+    address_version int not null default 1,
+    foreign key (address_user_id) references users(user_id) on delete cascade
+);
+
+create unique index if not exists addresses_one_default on addresses (address_user_id) where address_is_default;
+
+-- Shipping may be charged by weight.
+alter table books add column if not exists book_weight_grams int not null default 0 check (book_weight_grams >= 0);
+
+-- Orders keep a copy of the addresses as they were when the order was placed
+-- so editing or deleting an address never changes past orders.
+alter table orders add column if not exists order_shipping_address jsonb;
+alter table orders add column if not exists order_billing_address jsonb;
+alter table orders add column if not exists order_shipping_total bigint;
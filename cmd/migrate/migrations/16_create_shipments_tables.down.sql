@@ -0,0 +1,3 @@
+drop table if exists shipment_events;
+drop table if exists shipment_items;
+drop table if exists shipments;
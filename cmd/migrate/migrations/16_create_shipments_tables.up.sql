@@ -0,0 +1,38 @@
+-- An order can be split over several shipments, each with its own tracking
+-- number and the books it holds.
+create table if not exists shipments (
+    shipment_id serial unique primary key,
+    shipment_order_id int not null,
+    shipment_carrier varchar(32) not null,
+    shipment_tracking_number varchar(64) not null,
+    shipment_status varchar(20) not null,
+    shipment_shipped_at timestamptz not null default now(),
+    shipment_delivered_at timestamptz,
+    shipment_created_at timestamptz not null default now(),
+    shipment_updated_at timestamptz not null default now(),
+    shipment_version int not null default 1,
+    unique (shipment_carrier, shipment_tracking_number),
+    foreign key (shipment_order_id) references orders(order_id) on delete cascade
+);
+
+create table if not exists shipment_items (
+    shipment_item_shipment_id int not null,
+    shipment_item_book_id int not null,
+    shipment_item_quantity int not null check (shipment_item_quantity > 0),
+    primary key (shipment_item_shipment_id, shipment_item_book_id),
+    foreign key (shipment_item_shipment_id) references shipments(shipment_id) on delete cascade
+);
+
+-- Tracking events come from the carrier, with its event id, or from admins
+-- updating the shipment, without one.
+create table if not exists shipment_events (
+    shipment_event_id serial unique primary key,
+    shipment_event_shipment_id int not null,
+    shipment_event_carrier_event_id varchar(64),
+    shipment_event_status varchar(20) not null,
+    shipment_event_description varchar(256) not null default '',
+    shipment_event_location varchar(128) not null default '',
+    shipment_event_occurred_at timestamptz not null,
+    unique (shipment_event_shipment_id, shipment_event_carrier_event_id),
+    foreign key (shipment_event_shipment_id) references shipments(shipment_id) on delete cascade
+);
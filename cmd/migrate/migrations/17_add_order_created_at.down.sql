@@ -0,0 +1,3 @@
+drop index if exists orders_user_created_at;
+
+alter table orders drop column if exists order_created_at;
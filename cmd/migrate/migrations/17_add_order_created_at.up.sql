@@ -0,0 +1,5 @@
+-- Customers list their orders newest first and filter them by date. Orders
+-- placed before this column existed get the time of the migration.
+alter table orders add column if not exists order_created_at timestamptz not null default now();
+
+create index if not exists orders_user_created_at on orders (order_user_id, order_created_at);
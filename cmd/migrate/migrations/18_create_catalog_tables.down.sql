@@ -0,0 +1,7 @@
+alter table books drop column if exists book_publisher_id;
+
+drop table if exists book_categories;
+drop table if exists book_authors;
+drop table if exists categories;
+drop table if exists publishers;
+drop table if exists authors;
@@ -0,0 +1,61 @@
+-- Authors and publishers of books. Several authors may share a name.
+create table if not exists authors (
+    author_id serial unique primary key,
+    author_name varchar(256) not null,
+    author_bio text not null default '',
+    author_created_at timestamptz not null default now(),
+    author_version int not null default 1
+);
+
+create index if not exists authors_name on authors (author_name);
+
+create table if not exists publishers (
+    publisher_id serial unique primary key,
+    publisher_name varchar(256) not null unique,
+    publisher_website varchar(256) not null default '',
+    publisher_created_at timestamptz not null default now(),
+    publisher_version int not null default 1
+);
+
+-- Categories form a tree through their parent. Slugs are unique so they can
+-- be used in links.
+create table if not exists categories (
+    category_id serial unique primary key,
+    category_parent_id int,
+    category_name varchar(100) not null,
+    category_slug varchar(100) not null unique,
+    category_created_at timestamptz not null default now(),
+    category_version int not null default 1,
+    foreign key (category_parent_id) references categories(category_id)
+);
+
+-- A book's authors in the order they are credited.
+create table if not exists book_authors (
+    book_author_book_id int not null,
+    book_author_author_id int not null,
+    book_author_position int not null,
+    primary key (book_author_book_id, book_author_author_id),
+    foreign key (book_author_book_id) references books(book_id) on delete cascade,
+    foreign key (book_author_author_id) references authors(author_id)
+);
+
+create index if not exists book_authors_author on book_authors (book_author_author_id);
+
+create table if not exists book_categories (
+    book_category_book_id int not null,
+    book_category_category_id int not null,
+    primary key (book_category_book_id, book_category_category_id),
+    foreign key (book_category_book_id) references books(book_id) on delete cascade,
+    foreign key (book_category_category_id) references categories(category_id)
+);
+
+create index if not exists book_categories_category on book_categories (book_category_category_id);
+
+alter table books add column if not exists book_publisher_id int references publishers(publisher_id);
+
+-- Every existing author string becomes an author record linked to its books.
+-- book_author is kept as the byline shown with the book.
+insert into authors (author_name) select distinct book_author from books;
+
+insert into book_authors (book_author_book_id, book_author_author_id, book_author_position)
+    select b.book_id, a.author_id, 1 from books b join authors a on a.author_name = b.book_author;
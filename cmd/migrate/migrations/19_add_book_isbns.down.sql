@@ -0,0 +1,2 @@
+alter table books drop column if exists book_isbn_10;
+alter table books drop column if exists book_isbn_13;
@@ -0,0 +1,4 @@
+-- ISBNs are stored without hyphens. Every book with an ISBN has an ISBN-13;
+-- the ISBN-10 is kept alongside for books old enough to have one.
+alter table books add column if not exists book_isbn_13 varchar(13) unique;
+alter table books add column if not exists book_isbn_10 varchar(10) unique;
@@ -0,0 +1,2 @@
+drop table if exists import_job_rows;
+drop table if exists import_jobs;
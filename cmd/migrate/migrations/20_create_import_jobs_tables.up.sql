@@ -0,0 +1,36 @@
+-- Bulk catalog imports. The uploaded file is kept with the job so a worker
+-- can pick it up; the user is not a foreign key so jobs survive purged users.
+create table if not exists import_jobs (
+    import_job_id serial unique primary key,
+    import_job_user_id int,
+    import_job_format varchar(8) not null,
+    import_job_filename varchar(256) not null default '',
+    import_job_dry_run boolean not null default false,
+    import_job_status varchar(16) not null default 'queued',
+    import_job_data bytea not null,
+    import_job_total int not null default 0,
+    import_job_processed int not null default 0,
+    import_job_created int not null default 0,
+    import_job_updated int not null default 0,
+    import_job_unchanged int not null default 0,
+    import_job_failed int not null default 0,
+    import_job_error text not null default '',
+    import_job_created_at timestamptz not null default now(),
+    import_job_started_at timestamptz,
+    import_job_finished_at timestamptz
+);
+
+create index if not exists import_jobs_status on import_jobs (import_job_status, import_job_id);
+
+-- What happened to each row of an import, or would have on a dry run.
+create table if not exists import_job_rows (
+    import_job_row_job_id int not null,
+    import_job_row_number int not null,
+    import_job_row_isbn varchar(32) not null default '',
+    import_job_row_book_id int,
+    import_job_row_action varchar(16) not null,
+    import_job_row_changes text not null default '',
+    import_job_row_error text not null default '',
+    primary key (import_job_row_job_id, import_job_row_number),
+    foreign key (import_job_row_job_id) references import_jobs(import_job_id) on delete cascade
+);
@@ -0,0 +1,28 @@
+-- Background jobs. A queued job runs once job_run_at has passed; a running
+-- job belongs to job_locked_by until job_locked_until, after which it is
+-- considered abandoned and retried. job_unique_key stops scheduled jobs from
+-- being queued twice when several servers run the scheduler.
+create table if not exists jobs (
+    job_id bigserial unique primary key,
+    job_type varchar(64) not null,
+    job_payload jsonb not null default 'null',
+    job_status varchar(16) not null default 'queued',
+    job_unique_key varchar(128) unique,
+    job_attempts int not null default 0,
+    job_max_attempts int not null default 1,
+    job_run_at timestamptz not null default now(),
+    job_locked_by varchar(128),
+    job_locked_until timestamptz,
+    job_cancel_requested boolean not null default false,
+    job_progress int not null default 0 check (job_progress between 0 and 100),
+    job_progress_message text not null default '',
+    job_result jsonb,
+    job_error text not null default '',
+    job_created_by int,
+    job_created_at timestamptz not null default now(),
+    job_started_at timestamptz,
+    job_finished_at timestamptz
+);
+
+create index if not exists jobs_queued on jobs (job_run_at, job_id) where job_status = 'queued';
+create index if not exists jobs_running on jobs (job_locked_until) where job_status = 'running';
@@ -0,0 +1,19 @@
+-- Domain events written in the same transaction as the change they describe
+-- and relayed to other services afterwards. An unpublished event is due once
+-- outbox_event_next_attempt_at has passed; a relay claiming it pushes that
+-- time out for as long as it may take to publish it.
+create table if not exists outbox_events (
+    outbox_event_id bigserial unique primary key,
+    outbox_event_type varchar(64) not null,
+    outbox_event_aggregate_type varchar(32) not null,
+    outbox_event_aggregate_id int not null,
+    outbox_event_data jsonb not null,
+    outbox_event_created_at timestamptz not null default now(),
+    outbox_event_attempts int not null default 0,
+    outbox_event_next_attempt_at timestamptz not null default now(),
+    outbox_event_last_error text not null default '',
+    outbox_event_published_at timestamptz
+);
+
+create index if not exists outbox_events_unpublished on outbox_events (outbox_event_next_attempt_at, outbox_event_id) where outbox_event_published_at is null;
+create index if not exists outbox_events_published on outbox_events (outbox_event_published_at) where outbox_event_published_at is not null;
@@ -0,0 +1,55 @@
+-- Webhook subscriptions and their deliveries. Every published domain event of
+-- a type a subscription wants becomes one delivery, which is sent by a job
+-- and retried until it succeeds or runs out of attempts. Each try is logged
+-- in webhook_delivery_attempts. A subscription counts the attempts that have
+-- failed in a row and is disabled once there are too many. A subscription
+-- belongs to the partner user whose events it is sent.
+create table if not exists webhook_subscriptions (
+    webhook_subscription_id serial unique primary key,
+    webhook_subscription_user_id int not null,
+    webhook_subscription_url varchar(2048) not null,
+    webhook_subscription_event_types varchar(64)[] not null default '{}',
+    webhook_subscription_secret varchar(256) not null,
+    webhook_subscription_description varchar(256) not null default '',
+    webhook_subscription_enabled boolean not null default true,
+    webhook_subscription_failures int not null default 0,
+    webhook_subscription_disabled_reason text not null default '',
+    webhook_subscription_created_at timestamptz not null default now(),
+    webhook_subscription_version int not null default 1,
+    foreign key (webhook_subscription_user_id) references users(user_id) on delete cascade
+);
+
+create table if not exists webhook_deliveries (
+    webhook_delivery_id bigserial unique primary key,
+    webhook_delivery_subscription_id int not null,
+    webhook_delivery_event_id bigint not null,
+    webhook_delivery_event_type varchar(64) not null,
+    webhook_delivery_payload jsonb not null,
+    webhook_delivery_redelivery_of bigint,
+    webhook_delivery_status varchar(16) not null default 'pending',
+    webhook_delivery_attempts int not null default 0,
+    webhook_delivery_response_status int,
+    webhook_delivery_error text not null default '',
+    webhook_delivery_created_at timestamptz not null default now(),
+    webhook_delivery_delivered_at timestamptz,
+    foreign key (webhook_delivery_subscription_id) references webhook_subscriptions(webhook_subscription_id) on delete cascade,
+    foreign key (webhook_delivery_redelivery_of) references webhook_deliveries(webhook_delivery_id) on delete set null
+);
+
+-- An event is delivered to a subscription once, apart from redeliveries
+-- asked for by an admin.
+create unique index if not exists webhook_deliveries_event on webhook_deliveries (webhook_delivery_subscription_id, webhook_delivery_event_id) where webhook_delivery_redelivery_of is null;
+create index if not exists webhook_deliveries_subscription on webhook_deliveries (webhook_delivery_subscription_id, webhook_delivery_id);
+
+create table if not exists webhook_delivery_attempts (
+    webhook_delivery_attempt_id bigserial unique primary key,
+    webhook_delivery_attempt_delivery_id bigint not null,
+    webhook_delivery_attempt_response_status int,
+    webhook_delivery_attempt_response_body text not null default '',
+    webhook_delivery_attempt_error text not null default '',
+    webhook_delivery_attempt_duration_ms int not null,
+    webhook_delivery_attempt_at timestamptz not null default now(),
+    foreign key (webhook_delivery_attempt_delivery_id) references webhook_deliveries(webhook_delivery_id) on delete cascade
+);
+
+create index if not exists webhook_delivery_attempts_delivery on webhook_delivery_attempts (webhook_delivery_attempt_delivery_id);
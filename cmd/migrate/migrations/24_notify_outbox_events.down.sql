@@ -0,0 +1,2 @@
+drop trigger if exists outbox_events_notify on outbox_events;
+drop function if exists notify_outbox_event();
@@ -0,0 +1,13 @@
+-- Announce each outbox event with its id on the outbox_events channel once
+-- the transaction that recorded it commits, so every API instance can push
+-- it to the clients streaming from it.
+create or replace function notify_outbox_event() returns trigger as $$
+begin
+    perform pg_notify('outbox_events', new.outbox_event_id::text);
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists outbox_events_notify on outbox_events;
+create trigger outbox_events_notify after insert on outbox_events
+    for each row execute function notify_outbox_event();
@@ -0,0 +1,2 @@
+drop index if exists users_user_email_key;
+alter table users add constraint users_user_email_key unique (user_email);
@@ -0,0 +1,4 @@
+-- A deleted user must not keep their email from being registered again, so
+-- emails only have to be unique among users that are not deleted.
+alter table users drop constraint if exists users_user_email_key;
+create unique index if not exists users_user_email_key on users (user_email) where user_deleted_at is null;
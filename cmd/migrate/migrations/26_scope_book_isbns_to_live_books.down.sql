@@ -0,0 +1,4 @@
+drop index if exists books_book_isbn_10_key;
+drop index if exists books_book_isbn_13_key;
+alter table books add constraint books_book_isbn_13_key unique (book_isbn_13);
+alter table books add constraint books_book_isbn_10_key unique (book_isbn_10);
@@ -0,0 +1,6 @@
+-- A deleted book must not keep its ISBNs from being used by a new book, so
+-- ISBNs only have to be unique among books that are not deleted.
+alter table books drop constraint if exists books_book_isbn_13_key;
+alter table books drop constraint if exists books_book_isbn_10_key;
+create unique index if not exists books_book_isbn_13_key on books (book_isbn_13) where book_deleted_at is null;
+create unique index if not exists books_book_isbn_10_key on books (book_isbn_10) where book_deleted_at is null;
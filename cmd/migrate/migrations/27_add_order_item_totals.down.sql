@@ -0,0 +1,2 @@
+alter table order_items drop column if exists order_item_tax;
+alter table order_items drop column if exists order_item_total;
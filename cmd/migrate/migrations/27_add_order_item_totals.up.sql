@@ -0,0 +1,12 @@
+-- What was paid for each order line after discounts and the tax charged on
+-- it, so refunding part of an order gives back what was paid for those books.
+alter table order_items add column if not exists order_item_total bigint;
+alter table order_items add column if not exists order_item_tax bigint not null default 0;
+
+-- Taxed orders already kept the discounted line totals with their tax.
+update order_items set order_item_total = order_tax_line_taxable_amount, order_item_tax = order_tax_line_tax_amount
+    from order_tax_lines
+    where order_tax_line_order_id = order_item_order_id and order_tax_line_book_id = order_item_book_id;
+update order_items set order_item_total = order_item_unit_price * order_item_quantity where order_item_total is null;
+
+alter table order_items alter column order_item_total set not null;
@@ -0,0 +1,8 @@
+delete from promotion_redemptions where promotion_redemption_order_id is null;
+alter table promotion_redemptions drop constraint if exists promotion_redemptions_promotion_redemption_order_id_fkey;
+alter table promotion_redemptions drop constraint if exists promotion_redemptions_order_key;
+alter table promotion_redemptions drop column if exists promotion_redemption_id;
+alter table promotion_redemptions alter column promotion_redemption_order_id set not null;
+alter table promotion_redemptions add constraint promotion_redemptions_pkey primary key (promotion_redemption_promotion_id, promotion_redemption_order_id);
+alter table promotion_redemptions add constraint promotion_redemptions_promotion_redemption_order_id_fkey
+    foreign key (promotion_redemption_order_id) references orders(order_id) on delete cascade;
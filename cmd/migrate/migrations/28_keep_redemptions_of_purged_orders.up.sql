@@ -0,0 +1,9 @@
+-- Usage limits are counted from redemptions, so purging a deleted order must
+-- not give its codes back. The redemption outlives the order instead.
+alter table promotion_redemptions drop constraint if exists promotion_redemptions_promotion_redemption_order_id_fkey;
+alter table promotion_redemptions drop constraint if exists promotion_redemptions_pkey;
+alter table promotion_redemptions add column if not exists promotion_redemption_id bigserial primary key;
+alter table promotion_redemptions alter column promotion_redemption_order_id drop not null;
+alter table promotion_redemptions add constraint promotion_redemptions_order_key unique (promotion_redemption_promotion_id, promotion_redemption_order_id);
+alter table promotion_redemptions add constraint promotion_redemptions_promotion_redemption_order_id_fkey
+    foreign key (promotion_redemption_order_id) references orders(order_id) on delete set null;
@@ -0,0 +1,3 @@
+alter table books drop column if exists book_version;
+alter table orders drop column if exists order_version;
+alter table users drop column if exists user_version;
@@ -0,0 +1,3 @@
+alter table books add column if not exists book_version int not null default 1;
+alter table orders add column if not exists order_version int not null default 1;
+alter table users add column if not exists user_version int not null default 1;
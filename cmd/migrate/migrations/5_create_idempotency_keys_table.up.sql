@@ -0,0 +1,14 @@
+create table if not exists idempotency_keys (
+    idempotency_user_id int not null,
+    idempotency_key varchar(255) not null,
+    idempotency_fingerprint char(64) not null,
+    idempotency_response_status int,
+    idempotency_response_headers jsonb,
+    idempotency_response_body bytea,
+    idempotency_created_at timestamptz not null default now(),
+    idempotency_expires_at timestamptz not null,
+    primary key (idempotency_user_id, idempotency_key),
+    foreign key (idempotency_user_id) references users(user_id) on delete cascade
+);
+
+create index if not exists idempotency_keys_expires_at_idx on idempotency_keys (idempotency_expires_at);
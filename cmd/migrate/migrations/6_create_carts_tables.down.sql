@@ -0,0 +1,4 @@
+drop table if exists order_items;
+drop table if exists cart_items;
+drop table if exists carts;
+alter table books drop column if exists book_stock;
@@ -0,0 +1,37 @@
+-- Stock was not tracked before, so every existing book could always be
+-- ordered. Existing books start with a stock of 1000 to keep the catalog on
+-- sale after the upgrade, until admins set their real counts. Books added
+-- later start out of stock unless a stock is given.
+alter table books add column if not exists book_stock int not null default 1000 check (book_stock >= 0);
+alter table books alter column book_stock set default 0;
+
+-- A cart belongs either to a user or, before login, to an anonymous cart token.
+create table if not exists carts (
+    cart_id serial unique primary key,
+    cart_user_id int unique,
+    cart_token varchar(64) unique,
+    cart_updated_at timestamptz not null default now(),
+    foreign key (cart_user_id) references users(user_id) on delete cascade,
+    check ((cart_user_id is null) <> (cart_token is null))
+);
+
+create table if not exists cart_items (
+    cart_item_cart_id int not null,
+    cart_item_book_id int not null,
+    cart_item_quantity int not null check (cart_item_quantity > 0),
+    cart_item_unit_price int not null,
+    primary key (cart_item_cart_id, cart_item_book_id),
+    foreign key (cart_item_cart_id) references carts(cart_id) on delete cascade,
+    foreign key (cart_item_book_id) references books(book_id) on delete cascade
+);
+
+-- Order items keep the price paid, so they do not reference books and survive
+-- the book being deleted.
+create table if not exists order_items (
+    order_item_order_id int not null,
+    order_item_book_id int not null,
+    order_item_quantity int not null check (order_item_quantity > 0),
+    order_item_unit_price int not null,
+    primary key (order_item_order_id, order_item_book_id),
+    foreign key (order_item_order_id) references orders(order_id) on delete cascade
+);
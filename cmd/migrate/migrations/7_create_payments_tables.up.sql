@@ -0,0 +1,23 @@
+create table if not exists payments (
+    payment_id serial unique primary key,
+    payment_order_id int not null,
+    payment_provider varchar(32) not null,
+    payment_provider_id varchar(128),
+    payment_status varchar(16) not null,
+    payment_amount int not null,
+    payment_refunded_amount int not null default 0,
+    payment_failure_reason varchar(256) not null default '',
+    payment_created_at timestamptz not null default now(),
+    payment_updated_at timestamptz not null default now(),
+    unique (payment_provider, payment_provider_id),
+    foreign key (payment_order_id) references orders(order_id) on delete cascade
+);
+
+-- Webhook events already handled, so a redelivered event is applied once.
+create table if not exists payment_events (
+    payment_event_provider varchar(32) not null,
+    payment_event_id varchar(128) not null,
+    payment_event_type varchar(64) not null,
+    payment_event_received_at timestamptz not null default now(),
+    primary key (payment_event_provider, payment_event_id)
+);
@@ -0,0 +1,3 @@
+drop table if exists order_events;
+drop table if exists return_items;
+drop table if exists returns;
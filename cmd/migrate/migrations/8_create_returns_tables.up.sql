@@ -0,0 +1,32 @@
+create table if not exists returns (
+    return_id serial unique primary key,
+    return_order_id int not null,
+    return_status varchar(16) not null,
+    return_reason varchar(1024) not null,
+    return_admin_note varchar(1024) not null default '',
+    return_refund_amount int not null default 0,
+    return_created_at timestamptz not null default now(),
+    return_updated_at timestamptz not null default now(),
+    foreign key (return_order_id) references orders(order_id) on delete cascade
+);
+
+create table if not exists return_items (
+    return_item_return_id int not null,
+    return_item_book_id int not null,
+    return_item_quantity int not null check (return_item_quantity > 0),
+    primary key (return_item_return_id, return_item_book_id),
+    foreign key (return_item_return_id) references returns(return_id) on delete cascade
+);
+
+-- Timeline of everything that happened to an order.
+create table if not exists order_events (
+    order_event_id serial unique primary key,
+    order_event_order_id int not null,
+    order_event_type varchar(64) not null,
+    order_event_detail varchar(1024) not null default '',
+    order_event_actor_id int,
+    order_event_created_at timestamptz not null default now(),
+    foreign key (order_event_order_id) references orders(order_id) on delete cascade
+);
+
+create index if not exists order_events_order_id_idx on order_events (order_event_order_id, order_event_id);
@@ -0,0 +1,7 @@
+alter table orders drop constraint if exists orders_order_user_id_fkey;
+alter table orders add constraint orders_order_user_id_fkey
+    foreign key (order_user_id) references users(user_id) on delete cascade;
+
+alter table orders drop column if exists order_deleted_at;
+alter table books drop column if exists book_deleted_at;
+alter table users drop column if exists user_deleted_at;
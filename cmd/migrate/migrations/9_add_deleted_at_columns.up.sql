@@ -0,0 +1,9 @@
+alter table users add column if not exists user_deleted_at timestamptz;
+alter table books add column if not exists book_deleted_at timestamptz;
+alter table orders add column if not exists order_deleted_at timestamptz;
+
+-- Users are soft deleted now, so removing a user row must no longer take the
+-- sales history with it. The purge job only removes users without orders.
+alter table orders drop constraint if exists orders_order_user_id_fkey;
+alter table orders add constraint orders_order_user_id_fkey
+    foreign key (order_user_id) references users(user_id) on delete restrict;
@@ -15,9 +15,177 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/v1/audit-events": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets a page of audit events, newest first, filtered by actor, target and time range",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "gets a page of audit events",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of the user who made the change",
+                        "name": "actor_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "type of target, such as book, order, payment or return",
+                        "name": "target_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the changed resource",
+                        "name": "target_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "earliest time, RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "time before which events happened, RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of events to return per page",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got audit events",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.AuditEvent"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/audit-events/export": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "export every audit event matching the filter as CSV, newest first",
+                "produces": [
+                    "text/csv"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "export audit events",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of the user who made the change",
+                        "name": "actor_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "type of target, such as book, order, payment or return",
+                        "name": "target_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the changed resource",
+                        "name": "target_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "earliest time, RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "time before which events happened, RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file of audit events",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
         "/api/v1/auth/login": {
             "post": {
-                "description": "logins a user",
+                "description": "logins a user and merges the anonymous cart of the cart cookie into their cart",
                 "consumes": [
                     "application/json"
                 ],
@@ -47,21 +215,21 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "error binding JSON",
+                        "description": "malformed_body or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "401": {
-                        "description": "invalid email or password",
+                        "description": "invalid_credentials",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error generating token",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
@@ -99,33 +267,36 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "error binding JSON",
+                        "description": "malformed_body or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "email_already_registered",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error creating user",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/books": {
+        "/api/v1/authors": {
             "get": {
-                "description": "gets a page of books",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "gets a page of authors ordered by name",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "book"
+                    "author"
                 ],
-                "summary": "gets a page of books",
+                "summary": "gets a page of authors",
                 "parameters": [
                     {
                         "type": "integer",
@@ -135,25 +306,31 @@ const docTemplate = `{
                     },
                     {
                         "type": "integer",
-                        "description": "max number of books to return per page",
+                        "description": "max number of authors to return per page, at most 100",
                         "name": "limit",
                         "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully got a page of books",
+                        "description": "successfully got a page of authors",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/database.Book"
+                                "$ref": "#/definitions/database.Author"
                             }
                         }
                     },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
                     "500": {
-                        "description": "error getting a page",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
@@ -164,7 +341,7 @@ const docTemplate = `{
                         "CookieAuth": []
                     }
                 ],
-                "description": "creates a book",
+                "description": "adds an author, who can then be credited on books",
                 "consumes": [
                     "application/json"
                 ],
@@ -172,93 +349,129 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "book"
+                    "author"
                 ],
-                "summary": "creates a book",
+                "summary": "creates an author",
                 "parameters": [
                     {
-                        "description": "new book to add to db",
-                        "name": "book",
+                        "description": "new author",
+                        "name": "author",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/database.Book"
+                            "$ref": "#/definitions/database.Author"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "successfully created a book",
+                        "description": "successfully created an author",
                         "schema": {
-                            "$ref": "#/definitions/database.Book"
+                            "$ref": "#/definitions/database.Author"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the author"
+                            }
                         }
                     },
                     "400": {
-                        "description": "error binding JSON",
+                        "description": "malformed_body or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error creating books",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/books/:id": {
+        "/api/v1/authors/:id": {
             "get": {
-                "description": "get one book by id",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "get an author by id",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "book"
+                    "author"
                 ],
-                "summary": "get one book",
+                "summary": "get author",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of book to get",
+                        "description": "id of author",
                         "name": "id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully got a book",
+                        "description": "successfully got an author",
                         "schema": {
-                            "$ref": "#/definitions/database.Book"
+                            "$ref": "#/definitions/database.Author"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the author"
+                            }
                         }
                     },
+                    "304": {
+                        "description": "author has not changed"
+                    },
                     "400": {
-                        "description": "invalid book id",
+                        "description": "invalid_id",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "404": {
-                        "description": "book not found with this id",
+                        "description": "author_not_found",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error getting book",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
@@ -269,7 +482,7 @@ const docTemplate = `{
                         "CookieAuth": []
                     }
                 ],
-                "description": "update a book by id",
+                "description": "update an author by id. Renaming an author rewrites the author byline of their books.",
                 "consumes": [
                     "application/json"
                 ],
@@ -277,56 +490,81 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "book"
+                    "author"
                 ],
-                "summary": "update a book",
+                "summary": "update an author",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of book to update",
+                        "description": "id of author to update",
                         "name": "id",
                         "in": "query",
                         "required": true
                     },
                     {
-                        "description": "updated book data",
-                        "name": "book",
+                        "type": "string",
+                        "description": "current ETag of the author",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated author",
+                        "name": "author",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/database.Book"
+                            "$ref": "#/definitions/database.Author"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully updated a book",
+                        "description": "successfully updated an author",
                         "schema": {
-                            "$ref": "#/definitions/database.Book"
+                            "$ref": "#/definitions/database.Author"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the author"
+                            }
                         }
                     },
                     "400": {
-                        "description": "error binding JSON",
+                        "description": "invalid_id, malformed_body or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "404": {
-                        "description": "book to update not found",
+                        "description": "author_not_found",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "failed to update book",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
@@ -337,24 +575,28 @@ const docTemplate = `{
                         "CookieAuth": []
                     }
                 ],
-                "description": "delete a book by id",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "delete an author by id. Authors credited on books cannot be deleted.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "book"
+                    "author"
                 ],
-                "summary": "delete book",
+                "summary": "delete author",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of book to delete",
+                        "description": "id of author to delete",
                         "name": "id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the author",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -362,45 +604,68 @@ const docTemplate = `{
                         "description": "successfully deleted"
                     },
                     "400": {
-                        "description": "invalid id",
+                        "description": "invalid_id",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "author_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "author_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error deleting book",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/orders": {
+        "/api/v1/authors/:id/books": {
             "get": {
-                "security": [
-                    {
-                        "CookieAuth": []
-                    }
-                ],
-                "description": "gets a page of orders",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "gets a page of the books credited to an author",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "order"
+                    "author"
                 ],
-                "summary": "gets a page of orders",
+                "summary": "get author's books",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of author",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
                     {
                         "type": "integer",
                         "description": "page number to request",
@@ -409,31 +674,113 @@ const docTemplate = `{
                     },
                     {
                         "type": "integer",
-                        "description": "max number of orders to return per page",
+                        "description": "max number of books to return per page, at most 100",
                         "name": "limit",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency to price the books in",
+                        "name": "currency",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully got a page of orders",
+                        "description": "successfully got a page of books",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/database.Order"
+                                "$ref": "#/definitions/database.Book"
                             }
                         }
                     },
-                    "403": {
-                        "description": "wrong role",
+                    "400": {
+                        "description": "invalid_id or invalid_query",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
-                    "500": {
-                        "description": "error getting a page",
+                    "404": {
+                        "description": "author_not_found",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "exchange_rate_unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/books": {
+            "get": {
+                "description": "gets a page of books",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "book"
+                ],
+                "summary": "gets a page of books",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of books to return per page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency to price the books in",
+                        "name": "currency",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Book"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "exchange_rate_unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
@@ -444,7 +791,7 @@ const docTemplate = `{
                         "CookieAuth": []
                     }
                 ],
-                "description": "creates an order",
+                "description": "creates a book",
                 "consumes": [
                     "application/json"
                 ],
@@ -452,56 +799,69 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "order"
+                    "book"
                 ],
-                "summary": "creates an order",
+                "summary": "creates a book",
                 "parameters": [
                     {
-                        "description": "new order to add to db",
-                        "name": "order",
+                        "description": "new book to add to db",
+                        "name": "book",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/database.Order"
+                            "$ref": "#/definitions/database.Book"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "successfully created an order",
+                        "description": "successfully created a book",
                         "schema": {
-                            "$ref": "#/definitions/database.Order"
+                            "$ref": "#/definitions/database.Book"
                         }
                     },
                     "400": {
-                        "description": "error binding JSON",
+                        "description": "malformed_body or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "isbn_exists or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "publisher_not_found or idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error creating order",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/orders/:id": {
+        "/api/v1/books/:id": {
             "get": {
-                "security": [
-                    {
-                        "CookieAuth": []
-                    }
-                ],
-                "description": "get one order by id",
+                "description": "get one book by id",
                 "consumes": [
                     "application/json"
                 ],
@@ -509,47 +869,68 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "order"
+                    "book"
                 ],
-                "summary": "get one order",
+                "summary": "get one book",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of order to get",
+                        "description": "id of book to get",
                         "name": "id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency to price the book in",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully got an order",
+                        "description": "successfully got a book",
                         "schema": {
-                            "$ref": "#/definitions/database.Order"
+                            "$ref": "#/definitions/database.Book"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the book"
+                            }
                         }
                     },
+                    "304": {
+                        "description": "book has not changed"
+                    },
                     "400": {
-                        "description": "invalid order id",
+                        "description": "invalid_id or invalid_query",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
-                    "403": {
-                        "description": "wrong role/unauthorized",
+                    "404": {
+                        "description": "book_not_found",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
-                    "404": {
-                        "description": "order not found with this id",
+                    "422": {
+                        "description": "exchange_rate_unavailable",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error getting order",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
@@ -560,7 +941,7 @@ const docTemplate = `{
                         "CookieAuth": []
                     }
                 ],
-                "description": "update an order by id",
+                "description": "update a book by id",
                 "consumes": [
                     "application/json"
                 ],
@@ -568,56 +949,93 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "order"
+                    "book"
                 ],
-                "summary": "update an order",
+                "summary": "update a book",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of order to update",
+                        "description": "id of book to update",
                         "name": "id",
                         "in": "query",
                         "required": true
                     },
                     {
-                        "description": "updated order data",
-                        "name": "order",
+                        "type": "string",
+                        "description": "current ETag of the book",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated book data",
+                        "name": "book",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/database.Order"
+                            "$ref": "#/definitions/database.Book"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully updated a order",
+                        "description": "successfully updated a book",
                         "schema": {
-                            "$ref": "#/definitions/database.Order"
+                            "$ref": "#/definitions/database.Book"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the book"
+                            }
                         }
                     },
                     "400": {
-                        "description": "error binding JSON",
+                        "description": "invalid_id, malformed_body or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role/unauthorized",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "404": {
-                        "description": "order to update not found",
+                        "description": "book_not_found",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "isbn_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "publisher_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "failed to update order",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
@@ -628,7 +1046,7 @@ const docTemplate = `{
                         "CookieAuth": []
                     }
                 ],
-                "description": "delete an order by id",
+                "description": "delete a book by id",
                 "consumes": [
                     "application/json"
                 ],
@@ -636,16 +1054,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "order"
+                    "book"
                 ],
-                "summary": "delete order",
+                "summary": "delete book",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of order to delete",
+                        "description": "id of book to delete",
                         "name": "id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the book",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -653,161 +1078,212 @@ const docTemplate = `{
                         "description": "successfully deleted"
                     },
                     "400": {
-                        "description": "invalid id",
+                        "description": "invalid_id",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error deleting order",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
-            }
-        },
-        "/api/v1/users/:id": {
-            "get": {
+            },
+            "patch": {
                 "security": [
                     {
                         "CookieAuth": []
                     }
                 ],
-                "description": "get one user by id",
+                "description": "partially update a book by id with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902)",
                 "consumes": [
-                    "application/json"
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "book"
                 ],
-                "summary": "get one user",
+                "summary": "partially update a book",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of user to get",
+                        "description": "id of book to update",
                         "name": "id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the book",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "merge patch or JSON patch document",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully got a user",
+                        "description": "successfully updated a book",
                         "schema": {
-                            "$ref": "#/definitions/database.User"
+                            "$ref": "#/definitions/database.Book"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the book"
+                            }
                         }
                     },
                     "400": {
-                        "description": "invalid user id",
+                        "description": "invalid_id, malformed_body, invalid_patch or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role/unauthorized",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "404": {
-                        "description": "user not found with this id",
+                        "description": "book_not_found",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "patch_test_failed or isbn_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported_media_type",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "publisher_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error getting user",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
-            },
-            "put": {
-                "security": [
-                    {
-                        "CookieAuth": []
-                    }
-                ],
-                "description": "update a user by id",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/api/v1/books/:id/authors": {
+            "get": {
+                "description": "get the authors of a book in the order they are credited",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "book"
                 ],
-                "summary": "update a user",
+                "summary": "get book authors",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of user to update",
+                        "description": "id of book",
                         "name": "id",
                         "in": "query",
                         "required": true
-                    },
-                    {
-                        "description": "updated user data",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/database.User"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "successfully updated a user",
+                        "description": "successfully got the authors",
                         "schema": {
-                            "$ref": "#/definitions/database.User"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Author"
+                            }
                         }
                     },
                     "400": {
-                        "description": "error binding JSON",
-                        "schema": {
-                            "$ref": "#/definitions/gin.H"
-                        }
-                    },
-                    "403": {
-                        "description": "wrong role/unauthorized",
+                        "description": "invalid_id",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "404": {
-                        "description": "user to update not found",
+                        "description": "book_not_found",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "failed to update user",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             },
-            "delete": {
+            "put": {
                 "security": [
                     {
                         "CookieAuth": []
                     }
                 ],
-                "description": "delete a user by id",
+                "description": "replace the authors of a book, credited in the order given. The book's author byline becomes their names.",
                 "consumes": [
                     "application/json"
                 ],
@@ -815,51 +1291,151 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "book"
                 ],
-                "summary": "delete user",
+                "summary": "set book authors",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "id of user to delete",
+                        "description": "id of book",
                         "name": "id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the book",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "ids of the authors",
+                        "name": "authors",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.bookAuthorsRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "successfully deleted"
+                    "200": {
+                        "description": "successfully set the authors",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Author"
+                            }
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the book"
+                            }
+                        }
                     },
                     "400": {
-                        "description": "invalid id",
+                        "description": "invalid_id, malformed_body or validation_failed",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "author_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error deleting user",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
         },
-        "/api/v2/books/all": {
+        "/api/v1/books/:id/categories": {
             "get": {
+                "description": "get the categories a book is filed under",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "book"
+                ],
+                "summary": "get book categories",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of book",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the categories",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Category"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
                 "security": [
                     {
                         "CookieAuth": []
                     }
                 ],
-                "description": "gets all books",
+                "description": "replace the categories a book is filed under. An empty list removes it from every category.",
                 "consumes": [
                     "application/json"
                 ],
@@ -869,34 +1445,149 @@ const docTemplate = `{
                 "tags": [
                     "book"
                 ],
-                "summary": "gets all books",
+                "summary": "set book categories",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of book",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the book",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "ids of the categories",
+                        "name": "categories",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.bookCategoriesRequest"
+                        }
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "successfully got all books",
+                        "description": "successfully set the categories",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/database.Book"
+                                "$ref": "#/definitions/database.Category"
+                            }
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the book"
                             }
                         }
                     },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
                     "500": {
-                        "description": "error getting all books",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
         },
-        "/api/v2/orders/all": {
+        "/api/v1/books/:id/prices": {
             "get": {
+                "description": "get the list prices of a book in currencies other than its own, which are used instead of converting its price",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "book"
+                ],
+                "summary": "get book list prices",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of book",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the list prices",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/money.Money"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
                 "security": [
                     {
                         "CookieAuth": []
                     }
                 ],
-                "description": "gets all orders",
+                "description": "add or replace the list price of a book in one currency",
                 "consumes": [
                     "application/json"
                 ],
@@ -904,179 +1595,7695 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "order"
+                    "book"
+                ],
+                "summary": "set book list price",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of book",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "list price",
+                        "name": "price",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/money.Money"
+                        }
+                    }
                 ],
-                "summary": "gets all orders",
                 "responses": {
                     "200": {
-                        "description": "successfully got all Orders",
+                        "description": "successfully set the list price",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/database.Order"
+                                "$ref": "#/definitions/money.Money"
                             }
                         }
                     },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error getting all Orders",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
         },
-        "/api/v2/users/all": {
-            "get": {
+        "/api/v1/books/:id/prices/:currency": {
+            "delete": {
                 "security": [
                     {
                         "CookieAuth": []
                     }
                 ],
-                "description": "gets all users",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "delete the list price of a book in one currency, after which its price is converted again",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "book"
+                ],
+                "summary": "delete book list price",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of book",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency of the list price",
+                        "name": "currency",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
-                "summary": "gets all users",
                 "responses": {
-                    "200": {
-                        "description": "successfully got all users",
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/database.User"
-                            }
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "403": {
-                        "description": "wrong role",
+                        "description": "forbidden",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_price_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
                         }
                     },
                     "500": {
-                        "description": "error getting all users",
+                        "description": "internal_error",
                         "schema": {
-                            "$ref": "#/definitions/gin.H"
+                            "$ref": "#/definitions/main.problem"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "database.Book": {
-            "type": "object",
-            "required": [
-                "author",
-                "price",
-                "title"
-            ],
-            "properties": {
-                "author": {
-                    "type": "string",
-                    "minLength": 3
-                },
-                "id": {
-                    "type": "integer"
-                },
-                "price": {
-                    "type": "integer"
-                },
-                "title": {
+        },
+        "/api/v1/books/:id/restore": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "restore a deleted book by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "book"
+                ],
+                "summary": "restore book",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of book to restore",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully restored a book",
+                        "schema": {
+                            "$ref": "#/definitions/database.Book"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the book"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "isbn_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/books/isbn/:isbn": {
+            "get": {
+                "description": "get one book by its ISBN-13 or ISBN-10, with or without hyphens",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "book"
+                ],
+                "summary": "get one book by ISBN",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ISBN of book to get",
+                        "name": "isbn",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency to price the book in",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a book",
+                        "schema": {
+                            "$ref": "#/definitions/database.Book"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the book"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "book has not changed"
+                    },
+                    "400": {
+                        "description": "invalid_isbn or invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "exchange_rate_unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/cart": {
+            "get": {
+                "description": "get the cart of the logged in customer, or the anonymous cart of the cart cookie, priced at current book prices",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cart"
+                ],
+                "summary": "get cart",
+                "responses": {
+                    "200": {
+                        "description": "successfully got the cart",
+                        "schema": {
+                            "$ref": "#/definitions/database.Cart"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/cart/checkout": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "turn the customer's cart into a pending order, taking the books from stock and emptying the cart. The order is taxed in the region of its shipping address, which is required once tax rates exist.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cart"
+                ],
+                "summary": "checkout cart",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "currency to place the order in, at list prices or converted at the current rate",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "promotion codes to apply",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the address to ship to; defaults to the default address",
+                        "name": "shipping_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the billing address; defaults to the shipping address",
+                        "name": "billing_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created an order",
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "address_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "cart_empty, cart_prices_changed, cart_mixed_currencies, insufficient_stock or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused, exchange_rate_unavailable, promotion_not_applicable, shipping_unavailable or address_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/cart/items": {
+            "post": {
+                "description": "add copies of a book to the cart, on top of any already in it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cart"
+                ],
+                "summary": "add book to cart",
+                "parameters": [
+                    {
+                        "description": "book and quantity to add",
+                        "name": "item",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.addCartItemRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully added to the cart",
+                        "schema": {
+                            "$ref": "#/definitions/database.Cart"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "book_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/cart/items/:book_id": {
+            "put": {
+                "description": "set the quantity of a book already in the cart",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cart"
+                ],
+                "summary": "update cart item",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of the book in the cart",
+                        "name": "book_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "new quantity",
+                        "name": "item",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.updateCartItemRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated the cart",
+                        "schema": {
+                            "$ref": "#/definitions/database.Cart"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "cart_item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "remove a book from the cart",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cart"
+                ],
+                "summary": "remove cart item",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of the book in the cart",
+                        "name": "book_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully removed from the cart",
+                        "schema": {
+                            "$ref": "#/definitions/database.Cart"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "cart_item_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/categories": {
+            "get": {
+                "description": "gets every category ordered by name. The tree is built from their parent ids.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "category"
+                ],
+                "summary": "gets categories",
+                "responses": {
+                    "200": {
+                        "description": "successfully got the categories",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Category"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "adds a category, below parent_id if it is given",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "category"
+                ],
+                "summary": "creates a category",
+                "parameters": [
+                    {
+                        "description": "new category",
+                        "name": "category",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Category"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created a category",
+                        "schema": {
+                            "$ref": "#/definitions/database.Category"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the category"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "category_exists or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "invalid_category_parent or idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/categories/:id": {
+            "get": {
+                "description": "get a category by id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "category"
+                ],
+                "summary": "get category",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of category",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a category",
+                        "schema": {
+                            "$ref": "#/definitions/database.Category"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the category"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "category has not changed"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "update a category by id, which may move it below another parent",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "category"
+                ],
+                "summary": "update a category",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of category to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the category",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated category",
+                        "name": "category",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Category"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated a category",
+                        "schema": {
+                            "$ref": "#/definitions/database.Category"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the category"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "category_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "invalid_category_parent",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete a category by id. Categories with subcategories or books cannot be deleted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "category"
+                ],
+                "summary": "delete category",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of category to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the category",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "category_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/categories/:id/books": {
+            "get": {
+                "description": "gets a page of the books filed under a category or any of its subcategories",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "category"
+                ],
+                "summary": "get category's books",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of category",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of books to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency to price the books in",
+                        "name": "currency",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Book"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id or invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "category_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "exchange_rate_unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/exchange-rates": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets the exchange rates, including past and future ones, latest effective first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "exchange rate"
+                ],
+                "summary": "gets exchange rates",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "currency converted from",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency converted to",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got exchange rates",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.ExchangeRate"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "adds a rate for a currency pair that applies from effective_at, or from now if it is left out, until a later rate takes over",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "exchange rate"
+                ],
+                "summary": "creates an exchange rate",
+                "parameters": [
+                    {
+                        "description": "new exchange rate",
+                        "name": "rate",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.ExchangeRate"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created an exchange rate",
+                        "schema": {
+                            "$ref": "#/definitions/database.ExchangeRate"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "exchange_rate_exists or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/exchange-rates/:id": {
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete an exchange rate that has not taken effect yet; rates that did are kept as history",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "exchange rate"
+                ],
+                "summary": "delete exchange rate",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of exchange rate to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "exchange_rate_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "exchange_rate_in_effect",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/imports": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets a page of import jobs, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "import"
+                ],
+                "summary": "gets a page of imports",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of imports to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of imports",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.ImportJob"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "queues a CSV or ONIX 3.0 file whose books are added, or updated when a book with the same ISBN exists. The import runs in the background; poll the job for progress and download its report. A dry run records what would change without changing anything.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "import"
+                ],
+                "summary": "imports books",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "CSV file with columns isbn, title, author, price and optionally currency, stock, publisher, tax_category and weight_grams, or an ONIX 3.0 message in reference tags",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv or onix, by default inferred from the file name",
+                        "name": "format",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "only report what would change",
+                        "name": "dry_run",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "successfully queued the import",
+                        "schema": {
+                            "$ref": "#/definitions/database.ImportJob"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_import",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "413": {
+                        "description": "body_too_large",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/imports/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get an import job and its progress by id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "import"
+                ],
+                "summary": "get import",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of import",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got an import",
+                        "schema": {
+                            "$ref": "#/definitions/database.ImportJob"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "import_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/imports/:id/report": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "downloads what happened to each row of an import as CSV with columns row, isbn, action, book_id, changes and error. Rows are reported as they are processed.",
+                "produces": [
+                    "text/csv"
+                ],
+                "tags": [
+                    "import"
+                ],
+                "summary": "download import report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of import",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "only rows that were created, updated, unchanged or failed",
+                        "name": "action",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV report",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id or invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "import_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/jobs": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets a page of background jobs, newest first, optionally filtered by type and status",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "gets a page of jobs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "only jobs of this type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only jobs that are queued, running, succeeded, cancelled or dead",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of jobs to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of jobs",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Job"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/jobs/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get a background job with its progress, and its result or error once it has finished. Users can get the jobs they queued; admins can get any job.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "get job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of job",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a job",
+                        "schema": {
+                            "$ref": "#/definitions/database.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "job_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/jobs/:id/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "cancels a queued job at once, or asks the worker running a running job to stop, which it does within about a third of the job lease. Users can cancel the jobs they queued; admins can cancel any job.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "cancel job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of job",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully cancelled the job or asked for it to stop",
+                        "schema": {
+                            "$ref": "#/definitions/database.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "job_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "job_not_cancellable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/jobs/:id/retry": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "queues a dead or cancelled job to run again now, with a fresh set of attempts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "retry job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of job",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully queued the job again",
+                        "schema": {
+                            "$ref": "#/definitions/database.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "job_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "job_not_retryable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get the account of the logged in user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "get my profile",
+                "responses": {
+                    "200": {
+                        "description": "successfully got the user",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the user"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "user has not changed"
+                    }
+                }
+            }
+        },
+        "/api/v1/me/email": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "change the email the logged in user logs in with. The current password must be given.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "change my email",
+                "parameters": [
+                    {
+                        "description": "new email and current password",
+                        "name": "change",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.emailChangeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully changed the email",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "incorrect_password",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "email_already_registered",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me/orders": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get a page of the logged in user's orders, newest first, optionally filtered by status and by when they were placed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "get my orders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "only orders with this status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "earliest time the order was placed, RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "time before which the order was placed, RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of orders to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of orders",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Order"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me/orders/stream": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "streams an order.status_changed Server-Sent Event whenever one of the logged in user's orders changes status. Each event's data is the event as JSON. A comment is sent as a heartbeat while nothing happens. Each event's id is the client's position in the stream: the id of the latest event sent, followed by a colon and the ids of earlier events that were still committing, if any. A client that reconnects with Last-Event-ID first gets the events it missed, each once.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "stream my order status changes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "id of the last event received, to resume after",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "stream of events",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me/password": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "change the logged in user's password. The current password must be given.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "change my password",
+                "parameters": [
+                    {
+                        "description": "current and new password",
+                        "name": "change",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.passwordChangeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully changed the password"
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "incorrect_password",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets a page of orders",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "gets a page of orders",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of orders to return per page",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of orders",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Order"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "creates an order",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "creates an order",
+                "parameters": [
+                    {
+                        "description": "new order to add to db",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency to place the order in, converting the total at the current rate",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "promotion codes to apply to the total",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the address to ship to; defaults to the default address",
+                        "name": "shipping_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the billing address; defaults to the shipping address",
+                        "name": "billing_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created an order",
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body, validation_failed or invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "address_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused, exchange_rate_unavailable or promotion_not_applicable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get one order by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "get one order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order to get",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got an order",
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the order"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "order has not changed"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "cancel one of the customer's pending orders by setting its status to Cancelled, which puts its books back in stock. The user and total price cannot be changed, and other statuses are set by payments, shipments and refunds.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "update an order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the order",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated order data",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated a order",
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the order"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "order_not_cancellable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "order_read_only",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete an order by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "delete order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the order",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "cancel one of the customer's pending orders with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902) that sets its status to Cancelled. The user and total price cannot be changed, and other statuses are set by payments, shipments and refunds.",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "partially update an order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the order",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "merge patch or JSON patch document",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated an order",
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the order"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body, invalid_patch or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "patch_test_failed or order_not_cancellable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported_media_type",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "order_read_only",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/:id/history": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get the timeline of an order: creation, payments, refunds and returns, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "get order history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the history",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.OrderEvent"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/:id/invoice": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get the invoice of an order with its items, discounts, the tax on each line, its addresses and the subtotal, discount, shipping, tax and total",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "get order invoice",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the invoice",
+                        "schema": {
+                            "$ref": "#/definitions/main.invoice"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/:id/payments": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "list every payment attempt for an order",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "payment"
+                ],
+                "summary": "get order payments",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the payments",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Payment"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "authorize and capture the order total with the payment provider. The order becomes Paid when the provider confirms the capture by webhook.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "payment"
+                ],
+                "summary": "pay for an order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order to pay for",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "payment method from the provider",
+                        "name": "payment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.payOrderRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully captured the payment",
+                        "schema": {
+                            "$ref": "#/definitions/database.Payment"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "402": {
+                        "description": "payment_declined",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "order_not_payable or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "504": {
+                        "description": "payment_provider_timeout",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/:id/restore": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "restore a deleted order by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "restore order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order to restore",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully restored a order",
+                        "schema": {
+                            "$ref": "#/definitions/database.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the order"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/:id/returns": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "list the returns requested for an order",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "return"
+                ],
+                "summary": "get order returns",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the returns",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Return"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "request a return of some of the books of a paid order",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "return"
+                ],
+                "summary": "request a return",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "books to return and why",
+                        "name": "return",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.returnRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully requested the return",
+                        "schema": {
+                            "$ref": "#/definitions/database.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "order_not_returnable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "invalid_return_items",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/:id/shipments": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "list the shipments of an order with their tracking events. Shipments not yet delivered are first refreshed from the carrier.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shipment"
+                ],
+                "summary": "get order shipments",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the shipments",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Shipment"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "record that some or all of the remaining books of a paid order were handed to a carrier. The order moves to Partially Shipped until all of its books are shipped and then to Shipped.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shipment"
+                ],
+                "summary": "create shipment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of order",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "carrier, tracking number and books shipped",
+                        "name": "shipment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.shipmentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created the shipment",
+                        "schema": {
+                            "$ref": "#/definitions/database.Shipment"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the shipment"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "order_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "order_not_shippable or shipment_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "invalid_shipment_items",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/orders/stream": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "streams an order.created Server-Sent Event whenever any order is placed. Each event's data is the event as JSON. A comment is sent as a heartbeat while nothing happens. Each event's id is the client's position in the stream: the id of the latest event sent, followed by a colon and the ids of earlier events that were still committing, if any. A client that reconnects with Last-Event-ID first gets the events it missed, each once.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "stream new orders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "id of the last event received, to resume after",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "stream of events",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/payments/:id/refund": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "refund part or all of a captured payment. The order becomes Refunded when the provider confirms a full refund by webhook.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "payment"
+                ],
+                "summary": "refund payment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of payment to refund",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "amount to refund",
+                        "name": "refund",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.refundPaymentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully refunded",
+                        "schema": {
+                            "$ref": "#/definitions/database.Payment"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "payment_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "payment_not_refundable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "currency_mismatch",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "504": {
+                        "description": "payment_provider_timeout",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/payments/:id/void": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "cancel an authorized payment that was never captured",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "payment"
+                ],
+                "summary": "void payment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of payment to void",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully voided",
+                        "schema": {
+                            "$ref": "#/definitions/database.Payment"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "payment_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "payment_not_voidable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "504": {
+                        "description": "payment_provider_timeout",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/payments/webhook": {
+            "post": {
+                "description": "receives signed events from the payment provider. Each event is applied once; redelivered events are acknowledged without effect.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "payment"
+                ],
+                "summary": "payment provider webhook",
+                "responses": {
+                    "200": {
+                        "description": "event processed, duplicate or ignored",
+                        "schema": {
+                            "$ref": "#/definitions/gin.H"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_webhook_signature or malformed_body",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/promotions": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets every promotion by code, including expired and used up ones",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "promotion"
+                ],
+                "summary": "gets promotions",
+                "responses": {
+                    "200": {
+                        "description": "successfully got promotions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/promotion.Promotion"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "adds a promotion code. percent_off needs percent_off, fixed_amount needs amount_off and buy_x_get_y needs buy_quantity and get_quantity; book_id limits percent_off and buy_x_get_y to one book. A max_uses or max_uses_per_customer of 0 means no limit.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "promotion"
+                ],
+                "summary": "creates a promotion",
+                "parameters": [
+                    {
+                        "description": "new promotion",
+                        "name": "promotion",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/promotion.Promotion"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created a promotion",
+                        "schema": {
+                            "$ref": "#/definitions/promotion.Promotion"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the promotion"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "promotion_exists or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/promotions/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get a promotion by id with how often it has been used",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "promotion"
+                ],
+                "summary": "get promotion",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of promotion",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a promotion",
+                        "schema": {
+                            "$ref": "#/definitions/promotion.Promotion"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the promotion"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "promotion_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "update a promotion by id. Orders already placed keep the discounts they got.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "promotion"
+                ],
+                "summary": "update a promotion",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of promotion to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the promotion",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated promotion",
+                        "name": "promotion",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/promotion.Promotion"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated a promotion",
+                        "schema": {
+                            "$ref": "#/definitions/promotion.Promotion"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the promotion"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "promotion_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "promotion_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete a promotion by id so its code can no longer be used. Orders keep the discounts they got from it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "promotion"
+                ],
+                "summary": "delete promotion",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of promotion to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the promotion",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "promotion_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/publishers": {
+            "get": {
+                "description": "gets a page of publishers ordered by name",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "publisher"
+                ],
+                "summary": "gets a page of publishers",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of publishers to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of publishers",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Publisher"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "adds a publisher, which books can then name",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "publisher"
+                ],
+                "summary": "creates a publisher",
+                "parameters": [
+                    {
+                        "description": "new publisher",
+                        "name": "publisher",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Publisher"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created a publisher",
+                        "schema": {
+                            "$ref": "#/definitions/database.Publisher"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the publisher"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "publisher_exists or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/publishers/:id": {
+            "get": {
+                "description": "get a publisher by id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "publisher"
+                ],
+                "summary": "get publisher",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of publisher",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a publisher",
+                        "schema": {
+                            "$ref": "#/definitions/database.Publisher"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the publisher"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "publisher has not changed"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "publisher_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "update a publisher by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "publisher"
+                ],
+                "summary": "update a publisher",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of publisher to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the publisher",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated publisher",
+                        "name": "publisher",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Publisher"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated a publisher",
+                        "schema": {
+                            "$ref": "#/definitions/database.Publisher"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the publisher"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "publisher_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "publisher_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete a publisher by id. Publishers named by books cannot be deleted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "publisher"
+                ],
+                "summary": "delete publisher",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of publisher to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the publisher",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "publisher_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "publisher_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/publishers/:id/books": {
+            "get": {
+                "description": "gets a page of the books a publisher published",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "publisher"
+                ],
+                "summary": "get publisher's books",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of publisher",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of books to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "currency to price the books in",
+                        "name": "currency",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Book"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id or invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "publisher_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "exchange_rate_unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/returns/:id/approve": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "approve a requested return so the customer can send the books back",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "return"
+                ],
+                "summary": "approve return",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of return",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "note for the customer",
+                        "name": "decision",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.returnDecisionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully approved",
+                        "schema": {
+                            "$ref": "#/definitions/database.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "return_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "invalid_return_transition",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/returns/:id/receive": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "record that the books of an approved return arrived and put them back in stock",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "return"
+                ],
+                "summary": "receive return",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of return",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully received",
+                        "schema": {
+                            "$ref": "#/definitions/database.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "return_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "invalid_return_transition",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/returns/:id/refund": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "refund a received return against the order's payment. Without an amount the share of what was paid for the returned books, after discounts and with their tax, is refunded.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "return"
+                ],
+                "summary": "refund return",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of return",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "amount to refund",
+                        "name": "refund",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.returnRefundRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully refunded",
+                        "schema": {
+                            "$ref": "#/definitions/database.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "return_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "invalid_return_transition or payment_not_refundable",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "currency_mismatch",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "504": {
+                        "description": "payment_provider_timeout",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/returns/:id/reject": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "reject a requested return",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "return"
+                ],
+                "summary": "reject return",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of return",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "reason for the customer",
+                        "name": "decision",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.returnDecisionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully rejected",
+                        "schema": {
+                            "$ref": "#/definitions/database.Return"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "return_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "invalid_return_transition",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/shipments/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get a shipment with its tracking events by id, refreshing it from the carrier if it has not been delivered yet",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shipment"
+                ],
+                "summary": "get shipment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of shipment",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got the shipment",
+                        "schema": {
+                            "$ref": "#/definitions/database.Shipment"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the shipment"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "shipment_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "correct a shipment's carrier or tracking number, or move it to a new status when the carrier does not report it. Shipments only move forward, except that one not yet delivered can run into an exception and recover from it. The order moves to Delivered once all of its books are delivered.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shipment"
+                ],
+                "summary": "update shipment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of shipment",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the shipment",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated shipment",
+                        "name": "shipment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.shipmentUpdateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated the shipment",
+                        "schema": {
+                            "$ref": "#/definitions/database.Shipment"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the shipment"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "shipment_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "invalid_shipment_transition or shipment_exists",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tax-rates": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets the tax rules, including past and future ones, by region and category with the latest effective first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tax"
+                ],
+                "summary": "gets tax rates",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "region to get the rules of",
+                        "name": "region",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got tax rates",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/tax.Rule"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "adds a tax rule for a region and book category, or every category if it is left empty, that applies from effective_at, or from now if it is left out. The rate is a fraction, so 0.0725 is 7.25% and 0 exempts the category.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tax"
+                ],
+                "summary": "creates a tax rate",
+                "parameters": [
+                    {
+                        "description": "new tax rule",
+                        "name": "rule",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/tax.Rule"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created a tax rate",
+                        "schema": {
+                            "$ref": "#/definitions/tax.Rule"
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "tax_rate_exists or idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tax-rates/:id": {
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete a tax rule that has not taken effect yet; rules that did are kept as history",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tax"
+                ],
+                "summary": "delete tax rate",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of tax rate to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "tax_rate_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "tax_rate_in_effect",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get one user by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "get one user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of user to get",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a user",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the user"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "user has not changed"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "user_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "update a user by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "update a user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of user to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the user",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated user data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated a user",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "user_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "email_already_registered",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete a user by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "delete user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of user to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the user",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "user_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "partially update a user by id with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902)",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "partially update a user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of user to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the user",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "merge patch or JSON patch document",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated a user",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body, invalid_patch or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "user_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "patch_test_failed or email_already_registered",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported_media_type",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/:id/restore": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "restore a deleted user by id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "restore user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of user to restore",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully restored a user",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "user_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "email_already_registered",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/me/addresses": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get the addresses in the logged in user's address book with the default first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "address"
+                ],
+                "summary": "get my addresses",
+                "responses": {
+                    "200": {
+                        "description": "successfully got addresses",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Address"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "add an address to the logged in user's address book. The postal code is checked against the country's format. The first address, or one with is_default set, becomes the default.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "address"
+                ],
+                "summary": "add an address",
+                "parameters": [
+                    {
+                        "description": "new address",
+                        "name": "address",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Address"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully added an address",
+                        "schema": {
+                            "$ref": "#/definitions/database.Address"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the address"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users/me/addresses/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get an address in the logged in user's address book by id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "address"
+                ],
+                "summary": "get my address",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of address",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got an address",
+                        "schema": {
+                            "$ref": "#/definitions/database.Address"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the address"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "address_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "update an address in the logged in user's address book by id. Orders already placed keep their copy of it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "address"
+                ],
+                "summary": "update an address",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of address to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the address",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated address",
+                        "name": "address",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/database.Address"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated an address",
+                        "schema": {
+                            "$ref": "#/definitions/database.Address"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the address"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "address_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete an address from the logged in user's address book by id. Orders already placed keep their copy of it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "address"
+                ],
+                "summary": "delete an address",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of address to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the address",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "address_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets a page of webhook subscriptions, oldest first. Secrets are not included.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "gets a page of webhooks",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of webhooks to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of webhooks",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.WebhookSubscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "subscribes a partner's URL to domain events of the given types, or of every type if none are given. The partner is only sent events about themselves, such as changes to their orders, and events about no user in particular, such as price changes. Each delivery is posted with Webhook-Id, Webhook-Timestamp and Webhook-Signature headers; the signature is \"v1=\" and the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with the secret. A secret is generated when none is given. The secret is only ever returned here.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "creates a webhook",
+                "parameters": [
+                    {
+                        "description": "new webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.webhookRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "key that makes retries of this request safe",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "successfully created a webhook",
+                        "schema": {
+                            "$ref": "#/definitions/main.webhookCreated"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the webhook"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "idempotency_key_in_use",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "idempotency_key_reused or user_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/:id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get a webhook subscription by id, without its secret",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "get webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of webhook",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from a previous response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a webhook",
+                        "schema": {
+                            "$ref": "#/definitions/database.WebhookSubscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the webhook"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "webhook has not changed"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "replaces a webhook subscription's partner, URL, event types and description. The secret is only changed when one is given and enabled only when it is given. Enabling a subscription, including one disabled after repeated failures, clears its failures.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "update a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of webhook to update",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the webhook",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "updated webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.webhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully updated a webhook",
+                        "schema": {
+                            "$ref": "#/definitions/database.WebhookSubscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the webhook"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id, malformed_body or validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "422": {
+                        "description": "user_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "delete a webhook subscription by id, with its deliveries and their logs",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "delete webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of webhook to delete",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "current ETag of the webhook",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "successfully deleted"
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "412": {
+                        "description": "precondition_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "428": {
+                        "description": "precondition_required",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/:id/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets a page of a webhook subscription's deliveries, newest first, optionally filtered by status and event type. Use the delivery endpoint for the log of attempts.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "get webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of webhook",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "only deliveries that are pending, succeeded or failed",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only deliveries of events of this type",
+                        "name": "event_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number to request",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "max number of deliveries to return per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a page of deliveries",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id or invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/:id/deliveries/:delivery_id": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "get a webhook delivery with the payload sent and a log of every attempt, with the response status and the start of the response body",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "get webhook delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of webhook",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of delivery",
+                        "name": "delivery_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully got a delivery",
+                        "schema": {
+                            "$ref": "#/definitions/database.WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found or webhook_delivery_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/:id/deliveries/:delivery_id/redeliver": {
+            "post": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "queues a new delivery of the same event to the webhook, with a fresh set of attempts. The new delivery names the one it repeats in redelivery_of and keeps its Event-Id, so receivers can still ignore events they have already handled.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "redeliver webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id of webhook",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of delivery to send again",
+                        "name": "delivery_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "successfully queued a new delivery",
+                        "schema": {
+                            "$ref": "#/definitions/database.WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "404": {
+                        "description": "webhook_not_found or webhook_delivery_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "409": {
+                        "description": "webhook_disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v2/books/all": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "streams every book as a JSON array, JSON Lines, CSV or Parquet, chosen by the format parameter or else the Accept header. JSON and JSON Lines carry books as the API returns them; CSV and Parquet carry flat rows with amounts in minor units.",
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
+                ],
+                "tags": [
+                    "book"
+                ],
+                "summary": "exports all books",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "json, ndjson, csv or parquet",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "only books named by this publisher",
+                        "name": "publisher_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "only books filed under this category or below it",
+                        "name": "category_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully exported the books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Book"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v2/orders/all": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "streams every order as a JSON array, JSON Lines, CSV or Parquet, chosen by the format parameter or else the Accept header. JSON and JSON Lines carry orders as the API returns them; CSV and Parquet carry flat rows with amounts in minor units.",
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "exports all orders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "json, ndjson, csv or parquet",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only orders with this status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only orders placed at or after this time, RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only orders placed before this time, RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "successfully exported the orders",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.Order"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_query",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v2/users/all": {
+            "get": {
+                "security": [
+                    {
+                        "CookieAuth": []
+                    }
+                ],
+                "description": "gets all users",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "gets all users",
+                "responses": {
+                    "200": {
+                        "description": "successfully got all users",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.User"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    },
+                    "500": {
+                        "description": "internal_error",
+                        "schema": {
+                            "$ref": "#/definitions/main.problem"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "database.Address": {
+            "type": "object",
+            "required": [
+                "city",
+                "country",
+                "line1",
+                "name",
+                "postal_code"
+            ],
+            "properties": {
+                "city": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "country": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "is_default": {
+                    "type": "boolean"
+                },
+                "line1": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "line2": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "phone": {
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "postal_code": {
+                    "type": "string",
+                    "maxLength": 16
+                },
+                "region": {
+                    "type": "string",
+                    "maxLength": 50
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "database.AuditEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor_id": {
+                    "type": "integer"
+                },
+                "changes": {
+                    "type": "object"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "target_id": {
+                    "type": "integer"
+                },
+                "target_type": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.Author": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "bio": {
+                    "type": "string",
+                    "maxLength": 4000
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 256,
+                    "minLength": 3
+                }
+            }
+        },
+        "database.Book": {
+            "type": "object",
+            "required": [
+                "author",
+                "title"
+            ],
+            "properties": {
+                "author": {
+                    "type": "string",
+                    "minLength": 3
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "isbn_10": {
+                    "type": "string"
+                },
+                "isbn_13": {
+                    "type": "string"
+                },
+                "price": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "publisher_id": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "stock": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "tax_category": {
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "title": {
+                    "type": "string",
+                    "minLength": 3
+                },
+                "weight_grams": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "database.Cart": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.CartItem"
+                    }
+                },
+                "total_price": {
+                    "$ref": "#/definitions/money.Money"
+                }
+            }
+        },
+        "database.CartItem": {
+            "type": "object",
+            "properties": {
+                "book_id": {
+                    "type": "integer"
+                },
+                "in_stock": {
+                    "type": "boolean"
+                },
+                "line_price": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "price_changed": {
+                    "type": "boolean"
+                },
+                "quantity": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "unit_price": {
+                    "$ref": "#/definitions/money.Money"
+                }
+            }
+        },
+        "database.Category": {
+            "type": "object",
+            "required": [
+                "name",
+                "slug"
+            ],
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "parent_id": {
+                    "type": "integer"
+                },
+                "slug": {
+                    "type": "string",
+                    "maxLength": 100
+                }
+            }
+        },
+        "database.ExchangeRate": {
+            "type": "object",
+            "required": [
+                "from",
+                "rate",
+                "to"
+            ],
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "effective_at": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "rate": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.ImportJob": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "unchanged": {
+                    "type": "integer"
+                },
+                "updated": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "database.Job": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "cancel_requested": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "max_attempts": {
+                    "type": "integer"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "progress": {
+                    "type": "integer"
+                },
+                "progress_message": {
+                    "type": "string"
+                },
+                "result": {
+                    "type": "object"
+                },
+                "run_at": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.Order": {
+            "type": "object",
+            "required": [
+                "status",
+                "user_id"
+            ],
+            "properties": {
+                "billing_address": {
+                    "$ref": "#/definitions/database.Address"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "discount_total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "discounts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/promotion.Discount"
+                    }
+                },
+                "exchange_rate": {
+                    "type": "string"
+                },
+                "exchange_rate_from": {
+                    "type": "string"
+                },
+                "free_shipping": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "shipping_address": {
+                    "$ref": "#/definitions/database.Address"
+                },
+                "shipping_total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tax_lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/tax.LineTax"
+                    }
+                },
+                "tax_region": {
+                    "type": "string"
+                },
+                "tax_total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "total_price": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "database.OrderEvent": {
+            "type": "object",
+            "properties": {
+                "actor_id": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.OrderItem": {
+            "type": "object",
+            "properties": {
+                "book_id": {
+                    "type": "integer"
+                },
+                "quantity": {
+                    "type": "integer"
+                },
+                "tax": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "unit_price": {
+                    "$ref": "#/definitions/money.Money"
+                }
+            }
+        },
+        "database.Payment": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "failure_reason": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "provider_payment_id": {
+                    "type": "string"
+                },
+                "refunded_amount": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.Publisher": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 256
+                },
+                "website": {
+                    "type": "string",
+                    "maxLength": 256
+                }
+            }
+        },
+        "database.Return": {
+            "type": "object",
+            "properties": {
+                "admin_note": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.ReturnItem"
+                    }
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "refund_amount": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.ReturnItem": {
+            "type": "object",
+            "required": [
+                "book_id",
+                "quantity"
+            ],
+            "properties": {
+                "book_id": {
+                    "type": "integer"
+                },
+                "quantity": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "database.Shipment": {
+            "type": "object",
+            "properties": {
+                "carrier": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/shipping.TrackingEvent"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.ShipmentItem"
+                    }
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "shipped_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tracking_number": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.ShipmentItem": {
+            "type": "object",
+            "required": [
+                "book_id",
+                "quantity"
+            ],
+            "properties": {
+                "book_id": {
+                    "type": "integer"
+                },
+                "quantity": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "database.User": {
+            "type": "object",
+            "required": [
+                "email",
+                "role"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "role": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "integer"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "log": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.WebhookDeliveryAttempt"
+                    }
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "redelivery_of": {
+                    "type": "integer"
+                },
+                "response_status": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "subscription_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "database.WebhookDeliveryAttempt": {
+            "type": "object",
+            "properties": {
+                "attempted_at": {
+                    "type": "string"
+                },
+                "duration_ms": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "response_body": {
+                    "type": "string"
+                },
+                "response_status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "database.WebhookSubscription": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "disabled_reason": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "failures": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "gin.H": {
+            "type": "object",
+            "additionalProperties": {}
+        },
+        "main.addCartItemRequest": {
+            "type": "object",
+            "required": [
+                "book_id",
+                "quantity"
+            ],
+            "properties": {
+                "book_id": {
+                    "type": "integer"
+                },
+                "quantity": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 1
+                }
+            }
+        },
+        "main.bookAuthorsRequest": {
+            "type": "object",
+            "required": [
+                "author_ids"
+            ],
+            "properties": {
+                "author_ids": {
+                    "type": "array",
+                    "minItems": 1,
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "main.bookCategoriesRequest": {
+            "type": "object",
+            "required": [
+                "category_ids"
+            ],
+            "properties": {
+                "category_ids": {
+                    "type": "array",
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "main.emailChangeRequest": {
+            "type": "object",
+            "required": [
+                "current_password",
+                "email"
+            ],
+            "properties": {
+                "current_password": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.fieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.invoice": {
+            "type": "object",
+            "properties": {
+                "billing_address": {
+                    "$ref": "#/definitions/database.Address"
+                },
+                "discount_total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "discounts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/promotion.Discount"
+                    }
+                },
+                "exchange_rate": {
+                    "type": "string"
+                },
+                "exchange_rate_from": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.OrderItem"
+                    }
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "shipping_address": {
+                    "$ref": "#/definitions/database.Address"
+                },
+                "shipping_total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "subtotal": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "tax_lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/tax.LineTax"
+                    }
+                },
+                "tax_region": {
+                    "type": "string"
+                },
+                "tax_total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.loginRequest": {
+            "type": "object",
+            "required": [
+                "email",
+                "password"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "password": {
                     "type": "string",
-                    "minLength": 3
+                    "minLength": 4
                 }
             }
         },
-        "database.Order": {
+        "main.passwordChangeRequest": {
             "type": "object",
             "required": [
-                "status",
-                "total_price",
-                "user_id"
+                "current_password",
+                "new_password"
             ],
             "properties": {
-                "id": {
-                    "type": "integer"
+                "current_password": {
+                    "type": "string"
                 },
-                "status": {
+                "new_password": {
+                    "type": "string",
+                    "minLength": 8
+                }
+            }
+        },
+        "main.payOrderRequest": {
+            "type": "object",
+            "required": [
+                "payment_method"
+            ],
+            "properties": {
+                "payment_method": {
+                    "type": "string",
+                    "maxLength": 128
+                }
+            }
+        },
+        "main.problem": {
+            "type": "object",
+            "properties": {
+                "code": {
                     "type": "string"
                 },
-                "total_price": {
-                    "type": "integer"
+                "detail": {
+                    "type": "string"
                 },
-                "user_id": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.fieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "status": {
                     "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
                 }
             }
         },
-        "database.User": {
+        "main.refundPaymentRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/money.Money"
+                }
+            }
+        },
+        "main.registerRequest": {
             "type": "object",
             "required": [
                 "email",
+                "password",
                 "role"
             ],
             "properties": {
                 "email": {
                     "type": "string"
                 },
+                "password": {
+                    "type": "string",
+                    "minLength": 8
+                },
+                "role": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.returnDecisionRequest": {
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string",
+                    "maxLength": 1024
+                }
+            }
+        },
+        "main.returnRefundRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/money.Money"
+                }
+            }
+        },
+        "main.returnRequest": {
+            "type": "object",
+            "required": [
+                "items",
+                "reason"
+            ],
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/database.ReturnItem"
+                    }
+                },
+                "reason": {
+                    "type": "string",
+                    "maxLength": 1024
+                }
+            }
+        },
+        "main.shipmentRequest": {
+            "type": "object",
+            "required": [
+                "carrier",
+                "items",
+                "tracking_number"
+            ],
+            "properties": {
+                "carrier": {
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "items": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/database.ShipmentItem"
+                    }
+                },
+                "tracking_number": {
+                    "type": "string",
+                    "maxLength": 64
+                }
+            }
+        },
+        "main.shipmentUpdateRequest": {
+            "type": "object",
+            "required": [
+                "carrier",
+                "tracking_number"
+            ],
+            "properties": {
+                "carrier": {
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "location": {
+                    "type": "string",
+                    "maxLength": 128
+                },
+                "note": {
+                    "type": "string",
+                    "maxLength": 256
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "in_transit",
+                        "out_for_delivery",
+                        "delivered",
+                        "exception"
+                    ]
+                },
+                "tracking_number": {
+                    "type": "string",
+                    "maxLength": 64
+                }
+            }
+        },
+        "main.updateCartItemRequest": {
+            "type": "object",
+            "required": [
+                "quantity"
+            ],
+            "properties": {
+                "quantity": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 1
+                }
+            }
+        },
+        "main.webhookCreated": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "disabled_reason": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "failures": {
+                    "type": "integer"
+                },
                 "id": {
                     "type": "integer"
                 },
-                "role": {
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
                     "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
                 }
             }
         },
-        "gin.H": {
+        "main.webhookRequest": {
             "type": "object",
-            "additionalProperties": {}
+            "required": [
+                "url",
+                "user_id"
+            ],
+            "properties": {
+                "description": {
+                    "type": "string",
+                    "maxLength": 256
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "event_types": {
+                    "type": "array",
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "type": "string",
+                    "maxLength": 256,
+                    "minLength": 16
+                },
+                "url": {
+                    "type": "string",
+                    "maxLength": 2048
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
         },
-        "main.loginRequest": {
+        "money.Money": {
             "type": "object",
             "required": [
-                "email",
-                "password"
+                "currency"
             ],
             "properties": {
-                "email": {
+                "amount": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "currency": {
+                    "type": "string"
+                }
+            }
+        },
+        "promotion.Discount": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "book_id": {
+                    "type": "integer"
+                },
+                "code": {
                     "type": "string"
                 },
-                "password": {
+                "description": {
+                    "type": "string"
+                },
+                "promotion_id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "promotion.Promotion": {
+            "type": "object",
+            "required": [
+                "code",
+                "type"
+            ],
+            "properties": {
+                "amount_off": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "book_id": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "buy_quantity": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "code": {
+                    "type": "string"
+                },
+                "description": {
                     "type": "string",
-                    "minLength": 4
+                    "maxLength": 200
+                },
+                "ends_at": {
+                    "type": "string"
+                },
+                "get_quantity": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "max_uses": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_uses_per_customer": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "min_order_total": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "percent_off": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 0
+                },
+                "starts_at": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "buy_x_get_y",
+                        "percent_off",
+                        "fixed_amount",
+                        "free_shipping"
+                    ]
+                },
+                "uses": {
+                    "type": "integer"
                 }
             }
         },
-        "main.registerRequest": {
+        "shipping.TrackingEvent": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "location": {
+                    "type": "string"
+                },
+                "occurred_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "tax.LineTax": {
+            "type": "object",
+            "properties": {
+                "book_id": {
+                    "type": "integer"
+                },
+                "category": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "rate": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                },
+                "rule_id": {
+                    "type": "integer"
+                },
+                "tax_amount": {
+                    "$ref": "#/definitions/money.Money"
+                },
+                "taxable_amount": {
+                    "$ref": "#/definitions/money.Money"
+                }
+            }
+        },
+        "tax.Rule": {
             "type": "object",
             "required": [
-                "email",
-                "password",
-                "role"
+                "name",
+                "rate",
+                "region"
             ],
             "properties": {
-                "email": {
+                "category": {
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "effective_at": {
                     "type": "string"
                 },
-                "password": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
                     "type": "string",
-                    "minLength": 8
+                    "maxLength": 64
                 },
-                "role": {
+                "rate": {
+                    "type": "string"
+                },
+                "region": {
                     "type": "string"
                 }
             }
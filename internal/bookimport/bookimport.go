@@ -0,0 +1,244 @@
+// Package bookimport reads catalog files in CSV or ONIX 3.0 format and
+// upserts their books by ISBN, recording what happened to each row.
+package bookimport
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/isbn"
+)
+
+// Supported file formats.
+const (
+	FormatCSV  = "csv"
+	FormatONIX = "onix"
+)
+
+// progressEvery is how many rows are processed between progress updates.
+const progressEvery = 100
+
+// Row is one book read from a file, or the reason it could not be read.
+// Number is the line of a CSV file or the position of an ONIX product.
+type Row struct {
+	Number int
+	Isbn   string
+	Book   database.BookUpsert
+	Err    error
+}
+
+// FormatFor infers the format of a file from its name.
+func FormatFor(filename string) (string, bool) {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		return FormatCSV, true
+	case strings.HasSuffix(name, ".xml"), strings.HasSuffix(name, ".onix"):
+		return FormatONIX, true
+	}
+	return "", false
+}
+
+// Parse reads every row of a file. Rows that are invalid carry their error;
+// the returned error means the file as a whole could not be read.
+func Parse(format string, r io.Reader) ([]Row, error) {
+	var rows []Row
+	var err error
+
+	switch format {
+	case FormatCSV:
+		rows, err = ParseCSV(r)
+	case FormatONIX:
+		rows, err = ParseONIX(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		if rows[i].Err == nil {
+			rows[i].Err = validate(&rows[i].Book)
+		}
+	}
+	return rows, nil
+}
+
+// validate checks a book with the same rules the API applies and normalizes
+// its ISBN to ISBN-13.
+func validate(u *database.BookUpsert) error {
+	if u.Isbn_13 == "" {
+		return errors.New("isbn is required")
+	}
+	isbn13, err := isbn.To13(u.Isbn_13)
+	if err != nil {
+		return fmt.Errorf("isbn %q is not a valid ISBN-10 or ISBN-13", u.Isbn_13)
+	}
+	u.Isbn_13 = isbn13
+
+	switch {
+	case len(u.Title) < 3:
+		return errors.New("title must be at least 3 characters")
+	case len(u.Author) < 3:
+		return errors.New("author must be at least 3 characters")
+	case !u.Price.IsPositive():
+		return errors.New("price must be positive")
+	case u.Stock != nil && *u.Stock < 0:
+		return errors.New("stock must not be negative")
+	case u.Weight_Grams != nil && *u.Weight_Grams < 0:
+		return errors.New("weight_grams must not be negative")
+	case u.Tax_Category != nil && len(*u.Tax_Category) > 32:
+		return errors.New("tax_category must be at most 32 characters")
+	case u.Publisher != nil && len(*u.Publisher) > 256:
+		return errors.New("publisher must be at most 256 characters")
+	}
+	return nil
+}
+
+// Run imports the job's file, recording the outcome of every row and the
+// job's progress as it goes, and finishes the job. A job that already
+// processed some rows carries on after them. progress, if not nil, is called
+// after each batch of rows. It stops after the batch in progress when
+// ctx is done, leaving the job running. The returned error means the import
+// stopped or the job's state could not be stored; a file that cannot be read
+// fails the job instead.
+func Run(ctx context.Context, models *database.Models, job *database.ImportJob, progress func(*database.ImportJob)) error {
+	rows, err := Parse(job.Format, bytes.NewReader(job.Data))
+	if err != nil {
+		job.Status = database.ImportFailed
+		job.Error = err.Error()
+		return models.ImportJobs.FinishImportJob(job)
+	}
+
+	job.Total = len(rows)
+	start := min(job.Processed, len(rows))
+	var batch []database.ImportRow
+
+	// a dry run changes nothing, so a row repeating an ISBN is compared with
+	// what the rows before it would have left
+	var earlier map[string][]*database.BookUpsert
+	if job.Dry_Run {
+		if earlier, err = earlierUpserts(models, job, rows[:start]); err != nil {
+			return err
+		}
+	}
+
+	for i := start; i < len(rows); i++ {
+		result := importRow(models, job, rows[i], earlier)
+
+		job.Processed++
+		switch result.Action {
+		case database.ImportRowCreated:
+			job.Created++
+		case database.ImportRowUpdated:
+			job.Updated++
+		case database.ImportRowUnchanged:
+			job.Unchanged++
+		default:
+			job.Failed++
+		}
+
+		batch = append(batch, result)
+		if len(batch) == progressEvery || i == len(rows)-1 {
+			if err := models.ImportJobs.RecordImportRows(job, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+			if progress != nil {
+				progress(job)
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	job.Status = database.ImportSucceeded
+	return models.ImportJobs.FinishImportJob(job)
+}
+
+// earlierUpserts returns the books of the rows a dry run already imported
+// without error, by ISBN, for a dry run that carries on after them.
+func earlierUpserts(models *database.Models, job *database.ImportJob, done []Row) (map[string][]*database.BookUpsert, error) {
+	earlier := map[string][]*database.BookUpsert{}
+	if len(done) == 0 {
+		return earlier, nil
+	}
+
+	recorded, err := models.ImportJobs.GetImportRows(job.Id, database.ImportRowFailed)
+	if err != nil {
+		return nil, err
+	}
+	failed := map[int]bool{}
+	for _, row := range recorded {
+		failed[row.Number] = true
+	}
+
+	for i := range done {
+		if done[i].Err == nil && !failed[done[i].Number] {
+			earlier[done[i].Book.Isbn_13] = append(earlier[done[i].Book.Isbn_13], &done[i].Book)
+		}
+	}
+	return earlier, nil
+}
+
+// importRow upserts the row's book and returns its outcome. With earlier,
+// which only dry runs pass, the upsert is made after those of the same ISBN
+// and a successful one is added to them.
+func importRow(models *database.Models, job *database.ImportJob, row Row, earlier map[string][]*database.BookUpsert) database.ImportRow {
+	result := database.ImportRow{Number: row.Number, Isbn: row.Isbn, Action: database.ImportRowFailed}
+
+	if row.Err != nil {
+		result.Error = row.Err.Error()
+		return result
+	}
+
+	result.Isbn = row.Book.Isbn_13
+	action, id, changes, err := models.Books.UpsertBookByIsbn(&row.Book, job.Dry_Run, earlier[row.Book.Isbn_13]...)
+	switch {
+	case errors.Is(err, database.ErrBookDeleted):
+		result.Book_Id = id
+		result.Error = fmt.Sprintf("book %d with this ISBN is deleted; restore it to import over it", id)
+	case database.IsUniqueViolation(err):
+		result.Error = "another book has this ISBN"
+	case err != nil:
+		// the report is shown to whoever uploaded the file, so database
+		// errors stay in the log
+		log.Printf("import %d row %d: %v", job.Id, row.Number, err)
+		result.Error = "the book could not be saved"
+	default:
+		result.Action = action
+		result.Book_Id = id
+		result.Changes = changes
+		if earlier != nil {
+			earlier[row.Book.Isbn_13] = append(earlier[row.Book.Isbn_13], &row.Book)
+		}
+	}
+	return result
+}
+
+// WriteReport writes the outcome of each row as CSV.
+func WriteReport(w io.Writer, rows []database.ImportRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"row", "isbn", "action", "book_id", "changes", "error"})
+
+	for _, row := range rows {
+		bookId := ""
+		if row.Book_Id != 0 {
+			bookId = strconv.Itoa(row.Book_Id)
+		}
+		cw.Write([]string{strconv.Itoa(row.Number), row.Isbn, row.Action, bookId, strings.Join(row.Changes, ";"), row.Error})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,163 @@
+package bookimport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSV(t *testing.T) {
+	file := "\ufeffISBN,Title,Author,Price,Currency,Stock,Publisher\n" +
+		"0-306-40615-2,Go Deep,Some Author,12.99,,4,Penguin\n" +
+		"9780306406158,Bad Check,Some Author,1.00,EUR,,\n" +
+		"9780306406157,Go,Some Author,1.00,EUR,,\n" +
+		"9780306406157,Free,Some Author,1.001,USD,,\n" +
+		"9780306406157,Short\n" +
+		"9780306406157,Stockless,Some Author,5,JPY,,\n"
+
+	rows, err := Parse(FormatCSV, strings.NewReader(file))
+	require.NoError(t, err)
+	require.Len(t, rows, 6)
+
+	first := rows[0]
+	require.NoError(t, first.Err)
+	assert.Equal(t, 2, first.Number)
+	assert.Equal(t, "0-306-40615-2", first.Isbn)
+	assert.Equal(t, "9780306406157", first.Book.Isbn_13)
+	assert.Equal(t, money.New(1299, "USD"), first.Book.Price)
+	require.NotNil(t, first.Book.Stock)
+	assert.Equal(t, 4, *first.Book.Stock)
+	require.NotNil(t, first.Book.Publisher)
+	assert.Equal(t, "Penguin", *first.Book.Publisher)
+	assert.Nil(t, first.Book.Weight_Grams)
+	assert.Nil(t, first.Book.Tax_Category)
+
+	assert.ErrorContains(t, rows[1].Err, "not a valid ISBN")
+	assert.ErrorContains(t, rows[2].Err, "title must be at least 3 characters")
+	assert.ErrorContains(t, rows[3].Err, "not a valid amount")
+	assert.ErrorContains(t, rows[4].Err, "expected 7 fields")
+	assert.Equal(t, 6, rows[4].Number)
+
+	last := rows[5]
+	require.NoError(t, last.Err)
+	assert.Equal(t, money.New(5, "JPY"), last.Book.Price)
+	assert.Nil(t, last.Book.Stock)
+	// an empty publisher cell clears the publisher
+	require.NotNil(t, last.Book.Publisher)
+	assert.Equal(t, "", *last.Book.Publisher)
+}
+
+func TestParseCSV_BadHeader(t *testing.T) {
+	_, err := Parse(FormatCSV, strings.NewReader("isbn,title,author\n"))
+	assert.ErrorContains(t, err, `missing required column "price"`)
+
+	_, err = Parse(FormatCSV, strings.NewReader("isbn,title,author,price,colour\n"))
+	assert.ErrorContains(t, err, `unknown column "colour"`)
+
+	_, err = Parse(FormatCSV, strings.NewReader(""))
+	assert.ErrorContains(t, err, "empty")
+}
+
+const onixMessage = `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header><Sender><SenderName>Test</SenderName></Sender></Header>
+  <Product>
+    <RecordReference>rec-1</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>01</ProductIDType><IDValue>internal</IDValue></ProductIdentifier>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780306406157</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <Measure><MeasureType>01</MeasureType><Measurement>20</Measurement><MeasureUnitCode>cm</MeasureUnitCode></Measure>
+      <Measure><MeasureType>08</MeasureType><Measurement>0.45</Measurement><MeasureUnitCode>kg</MeasureUnitCode></Measure>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitlePrefix>The</TitlePrefix>
+          <TitleWithoutPrefix>Go Book</TitleWithoutPrefix>
+        </TitleElement>
+      </TitleDetail>
+      <Contributor><SequenceNumber>1</SequenceNumber><ContributorRole>A01</ContributorRole><PersonName>Ann Author</PersonName></Contributor>
+      <Contributor><SequenceNumber>2</SequenceNumber><ContributorRole>B01</ContributorRole><PersonName>Ed Editor</PersonName></Contributor>
+      <Contributor><SequenceNumber>3</SequenceNumber><ContributorRole>A01</ContributorRole><NamesBeforeKey>Bo</NamesBeforeKey><KeyNames>Writer</KeyNames></Contributor>
+    </DescriptiveDetail>
+    <PublishingDetail>
+      <Publisher><PublishingRole>02</PublishingRole><PublisherName>Co Press</PublisherName></Publisher>
+      <Publisher><PublishingRole>01</PublishingRole><PublisherName>Main Press</PublisherName></Publisher>
+    </PublishingDetail>
+    <ProductSupply>
+      <SupplyDetail>
+        <Stock><OnHand>12</OnHand></Stock>
+        <Price><PriceType>02</PriceType><PriceAmount>19.95</PriceAmount><CurrencyCode>GBP</CurrencyCode></Price>
+      </SupplyDetail>
+    </ProductSupply>
+  </Product>
+  <Product>
+    <RecordReference>rec-2</RecordReference>
+    <NotificationType>03</NotificationType>
+    <DescriptiveDetail>
+      <TitleDetail><TitleType>01</TitleType><TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>No ISBN</TitleText></TitleElement></TitleDetail>
+    </DescriptiveDetail>
+  </Product>
+</ONIXMessage>`
+
+func TestParseONIX(t *testing.T) {
+	rows, err := Parse(FormatONIX, strings.NewReader(onixMessage))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+
+	first := rows[0]
+	require.NoError(t, first.Err)
+	assert.Equal(t, 1, first.Number)
+	assert.Equal(t, "9780306406157", first.Book.Isbn_13)
+	assert.Equal(t, "The Go Book", first.Book.Title)
+	assert.Equal(t, "Ann Author, Bo Writer", first.Book.Author)
+	assert.Equal(t, money.New(1995, "GBP"), first.Book.Price)
+	require.NotNil(t, first.Book.Stock)
+	assert.Equal(t, 12, *first.Book.Stock)
+	require.NotNil(t, first.Book.Weight_Grams)
+	assert.Equal(t, 450, *first.Book.Weight_Grams)
+	require.NotNil(t, first.Book.Publisher)
+	assert.Equal(t, "Main Press", *first.Book.Publisher)
+
+	assert.Equal(t, "rec-2", rows[1].Isbn)
+	assert.ErrorContains(t, rows[1].Err, "no ISBN")
+}
+
+func TestParseONIX_NotONIX(t *testing.T) {
+	_, err := Parse(FormatONIX, strings.NewReader(`<ONIXmessage><product/></ONIXmessage>`))
+	assert.ErrorContains(t, err, "no Product records")
+
+	_, err = Parse(FormatONIX, strings.NewReader(`<ONIXMessage><Product>`))
+	assert.Error(t, err)
+}
+
+func TestFormatFor(t *testing.T) {
+	format, ok := FormatFor("Catalog.CSV")
+	assert.True(t, ok)
+	assert.Equal(t, FormatCSV, format)
+
+	format, ok = FormatFor("feed.xml")
+	assert.True(t, ok)
+	assert.Equal(t, FormatONIX, format)
+
+	_, ok = FormatFor("books.xlsx")
+	assert.False(t, ok)
+}
+
+func TestWriteReport(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteReport(&buf, []database.ImportRow{
+		{Number: 2, Isbn: "9780306406157", Book_Id: 3, Action: database.ImportRowUpdated, Changes: []string{"price", "stock"}},
+		{Number: 3, Isbn: "x", Action: database.ImportRowFailed, Error: "isbn \"x\" is not valid"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "row,isbn,action,book_id,changes,error\n"+
+		"2,9780306406157,updated,3,price;stock,\n"+
+		"3,x,failed,,,\"isbn \"\"x\"\" is not valid\"\n", buf.String())
+}
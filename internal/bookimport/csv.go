@@ -0,0 +1,137 @@
+package bookimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// csvColumns are the columns a CSV file may have. The first four are
+// required; a missing optional column leaves that field unchanged.
+var csvColumns = []string{"isbn", "title", "author", "price", "currency", "stock", "publisher", "tax_category", "weight_grams"}
+
+const requiredCSVColumns = 4
+
+// ParseCSV reads a CSV file whose first line names its columns. Prices are in
+// major units, e.g. 12.99, of the currency column or money.DefaultCurrency.
+func ParseCSV(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(csvColumns, name) {
+			return nil, fmt.Errorf("unknown column %q; columns are %s", name, strings.Join(csvColumns, ", "))
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		index[name] = i
+	}
+	for _, name := range csvColumns[:requiredCSVColumns] {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("missing required column %q", name)
+		}
+	}
+
+	var rows []Row
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, Row{Number: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := Row{Number: line}
+
+		switch {
+		case len(record) != len(header):
+			row.Err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+		default:
+			row.Err = csvRow(&row, func(name string) (string, bool) {
+				i, ok := index[name]
+				if !ok {
+					return "", false
+				}
+				return strings.TrimSpace(record[i]), true
+			})
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func csvRow(row *Row, field func(string) (string, bool)) error {
+	b := &row.Book
+
+	row.Isbn, _ = field("isbn")
+	b.Isbn_13 = row.Isbn
+	b.Title, _ = field("title")
+	b.Author, _ = field("author")
+
+	currency, _ := field("currency")
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	price, _ := field("price")
+	p, err := money.Parse(price + " " + strings.ToUpper(currency))
+	if err != nil {
+		return fmt.Errorf("price %q in %s is not a valid amount", price, currency)
+	}
+	b.Price = p
+
+	if b.Stock, err = intField(field, "stock"); err != nil {
+		return err
+	}
+	if b.Weight_Grams, err = intField(field, "weight_grams"); err != nil {
+		return err
+	}
+	if v, ok := field("tax_category"); ok {
+		b.Tax_Category = &v
+	}
+	if v, ok := field("publisher"); ok {
+		b.Publisher = &v
+	}
+	return nil
+}
+
+// intField reads an optional integer column; an empty cell counts as absent.
+func intField(field func(string) (string, bool), name string) (*int, error) {
+	v, ok := field(name)
+	if !ok || v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q is not a whole number", name, v)
+	}
+	return &n, nil
+}
@@ -0,0 +1,240 @@
+package bookimport
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hamorrar/bookstore/internal/isbn"
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// onixProduct holds the parts of an ONIX 3.0 Product record, in reference
+// tags, that map to a book.
+type onixProduct struct {
+	RecordReference  string `xml:"RecordReference"`
+	NotificationType string `xml:"NotificationType"`
+	Identifiers      []struct {
+		Type  string `xml:"ProductIDType"`
+		Value string `xml:"IDValue"`
+	} `xml:"ProductIdentifier"`
+	Titles []struct {
+		Type     string `xml:"TitleType"`
+		Elements []struct {
+			Level         string `xml:"TitleElementLevel"`
+			Text          string `xml:"TitleText"`
+			Prefix        string `xml:"TitlePrefix"`
+			WithoutPrefix string `xml:"TitleWithoutPrefix"`
+		} `xml:"TitleElement"`
+	} `xml:"DescriptiveDetail>TitleDetail"`
+	Contributors []struct {
+		Roles          []string `xml:"ContributorRole"`
+		PersonName     string   `xml:"PersonName"`
+		NamesBeforeKey string   `xml:"NamesBeforeKey"`
+		KeyNames       string   `xml:"KeyNames"`
+		CorporateName  string   `xml:"CorporateName"`
+	} `xml:"DescriptiveDetail>Contributor"`
+	Measures []struct {
+		Type  string `xml:"MeasureType"`
+		Value string `xml:"Measurement"`
+		Unit  string `xml:"MeasureUnitCode"`
+	} `xml:"DescriptiveDetail>Measure"`
+	Publishers []struct {
+		Role string `xml:"PublishingRole"`
+		Name string `xml:"PublisherName"`
+	} `xml:"PublishingDetail>Publisher"`
+	Supplies []struct {
+		Stock []struct {
+			OnHand string `xml:"OnHand"`
+		} `xml:"Stock"`
+		Prices []struct {
+			Amount   string `xml:"PriceAmount"`
+			Currency string `xml:"CurrencyCode"`
+		} `xml:"Price"`
+	} `xml:"ProductSupply>SupplyDetail"`
+}
+
+// ONIX code list values used when mapping a product.
+const (
+	onixDelete           = "05" // NotificationType: delete
+	onixISBN10           = "02" // ProductIDType
+	onixGTIN13           = "03"
+	onixISBN13           = "15"
+	onixDistinctiveTitle = "01"  // TitleType
+	onixProductLevel     = "01"  // TitleElementLevel
+	onixAuthor           = "A01" // ContributorRole: by (author)
+	onixPublisher        = "01"  // PublishingRole
+	onixUnitWeight       = "08"  // MeasureType
+)
+
+// gramsPer converts the ONIX weight units to grams.
+var gramsPer = map[string]float64{"gr": 1, "kg": 1000, "oz": 28.349523125, "lb": 453.59237}
+
+// ParseONIX reads the Product records of an ONIX 3.0 message in reference
+// tags. Products are streamed, so large messages are not held in memory as
+// a tree. Prices without a CurrencyCode are in money.DefaultCurrency.
+func ParseONIX(r io.Reader) ([]Row, error) {
+	dec := xml.NewDecoder(r)
+	var rows []Row
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading ONIX: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Product" {
+			continue
+		}
+
+		var p onixProduct
+		if err := dec.DecodeElement(&p, &start); err != nil {
+			return nil, fmt.Errorf("reading ONIX product %d: %w", len(rows)+1, err)
+		}
+
+		row := Row{Number: len(rows) + 1}
+		row.Err = onixRow(&row, &p)
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("no Product records found; only ONIX 3.0 reference tags are supported")
+	}
+	return rows, nil
+}
+
+func onixRow(row *Row, p *onixProduct) error {
+	b := &row.Book
+
+	row.Isbn = onixIsbn(p)
+	if row.Isbn == "" {
+		row.Isbn = strings.TrimSpace(p.RecordReference)
+		return errors.New("product has no ISBN identifier")
+	}
+	b.Isbn_13 = row.Isbn
+
+	if p.NotificationType == onixDelete {
+		return errors.New("deletions are not imported; delete the book instead")
+	}
+
+	b.Title = onixTitle(p)
+
+	var authors []string
+	for _, c := range p.Contributors {
+		if !slices.Contains(c.Roles, onixAuthor) {
+			continue
+		}
+		name := strings.TrimSpace(c.PersonName)
+		if name == "" {
+			name = strings.TrimSpace(strings.TrimSpace(c.NamesBeforeKey) + " " + strings.TrimSpace(c.KeyNames))
+		}
+		if name == "" {
+			name = strings.TrimSpace(c.CorporateName)
+		}
+		if name != "" {
+			authors = append(authors, name)
+		}
+	}
+	b.Author = strings.Join(authors, ", ")
+
+	for _, pub := range p.Publishers {
+		name := strings.TrimSpace(pub.Name)
+		if name != "" && (b.Publisher == nil || pub.Role == onixPublisher) {
+			b.Publisher = &name
+			if pub.Role == onixPublisher {
+				break
+			}
+		}
+	}
+
+	for _, m := range p.Measures {
+		if m.Type != onixUnitWeight {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(m.Value), 64)
+		factor, ok := gramsPer[m.Unit]
+		if err != nil || !ok {
+			return fmt.Errorf("weight %q %s is not a supported measurement", m.Value, m.Unit)
+		}
+		grams := int(math.Round(value * factor))
+		b.Weight_Grams = &grams
+		break
+	}
+
+	var priced, stocked bool
+	for _, s := range p.Supplies {
+		for _, price := range s.Prices {
+			if priced || strings.TrimSpace(price.Amount) == "" {
+				continue
+			}
+			currency := strings.TrimSpace(price.Currency)
+			if currency == "" {
+				currency = money.DefaultCurrency
+			}
+			amount, err := money.Parse(strings.TrimSpace(price.Amount) + " " + currency)
+			if err != nil {
+				return fmt.Errorf("price %q in %s is not a valid amount", price.Amount, currency)
+			}
+			b.Price = amount
+			priced = true
+		}
+		for _, stock := range s.Stock {
+			if stocked || strings.TrimSpace(stock.OnHand) == "" {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(stock.OnHand))
+			if err != nil {
+				return fmt.Errorf("stock %q is not a whole number", stock.OnHand)
+			}
+			b.Stock = &n
+			stocked = true
+		}
+	}
+	return nil
+}
+
+// onixIsbn returns the product's ISBN-13, falling back to its ISBN-10 or a
+// GTIN-13 that is an ISBN.
+func onixIsbn(p *onixProduct) string {
+	for _, want := range []string{onixISBN13, onixISBN10, onixGTIN13} {
+		for _, id := range p.Identifiers {
+			value := strings.TrimSpace(id.Value)
+			if id.Type != want || value == "" {
+				continue
+			}
+			if want == onixGTIN13 && !isbn.Valid13(value) {
+				continue
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// onixTitle returns the product level distinctive title.
+func onixTitle(p *onixProduct) string {
+	for _, t := range p.Titles {
+		if t.Type != onixDistinctiveTitle {
+			continue
+		}
+		for _, e := range t.Elements {
+			if e.Level != onixProductLevel {
+				continue
+			}
+			if text := strings.TrimSpace(e.Text); text != "" {
+				return text
+			}
+			return strings.TrimSpace(strings.TrimSpace(e.Prefix) + " " + strings.TrimSpace(e.WithoutPrefix))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,518 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Component selects which settings are required when validating a Config.
+// The API server needs a signing secret and a listen port, the migrate
+// command needs a database connection and its migrations, and the import
+// command only needs a database connection.
+type Component int
+
+const (
+	API Component = iota
+	Migrate
+	Import
+)
+
+const minSecretKeyLength = 32
+
+type Config struct {
+	Env       string   `yaml:"env"`
+	Port      int      `yaml:"port"`
+	SecretKey string   `yaml:"secret_key"`
+	BaseURL   string   `yaml:"base_url"`
+	DB        DBConfig `yaml:"db"`
+
+	// IdempotencyKeyTTL is how long a stored Idempotency-Key response is
+	// replayed before the key may be reused.
+	IdempotencyKeyTTL time.Duration `yaml:"idempotency_key_ttl"`
+
+	// DeletedRetention is how long soft deleted books, users and orders can
+	// be restored before they are purged for good.
+	DeletedRetention time.Duration `yaml:"deleted_retention"`
+
+	Payment  PaymentConfig  `yaml:"payment"`
+	Shipping ShippingConfig `yaml:"shipping"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+	Events   EventsConfig   `yaml:"events"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+}
+
+type PaymentConfig struct {
+	// Provider names the payment provider. Only "fake" is built in; it must
+	// not be used in production.
+	Provider string `yaml:"provider"`
+	// WebhookSecret verifies webhooks from the provider. The fake provider
+	// makes one up when it is empty.
+	WebhookSecret string        `yaml:"webhook_secret"`
+	Timeout       time.Duration `yaml:"timeout"`
+}
+
+type ShippingConfig struct {
+	// Calculator is "items" to charge per item or "weight" to charge per
+	// started kilogram.
+	Calculator string `yaml:"calculator"`
+	// Currency is the currency of the rates, which are in its minor units.
+	Currency string `yaml:"currency"`
+	// Rates holds the rate for each destination country. The "*" entry
+	// covers countries without a rate of their own and is the one set by
+	// SHIPPING_BASE_RATE and SHIPPING_UNIT_RATE.
+	Rates map[string]ShippingRate `yaml:"rates"`
+	// Carrier names the client that fetches tracking updates. Only "fake"
+	// is built in; it must not be used in production.
+	Carrier        string        `yaml:"carrier"`
+	CarrierTimeout time.Duration `yaml:"carrier_timeout"`
+}
+
+type JobsConfig struct {
+	// Workers is how many background jobs the server runs at once. With
+	// none, jobs are queued for other servers to run.
+	Workers int `yaml:"workers"`
+	// PollInterval is how often idle workers look for due jobs.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// Lease is how long a job stays with a worker that stopped responding
+	// before another worker takes it over.
+	Lease time.Duration `yaml:"lease"`
+}
+
+type EventsConfig struct {
+	// Publisher is where domain events are delivered: "memory", which keeps
+	// them in the process and must not be used in production, "file" to
+	// append them to File or "http" to post them to URL.
+	Publisher string        `yaml:"publisher"`
+	File      string        `yaml:"file"`
+	URL       string        `yaml:"url"`
+	Timeout   time.Duration `yaml:"timeout"`
+	// PollInterval is how often the outbox is checked for new events.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// Retention is how long published events are kept in the outbox.
+	Retention time.Duration `yaml:"retention"`
+	// StreamHeartbeat is how often an idle event stream sends a comment to
+	// keep proxies from closing it.
+	StreamHeartbeat time.Duration `yaml:"stream_heartbeat"`
+}
+
+type WebhooksConfig struct {
+	// Timeout is how long to wait for a subscriber to answer a delivery.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is how many times a delivery is tried before it fails.
+	MaxAttempts int `yaml:"max_attempts"`
+	// DisableAfter is how many attempts in a row may fail before the
+	// subscription is disabled.
+	DisableAfter int `yaml:"disable_after"`
+}
+
+type ShippingRate struct {
+	Base    int64 `yaml:"base"`
+	PerUnit int64 `yaml:"per_unit"`
+}
+
+type DBConfig struct {
+	DSN            string `yaml:"dsn"`
+	URL            string `yaml:"url"`
+	Host           string `yaml:"host"`
+	Port           int    `yaml:"port"`
+	Name           string `yaml:"name"`
+	User           string `yaml:"user"`
+	Password       string `yaml:"password"`
+	SSLMode        string `yaml:"sslmode"`
+	MigrationsPath string `yaml:"migrations_path"`
+}
+
+// Defaults returns the configuration used when nothing else is set.
+func Defaults() *Config {
+	return &Config{
+		Env:               "development",
+		Port:              8080,
+		IdempotencyKeyTTL: 24 * time.Hour,
+		DeletedRetention:  30 * 24 * time.Hour,
+		Payment: PaymentConfig{
+			Provider: "fake",
+			Timeout:  10 * time.Second,
+		},
+		Shipping: ShippingConfig{
+			Calculator: "items",
+			Currency:   "USD",
+			Rates:      map[string]ShippingRate{"*": {Base: 499, PerUnit: 99}},
+
+			Carrier:        "fake",
+			CarrierTimeout: 5 * time.Second,
+		},
+		Jobs: JobsConfig{
+			Workers:      4,
+			PollInterval: time.Second,
+			Lease:        time.Minute,
+		},
+		Events: EventsConfig{
+			Publisher:    "memory",
+			Timeout:      10 * time.Second,
+			PollInterval: time.Second,
+			Retention:    7 * 24 * time.Hour,
+
+			StreamHeartbeat: 15 * time.Second,
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			DisableAfter: 20,
+		},
+		DB: DBConfig{
+			Host:           "localhost",
+			Port:           5432,
+			SSLMode:        "disable",
+			MigrationsPath: "cmd/migrate/migrations",
+		},
+	}
+}
+
+// Load builds the configuration for the given component. Values are layered
+// from lowest to highest precedence: defaults, the YAML file named by
+// CONFIG_FILE, the .env file in the working directory and finally the process
+// environment. The result is validated before it is returned.
+func Load(component Component) (*Config, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config: loading .env: %w", err)
+	}
+
+	cfg := Defaults()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadYAML(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	cfg.fillDerived()
+
+	if err := cfg.Validate(component); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadYAML(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+
+	setString := func(key string, dst *string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	setInt := func(key string, dst *int) {
+		v, ok := lookup(key)
+		if !ok || v == "" {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s must be an integer, got %q", key, v))
+			return
+		}
+		*dst = n
+	}
+	setInt64 := func(key string, dst *int64) {
+		v, ok := lookup(key)
+		if !ok || v == "" {
+			return
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s must be an integer, got %q", key, v))
+			return
+		}
+		*dst = n
+	}
+	setDuration := func(key string, dst *time.Duration) {
+		v, ok := lookup(key)
+		if !ok || v == "" {
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s must be a duration such as 24h, got %q", key, v))
+			return
+		}
+		*dst = d
+	}
+
+	setString("APP_ENV", &c.Env)
+	setInt("PORT", &c.Port)
+	setString("SECRET_KEY", &c.SecretKey)
+	setString("BASE_URL", &c.BaseURL)
+	setDuration("IDEMPOTENCY_KEY_TTL", &c.IdempotencyKeyTTL)
+	setDuration("DELETED_RETENTION", &c.DeletedRetention)
+	setString("PAYMENT_PROVIDER", &c.Payment.Provider)
+	setString("PAYMENT_WEBHOOK_SECRET", &c.Payment.WebhookSecret)
+	setDuration("PAYMENT_TIMEOUT", &c.Payment.Timeout)
+	setString("SHIPPING_CALCULATOR", &c.Shipping.Calculator)
+	setString("SHIPPING_CURRENCY", &c.Shipping.Currency)
+	setString("SHIPPING_CARRIER", &c.Shipping.Carrier)
+	setDuration("SHIPPING_CARRIER_TIMEOUT", &c.Shipping.CarrierTimeout)
+	defaultRate := c.Shipping.Rates["*"]
+	setInt64("SHIPPING_BASE_RATE", &defaultRate.Base)
+	setInt64("SHIPPING_UNIT_RATE", &defaultRate.PerUnit)
+	setInt("JOB_WORKERS", &c.Jobs.Workers)
+	setDuration("JOB_POLL_INTERVAL", &c.Jobs.PollInterval)
+	setDuration("JOB_LEASE", &c.Jobs.Lease)
+	setString("EVENT_PUBLISHER", &c.Events.Publisher)
+	setString("EVENT_FILE", &c.Events.File)
+	setString("EVENT_URL", &c.Events.URL)
+	setDuration("EVENT_TIMEOUT", &c.Events.Timeout)
+	setDuration("EVENT_POLL_INTERVAL", &c.Events.PollInterval)
+	setDuration("EVENT_RETENTION", &c.Events.Retention)
+	setDuration("EVENT_STREAM_HEARTBEAT", &c.Events.StreamHeartbeat)
+	setDuration("WEBHOOK_TIMEOUT", &c.Webhooks.Timeout)
+	setInt("WEBHOOK_MAX_ATTEMPTS", &c.Webhooks.MaxAttempts)
+	setInt("WEBHOOK_DISABLE_AFTER", &c.Webhooks.DisableAfter)
+	if defaultRate != c.Shipping.Rates["*"] {
+		if c.Shipping.Rates == nil {
+			c.Shipping.Rates = map[string]ShippingRate{}
+		}
+		c.Shipping.Rates["*"] = defaultRate
+	}
+
+	setString("DB_DSN", &c.DB.DSN)
+	setString("DB_URL", &c.DB.URL)
+	setString("DB_HOST", &c.DB.Host)
+	setInt("DB_PORT", &c.DB.Port)
+	setString("DB_NAME", &c.DB.Name)
+	setString("DB_USER", &c.DB.User)
+	setString("DB_PASSWORD", &c.DB.Password)
+	setString("DB_SSLMODE", &c.DB.SSLMode)
+	setString("MIGRATIONS_PATH", &c.DB.MigrationsPath)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// fillDerived fills in settings that can be worked out from other settings,
+// such as a connection string built from the individual DB_* parts.
+func (c *Config) fillDerived() {
+	if c.DB.DSN == "" && c.DB.URL == "" && c.DB.Name != "" {
+		c.DB.URL = c.DB.buildURL()
+	}
+	if c.DB.DSN == "" {
+		c.DB.DSN = c.DB.URL
+	}
+	if c.DB.URL == "" {
+		c.DB.URL = c.DB.DSN
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = fmt.Sprintf("http://localhost:%d", c.Port)
+	}
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+}
+
+func (d DBConfig) buildURL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		Host:     fmt.Sprintf("%s:%d", d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: url.Values{"sslmode": {d.SSLMode}}.Encode(),
+	}
+	if d.User != "" {
+		if d.Password != "" {
+			u.User = url.UserPassword(d.User, d.Password)
+		} else {
+			u.User = url.User(d.User)
+		}
+	}
+	return u.String()
+}
+
+// Validate checks every setting the component depends on and reports all
+// problems at once so a misconfigured deployment can be fixed in one pass.
+func (c *Config) Validate(component Component) error {
+	var errs []error
+
+	if c.DB.DSN == "" {
+		errs = append(errs, errors.New("a database connection is required: set DB_DSN, DB_URL or DB_NAME"))
+	}
+	if c.DB.Port < 1 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT must be between 1 and 65535, got %d", c.DB.Port))
+	}
+
+	switch component {
+	case API:
+		if c.Port < 1 || c.Port > 65535 {
+			errs = append(errs, fmt.Errorf("PORT must be between 1 and 65535, got %d", c.Port))
+		}
+		if c.SecretKey == "" {
+			errs = append(errs, errors.New("SECRET_KEY is required to sign auth tokens"))
+		} else if len(c.SecretKey) < minSecretKeyLength {
+			errs = append(errs, fmt.Errorf("SECRET_KEY must be at least %d bytes, got %d", minSecretKeyLength, len(c.SecretKey)))
+		}
+		if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("BASE_URL must be an absolute URL, got %q", c.BaseURL))
+		}
+		if c.IdempotencyKeyTTL <= 0 {
+			errs = append(errs, fmt.Errorf("IDEMPOTENCY_KEY_TTL must be positive, got %s", c.IdempotencyKeyTTL))
+		}
+		if c.DeletedRetention <= 0 {
+			errs = append(errs, fmt.Errorf("DELETED_RETENTION must be positive, got %s", c.DeletedRetention))
+		}
+		switch c.Payment.Provider {
+		case "fake":
+			if c.Env == "production" {
+				errs = append(errs, errors.New("PAYMENT_PROVIDER fake must not be used in production"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("PAYMENT_PROVIDER must be one of: fake, got %q", c.Payment.Provider))
+		}
+		if c.Payment.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("PAYMENT_TIMEOUT must be positive, got %s", c.Payment.Timeout))
+		}
+		if c.Shipping.Calculator != "items" && c.Shipping.Calculator != "weight" {
+			errs = append(errs, fmt.Errorf("SHIPPING_CALCULATOR must be one of: items, weight, got %q", c.Shipping.Calculator))
+		}
+		if !money.IsCurrency(c.Shipping.Currency) {
+			errs = append(errs, fmt.Errorf("SHIPPING_CURRENCY must be a supported ISO 4217 currency code, got %q", c.Shipping.Currency))
+		}
+		for country, rate := range c.Shipping.Rates {
+			if country != "*" && !shippingCountry.MatchString(country) {
+				errs = append(errs, fmt.Errorf("shipping rates must be keyed by ISO 3166 country code or *, got %q", country))
+			}
+			if rate.Base < 0 || rate.PerUnit < 0 {
+				errs = append(errs, fmt.Errorf("shipping rate for %s must not be negative", country))
+			}
+		}
+		switch c.Shipping.Carrier {
+		case "fake":
+			if c.Env == "production" {
+				errs = append(errs, errors.New("SHIPPING_CARRIER fake must not be used in production"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("SHIPPING_CARRIER must be one of: fake, got %q", c.Shipping.Carrier))
+		}
+		if c.Shipping.CarrierTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("SHIPPING_CARRIER_TIMEOUT must be positive, got %s", c.Shipping.CarrierTimeout))
+		}
+		if c.Jobs.Workers < 0 {
+			errs = append(errs, fmt.Errorf("JOB_WORKERS must not be negative, got %d", c.Jobs.Workers))
+		}
+		if c.Jobs.PollInterval <= 0 {
+			errs = append(errs, fmt.Errorf("JOB_POLL_INTERVAL must be positive, got %s", c.Jobs.PollInterval))
+		}
+		if c.Jobs.Lease < 3*time.Second {
+			errs = append(errs, fmt.Errorf("JOB_LEASE must be at least 3s, got %s", c.Jobs.Lease))
+		}
+		switch c.Events.Publisher {
+		case "memory":
+			if c.Env == "production" {
+				errs = append(errs, errors.New("EVENT_PUBLISHER memory must not be used in production"))
+			}
+		case "file":
+			if c.Events.File == "" {
+				errs = append(errs, errors.New("EVENT_FILE is required when EVENT_PUBLISHER is file"))
+			}
+		case "http":
+			if u, err := url.Parse(c.Events.URL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("EVENT_URL must be an absolute URL when EVENT_PUBLISHER is http, got %q", c.Events.URL))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("EVENT_PUBLISHER must be one of: memory, file, http, got %q", c.Events.Publisher))
+		}
+		if c.Events.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("EVENT_TIMEOUT must be positive, got %s", c.Events.Timeout))
+		}
+		if c.Events.PollInterval <= 0 {
+			errs = append(errs, fmt.Errorf("EVENT_POLL_INTERVAL must be positive, got %s", c.Events.PollInterval))
+		}
+		if c.Events.Retention <= 0 {
+			errs = append(errs, fmt.Errorf("EVENT_RETENTION must be positive, got %s", c.Events.Retention))
+		}
+		if c.Events.StreamHeartbeat <= 0 {
+			errs = append(errs, fmt.Errorf("EVENT_STREAM_HEARTBEAT must be positive, got %s", c.Events.StreamHeartbeat))
+		}
+		if c.Webhooks.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("WEBHOOK_TIMEOUT must be positive, got %s", c.Webhooks.Timeout))
+		}
+		if c.Webhooks.MaxAttempts < 1 {
+			errs = append(errs, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", c.Webhooks.MaxAttempts))
+		}
+		if c.Webhooks.DisableAfter < 1 {
+			errs = append(errs, fmt.Errorf("WEBHOOK_DISABLE_AFTER must be at least 1, got %d", c.Webhooks.DisableAfter))
+		}
+	case Migrate:
+		if c.DB.MigrationsPath == "" {
+			errs = append(errs, errors.New("MIGRATIONS_PATH is required"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+var shippingCountry = regexp.MustCompile(`^[A-Z]{2}$`)
+
+const redacted = "[REDACTED]"
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Dump writes the effective configuration with secrets redacted.
+func (c *Config) Dump(w io.Writer) error {
+	safe := *c
+	if safe.SecretKey != "" {
+		safe.SecretKey = redacted
+	}
+	if safe.DB.Password != "" {
+		safe.DB.Password = redacted
+	}
+	if safe.Payment.WebhookSecret != "" {
+		safe.Payment.WebhookSecret = redacted
+	}
+	safe.DB.DSN = redactConnString(safe.DB.DSN)
+	safe.DB.URL = redactConnString(safe.DB.URL)
+
+	encoder := yaml.NewEncoder(w)
+	defer encoder.Close()
+	return encoder.Encode(safe)
+}
+
+func redactConnString(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			return strings.Replace(u.String(), url.QueryEscape(redacted), redacted, 1)
+		}
+		return s
+	}
+	return dsnPassword.ReplaceAllString(s, "${1}"+redacted)
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type AddressModel struct {
+	DB *sql.DB
+}
+
+// Address is a postal address in a customer's address book. Orders keep a
+// copy of the addresses they were placed with, stored as JSON.
+type Address struct {
+	Id          int    `json:"id"`
+	User_Id     int    `json:"user_id"`
+	Name        string `json:"name" binding:"required,max=100"`
+	Line1       string `json:"line1" binding:"required,max=100"`
+	Line2       string `json:"line2,omitempty" binding:"max=100"`
+	City        string `json:"city" binding:"required,max=100"`
+	Region      string `json:"region,omitempty" binding:"max=50"`
+	Postal_Code string `json:"postal_code" binding:"required,max=16"`
+	Country     string `json:"country" binding:"required,iso3166_1_alpha2"`
+	Phone       string `json:"phone,omitempty" binding:"max=32"`
+	Is_Default  bool   `json:"is_default"`
+	Version     int    `json:"-"`
+}
+
+// Value stores an address snapshot as JSON.
+func (a Address) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan reads an address snapshot stored as JSON.
+func (a *Address) Scan(src any) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("address: cannot scan %T", src)
+	}
+	return json.Unmarshal(data, a)
+}
+
+const addressColumns = `address_id, address_user_id, address_name, address_line1, address_line2, address_city, address_region,
+	address_postal_code, address_country, address_phone, address_is_default, address_version`
+
+func (a *Address) scanFields() []any {
+	return []any{&a.Id, &a.User_Id, &a.Name, &a.Line1, &a.Line2, &a.City, &a.Region, &a.Postal_Code, &a.Country, &a.Phone,
+		&a.Is_Default, &a.Version}
+}
+
+// CreateAddress adds an address to the user's address book. The first
+// address a user adds becomes their default.
+func (m *AddressModel) CreateAddress(a *Address) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if a.Is_Default {
+		if err := clearDefaultAddress(ctx, tx, a.User_Id, 0); err != nil {
+			return err
+		}
+	}
+
+	query := `insert into addresses (address_user_id, address_name, address_line1, address_line2, address_city, address_region,
+			address_postal_code, address_country, address_phone, address_is_default)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10 or not exists (select 1 from addresses where address_user_id = $1))
+		returning ` + addressColumns
+
+	err = tx.QueryRowContext(ctx, query, a.User_Id, a.Name, a.Line1, a.Line2, a.City, a.Region, a.Postal_Code, a.Country,
+		a.Phone, a.Is_Default).Scan(a.scanFields()...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// clearDefaultAddress makes none of the user's addresses other than except
+// the default.
+func clearDefaultAddress(ctx context.Context, db execer, userId int, except int) error {
+	query := `update addresses set address_is_default = false, address_version = address_version + 1
+		where address_user_id = $1 and address_id <> $2 and address_is_default`
+	_, err := db.ExecContext(ctx, query, userId, except)
+	return err
+}
+
+func (m *AddressModel) GetAddress(id int) (*Address, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + addressColumns + " from addresses where address_id = $1"
+
+	var a Address
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(a.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetDefaultAddress returns the user's default address, or nil if they have
+// none.
+func (m *AddressModel) GetDefaultAddress(userId int) (*Address, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + addressColumns + " from addresses where address_user_id = $1 and address_is_default"
+
+	var a Address
+
+	err := m.DB.QueryRowContext(ctx, query, userId).Scan(a.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetAddresses returns the user's addresses with the default first.
+func (m *AddressModel) GetAddresses(userId int) ([]*Address, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + addressColumns + " from addresses where address_user_id = $1 order by address_is_default desc, address_id"
+
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	addresses := []*Address{}
+
+	for rows.Next() {
+		var a Address
+
+		err := rows.Scan(a.scanFields()...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		addresses = append(addresses, &a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+// UpdateAddress replaces the address if it is still at a.Version and returns
+// ErrEditConflict otherwise. Making it the default takes that from the
+// user's other addresses.
+func (m *AddressModel) UpdateAddress(a *Address) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if a.Is_Default {
+		if err := clearDefaultAddress(ctx, tx, a.User_Id, a.Id); err != nil {
+			return err
+		}
+	}
+
+	query := `update addresses set address_name = $1, address_line1 = $2, address_line2 = $3, address_city = $4, address_region = $5,
+			address_postal_code = $6, address_country = $7, address_phone = $8, address_is_default = $9, address_version = address_version + 1
+		where address_id = $10 and address_version = $11 returning address_version`
+
+	err = tx.QueryRowContext(ctx, query, a.Name, a.Line1, a.Line2, a.City, a.Region, a.Postal_Code, a.Country, a.Phone,
+		a.Is_Default, a.Id, a.Version).Scan(&a.Version)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteAddress removes the address if it is still at the given version and
+// returns ErrEditConflict otherwise. Orders keep their copy of it.
+func (m *AddressModel) DeleteAddress(id int, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "delete from addresses where address_id = $1 and address_version = $2", id, version)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type AuditEventModel struct {
+	DB *sql.DB
+}
+
+// AuditEvent records one change made through the API. Changes holds the
+// fields that differ between the target before and after the action.
+type AuditEvent struct {
+	Id          int64           `json:"id"`
+	Actor_Id    int             `json:"actor_id,omitempty"`
+	Action      string          `json:"action"`
+	Target_Type string          `json:"target_type"`
+	Target_Id   int             `json:"target_id,omitempty"`
+	Changes     json.RawMessage `json:"changes,omitempty" swaggertype:"object"`
+	IP          string          `json:"ip"`
+	User_Agent  string          `json:"user_agent"`
+	Request_Id  string          `json:"request_id"`
+	Created_At  time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects audit events. Zero values match everything; a Limit of
+// zero or less returns every matching event.
+type AuditFilter struct {
+	Actor_Id    int
+	Target_Type string
+	Target_Id   int
+	From        time.Time
+	To          time.Time
+	Limit       int
+	Page        int
+}
+
+const auditEventColumns = `audit_event_id, coalesce(audit_event_actor_id, 0), audit_event_action, audit_event_target_type,
+	coalesce(audit_event_target_id, 0), audit_event_changes, audit_event_ip, audit_event_user_agent, audit_event_request_id, audit_event_created_at`
+
+func (event *AuditEvent) scanFields() []any {
+	return []any{&event.Id, &event.Actor_Id, &event.Action, &event.Target_Type, &event.Target_Id, (*[]byte)(&event.Changes),
+		&event.IP, &event.User_Agent, &event.Request_Id, &event.Created_At}
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+func (m *AuditEventModel) CreateAuditEvent(event *AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into audit_events (audit_event_actor_id, audit_event_action, audit_event_target_type, audit_event_target_id,
+		audit_event_changes, audit_event_ip, audit_event_user_agent, audit_event_request_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning audit_event_id, audit_event_created_at`
+
+	var changes any
+	if len(event.Changes) > 0 {
+		changes = []byte(event.Changes)
+	}
+
+	return m.DB.QueryRowContext(ctx, query, nullInt(event.Actor_Id), event.Action, event.Target_Type, nullInt(event.Target_Id),
+		changes, event.IP, event.User_Agent, event.Request_Id).Scan(&event.Id, &event.Created_At)
+}
+
+// where returns the where clause selecting the events that match the filter
+// with its arguments. Limit and Page are left to the caller.
+func (filter AuditFilter) where() (string, []any) {
+	var where []string
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Actor_Id != 0 {
+		add("audit_event_actor_id = $%d", filter.Actor_Id)
+	}
+	if filter.Target_Type != "" {
+		add("audit_event_target_type = $%d", filter.Target_Type)
+	}
+	if filter.Target_Id != 0 {
+		add("audit_event_target_id = $%d", filter.Target_Id)
+	}
+	if !filter.From.IsZero() {
+		add("audit_event_created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("audit_event_created_at < $%d", filter.To)
+	}
+
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " where " + strings.Join(where, " and "), args
+}
+
+// GetAuditEvents returns the events matching the filter, newest first.
+func (m *AuditEventModel) GetAuditEvents(filter AuditFilter) ([]*AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conditions, args := filter.where()
+	query := "select " + auditEventColumns + " from audit_events" + conditions
+	query += " order by audit_event_id desc"
+
+	if filter.Limit > 0 {
+		page := filter.Page
+		if page <= 0 {
+			page = 1
+		}
+		args = append(args, filter.Limit, (page-1)*filter.Limit)
+		query += fmt.Sprintf(" limit $%d offset $%d", len(args)-1, len(args))
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+
+		err := rows.Scan(event.scanFields()...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type AuthorModel struct {
+	DB *sql.DB
+}
+
+// Author is a person credited on books. Books link to their authors and show
+// their names joined as the book's author byline.
+type Author struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name" binding:"required,min=3,max=256"`
+	Bio     string `json:"bio,omitempty" binding:"max=4000"`
+	Version int    `json:"-"`
+}
+
+const authorColumns = "author_id, author_name, author_bio, author_version"
+
+func (a *Author) scanFields() []any {
+	return []any{&a.Id, &a.Name, &a.Bio, &a.Version}
+}
+
+func (m *AuthorModel) CreateAuthor(a *Author) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "insert into authors (author_name, author_bio) values ($1, $2) returning author_id, author_version"
+
+	return m.DB.QueryRowContext(ctx, query, a.Name, a.Bio).Scan(&a.Id, &a.Version)
+}
+
+func (m *AuthorModel) GetAuthor(id int) (*Author, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + authorColumns + " from authors where author_id = $1"
+
+	var a Author
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(a.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetPageOfAuthors returns a page of authors ordered by name.
+func (m *AuthorModel) GetPageOfAuthors(limit int, page int) ([]*Author, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+
+	query := "select " + authorColumns + " from authors order by author_name, author_id limit $1 offset $2"
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, (page-1)*limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	authors := []*Author{}
+
+	for rows.Next() {
+		var a Author
+
+		if err := rows.Scan(a.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		authors = append(authors, &a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return authors, nil
+}
+
+// UpdateAuthor replaces the author if it is still at a.Version and rewrites
+// the bylines of the author's books when the name changed. On success
+// a.Version is set to the new version, otherwise ErrEditConflict is returned.
+func (m *AuthorModel) UpdateAuthor(a *Author) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "update authors set author_name = $1, author_bio = $2, author_version = author_version + 1 where author_id = $3 and author_version = $4 returning author_version"
+
+	err = tx.QueryRowContext(ctx, query, a.Name, a.Bio, a.Id, a.Version).Scan(&a.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	query = "update books set " + bylineSet + " where book_id in (select book_author_book_id from book_authors where book_author_author_id = $1) and book_author <> " + bylineOf
+	if _, err := tx.ExecContext(ctx, query, a.Id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAuthor removes the author if it is still at the given version. It
+// fails with a foreign key violation while books are linked to the author.
+func (m *AuthorModel) DeleteAuthor(id int, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from authors where author_id = $1 and author_version = $2"
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// GetBookAuthors returns the authors of the book in the order they are
+// credited.
+func (m *AuthorModel) GetBookAuthors(bookId int) ([]*Author, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select a.author_id, a.author_name, a.author_bio, a.author_version from authors a
+		join book_authors ba on ba.book_author_author_id = a.author_id
+		where ba.book_author_book_id = $1 order by ba.book_author_position`
+
+	rows, err := m.DB.QueryContext(ctx, query, bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	authors := []*Author{}
+
+	for rows.Next() {
+		var a Author
+
+		if err := rows.Scan(a.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		authors = append(authors, &a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return authors, nil
+}
+
+// bylineOf is the byline of the book in the surrounding books row: its
+// authors' names in credit order.
+const bylineOf = `(select string_agg(a.author_name, ', ' order by ba.book_author_position) from book_authors ba
+	join authors a on a.author_id = ba.book_author_author_id where ba.book_author_book_id = books.book_id)`
+
+// bylineSet sets book_author from the book's linked authors and bumps the
+// book's version.
+const bylineSet = "book_author = " + bylineOf + ", book_version = book_version + 1"
+
+// linkBylineAuthor links the book to the author called name, adding the author
+// if there is none, in place of the authors it had. It is used when a book's
+// byline is set directly.
+func linkBylineAuthor(ctx context.Context, tx *sql.Tx, bookId int, name string) error {
+	var authorId int
+	query := "select author_id from authors where author_name = $1 order by author_id limit 1"
+	err := tx.QueryRowContext(ctx, query, name).Scan(&authorId)
+	if err == sql.ErrNoRows {
+		query = "insert into authors (author_name) values ($1) returning author_id"
+		err = tx.QueryRowContext(ctx, query, name).Scan(&authorId)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "delete from book_authors where book_author_book_id = $1", bookId); err != nil {
+		return err
+	}
+
+	query = "insert into book_authors (book_author_book_id, book_author_author_id, book_author_position) values ($1, $2, 1)"
+	_, err = tx.ExecContext(ctx, query, bookId, authorId)
+	return err
+}
+
+// SetBookAuthors replaces the authors of the book, credited in the order
+// given, and sets its byline from their names. The book must still be at
+// version; on success its new byline and version are returned, otherwise
+// ErrEditConflict.
+func (m *AuthorModel) SetBookAuthors(bookId int, version int, authorIds []int) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from book_authors where book_author_book_id = $1", bookId); err != nil {
+		return "", 0, err
+	}
+
+	for i, authorId := range authorIds {
+		query := "insert into book_authors (book_author_book_id, book_author_author_id, book_author_position) values ($1, $2, $3)"
+		if _, err := tx.ExecContext(ctx, query, bookId, authorId, i+1); err != nil {
+			return "", 0, err
+		}
+	}
+
+	var byline string
+	query := "update books set " + bylineSet + " where book_id = $1 and book_version = $2 and book_deleted_at is null returning book_author, book_version"
+	if err := tx.QueryRowContext(ctx, query, bookId, version).Scan(&byline, &version); err != nil {
+		if err == sql.ErrNoRows {
+			return "", 0, ErrEditConflict
+		}
+		return "", 0, err
+	}
+
+	return byline, version, tx.Commit()
+}
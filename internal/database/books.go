@@ -4,50 +4,116 @@ import (
 	"context"
 	"database/sql"
 	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/lib/pq"
 )
 
 type BookModel struct {
 	DB *sql.DB
 }
 
+// Book is a book in the catalog. Tax_Category selects the tax rate charged on
+// it; books without one get the general rate. Weight_Grams is used when
+// shipping is charged by weight. Author is the byline, kept in step with the
+// book's linked authors. ISBNs are stored without hyphens.
 type Book struct {
-	Id     int    `json:"id"`
-	Title  string `json:"title" binding:"required,min=3"`
-	Author string `json:"author" binding:"required,min=3"`
-	Price  int    `json:"price" binding:"required"`
+	Id           int         `json:"id"`
+	Title        string      `json:"title" binding:"required,min=3"`
+	Author       string      `json:"author" binding:"required,min=3"`
+	Price        money.Money `json:"price" binding:"positive_money"`
+	Stock        int         `json:"stock" binding:"min=0"`
+	Tax_Category string      `json:"tax_category,omitempty" binding:"max=32"`
+	Weight_Grams int         `json:"weight_grams,omitempty" binding:"min=0"`
+	Publisher_Id int         `json:"publisher_id,omitempty" binding:"min=0"`
+	Isbn_13      string      `json:"isbn_13,omitempty" binding:"omitempty,isbn13"`
+	Isbn_10      string      `json:"isbn_10,omitempty" binding:"omitempty,isbn10"`
+	Version      int         `json:"-"`
+}
+
+const bookColumns = "book_id, book_title, book_author, book_price, book_currency, book_stock, book_tax_category, book_weight_grams, coalesce(book_publisher_id, 0), coalesce(book_isbn_13, ''), coalesce(book_isbn_10, ''), book_version"
+
+func (book *Book) scanFields() []any {
+	return []any{&book.Id, &book.Title, &book.Author, &book.Price.Amount, &book.Price.Currency, &book.Stock, &book.Tax_Category, &book.Weight_Grams, &book.Publisher_Id, &book.Isbn_13, &book.Isbn_10, &book.Version}
 }
 
+// CreateBook adds the book and links it to the author named by its byline.
 func (m *BookModel) CreateBook(book *Book) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "insert into books (book_title, book_author, book_price) values ($1, $2, $3) returning book_id"
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return m.DB.QueryRowContext(ctx, query, book.Title, book.Author, book.Price).Scan(&book.Id)
+	if err := insertBook(ctx, tx, book); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m *BookModel) DeleteBook(id int) error {
+func insertBook(ctx context.Context, tx *sql.Tx, book *Book) error {
+	query := `insert into books (book_title, book_author, book_price, book_currency, book_stock, book_tax_category, book_weight_grams, book_publisher_id, book_isbn_13, book_isbn_10)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning book_id, book_version`
+
+	err := tx.QueryRowContext(ctx, query, book.Title, book.Author, book.Price.Amount, book.Price.Currency, book.Stock, book.Tax_Category, book.Weight_Grams, nullInt(book.Publisher_Id),
+		nullString(book.Isbn_13), nullString(book.Isbn_10)).Scan(&book.Id, &book.Version)
+	if err != nil {
+		return err
+	}
+
+	return linkBylineAuthor(ctx, tx, book.Id, book.Author)
+}
+
+// DeleteBook soft deletes the book if it is still at the given version and
+// returns ErrEditConflict otherwise. Deleted books are hidden until they are
+// restored or purged.
+func (m *BookModel) DeleteBook(id int, version int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "delete from books where book_id = $1"
+	query := "update books set book_deleted_at = now(), book_version = book_version + 1 where book_id = $1 and book_version = $2 and book_deleted_at is null"
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
-	return nil
+	return checkAffected(result)
 }
 
 func (m *BookModel) GetBook(id int) (*Book, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "select * from books where book_id = $1"
+	query := "select " + bookColumns + " from books where book_id = $1 and book_deleted_at is null"
+
+	var book Book
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(book.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &book, nil
+}
+
+// GetBookByIsbn returns the book with the given ISBN-13, or nil if there is
+// none.
+func (m *BookModel) GetBookByIsbn(isbn13 string) (*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + bookColumns + " from books where book_isbn_13 = $1 and book_deleted_at is null"
 
 	var book Book
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&book.Id, &book.Title, &book.Author, &book.Price)
+	err := m.DB.QueryRowContext(ctx, query, isbn13).Scan(book.scanFields()...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -72,9 +138,68 @@ func (m *BookModel) GetPageOfBooks(limit int, page int) ([]*Book, error) {
 
 	offset := (page - 1) * limit
 
-	query := "select * from books order by book_id limit $1 offset $2"
+	query := "select " + bookColumns + " from books where book_deleted_at is null order by book_id limit $1 offset $2"
 
-	rows, err := m.DB.QueryContext(ctx, query, limit, offset)
+	return m.queryBooks(ctx, query, limit, offset)
+}
+
+// GetBooksByAuthor returns a page of the books credited to the author.
+func (m *BookModel) GetBooksByAuthor(authorId int, limit int, page int) ([]*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, offset := pageBounds(limit, page)
+
+	query := `select ` + bookColumns + ` from books where book_deleted_at is null
+		and book_id in (select book_author_book_id from book_authors where book_author_author_id = $1)
+		order by book_id limit $2 offset $3`
+
+	return m.queryBooks(ctx, query, authorId, limit, offset)
+}
+
+// GetBooksByPublisher returns a page of the books the publisher published.
+func (m *BookModel) GetBooksByPublisher(publisherId int, limit int, page int) ([]*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, offset := pageBounds(limit, page)
+
+	query := "select " + bookColumns + " from books where book_deleted_at is null and book_publisher_id = $1 order by book_id limit $2 offset $3"
+
+	return m.queryBooks(ctx, query, publisherId, limit, offset)
+}
+
+// GetBooksInCategory returns a page of the books filed under the category or
+// any category below it.
+func (m *BookModel) GetBooksInCategory(categoryId int, limit int, page int) ([]*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, offset := pageBounds(limit, page)
+
+	query := categoryTree + ` select ` + bookColumns + ` from books where book_deleted_at is null
+		and book_id in (select book_category_book_id from book_categories join tree on book_category_category_id = tree.id)
+		order by book_id limit $2 offset $3`
+
+	return m.queryBooks(ctx, query, categoryId, limit, offset)
+}
+
+// pageBounds returns the limit and offset of a page, defaulting to the first
+// page of 20.
+func pageBounds(limit int, page int) (int, int) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+
+	return limit, (page - 1) * limit
+}
+
+func (m *BookModel) queryBooks(ctx context.Context, query string, args ...any) ([]*Book, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 
 	if err != nil {
 		return nil, err
@@ -87,7 +212,7 @@ func (m *BookModel) GetPageOfBooks(limit int, page int) ([]*Book, error) {
 	for rows.Next() {
 		var book Book
 
-		err := rows.Scan(&book.Id, &book.Title, &book.Author, &book.Price)
+		err := rows.Scan(book.scanFields()...)
 
 		if err != nil {
 			return nil, err
@@ -103,16 +228,326 @@ func (m *BookModel) GetPageOfBooks(limit int, page int) ([]*Book, error) {
 	return books, nil
 }
 
+// RestoreBook undeletes a soft deleted book and returns it, or nil if there is
+// no deleted book with that id.
+func (m *BookModel) RestoreBook(id int) (*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "update books set book_deleted_at = null, book_version = book_version + 1 where book_id = $1 and book_deleted_at is not null returning " + bookColumns
+
+	var book Book
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(book.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &book, nil
+}
+
+// PurgeDeletedBooks removes books soft deleted before the given time and
+// returns how many were removed.
+func (m *BookModel) PurgeDeletedBooks(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from books where book_deleted_at < $1"
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpdateBook replaces the book if it is still at book.Version, relinking its
+// author if the byline changed. On success book.Version is set to the new
+// version, otherwise ErrEditConflict is returned.
 func (m *BookModel) UpdateBook(book *Book) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "update books set book_title = $1, book_author = $2, book_price = $3 where book_id = $4"
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var byline string
+	var price money.Money
+	query := "select book_author, book_price, book_currency from books where book_id = $1 and book_version = $2 and book_deleted_at is null for update"
+	if err := tx.QueryRowContext(ctx, query, book.Id, book.Version).Scan(&byline, &price.Amount, &price.Currency); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	query = `update books set book_title = $1, book_author = $2, book_price = $3, book_currency = $4, book_stock = $5, book_tax_category = $6, book_weight_grams = $7,
+		book_publisher_id = $8, book_isbn_13 = $9, book_isbn_10 = $10, book_version = book_version + 1 where book_id = $11 returning book_version`
+
+	err = tx.QueryRowContext(ctx, query, book.Title, book.Author, book.Price.Amount, book.Price.Currency, book.Stock, book.Tax_Category, book.Weight_Grams, nullInt(book.Publisher_Id),
+		nullString(book.Isbn_13), nullString(book.Isbn_10), book.Id).Scan(&book.Version)
+	if err != nil {
+		return err
+	}
+
+	if book.Author != byline {
+		if err := linkBylineAuthor(ctx, tx, book.Id, book.Author); err != nil {
+			return err
+		}
+	}
+
+	if err := recordPriceChange(ctx, tx, book.Id, price, book.Price); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PatchBook writes only the columns of patched that differ from existing,
+// provided the row is still at existing.Version. patched.Version is set to the
+// resulting version.
+func (m *BookModel) PatchBook(existing *Book, patched *Book) error {
+	changes := bookChanges(existing, patched)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version, err := updateColumns(ctx, tx, "books", "book_id", "book_version", existing.Id, existing.Version, changes)
+	if err != nil {
+		return err
+	}
+
+	if patched.Author != existing.Author {
+		if err := linkBylineAuthor(ctx, tx, existing.Id, patched.Author); err != nil {
+			return err
+		}
+	}
+
+	if err := recordPriceChange(ctx, tx, existing.Id, existing.Price, patched.Price); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	patched.Version = version
+	return nil
+}
+
+// bookChanges returns the columns of patched that differ from existing.
+func bookChanges(existing *Book, patched *Book) []columnChange {
+	var changes []columnChange
+	if patched.Title != existing.Title {
+		changes = append(changes, columnChange{"book_title", patched.Title})
+	}
+	if patched.Author != existing.Author {
+		changes = append(changes, columnChange{"book_author", patched.Author})
+	}
+	if patched.Price.Amount != existing.Price.Amount {
+		changes = append(changes, columnChange{"book_price", patched.Price.Amount})
+	}
+	if patched.Price.Currency != existing.Price.Currency {
+		changes = append(changes, columnChange{"book_currency", patched.Price.Currency})
+	}
+	if patched.Stock != existing.Stock {
+		changes = append(changes, columnChange{"book_stock", patched.Stock})
+	}
+	if patched.Tax_Category != existing.Tax_Category {
+		changes = append(changes, columnChange{"book_tax_category", patched.Tax_Category})
+	}
+	if patched.Weight_Grams != existing.Weight_Grams {
+		changes = append(changes, columnChange{"book_weight_grams", patched.Weight_Grams})
+	}
+	if patched.Publisher_Id != existing.Publisher_Id {
+		changes = append(changes, columnChange{"book_publisher_id", nullInt(patched.Publisher_Id)})
+	}
+	if patched.Isbn_13 != existing.Isbn_13 {
+		changes = append(changes, columnChange{"book_isbn_13", nullString(patched.Isbn_13)})
+	}
+	if patched.Isbn_10 != existing.Isbn_10 {
+		changes = append(changes, columnChange{"book_isbn_10", nullString(patched.Isbn_10)})
+	}
+	return changes
+}
+
+// GetBookPrices returns the list prices of the book in other currencies than
+// its own, ordered by currency.
+func (m *BookModel) GetBookPrices(bookId int) ([]money.Money, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select book_price_amount, book_price_currency from book_prices where book_price_book_id = $1 order by book_price_currency"
 
-	_, err := m.DB.ExecContext(ctx, query, book.Title, book.Author, book.Price, book.Id)
+	rows, err := m.DB.QueryContext(ctx, query, bookId)
 
 	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	prices := []money.Money{}
+
+	for rows.Next() {
+		var price money.Money
+
+		err := rows.Scan(&price.Amount, &price.Currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prices = append(prices, price)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// SetBookPrice adds or replaces the book's list price in price.Currency and
+// bumps the book's version, since its price in that currency changed. It
+// returns false if the book does not exist.
+func (m *BookModel) SetBookPrice(bookId int, price money.Money) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := "update books set book_version = book_version + 1 where book_id = $1 and book_deleted_at is null"
+	result, err := tx.ExecContext(ctx, query, bookId)
+	if err != nil {
+		return false, err
+	}
+	if err := checkAffected(result); err != nil {
+		return false, nil
+	}
+
+	var old *money.Money
+	query = "select book_price_amount from book_prices where book_price_book_id = $1 and book_price_currency = $2 for update"
+	var amount int64
+	switch err := tx.QueryRowContext(ctx, query, bookId, price.Currency).Scan(&amount); err {
+	case nil:
+		old = &money.Money{Amount: amount, Currency: price.Currency}
+	case sql.ErrNoRows:
+	default:
+		return false, err
+	}
+
+	query = `insert into book_prices (book_price_book_id, book_price_currency, book_price_amount) values ($1, $2, $3)
+		on conflict (book_price_book_id, book_price_currency) do update set book_price_amount = excluded.book_price_amount`
+	if _, err := tx.ExecContext(ctx, query, bookId, price.Currency, price.Amount); err != nil {
+		return false, err
+	}
+
+	if old == nil || *old != price {
+		if err := recordEvent(ctx, tx, BookPriceChanged{Book_Id: bookId, Old_Price: old, New_Price: &price}); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// DeleteBookPrice removes the book's list price in currency, after which the
+// price is converted again. It returns false if there was no such price.
+func (m *BookModel) DeleteBookPrice(bookId int, currency string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	old := money.Money{Currency: currency}
+	query := "delete from book_prices where book_price_book_id = $1 and book_price_currency = $2 returning book_price_amount"
+	err = tx.QueryRowContext(ctx, query, bookId, currency).Scan(&old.Amount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	query = "update books set book_version = book_version + 1 where book_id = $1"
+	if _, err := tx.ExecContext(ctx, query, bookId); err != nil {
+		return false, err
+	}
+
+	if err := recordEvent(ctx, tx, BookPriceChanged{Book_Id: bookId, Old_Price: &old}); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// PriceIn replaces the price of each book with its list price in currency or,
+// failing that, its price converted at the rate in effect at the given time.
+// It returns an *ExchangeRateError if a rate is missing.
+func (m *BookModel) PriceIn(books []*Book, currency string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ids := make([]int64, len(books))
+	for i, book := range books {
+		ids[i] = int64(book.Id)
+	}
+
+	query := "select book_price_book_id, book_price_amount from book_prices where book_price_book_id = any($1) and book_price_currency = $2"
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids), currency)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	listPrices := map[int]money.Money{}
+
+	for rows.Next() {
+		var bookId int
+		price := money.Money{Currency: currency}
+
+		if err := rows.Scan(&bookId, &price.Amount); err != nil {
+			return err
+		}
+
+		listPrices[bookId] = price
+	}
+
+	if err = rows.Err(); err != nil {
 		return err
 	}
+
+	cv := newConverter(ctx, m.DB, currency, at)
+	for _, book := range books {
+		if price, ok := listPrices[book.Id]; ok {
+			book.Price = price
+			continue
+		}
+		if book.Price, _, err = cv.convert(book.Price); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,518 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/promotion"
+	"github.com/hamorrar/bookstore/internal/shipping"
+	"github.com/hamorrar/bookstore/internal/tax"
+)
+
+var (
+	// ErrCartEmpty is returned when checking out a cart with no items.
+	ErrCartEmpty = errors.New("cart is empty")
+	// ErrCartPriceChanged is returned by Checkout when a book's price changed
+	// after it was put in the cart. The cart is updated to the current prices
+	// so the customer can review them and check out again.
+	ErrCartPriceChanged = errors.New("cart prices changed")
+	// ErrCartMixedCurrencies is returned by Checkout when the cart holds
+	// books priced in different currencies and no currency to convert them to
+	// was requested, or when converting would take more than one rate.
+	ErrCartMixedCurrencies = errors.New("cart has mixed currencies")
+)
+
+// StockError is returned by Checkout when a book does not have enough stock
+// for the quantity in the cart.
+type StockError struct {
+	Book_Id   int
+	Requested int
+	Available int
+}
+
+func (e *StockError) Error() string {
+	return fmt.Sprintf("book %d has %d in stock, %d requested", e.Book_Id, e.Available, e.Requested)
+}
+
+type CartModel struct {
+	DB *sql.DB
+}
+
+// CartOwner identifies a cart. Logged in customers own a cart by user id and
+// anonymous visitors by the random token in their cart cookie.
+type CartOwner struct {
+	User_Id int
+	Token   string
+}
+
+func (owner CartOwner) column() (string, any) {
+	if owner.User_Id != 0 {
+		return "cart_user_id", owner.User_Id
+	}
+	return "cart_token", owner.Token
+}
+
+// Cart is the content of a cart. Total_Price is nil when the books in it are
+// priced in different currencies, which cannot be checked out together.
+type Cart struct {
+	Items       []*CartItem  `json:"items"`
+	Total_Price *money.Money `json:"total_price"`
+}
+
+// CartItem is a line in a cart. Unit_Price is always the book's current price;
+// Price_Changed reports that it differs from the price when the line was last
+// added or updated.
+type CartItem struct {
+	Book_Id       int         `json:"book_id"`
+	Title         string      `json:"title"`
+	Quantity      int         `json:"quantity"`
+	Unit_Price    money.Money `json:"unit_price"`
+	Line_Price    money.Money `json:"line_price"`
+	Price_Changed bool        `json:"price_changed"`
+	In_Stock      bool        `json:"in_stock"`
+}
+
+// GetCartId returns the id of the owner's cart, or 0 if they have none.
+func (m *CartModel) GetCartId(owner CartOwner) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	column, value := owner.column()
+	query := "select cart_id from carts where " + column + " = $1"
+
+	var cartId int
+	err := m.DB.QueryRowContext(ctx, query, value).Scan(&cartId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return cartId, nil
+}
+
+// EnsureCart returns the id of the owner's cart, creating it if needed.
+func (m *CartModel) EnsureCart(owner CartOwner) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	column, value := owner.column()
+	query := "insert into carts (" + column + ") values ($1) on conflict (" + column + ") do update set cart_updated_at = now() returning cart_id"
+
+	var cartId int
+	err := m.DB.QueryRowContext(ctx, query, value).Scan(&cartId)
+	return cartId, err
+}
+
+// GetCart returns the cart with every line priced from books.book_price.
+// Books deleted since they were added are shown as out of stock.
+func (m *CartModel) GetCart(cartId int) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select b.book_id, b.book_title, ci.cart_item_quantity, b.book_price, b.book_currency,
+			ci.cart_item_unit_price, ci.cart_item_currency,
+			case when b.book_deleted_at is null then b.book_stock else 0 end
+		from cart_items ci join books b on b.book_id = ci.cart_item_book_id
+		where ci.cart_item_cart_id = $1 order by b.book_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, cartId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	cart := &Cart{Items: []*CartItem{}}
+
+	for rows.Next() {
+		var item CartItem
+		var addedPrice money.Money
+		var stock int
+
+		err := rows.Scan(&item.Book_Id, &item.Title, &item.Quantity, &item.Unit_Price.Amount, &item.Unit_Price.Currency,
+			&addedPrice.Amount, &addedPrice.Currency, &stock)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Line_Price = item.Unit_Price.Mul(int64(item.Quantity))
+		item.Price_Changed = item.Unit_Price != addedPrice
+		item.In_Stock = stock >= item.Quantity
+
+		cart.Items = append(cart.Items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	total := money.New(0, money.DefaultCurrency)
+	if len(cart.Items) > 0 {
+		total.Currency = cart.Items[0].Line_Price.Currency
+	}
+	for _, item := range cart.Items {
+		if total, err = total.Add(item.Line_Price); err != nil {
+			return cart, nil
+		}
+	}
+	cart.Total_Price = &total
+
+	return cart, nil
+}
+
+// AddCartItem adds quantity copies of the book to the cart. It returns false if
+// the book does not exist or was deleted.
+func (m *CartModel) AddCartItem(cartId int, bookId int, quantity int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into cart_items (cart_item_cart_id, cart_item_book_id, cart_item_quantity, cart_item_unit_price, cart_item_currency)
+		select $1, book_id, $3, book_price, book_currency from books where book_id = $2 and book_deleted_at is null
+		on conflict (cart_item_cart_id, cart_item_book_id) do update set
+			cart_item_quantity = cart_items.cart_item_quantity + excluded.cart_item_quantity,
+			cart_item_unit_price = excluded.cart_item_unit_price,
+			cart_item_currency = excluded.cart_item_currency`
+
+	result, err := m.DB.ExecContext(ctx, query, cartId, bookId, quantity)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// SetCartItemQuantity replaces the quantity of a line already in the cart. It
+// returns false if the book is not in the cart.
+func (m *CartModel) SetCartItemQuantity(cartId int, bookId int, quantity int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update cart_items set cart_item_quantity = $3, cart_item_unit_price = b.book_price, cart_item_currency = b.book_currency
+		from books b where b.book_id = $2 and cart_item_cart_id = $1 and cart_item_book_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, cartId, bookId, quantity)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// RemoveCartItem removes a line from the cart. It returns false if the book is
+// not in the cart.
+func (m *CartModel) RemoveCartItem(cartId int, bookId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from cart_items where cart_item_cart_id = $1 and cart_item_book_id = $2"
+
+	result, err := m.DB.ExecContext(ctx, query, cartId, bookId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// MergeCarts moves the anonymous cart with the given token into the user's
+// cart, adding quantities for books that are in both, and deletes it.
+func (m *CartModel) MergeCarts(token string, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var anonymousCartId int
+	err = tx.QueryRowContext(ctx, "select cart_id from carts where cart_token = $1 for update", token).Scan(&anonymousCartId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	var userCartId int
+	query := "insert into carts (cart_user_id) values ($1) on conflict (cart_user_id) do update set cart_updated_at = now() returning cart_id"
+	if err := tx.QueryRowContext(ctx, query, userId).Scan(&userCartId); err != nil {
+		return err
+	}
+
+	query = `insert into cart_items (cart_item_cart_id, cart_item_book_id, cart_item_quantity, cart_item_unit_price, cart_item_currency)
+		select $1, cart_item_book_id, cart_item_quantity, cart_item_unit_price, cart_item_currency from cart_items where cart_item_cart_id = $2
+		on conflict (cart_item_cart_id, cart_item_book_id) do update set
+			cart_item_quantity = cart_items.cart_item_quantity + excluded.cart_item_quantity`
+	if _, err := tx.ExecContext(ctx, query, userCartId, anonymousCartId); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "delete from carts where cart_id = $1", anonymousCartId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type checkoutLine struct {
+	bookId      int
+	quantity    int
+	addedPrice  money.Money
+	price       money.Money
+	listPrice   sql.NullInt64
+	taxCategory string
+	weightGrams int
+	stock       int
+}
+
+// CheckoutOptions are the choices a customer makes at checkout. Currency is
+// the currency to place the order in, if any. Promotion_Codes are applied
+// before tax. When Tax_Region is set the discounted lines are taxed by Tax for
+// that region. The addresses are copied onto the order and shipping to
+// Shipping_Address is charged at the rate quoted by Shipping.
+type CheckoutOptions struct {
+	Currency         string
+	Promotion_Codes  []string
+	Tax_Region       string
+	Tax              tax.Calculator
+	Shipping_Address *Address
+	Billing_Address  *Address
+	Shipping         shipping.RateCalculator
+}
+
+// Checkout turns the cart into a pending order for the user in a single
+// transaction: stock is taken from every book, the order and its items are
+// written and the cart is emptied. The books are locked while this happens so
+// two checkouts cannot sell the same stock.
+//
+// With a currency the order is placed in it, at the books' list prices in that
+// currency or their prices converted at the current rate, which is frozen onto
+// the order. Only books priced in one other currency can be converted in one
+// order. Without a currency the books must all be priced in the same one.
+// Promotion codes are then applied, shipping is added and tax is worked out
+// on the discounted prices and added to the total. A free shipping promotion
+// takes off the whole shipping cost.
+func (m *CartModel) Checkout(cartId int, userId int, opts CheckoutOptions) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `select b.book_id, ci.cart_item_quantity, ci.cart_item_unit_price, ci.cart_item_currency, b.book_price, b.book_currency,
+			bp.book_price_amount, b.book_tax_category, b.book_weight_grams, case when b.book_deleted_at is null then b.book_stock else 0 end
+		from cart_items ci join books b on b.book_id = ci.cart_item_book_id
+			left join book_prices bp on bp.book_price_book_id = b.book_id and bp.book_price_currency = $2
+		where ci.cart_item_cart_id = $1 order by b.book_id for update of b`
+
+	rows, err := tx.QueryContext(ctx, query, cartId, opts.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []checkoutLine
+	for rows.Next() {
+		var line checkoutLine
+		if err := rows.Scan(&line.bookId, &line.quantity, &line.addedPrice.Amount, &line.addedPrice.Currency,
+			&line.price.Amount, &line.price.Currency, &line.listPrice, &line.taxCategory, &line.weightGrams, &line.stock); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	priceChanged := false
+	for _, line := range lines {
+		if line.stock < line.quantity {
+			return nil, &StockError{Book_Id: line.bookId, Requested: line.quantity, Available: line.stock}
+		}
+		if line.price != line.addedPrice {
+			priceChanged = true
+		}
+	}
+
+	if priceChanged {
+		query = `update cart_items set cart_item_unit_price = b.book_price, cart_item_currency = b.book_currency from books b
+			where b.book_id = cart_item_book_id and cart_item_cart_id = $1`
+		if _, err := tx.ExecContext(ctx, query, cartId); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrCartPriceChanged
+	}
+
+	currency := opts.Currency
+	convert := currency != ""
+	if !convert {
+		currency = lines[0].price.Currency
+	}
+	now := time.Now()
+	cv := newConverter(ctx, tx, currency, now)
+
+	order := &Order{User_Id: userId, Status: OrderPending, Total_Price: money.New(0, currency)}
+	unitPrices := make([]money.Money, len(lines))
+	for i, line := range lines {
+		switch {
+		case line.listPrice.Valid:
+			unitPrices[i] = money.New(line.listPrice.Int64, currency)
+		case line.price.Currency == currency:
+			unitPrices[i] = line.price
+		case !convert:
+			return nil, ErrCartMixedCurrencies
+		default:
+			converted, rate, err := cv.convert(line.price)
+			if err != nil {
+				return nil, err
+			}
+			if order.Exchange_Rate_From != "" && order.Exchange_Rate_From != rate.From {
+				return nil, ErrCartMixedCurrencies
+			}
+			order.Exchange_Rate_From, order.Exchange_Rate = rate.From, rate.Rate
+			unitPrices[i] = converted
+		}
+
+		if order.Total_Price, err = order.Total_Price.Add(unitPrices[i].Mul(int64(line.quantity))); err != nil {
+			return nil, err
+		}
+	}
+
+	lineTotals := make([]money.Money, len(lines))
+	for i, line := range lines {
+		lineTotals[i] = unitPrices[i].Mul(int64(line.quantity))
+	}
+
+	if len(opts.Promotion_Codes) > 0 {
+		promoLines := make([]promotion.Line, len(lines))
+		for i, line := range lines {
+			promoLines[i] = promotion.Line{Book_Id: line.bookId, Quantity: line.quantity, Unit_Price: unitPrices[i]}
+		}
+		result, err := applyPromotions(ctx, tx, opts.Promotion_Codes, userId, promoLines, now)
+		if err != nil {
+			return nil, err
+		}
+		order.setDiscounts(result)
+		order.Total_Price, lineTotals = result.Total, result.Line_Totals
+	}
+
+	if opts.Shipping_Address != nil {
+		parcel := shipping.Parcel{Country: opts.Shipping_Address.Country, Postal_Code: opts.Shipping_Address.Postal_Code}
+		for _, line := range lines {
+			parcel.Items += line.quantity
+			parcel.Weight_Grams += line.weightGrams * line.quantity
+		}
+		if order.Shipping_Total, err = opts.Shipping.Quote(parcel); err != nil {
+			return nil, err
+		}
+		if order.Shipping_Total.Currency != currency {
+			converted, rate, err := cv.convert(order.Shipping_Total)
+			if err != nil {
+				return nil, err
+			}
+			if order.Exchange_Rate_From != "" && order.Exchange_Rate_From != rate.From {
+				return nil, ErrCartMixedCurrencies
+			}
+			order.Exchange_Rate_From, order.Exchange_Rate = rate.From, rate.Rate
+			order.Shipping_Total = converted
+		}
+		if order.Total_Price, err = order.Total_Price.Add(order.Shipping_Total); err != nil {
+			return nil, err
+		}
+
+		if order.Free_Shipping {
+			for i, d := range order.Discounts {
+				if d.Type == promotion.TypeFreeShipping {
+					order.Discounts[i].Amount = order.Shipping_Total
+				}
+			}
+			order.Discount_Total, _ = order.Discount_Total.Add(order.Shipping_Total)
+			order.Total_Price, _ = order.Total_Price.Sub(order.Shipping_Total)
+		}
+	}
+	order.Shipping_Address, order.Billing_Address = opts.Shipping_Address, opts.Billing_Address
+
+	if opts.Tax_Region != "" {
+		taxLines := make([]tax.Line, len(lines))
+		for i, line := range lines {
+			taxLines[i] = tax.Line{Book_Id: line.bookId, Category: line.taxCategory, Amount: lineTotals[i]}
+		}
+		if order.Tax_Lines, err = opts.Tax.Calculate(opts.Tax_Region, now, taxLines); err != nil {
+			return nil, err
+		}
+
+		order.Tax_Region = opts.Tax_Region
+		order.Tax_Total = money.New(0, currency)
+		for _, line := range order.Tax_Lines {
+			if order.Tax_Total, err = order.Tax_Total.Add(line.Tax_Amount); err != nil {
+				return nil, err
+			}
+		}
+		if order.Total_Price, err = order.Total_Price.Add(order.Tax_Total); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, line := range lines {
+		query = "update books set book_stock = book_stock - $1, book_version = book_version + 1 where book_id = $2"
+		if _, err := tx.ExecContext(ctx, query, line.quantity, line.bookId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := insertOrder(ctx, tx, order); err != nil {
+		return nil, err
+	}
+
+	lineTaxes := map[int]int64{}
+	for _, line := range order.Tax_Lines {
+		lineTaxes[line.Book_Id] += line.Tax_Amount.Amount
+	}
+
+	for i, line := range lines {
+		query = `insert into order_items (order_item_order_id, order_item_book_id, order_item_quantity, order_item_unit_price, order_item_total, order_item_tax)
+			values ($1, $2, $3, $4, $5, $6)`
+		if _, err := tx.ExecContext(ctx, query, order.Id, line.bookId, line.quantity, unitPrices[i].Amount, lineTotals[i].Amount, lineTaxes[line.bookId]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := insertOrderTaxLines(ctx, tx, order.Id, order.Tax_Lines); err != nil {
+		return nil, err
+	}
+
+	if err := insertOrderDiscounts(ctx, tx, order); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "delete from cart_items where cart_item_cart_id = $1", cartId); err != nil {
+		return nil, err
+	}
+
+	if err := insertOrderEvent(ctx, tx, &OrderEvent{Order_Id: order.Id, Type: OrderEventCreated, Detail: "checked out from cart", Actor_Id: userId}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+)
+
+type CategoryModel struct {
+	DB *sql.DB
+}
+
+// Category is a node in the tree of book categories. Top level categories
+// have no Parent_Id.
+type Category struct {
+	Id        int    `json:"id"`
+	Parent_Id int    `json:"parent_id,omitempty"`
+	Name      string `json:"name" binding:"required,max=100"`
+	Slug      string `json:"slug" binding:"required,slug,max=100"`
+	Version   int    `json:"-"`
+}
+
+// ErrCategoryCycle is returned when a category would become its own ancestor.
+var ErrCategoryCycle = errors.New("category cycle")
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// IsSlug reports whether s is lower case letters and digits in words joined
+// by dashes.
+func IsSlug(s string) bool {
+	return slugPattern.MatchString(s)
+}
+
+const categoryColumns = "category_id, coalesce(category_parent_id, 0), category_name, category_slug, category_version"
+
+func (cat *Category) scanFields() []any {
+	return []any{&cat.Id, &cat.Parent_Id, &cat.Name, &cat.Slug, &cat.Version}
+}
+
+// categoryTree selects the ids of category $1 and every category below it.
+const categoryTree = `with recursive tree(id) as (
+		select $1::int
+		union
+		select c.category_id from categories c join tree on c.category_parent_id = tree.id
+	)`
+
+func (m *CategoryModel) CreateCategory(cat *Category) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "insert into categories (category_parent_id, category_name, category_slug) values ($1, $2, $3) returning category_id, category_version"
+
+	return m.DB.QueryRowContext(ctx, query, nullInt(cat.Parent_Id), cat.Name, cat.Slug).Scan(&cat.Id, &cat.Version)
+}
+
+func (m *CategoryModel) GetCategory(id int) (*Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + categoryColumns + " from categories where category_id = $1"
+
+	var cat Category
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(cat.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cat, nil
+}
+
+// GetCategories returns every category ordered by name. Clients build the
+// tree from the parent ids.
+func (m *CategoryModel) GetCategories() ([]*Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + categoryColumns + " from categories order by category_name, category_id"
+
+	return m.queryCategories(ctx, query)
+}
+
+func (m *CategoryModel) queryCategories(ctx context.Context, query string, args ...any) ([]*Category, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	categories := []*Category{}
+
+	for rows.Next() {
+		var cat Category
+
+		if err := rows.Scan(cat.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, &cat)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// UpdateCategory replaces the category if it is still at cat.Version. It
+// returns ErrCategoryCycle if the new parent is the category itself or one of
+// the categories below it, and ErrEditConflict if the category changed.
+func (m *CategoryModel) UpdateCategory(cat *Category) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if cat.Parent_Id != 0 {
+		// lock the category and the new parent's ancestors, so that moves that
+		// could together make a cycle wait for each other and the check below
+		// sees the one made first
+		query := `with recursive chain(id) as (
+				select $2::int
+				union
+				select c.category_parent_id from categories c join chain on c.category_id = chain.id where c.category_parent_id is not null
+			)
+			select category_id from categories where category_id = $1 or category_id in (select id from chain) order by category_id for update`
+		if _, err := tx.ExecContext(ctx, query, cat.Id, cat.Parent_Id); err != nil {
+			return err
+		}
+
+		var cycle bool
+		query = categoryTree + " select exists (select 1 from tree where id = $2)"
+		if err := tx.QueryRowContext(ctx, query, cat.Id, cat.Parent_Id).Scan(&cycle); err != nil {
+			return err
+		}
+		if cycle {
+			return ErrCategoryCycle
+		}
+	}
+
+	query := `update categories set category_parent_id = $1, category_name = $2, category_slug = $3, category_version = category_version + 1
+		where category_id = $4 and category_version = $5 returning category_version`
+
+	err = tx.QueryRowContext(ctx, query, nullInt(cat.Parent_Id), cat.Name, cat.Slug, cat.Id, cat.Version).Scan(&cat.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCategory removes the category if it is still at the given version.
+// It fails with a foreign key violation while it has subcategories or books.
+func (m *CategoryModel) DeleteCategory(id int, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from categories where category_id = $1 and category_version = $2"
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// GetBookCategories returns the categories the book is filed under.
+func (m *CategoryModel) GetBookCategories(bookId int) ([]*Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select c.category_id, coalesce(c.category_parent_id, 0), c.category_name, c.category_slug, c.category_version from categories c
+		join book_categories bc on bc.book_category_category_id = c.category_id
+		where bc.book_category_book_id = $1 order by c.category_name`
+
+	return m.queryCategories(ctx, query, bookId)
+}
+
+// SetBookCategories replaces the categories the book is filed under. The
+// book must still be at version; on success its new version is returned,
+// otherwise ErrEditConflict.
+func (m *CategoryModel) SetBookCategories(bookId int, version int, categoryIds []int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := "update books set book_version = book_version + 1 where book_id = $1 and book_version = $2 and book_deleted_at is null returning book_version"
+	if err := tx.QueryRowContext(ctx, query, bookId, version).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrEditConflict
+		}
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "delete from book_categories where book_category_book_id = $1", bookId); err != nil {
+		return 0, err
+	}
+
+	for _, categoryId := range categoryIds {
+		query := "insert into book_categories (book_category_book_id, book_category_category_id) values ($1, $2) on conflict do nothing"
+		if _, err := tx.ExecContext(ctx, query, bookId, categoryId); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, tx.Commit()
+}
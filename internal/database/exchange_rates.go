@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// ExchangeRateError is returned when a price has to be converted between two
+// currencies that have no rate in effect.
+type ExchangeRateError struct {
+	From string
+	To   string
+}
+
+func (e *ExchangeRateError) Error() string {
+	return fmt.Sprintf("no exchange rate from %s to %s", e.From, e.To)
+}
+
+type ExchangeRateModel struct {
+	DB *sql.DB
+}
+
+// ExchangeRate is the price of one unit of From in units of To. It applies
+// from Effective_At until a later rate for the same pair takes effect, so old
+// rates stay in the table as history.
+type ExchangeRate struct {
+	Id           int64     `json:"id"`
+	From         string    `json:"from" binding:"required,currency"`
+	To           string    `json:"to" binding:"required,currency,nefield=From"`
+	Rate         string    `json:"rate" binding:"required,rate"`
+	Effective_At time.Time `json:"effective_at"`
+	Created_At   time.Time `json:"created_at"`
+}
+
+const exchangeRateColumns = "exchange_rate_id, exchange_rate_from, exchange_rate_to, exchange_rate_rate::text, exchange_rate_effective_at, exchange_rate_created_at"
+
+func (rate *ExchangeRate) scanFields() []any {
+	return []any{&rate.Id, &rate.From, &rate.To, &rate.Rate, &rate.Effective_At, &rate.Created_At}
+}
+
+// Convert converts price, which must be in the From currency, into To.
+func (rate *ExchangeRate) Convert(price money.Money) (money.Money, error) {
+	if price.Currency != rate.From {
+		return money.Money{}, fmt.Errorf("%w: converting %s at a %s rate", money.ErrCurrencyMismatch, price.Currency, rate.From)
+	}
+	r, err := money.ParseRate(rate.Rate)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return price.Convert(rate.To, r)
+}
+
+func (m *ExchangeRateModel) CreateExchangeRate(rate *ExchangeRate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into exchange_rates (exchange_rate_from, exchange_rate_to, exchange_rate_rate, exchange_rate_effective_at)
+		values ($1, $2, $3, $4) returning ` + exchangeRateColumns
+
+	return m.DB.QueryRowContext(ctx, query, rate.From, rate.To, rate.Rate, rate.Effective_At).Scan(rate.scanFields()...)
+}
+
+func (m *ExchangeRateModel) GetExchangeRate(id int64) (*ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + exchangeRateColumns + " from exchange_rates where exchange_rate_id = $1"
+
+	var rate ExchangeRate
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(rate.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// GetExchangeRates returns the rates from and to the given currencies, either
+// of which may be empty to match any, latest effective first.
+func (m *ExchangeRateModel) GetExchangeRates(from string, to string) ([]*ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + exchangeRateColumns + ` from exchange_rates
+		where ($1 = '' or exchange_rate_from = $1) and ($2 = '' or exchange_rate_to = $2)
+		order by exchange_rate_effective_at desc, exchange_rate_id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	rates := []*ExchangeRate{}
+
+	for rows.Next() {
+		var rate ExchangeRate
+
+		err := rows.Scan(rate.scanFields()...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, &rate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// DeleteExchangeRate removes a rate that has not taken effect yet. Rates that
+// did are kept as history. It returns false if there is no such rate.
+func (m *ExchangeRateModel) DeleteExchangeRate(id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from exchange_rates where exchange_rate_id = $1 and exchange_rate_effective_at > now()"
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// FindExchangeRate returns the rate from one currency to another in effect at
+// the given time, or nil if there is none.
+func (m *ExchangeRateModel) FindExchangeRate(from string, to string, at time.Time) (*ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return findExchangeRate(ctx, m.DB, from, to, at)
+}
+
+// findExchangeRate looks up the latest rate for the pair that took effect by
+// at. A rate stored for the opposite direction is used inverted when it is
+// more recent, or the only one.
+func findExchangeRate(ctx context.Context, db queryRower, from string, to string, at time.Time) (*ExchangeRate, error) {
+	query := `select ` + exchangeRateColumns + `, exchange_rate_from <> $1 from exchange_rates
+		where ((exchange_rate_from = $1 and exchange_rate_to = $2) or (exchange_rate_from = $2 and exchange_rate_to = $1))
+			and exchange_rate_effective_at <= $3
+		order by exchange_rate_effective_at desc, exchange_rate_from <> $1 limit 1`
+
+	var rate ExchangeRate
+	var inverse bool
+
+	err := db.QueryRowContext(ctx, query, from, to, at).Scan(append(rate.scanFields(), &inverse)...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if inverse {
+		r, err := money.ParseRate(rate.Rate)
+		if err != nil {
+			return nil, err
+		}
+		rate.From, rate.To = rate.To, rate.From
+		rate.Rate = money.FormatRate(new(big.Rat).Inv(r))
+	}
+	return &rate, nil
+}
+
+// converter converts prices into one currency at the rates in effect at one
+// time, looking each pair up once.
+type converter struct {
+	ctx   context.Context
+	db    queryRower
+	to    string
+	at    time.Time
+	rates map[string]*ExchangeRate
+}
+
+func newConverter(ctx context.Context, db queryRower, to string, at time.Time) *converter {
+	return &converter{ctx: ctx, db: db, to: to, at: at, rates: map[string]*ExchangeRate{}}
+}
+
+// convert returns price in the converter's currency and the rate used, which
+// is nil when the price already was in that currency.
+func (cv *converter) convert(price money.Money) (money.Money, *ExchangeRate, error) {
+	if price.Currency == cv.to {
+		return price, nil, nil
+	}
+
+	rate, ok := cv.rates[price.Currency]
+	if !ok {
+		var err error
+		rate, err = findExchangeRate(cv.ctx, cv.db, price.Currency, cv.to, cv.at)
+		if err != nil {
+			return money.Money{}, nil, err
+		}
+		cv.rates[price.Currency] = rate
+	}
+	if rate == nil {
+		return money.Money{}, nil, &ExchangeRateError{From: price.Currency, To: cv.to}
+	}
+
+	converted, err := rate.Convert(price)
+	return converted, rate, err
+}
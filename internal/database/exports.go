@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// exportBatchSize is how many rows an export fetches from its cursor at once.
+const exportBatchSize = 500
+
+// streamRows runs query through a server side cursor and calls scan for each
+// row, fetching exportBatchSize rows at a time so memory stays flat however
+// large the table. The rows come from a single read only snapshot. There is
+// no timeout other than ctx, which should end when the client goes away.
+func streamRows(ctx context.Context, db *sql.DB, query string, args []any, scan func(*sql.Rows) error) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "declare export_cursor no scroll cursor for "+query, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("fetch %d from export_cursor", exportBatchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			n++
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// BookFilter selects books to export. Zero values match everything.
+type BookFilter struct {
+	Publisher_Id int
+	// Category_Id matches books filed under the category or below it.
+	Category_Id int
+}
+
+// StreamBooks calls fn for every book matching the filter in id order.
+func (m *BookModel) StreamBooks(ctx context.Context, filter BookFilter, fn func(*Book) error) error {
+	var args []any
+	query := "select " + bookColumns + " from books where book_deleted_at is null"
+
+	if filter.Category_Id != 0 {
+		args = append(args, filter.Category_Id)
+		query = categoryTree + " " + query + " and book_id in (select book_category_book_id from book_categories join tree on book_category_category_id = tree.id)"
+	}
+	if filter.Publisher_Id != 0 {
+		args = append(args, filter.Publisher_Id)
+		query += fmt.Sprintf(" and book_publisher_id = $%d", len(args))
+	}
+	query += " order by book_id"
+
+	return streamRows(ctx, m.DB, query, args, func(rows *sql.Rows) error {
+		var book Book
+		if err := rows.Scan(book.scanFields()...); err != nil {
+			return err
+		}
+		return fn(&book)
+	})
+}
+
+// StreamOrders calls fn for every order matching the filter in id order, with
+// Created_At set. The filter's Limit and Page are ignored.
+func (m *OrderModel) StreamOrders(ctx context.Context, filter OrderFilter, fn func(*Order) error) error {
+	var args []any
+	query := "select " + orderColumns + ", order_created_at from orders where order_deleted_at is null"
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" and order_status = $%d", len(args))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		query += fmt.Sprintf(" and order_created_at >= $%d", len(args))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		query += fmt.Sprintf(" and order_created_at < $%d", len(args))
+	}
+	query += " order by order_id"
+
+	return streamRows(ctx, m.DB, query, args, func(rows *sql.Rows) error {
+		var order Order
+		if err := rows.Scan(append(order.scanFields(), &order.Created_At)...); err != nil {
+			return err
+		}
+		return fn(&order)
+	})
+}
+
+// StreamAuditEvents calls fn for every audit event matching the filter,
+// newest first. The filter's Limit and Page are ignored.
+func (m *AuditEventModel) StreamAuditEvents(ctx context.Context, filter AuditFilter, fn func(*AuditEvent) error) error {
+	conditions, args := filter.where()
+	query := "select " + auditEventColumns + " from audit_events" + conditions + " order by audit_event_id desc"
+
+	return streamRows(ctx, m.DB, query, args, func(rows *sql.Rows) error {
+		var event AuditEvent
+		if err := rows.Scan(event.scanFields()...); err != nil {
+			return err
+		}
+		return fn(&event)
+	})
+}
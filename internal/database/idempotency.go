@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type IdempotencyKeyModel struct {
+	DB *sql.DB
+}
+
+// IdempotencyKey is a client supplied key for a POST request together with
+// the response that was sent for it. Response_Status is zero while the first
+// request is still being handled.
+type IdempotencyKey struct {
+	User_Id          int
+	Key              string
+	Fingerprint      string
+	Response_Status  int
+	Response_Headers map[string]string
+	Response_Body    []byte
+	Expires_At       time.Time
+}
+
+// ReserveIdempotencyKey claims the key for a new request. It returns false if
+// the user already has a live request or response under this key. An expired
+// key is taken over as if it never existed.
+func (m *IdempotencyKeyModel) ReserveIdempotencyKey(key *IdempotencyKey) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into idempotency_keys (idempotency_user_id, idempotency_key, idempotency_fingerprint, idempotency_expires_at)
+		values ($1, $2, $3, $4)
+		on conflict (idempotency_user_id, idempotency_key) do update set
+			idempotency_fingerprint = excluded.idempotency_fingerprint,
+			idempotency_response_status = null,
+			idempotency_response_headers = null,
+			idempotency_response_body = null,
+			idempotency_created_at = now(),
+			idempotency_expires_at = excluded.idempotency_expires_at
+		where idempotency_keys.idempotency_expires_at < now()
+		returning idempotency_user_id`
+
+	var userId int
+	err := m.DB.QueryRowContext(ctx, query, key.User_Id, key.Key, key.Fingerprint, key.Expires_At).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *IdempotencyKeyModel) GetIdempotencyKey(userId int, key string) (*IdempotencyKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select idempotency_user_id, idempotency_key, idempotency_fingerprint, coalesce(idempotency_response_status, 0),
+		idempotency_response_headers, idempotency_response_body, idempotency_expires_at
+		from idempotency_keys where idempotency_user_id = $1 and idempotency_key = $2`
+
+	var idempotencyKey IdempotencyKey
+	var headers []byte
+
+	err := m.DB.QueryRowContext(ctx, query, userId, key).Scan(&idempotencyKey.User_Id, &idempotencyKey.Key,
+		&idempotencyKey.Fingerprint, &idempotencyKey.Response_Status, &headers, &idempotencyKey.Response_Body,
+		&idempotencyKey.Expires_At)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if headers != nil {
+		if err := json.Unmarshal(headers, &idempotencyKey.Response_Headers); err != nil {
+			return nil, err
+		}
+	}
+	return &idempotencyKey, nil
+}
+
+// SaveIdempotencyResponse records the response so later retries can replay it.
+func (m *IdempotencyKeyModel) SaveIdempotencyResponse(key *IdempotencyKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	headers, err := json.Marshal(key.Response_Headers)
+	if err != nil {
+		return err
+	}
+
+	query := `update idempotency_keys set idempotency_response_status = $1, idempotency_response_headers = $2, idempotency_response_body = $3
+		where idempotency_user_id = $4 and idempotency_key = $5`
+
+	_, err = m.DB.ExecContext(ctx, query, key.Response_Status, headers, key.Response_Body, key.User_Id, key.Key)
+	return err
+}
+
+func (m *IdempotencyKeyModel) DeleteIdempotencyKey(userId int, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from idempotency_keys where idempotency_user_id = $1 and idempotency_key = $2"
+
+	_, err := m.DB.ExecContext(ctx, query, userId, key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes keys past their expiry and returns how
+// many were removed.
+func (m *IdempotencyKeyModel) DeleteExpiredIdempotencyKeys() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	query := "delete from idempotency_keys where idempotency_expires_at < now()"
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,410 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/isbn"
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+// Import job statuses.
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportSucceeded = "succeeded"
+	ImportFailed    = "failed"
+)
+
+// What happened to a row of an import, or would have on a dry run.
+const (
+	ImportRowCreated   = "created"
+	ImportRowUpdated   = "updated"
+	ImportRowUnchanged = "unchanged"
+	ImportRowFailed    = "failed"
+)
+
+// ImportJob is a bulk catalog import. The counters track its progress
+// through the rows of Data, the uploaded file.
+type ImportJob struct {
+	Id          int        `json:"id"`
+	User_Id     int        `json:"user_id,omitempty"`
+	Format      string     `json:"format"`
+	Filename    string     `json:"filename,omitempty"`
+	Dry_Run     bool       `json:"dry_run"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Created     int        `json:"created"`
+	Updated     int        `json:"updated"`
+	Unchanged   int        `json:"unchanged"`
+	Failed      int        `json:"failed"`
+	Error       string     `json:"error,omitempty"`
+	Created_At  time.Time  `json:"created_at"`
+	Started_At  *time.Time `json:"started_at,omitempty"`
+	Finished_At *time.Time `json:"finished_at,omitempty"`
+	Data        []byte     `json:"-"`
+}
+
+// ImportRow is the outcome of one row of an import. Changes names the book
+// fields that were, or on a dry run would be, changed.
+type ImportRow struct {
+	Number  int      `json:"row"`
+	Isbn    string   `json:"isbn,omitempty"`
+	Book_Id int      `json:"book_id,omitempty"`
+	Action  string   `json:"action"`
+	Changes []string `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+const importJobColumns = `import_job_id, coalesce(import_job_user_id, 0), import_job_format, import_job_filename, import_job_dry_run, import_job_status,
+	import_job_total, import_job_processed, import_job_created, import_job_updated, import_job_unchanged, import_job_failed, import_job_error,
+	import_job_created_at, import_job_started_at, import_job_finished_at`
+
+func (job *ImportJob) scanFields() []any {
+	return []any{&job.Id, &job.User_Id, &job.Format, &job.Filename, &job.Dry_Run, &job.Status,
+		&job.Total, &job.Processed, &job.Created, &job.Updated, &job.Unchanged, &job.Failed, &job.Error,
+		&job.Created_At, &job.Started_At, &job.Finished_At}
+}
+
+// CreateImportJob queues the job to be picked up by ClaimImportJob.
+func (m *ImportJobModel) CreateImportJob(job *ImportJob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `insert into import_jobs (import_job_user_id, import_job_format, import_job_filename, import_job_dry_run, import_job_data)
+		values ($1, $2, $3, $4, $5) returning import_job_id, import_job_status, import_job_created_at`
+
+	return m.DB.QueryRowContext(ctx, query, nullInt(job.User_Id), job.Format, job.Filename, job.Dry_Run, job.Data).Scan(&job.Id, &job.Status, &job.Created_At)
+}
+
+func (m *ImportJobModel) GetImportJob(id int) (*ImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + importJobColumns + " from import_jobs where import_job_id = $1"
+
+	var job ImportJob
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(job.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetImportJobs returns a page of import jobs, newest first.
+func (m *ImportJobModel) GetImportJobs(limit int, page int) ([]*ImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, offset := pageBounds(limit, page)
+
+	query := "select " + importJobColumns + " from import_jobs order by import_job_id desc limit $1 offset $2"
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	jobs := []*ImportJob{}
+
+	for rows.Next() {
+		var job ImportJob
+
+		if err := rows.Scan(job.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ClaimImportJob marks the oldest queued job, or the job with the given id if
+// it is not 0, as running and returns it with its file. A job named by id is
+// claimed again if it is running or failed, so an import whose worker crashed
+// or gave up can carry on; its counters still match the rows recorded so far.
+// It returns nil if there is no such unfinished job. Workers never claim the
+// same job.
+func (m *ImportJobModel) ClaimImportJob(id int) (*ImportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `update import_jobs set import_job_status = $1, import_job_error = '', import_job_started_at = now(), import_job_finished_at = null
+		where import_job_id = (
+			select import_job_id from import_jobs
+			where (import_job_status = $2 and $3 = 0) or (import_job_status in ($1, $2, $4) and import_job_id = $3)
+			order by import_job_id limit 1 for update skip locked
+		) returning ` + importJobColumns + `, import_job_data`
+
+	var job ImportJob
+
+	err := m.DB.QueryRowContext(ctx, query, ImportRunning, ImportQueued, id, ImportFailed).Scan(append(job.scanFields(), &job.Data)...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RecordImportRows stores the outcomes of a batch of rows together with the
+// job's counters, so the progress never runs ahead of the report.
+func (m *ImportJobModel) RecordImportRows(job *ImportJob, rows []ImportRow) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		query := `insert into import_job_rows (import_job_row_job_id, import_job_row_number, import_job_row_isbn, import_job_row_book_id,
+			import_job_row_action, import_job_row_changes, import_job_row_error) values ($1, $2, $3, $4, $5, $6, $7)
+			on conflict (import_job_row_job_id, import_job_row_number) do update set import_job_row_isbn = excluded.import_job_row_isbn,
+			import_job_row_book_id = excluded.import_job_row_book_id, import_job_row_action = excluded.import_job_row_action,
+			import_job_row_changes = excluded.import_job_row_changes, import_job_row_error = excluded.import_job_row_error`
+		_, err := tx.ExecContext(ctx, query, job.Id, row.Number, row.Isbn, nullInt(row.Book_Id), row.Action, strings.Join(row.Changes, ","), row.Error)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := updateImportCounters(ctx, tx, job); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FinishImportJob stores the job's final status, error and counters.
+func (m *ImportJobModel) FinishImportJob(job *ImportJob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateImportCounters(ctx, tx, job); err != nil {
+		return err
+	}
+
+	query := "update import_jobs set import_job_status = $1, import_job_error = $2, import_job_finished_at = now() where import_job_id = $3 returning import_job_finished_at"
+	if err := tx.QueryRowContext(ctx, query, job.Status, job.Error, job.Id).Scan(&job.Finished_At); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateImportCounters(ctx context.Context, tx *sql.Tx, job *ImportJob) error {
+	query := `update import_jobs set import_job_total = $1, import_job_processed = $2, import_job_created = $3, import_job_updated = $4,
+		import_job_unchanged = $5, import_job_failed = $6 where import_job_id = $7`
+	_, err := tx.ExecContext(ctx, query, job.Total, job.Processed, job.Created, job.Updated, job.Unchanged, job.Failed, job.Id)
+	return err
+}
+
+// GetImportRows returns the outcomes of the job's rows in file order,
+// optionally only those with the given action.
+func (m *ImportJobModel) GetImportRows(jobId int, action string) ([]ImportRow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `select import_job_row_number, import_job_row_isbn, coalesce(import_job_row_book_id, 0), import_job_row_action, import_job_row_changes, import_job_row_error
+		from import_job_rows where import_job_row_job_id = $1 and ($2 = '' or import_job_row_action = $2) order by import_job_row_number`
+
+	rows, err := m.DB.QueryContext(ctx, query, jobId, action)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := []ImportRow{}
+
+	for rows.Next() {
+		var row ImportRow
+		var changes string
+
+		if err := rows.Scan(&row.Number, &row.Isbn, &row.Book_Id, &row.Action, &changes, &row.Error); err != nil {
+			return nil, err
+		}
+
+		if changes != "" {
+			row.Changes = strings.Split(changes, ",")
+		}
+		result = append(result, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// BookUpsert is a book to add, or to update if a book with its ISBN-13
+// exists. Nil fields are left as they are on an existing book and get their
+// defaults on a new one. Publisher names the publisher, which is added if
+// there is none by that name.
+type BookUpsert struct {
+	Isbn_13      string
+	Title        string
+	Author       string
+	Price        money.Money
+	Stock        *int
+	Tax_Category *string
+	Weight_Grams *int
+	Publisher    *string
+}
+
+// ErrBookDeleted is returned when upserting a book whose ISBN only belongs to
+// a soft deleted book, which has to be restored first.
+var ErrBookDeleted = errors.New("a deleted book has this ISBN")
+
+// UpsertBookByIsbn adds the book or updates the one with the same ISBN-13. It
+// returns the ImportRow action taken, the book's id and the book fields that
+// changed. With dryRun everything is rolled back, so the result is what would
+// have happened and a new book has no id. earlier are the upserts of the same
+// ISBN that came before u in a dry run; they are made first, so u is compared
+// with the book they would have left.
+func (m *BookModel) UpsertBookByIsbn(u *BookUpsert, dryRun bool, earlier ...*BookUpsert) (string, int, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	defer tx.Rollback()
+
+	created := false
+	for _, e := range earlier {
+		action, _, _, err := upsertBookByIsbn(ctx, tx, e)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		created = created || action == ImportRowCreated
+	}
+
+	action, id, changed, err := upsertBookByIsbn(ctx, tx, u)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	if dryRun {
+		if created || action == ImportRowCreated {
+			id = 0
+		}
+		return action, id, changed, nil
+	}
+	return action, id, changed, tx.Commit()
+}
+
+// upsertBookByIsbn does the work of UpsertBookByIsbn in tx.
+func upsertBookByIsbn(ctx context.Context, tx *sql.Tx, u *BookUpsert) (string, int, []string, error) {
+	var existing Book
+	var deleted bool
+	// a deleted book may share the ISBN of the live one
+	query := "select " + bookColumns + `, book_deleted_at is not null from books where book_isbn_13 = $1
+		order by book_deleted_at is not null, book_deleted_at desc limit 1 for update`
+	err := tx.QueryRowContext(ctx, query, u.Isbn_13).Scan(append(existing.scanFields(), &deleted)...)
+	if err != nil && err != sql.ErrNoRows {
+		return "", 0, nil, err
+	}
+	found := err == nil
+	if deleted {
+		return "", existing.Id, nil, ErrBookDeleted
+	}
+
+	book := existing
+	book.Isbn_13 = u.Isbn_13
+	book.Isbn_10, _ = isbn.To10(u.Isbn_13)
+	book.Title = u.Title
+	book.Author = u.Author
+	book.Price = u.Price
+	if u.Stock != nil {
+		book.Stock = *u.Stock
+	}
+	if u.Tax_Category != nil {
+		book.Tax_Category = *u.Tax_Category
+	}
+	if u.Weight_Grams != nil {
+		book.Weight_Grams = *u.Weight_Grams
+	}
+	if u.Publisher != nil {
+		book.Publisher_Id = 0
+		if *u.Publisher != "" {
+			if book.Publisher_Id, err = publisherNamed(ctx, tx, *u.Publisher); err != nil {
+				return "", 0, nil, err
+			}
+		}
+	}
+
+	action := ImportRowUnchanged
+	var changed []string
+
+	if !found {
+		action = ImportRowCreated
+		if err := insertBook(ctx, tx, &book); err != nil {
+			return "", 0, nil, err
+		}
+	} else if changes := bookChanges(&existing, &book); len(changes) > 0 {
+		action = ImportRowUpdated
+		for _, change := range changes {
+			changed = append(changed, strings.TrimPrefix(change.column, "book_"))
+		}
+		if _, err := updateColumns(ctx, tx, "books", "book_id", "book_version", existing.Id, existing.Version, changes); err != nil {
+			return "", 0, nil, err
+		}
+		if book.Author != existing.Author {
+			if err := linkBylineAuthor(ctx, tx, existing.Id, book.Author); err != nil {
+				return "", 0, nil, err
+			}
+		}
+		if err := recordPriceChange(ctx, tx, existing.Id, existing.Price, book.Price); err != nil {
+			return "", 0, nil, err
+		}
+	}
+
+	return action, book.Id, changed, nil
+}
+
+// publisherNamed returns the id of the publisher called name, adding it if
+// there is none.
+func publisherNamed(ctx context.Context, tx *sql.Tx, name string) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx, "select publisher_id from publishers where publisher_name = $1", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRowContext(ctx, "insert into publishers (publisher_name) values ($1) returning publisher_id", name).Scan(&id)
+	}
+	return id, err
+}
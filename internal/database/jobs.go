@@ -0,0 +1,354 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type JobModel struct {
+	DB *sql.DB
+}
+
+// Job statuses. A job that failed but will be retried is queued again with a
+// later Run_At; one that ran out of attempts is dead.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobCancelled = "cancelled"
+	JobDead      = "dead"
+)
+
+var (
+	// ErrJobExists is returned when queueing a job whose unique key is taken.
+	ErrJobExists = errors.New("a job with this unique key exists")
+	// ErrJobLost is returned when a worker updates a job it no longer holds,
+	// because its lease ran out and the job was recovered.
+	ErrJobLost = errors.New("the job is no longer held by this worker")
+)
+
+// Job is a unit of background work. Payload and Result are JSON whose shape
+// depends on the Type.
+type Job struct {
+	Id               int64           `json:"id"`
+	Type             string          `json:"type"`
+	Payload          json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+	Status           string          `json:"status"`
+	Attempts         int             `json:"attempts"`
+	Max_Attempts     int             `json:"max_attempts"`
+	Run_At           time.Time       `json:"run_at"`
+	Cancel_Requested bool            `json:"cancel_requested,omitempty"`
+	Progress         int             `json:"progress"`
+	Progress_Message string          `json:"progress_message,omitempty"`
+	Result           json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	Error            string          `json:"error,omitempty"`
+	Created_By       int             `json:"created_by,omitempty"`
+	Created_At       time.Time       `json:"created_at"`
+	Started_At       *time.Time      `json:"started_at,omitempty"`
+	Finished_At      *time.Time      `json:"finished_at,omitempty"`
+	Unique_Key       string          `json:"-"`
+}
+
+const jobColumns = `job_id, job_type, job_payload, job_status, job_attempts, job_max_attempts, job_run_at, job_cancel_requested,
+	job_progress, job_progress_message, job_result, job_error, coalesce(job_created_by, 0), job_created_at, job_started_at, job_finished_at`
+
+func (job *Job) scanFields() []any {
+	return []any{&job.Id, &job.Type, (*[]byte)(&job.Payload), &job.Status, &job.Attempts, &job.Max_Attempts, &job.Run_At, &job.Cancel_Requested,
+		&job.Progress, &job.Progress_Message, (*[]byte)(&job.Result), &job.Error, &job.Created_By, &job.Created_At, &job.Started_At, &job.Finished_At}
+}
+
+// JobFilter selects jobs. Zero values match everything.
+type JobFilter struct {
+	Type   string
+	Status string
+	Limit  int
+	Page   int
+}
+
+// CreateJob queues the job to run at its Run_At, or now if that is zero. It
+// returns ErrJobExists if the job has a Unique_Key that another job has.
+func (m *JobModel) CreateJob(job *Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	payload := []byte(job.Payload)
+	if len(payload) == 0 {
+		payload = []byte("null")
+	}
+	var runAt any
+	if !job.Run_At.IsZero() {
+		runAt = job.Run_At
+	}
+
+	query := `insert into jobs (job_type, job_payload, job_unique_key, job_max_attempts, job_run_at, job_created_by)
+		values ($1, $2, $3, $4, coalesce($5, now()), $6)
+		on conflict (job_unique_key) do nothing
+		returning ` + jobColumns
+
+	err := m.DB.QueryRowContext(ctx, query, job.Type, payload, nullString(job.Unique_Key), job.Max_Attempts, runAt, nullInt(job.Created_By)).Scan(job.scanFields()...)
+	if err == sql.ErrNoRows {
+		return ErrJobExists
+	}
+	return err
+}
+
+func (m *JobModel) GetJob(id int64) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + jobColumns + " from jobs where job_id = $1"
+
+	var job Job
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(job.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJobs returns a page of the jobs matching the filter, newest first.
+func (m *JobModel) GetJobs(filter JobFilter) ([]*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, offset := pageBounds(filter.Limit, filter.Page)
+
+	var args []any
+	query := "select " + jobColumns + " from jobs where true"
+
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		query += fmt.Sprintf(" and job_type = $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" and job_status = $%d", len(args))
+	}
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" order by job_id desc limit $%d offset $%d", len(args)-1, len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	jobs := []*Job{}
+
+	for rows.Next() {
+		var job Job
+
+		if err := rows.Scan(job.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ClaimJob marks the queued job of one of the types that is due first as
+// running, held by worker for the lease, and returns it. It returns nil if no
+// job is due. Workers never claim the same job.
+func (m *JobModel) ClaimJob(types []string, worker string, lease time.Duration) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update jobs set job_status = $1, job_attempts = job_attempts + 1, job_locked_by = $2,
+			job_locked_until = now() + $3 * interval '1 millisecond', job_started_at = coalesce(job_started_at, now())
+		where job_id = (
+			select job_id from jobs where job_status = $4 and job_run_at <= now() and job_type = any($5)
+			order by job_run_at, job_id limit 1 for update skip locked
+		) returning ` + jobColumns
+
+	var job Job
+
+	err := m.DB.QueryRowContext(ctx, query, JobRunning, worker, lease.Milliseconds(), JobQueued, pq.Array(types)).Scan(job.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// HeartbeatJob extends the worker's lease on a running job and reports
+// whether cancelling it was requested. It returns ErrJobLost if the worker no
+// longer holds the job.
+func (m *JobModel) HeartbeatJob(id int64, worker string, lease time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update jobs set job_locked_until = now() + $1 * interval '1 millisecond'
+		where job_id = $2 and job_status = $3 and job_locked_by = $4 returning job_cancel_requested`
+
+	var cancelRequested bool
+	err := m.DB.QueryRowContext(ctx, query, lease.Milliseconds(), id, JobRunning, worker).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, ErrJobLost
+	}
+	return cancelRequested, err
+}
+
+// SetJobProgress records how far along a running job is, as a percentage.
+func (m *JobModel) SetJobProgress(id int64, worker string, progress int, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update jobs set job_progress = $1, job_progress_message = $2
+		where job_id = $3 and job_status = $4 and job_locked_by = $5`
+
+	result, err := m.DB.ExecContext(ctx, query, min(max(progress, 0), 100), message, id, JobRunning, worker)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return ErrJobLost
+	}
+	return nil
+}
+
+// FinishJob ends a running job held by the worker with a final status, and
+// with its result or error.
+func (m *JobModel) FinishJob(id int64, worker string, status string, result json.RawMessage, jobErr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var resultArg any
+	if len(result) > 0 {
+		resultArg = []byte(result)
+	}
+
+	query := `update jobs set job_status = $1, job_result = $2, job_error = $3, job_finished_at = now(),
+			job_progress = case when $1 = 'succeeded' then 100 else job_progress end,
+			job_locked_by = null, job_locked_until = null
+		where job_id = $4 and job_status = $5 and job_locked_by = $6`
+
+	return lostIfUnaffected(m.DB.ExecContext(ctx, query, status, resultArg, jobErr, id, JobRunning, worker))
+}
+
+// RetryJob queues a running job held by the worker to run again at runAt,
+// recording why this attempt failed.
+func (m *JobModel) RetryJob(id int64, worker string, runAt time.Time, jobErr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update jobs set job_status = $1, job_run_at = $2, job_error = $3, job_locked_by = null, job_locked_until = null
+		where job_id = $4 and job_status = $5 and job_locked_by = $6`
+
+	return lostIfUnaffected(m.DB.ExecContext(ctx, query, JobQueued, runAt, jobErr, id, JobRunning, worker))
+}
+
+// ReleaseJob queues a running job held by the worker again without counting
+// the attempt, for when the worker stops before the job could finish.
+func (m *JobModel) ReleaseJob(id int64, worker string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update jobs set job_status = $1, job_attempts = job_attempts - 1, job_locked_by = null, job_locked_until = null
+		where job_id = $2 and job_status = $3 and job_locked_by = $4`
+
+	return lostIfUnaffected(m.DB.ExecContext(ctx, query, JobQueued, id, JobRunning, worker))
+}
+
+func lostIfUnaffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return ErrJobLost
+	}
+	return nil
+}
+
+// RecoverJobs requeues running jobs whose lease ran out because their worker
+// crashed or lost its connection. Jobs that were asked to cancel are
+// cancelled and jobs out of attempts are dead. It returns how many jobs were
+// recovered.
+func (m *JobModel) RecoverJobs() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `update jobs set
+			job_status = case when job_cancel_requested then $1 when job_attempts >= job_max_attempts then $2 else $3 end,
+			job_finished_at = case when job_cancel_requested or job_attempts >= job_max_attempts then now() end,
+			job_error = 'the worker running the job stopped responding',
+			job_run_at = now(), job_locked_by = null, job_locked_until = null
+		where job_status = $4 and job_locked_until < now()`
+
+	result, err := m.DB.ExecContext(ctx, query, JobCancelled, JobDead, JobQueued, JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CancelJob cancels a queued job at once and asks the worker running a
+// running job to stop. It returns the updated job, or nil if the job has
+// already finished.
+func (m *JobModel) CancelJob(id int64) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update jobs set
+			job_status = case when job_status = $1 then $2 else job_status end,
+			job_finished_at = case when job_status = $1 then now() end,
+			job_cancel_requested = true
+		where job_id = $3 and job_status in ($1, $4) returning ` + jobColumns
+
+	var job Job
+
+	err := m.DB.QueryRowContext(ctx, query, JobQueued, JobCancelled, id, JobRunning).Scan(job.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RequeueJob gives a dead or cancelled job a fresh set of attempts and queues
+// it to run now. It returns nil if the job is not dead or cancelled.
+func (m *JobModel) RequeueJob(id int64) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update jobs set job_status = $1, job_attempts = 0, job_run_at = now(), job_cancel_requested = false,
+			job_progress = 0, job_progress_message = '', job_error = '', job_finished_at = null
+		where job_id = $2 and job_status in ($3, $4) returning ` + jobColumns
+
+	var job Job
+
+	err := m.DB.QueryRowContext(ctx, query, JobQueued, id, JobDead, JobCancelled).Scan(job.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
@@ -6,6 +6,29 @@ type Models struct {
 	Users  UserModel
 	Orders OrderModel
 	Books  BookModel
+	Carts  CartModel
+
+	Authors    AuthorModel
+	Publishers PublisherModel
+	Categories CategoryModel
+	ImportJobs ImportJobModel
+
+	Addresses AddressModel
+
+	ExchangeRates ExchangeRateModel
+	TaxRates      TaxRateModel
+	Promotions    PromotionModel
+
+	Payments    PaymentModel
+	Returns     ReturnModel
+	Shipments   ShipmentModel
+	OrderEvents OrderEventModel
+
+	AuditEvents     AuditEventModel
+	IdempotencyKeys IdempotencyKeyModel
+	Jobs            JobModel
+	Outbox          OutboxModel
+	Webhooks        WebhookModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -13,5 +36,28 @@ func NewModels(db *sql.DB) Models {
 		Users:  UserModel{DB: db},
 		Orders: OrderModel{DB: db},
 		Books:  BookModel{DB: db},
+		Carts:  CartModel{DB: db},
+
+		Authors:    AuthorModel{DB: db},
+		Publishers: PublisherModel{DB: db},
+		Categories: CategoryModel{DB: db},
+		ImportJobs: ImportJobModel{DB: db},
+
+		Addresses: AddressModel{DB: db},
+
+		ExchangeRates: ExchangeRateModel{DB: db},
+		TaxRates:      TaxRateModel{DB: db},
+		Promotions:    PromotionModel{DB: db},
+
+		Payments:    PaymentModel{DB: db},
+		Returns:     ReturnModel{DB: db},
+		Shipments:   ShipmentModel{DB: db},
+		OrderEvents: OrderEventModel{DB: db},
+
+		AuditEvents:     AuditEventModel{DB: db},
+		IdempotencyKeys: IdempotencyKeyModel{DB: db},
+		Jobs:            JobModel{DB: db},
+		Outbox:          OutboxModel{DB: db},
+		Webhooks:        WebhookModel{DB: db},
 	}
 }
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Order event types shown in an order's history.
+const (
+	OrderEventCreated         = "order_created"
+	OrderEventPaymentCaptured = "payment_captured"
+	OrderEventPaymentDeclined = "payment_declined"
+	OrderEventPaymentFailed   = "payment_failed"
+	OrderEventPaid            = "order_paid"
+	OrderEventRefundIssued    = "refund_issued"
+	OrderEventRefunded        = "order_refunded"
+	OrderEventReturnRequested = "return_requested"
+	OrderEventReturnApproved  = "return_approved"
+	OrderEventReturnRejected  = "return_rejected"
+	OrderEventReturnReceived  = "return_received"
+	OrderEventReturnRefunded  = "return_refunded"
+	OrderEventShipmentCreated = "shipment_created"
+	OrderEventShipmentUpdated = "shipment_updated"
+	OrderEventShipped         = "order_shipped"
+	OrderEventDelivered       = "order_delivered"
+)
+
+type OrderEventModel struct {
+	DB *sql.DB
+}
+
+// OrderEvent is one entry in an order's history. Actor_Id is the user who
+// caused it, or 0 for events from the system or the payment provider.
+type OrderEvent struct {
+	Id         int       `json:"id"`
+	Order_Id   int       `json:"order_id"`
+	Type       string    `json:"type"`
+	Detail     string    `json:"detail,omitempty"`
+	Actor_Id   int       `json:"actor_id,omitempty"`
+	Created_At time.Time `json:"created_at"`
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx so events can be written
+// inside the transaction of the change they describe.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertOrderEvent(ctx context.Context, db execer, event *OrderEvent) error {
+	query := "insert into order_events (order_event_order_id, order_event_type, order_event_detail, order_event_actor_id) values ($1, $2, $3, $4)"
+
+	actor := sql.NullInt64{Int64: int64(event.Actor_Id), Valid: event.Actor_Id != 0}
+	_, err := db.ExecContext(ctx, query, event.Order_Id, event.Type, event.Detail, actor)
+	return err
+}
+
+func (m *OrderEventModel) CreateOrderEvent(event *OrderEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertOrderEvent(ctx, m.DB, event)
+}
+
+// GetOrderEvents returns the history of the order, oldest first.
+func (m *OrderEventModel) GetOrderEvents(orderId int) ([]*OrderEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select order_event_id, order_event_order_id, order_event_type, order_event_detail, coalesce(order_event_actor_id, 0), order_event_created_at
+		from order_events where order_event_order_id = $1 order by order_event_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []*OrderEvent{}
+
+	for rows.Next() {
+		var event OrderEvent
+
+		err := rows.Scan(&event.Id, &event.Order_Id, &event.Type, &event.Detail, &event.Actor_Id, &event.Created_At)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -3,55 +3,271 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/promotion"
+	"github.com/hamorrar/bookstore/internal/tax"
+	"github.com/lib/pq"
 )
 
 type OrderModel struct {
 	DB *sql.DB
 }
 
+// Order statuses set by the API itself. Customers can cancel their pending
+// orders; every other status follows from payments, shipments and refunds.
+const (
+	OrderPending          = "Pending"
+	OrderPaid             = "Paid"
+	OrderPartiallyShipped = "Partially Shipped"
+	OrderShipped          = "Shipped"
+	OrderDelivered        = "Delivered"
+	OrderRefunded         = "Refunded"
+	OrderCancelled        = "Cancelled"
+)
+
+// Order is a customer's order. Exchange_Rate is set when the prices were
+// converted from Exchange_Rate_From into the order's currency and records the
+// rate used, so the total never changes with later rates. Orders taxed at
+// checkout have a Tax_Region and a Tax_Total, which is included in
+// Total_Price, and Tax_Lines when loaded. Orders placed with promotion codes
+// have a Discount_Total, which is taken off Total_Price before tax, and
+// Discounts when loaded. Shipping_Address and Billing_Address are copies of
+// the addresses chosen when the order was placed and Shipping_Total, which is
+// included in Total_Price, is what shipping cost. None of these can be set by
+// clients. Created_At is only loaded when a customer lists their orders.
 type Order struct {
-	Id          int    `json:"id"`
-	User_Id     int    `json:"user_id" binding:"required"`
-	Status      string `json:"status" binding:"required"`
-	Total_Price int    `json:"total_price" binding:"required"`
+	Id                 int                  `json:"id"`
+	User_Id            int                  `json:"user_id" binding:"required"`
+	Status             string               `json:"status" binding:"required"`
+	Total_Price        money.Money          `json:"total_price"`
+	Exchange_Rate_From string               `json:"exchange_rate_from,omitempty"`
+	Exchange_Rate      string               `json:"exchange_rate,omitempty"`
+	Tax_Region         string               `json:"tax_region,omitempty"`
+	Tax_Total          money.Money          `json:"tax_total,omitzero"`
+	Tax_Lines          []tax.LineTax        `json:"tax_lines,omitempty"`
+	Discount_Total     money.Money          `json:"discount_total,omitzero"`
+	Discounts          []promotion.Discount `json:"discounts,omitempty"`
+	Free_Shipping      bool                 `json:"free_shipping,omitempty"`
+	Shipping_Address   *Address             `json:"shipping_address,omitempty"`
+	Billing_Address    *Address             `json:"billing_address,omitempty"`
+	Shipping_Total     money.Money          `json:"shipping_total,omitzero"`
+	Created_At         time.Time            `json:"created_at,omitzero"`
+	Version            int                  `json:"-"`
+}
+
+// KeepComputedFields copies the fields that are worked out by the API rather
+// than set by clients from existing to order.
+func (order *Order) KeepComputedFields(existing *Order) {
+	order.Exchange_Rate_From, order.Exchange_Rate = existing.Exchange_Rate_From, existing.Exchange_Rate
+	order.Tax_Region, order.Tax_Total, order.Tax_Lines = existing.Tax_Region, existing.Tax_Total, existing.Tax_Lines
+	order.Discount_Total, order.Discounts, order.Free_Shipping = existing.Discount_Total, existing.Discounts, existing.Free_Shipping
+	order.Shipping_Address, order.Billing_Address, order.Shipping_Total = existing.Shipping_Address, existing.Billing_Address, existing.Shipping_Total
+}
+
+// OrderItem is a book bought in an order at the price paid for it. Total is
+// what was paid for the line after discounts and Tax the tax charged on it.
+type OrderItem struct {
+	Book_Id    int         `json:"book_id"`
+	Quantity   int         `json:"quantity"`
+	Unit_Price money.Money `json:"unit_price"`
+	Total      money.Money `json:"total"`
+	Tax        money.Money `json:"tax"`
 }
 
-func (m *OrderModel) CreateOrder(order *Order) error {
+const orderColumns = `order_id, order_user_id, order_status, order_total_price, order_currency,
+	coalesce(order_exchange_rate_from, ''), coalesce(order_exchange_rate::text, ''), coalesce(order_tax_region, ''),
+	coalesce(order_tax_total, 0), case when order_tax_total is null then '' else order_currency end,
+	coalesce(order_discount_total, 0), case when order_discount_total is null then '' else order_currency end, order_free_shipping,
+	order_shipping_address, order_billing_address,
+	coalesce(order_shipping_total, 0), case when order_shipping_total is null then '' else order_currency end, order_version`
+
+func (order *Order) scanFields() []any {
+	return []any{&order.Id, &order.User_Id, &order.Status, &order.Total_Price.Amount, &order.Total_Price.Currency,
+		&order.Exchange_Rate_From, &order.Exchange_Rate, &order.Tax_Region, &order.Tax_Total.Amount, &order.Tax_Total.Currency,
+		&order.Discount_Total.Amount, &order.Discount_Total.Currency, &order.Free_Shipping,
+		&order.Shipping_Address, &order.Billing_Address, &order.Shipping_Total.Amount, &order.Shipping_Total.Currency, &order.Version}
+}
+
+// CreateOrder writes a new order. Promotion codes are applied to its total
+// first, with the same limits and stacking as at checkout.
+func (m *OrderModel) CreateOrder(order *Order, codes []string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "insert into orders (order_user_id, order_status, order_total_price) values ($1, $2, $3) returning order_id"
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(codes) > 0 {
+		lines := []promotion.Line{{Quantity: 1, Unit_Price: order.Total_Price}}
+		result, err := applyPromotions(ctx, tx, codes, order.User_Id, lines, time.Now())
+		if err != nil {
+			return err
+		}
+		order.setDiscounts(result)
+		order.Total_Price = result.Total
+	}
+
+	if err := insertOrder(ctx, tx, order); err != nil {
+		return err
+	}
+	if err := insertOrderDiscounts(ctx, tx, order); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
-	err := m.DB.QueryRowContext(ctx, query, order.User_Id, order.Status, order.Total_Price).Scan(&order.Id)
+// insertOrder adds the order and records an OrderCreated event.
+func insertOrder(ctx context.Context, tx *sql.Tx, order *Order) error {
+	query := `insert into orders (order_user_id, order_status, order_total_price, order_currency, order_exchange_rate_from, order_exchange_rate,
+			order_tax_region, order_tax_total, order_discount_total, order_free_shipping, order_shipping_address, order_billing_address,
+			order_shipping_total)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) returning order_id, order_version`
+
+	taxTotal := sql.NullInt64{Int64: order.Tax_Total.Amount, Valid: order.Tax_Region != ""}
+	discountTotal := sql.NullInt64{Int64: order.Discount_Total.Amount, Valid: len(order.Discounts) > 0}
+	shippingTotal := sql.NullInt64{Int64: order.Shipping_Total.Amount, Valid: order.Shipping_Total.Currency != ""}
+	err := tx.QueryRowContext(ctx, query, order.User_Id, order.Status, order.Total_Price.Amount, order.Total_Price.Currency,
+		nullString(order.Exchange_Rate_From), nullString(order.Exchange_Rate), nullString(order.Tax_Region), taxTotal,
+		discountTotal, order.Free_Shipping, order.Shipping_Address, order.Billing_Address, shippingTotal).Scan(&order.Id, &order.Version)
 	if err != nil {
 		return err
 	}
+
+	return recordEvent(ctx, tx, OrderCreated{Order_Id: order.Id, User_Id: order.User_Id, Status: order.Status, Total_Price: order.Total_Price})
+}
+
+func insertOrderTaxLines(ctx context.Context, db execer, orderId int, lines []tax.LineTax) error {
+	query := `insert into order_tax_lines (order_tax_line_order_id, order_tax_line_book_id, order_tax_line_rule_id, order_tax_line_name,
+			order_tax_line_region, order_tax_line_category, order_tax_line_rate, order_tax_line_taxable_amount, order_tax_line_tax_amount)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	for _, line := range lines {
+		ruleId := sql.NullInt64{Int64: line.Rule_Id, Valid: line.Rule_Id != 0}
+		if _, err := db.ExecContext(ctx, query, orderId, line.Book_Id, ruleId, line.Name, line.Region, line.Category, line.Rate,
+			line.Taxable_Amount.Amount, line.Tax_Amount.Amount); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (m *OrderModel) DeleteOrder(id int) error {
+// GetOrderTaxLines returns the tax charged on each line of the order, as
+// computed at checkout.
+func (m *OrderModel) GetOrderTaxLines(orderId int) ([]tax.LineTax, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select order_tax_line_book_id, coalesce(order_tax_line_rule_id, 0), order_tax_line_name, order_tax_line_region,
+			order_tax_line_category, order_tax_line_rate::text, order_tax_line_taxable_amount, order_tax_line_tax_amount, order_currency
+		from order_tax_lines join orders on order_id = order_tax_line_order_id
+		where order_tax_line_order_id = $1 order by order_tax_line_book_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	lines := []tax.LineTax{}
+
+	for rows.Next() {
+		var line tax.LineTax
+
+		err := rows.Scan(&line.Book_Id, &line.Rule_Id, &line.Name, &line.Region, &line.Category, &line.Rate,
+			&line.Taxable_Amount.Amount, &line.Tax_Amount.Amount, &line.Tax_Amount.Currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		line.Taxable_Amount.Currency = line.Tax_Amount.Currency
+		lines = append(lines, line)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// GetOrderDiscounts returns the discounts on the order in the order they were
+// applied.
+func (m *OrderModel) GetOrderDiscounts(orderId int) ([]promotion.Discount, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "delete from orders where order_id = $1"
+	query := `select coalesce(order_discount_promotion_id, 0), order_discount_code, order_discount_type, order_discount_description,
+			coalesce(order_discount_book_id, 0), order_discount_amount, order_currency
+		from order_discounts join orders on order_id = order_discount_order_id
+		where order_discount_order_id = $1 order by order_discount_position`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderId)
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	discounts := []promotion.Discount{}
+
+	for rows.Next() {
+		var d promotion.Discount
+
+		err := rows.Scan(&d.Promotion_Id, &d.Code, &d.Type, &d.Description, &d.Book_Id, &d.Amount.Amount, &d.Amount.Currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		discounts = append(discounts, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return discounts, nil
+}
+
+// DeleteOrder soft deletes the order if it is still at the given version and
+// returns ErrEditConflict otherwise.
+func (m *OrderModel) DeleteOrder(id int, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "update orders set order_deleted_at = now(), order_version = order_version + 1 where order_id = $1 and order_version = $2 and order_deleted_at is null"
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
-	return nil
+	return checkAffected(result)
 }
 
 func (m *OrderModel) GetOrder(id int) (*Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "select * from orders where order_id = $1"
+	query := "select " + orderColumns + " from orders where order_id = $1 and order_deleted_at is null"
 
 	var order Order
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&order.Id, &order.User_Id, &order.Status, &order.Total_Price)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(order.scanFields()...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -62,6 +278,98 @@ func (m *OrderModel) GetOrder(id int) (*Order, error) {
 	return &order, nil
 }
 
+// GetOrderForUser returns the order if it belongs to the user, or nil if
+// there is no such order or it is someone else's.
+func (m *OrderModel) GetOrderForUser(id int, userId int) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + orderColumns + " from orders where order_id = $1 and order_user_id = $2 and order_deleted_at is null"
+
+	var order Order
+
+	err := m.DB.QueryRowContext(ctx, query, id, userId).Scan(order.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// OrderFilter selects orders. Zero values match everything; To is exclusive.
+type OrderFilter struct {
+	Status string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Page   int
+}
+
+// GetOrdersForUser returns a page of the user's orders matching the filter,
+// newest first, with Created_At set.
+func (m *OrderModel) GetOrdersForUser(userId int, filter OrderFilter) ([]*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	args := []any{userId}
+	query := "select " + orderColumns + ", order_created_at from orders where order_user_id = $1 and order_deleted_at is null"
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" and order_status = $%d", len(args))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		query += fmt.Sprintf(" and order_created_at >= $%d", len(args))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		query += fmt.Sprintf(" and order_created_at < $%d", len(args))
+	}
+
+	args = append(args, filter.Limit, (filter.Page-1)*filter.Limit)
+	query += fmt.Sprintf(" order by order_created_at desc, order_id desc limit $%d offset $%d", len(args)-1, len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	orders := []*Order{}
+
+	for rows.Next() {
+		var order Order
+
+		err := rows.Scan(append(order.scanFields(), &order.Created_At)...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, &order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
 func (m *OrderModel) GetPageOfOrders(limit int, page int) ([]*Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -76,7 +384,7 @@ func (m *OrderModel) GetPageOfOrders(limit int, page int) ([]*Order, error) {
 
 	offset := (page - 1) * limit
 
-	query := "select * from orders order by order_id limit $1 offset $2"
+	query := "select " + orderColumns + " from orders where order_deleted_at is null order by order_id limit $1 offset $2"
 
 	rows, err := m.DB.QueryContext(ctx, query, limit, offset)
 
@@ -91,7 +399,7 @@ func (m *OrderModel) GetPageOfOrders(limit int, page int) ([]*Order, error) {
 	for rows.Next() {
 		var order Order
 
-		err := rows.Scan(&order.Id, &order.User_Id, &order.Status, &order.Total_Price)
+		err := rows.Scan(order.scanFields()...)
 
 		if err != nil {
 			return nil, err
@@ -111,7 +419,7 @@ func (m *OrderModel) GetAllOrders() ([]*Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "select * from orders"
+	query := "select " + orderColumns + " from orders where order_deleted_at is null"
 
 	rows, err := m.DB.QueryContext(ctx, query)
 
@@ -126,7 +434,7 @@ func (m *OrderModel) GetAllOrders() ([]*Order, error) {
 	for rows.Next() {
 		var order Order
 
-		err := rows.Scan(&order.Id, &order.User_Id, &order.Status, &order.Total_Price)
+		err := rows.Scan(order.scanFields()...)
 
 		if err != nil {
 			return nil, err
@@ -142,17 +450,159 @@ func (m *OrderModel) GetAllOrders() ([]*Order, error) {
 	return orders, nil
 }
 
-func (m *OrderModel) UpdateOrder(order *Order) error {
+// RestoreOrder undeletes a soft deleted order and returns it, or nil if there
+// is no deleted order with that id.
+func (m *OrderModel) RestoreOrder(id int) (*Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "UPDATE orders SET order_user_id = $1, order_status = $2, order_total_price = $3 WHERE order_id = $4"
+	query := "update orders set order_deleted_at = null, order_version = order_version + 1 where order_id = $1 and order_deleted_at is not null returning " + orderColumns
+
+	var order Order
 
-	_, err := m.DB.ExecContext(ctx, query, order.User_Id, order.Status, order.Total_Price, order.Id)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(order.scanFields()...)
 
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
 	}
+	return &order, nil
+}
 
-	return nil
+// PurgeDeletedOrders removes orders soft deleted before the given time, along
+// with their items, payments, returns and history, and returns how many were
+// removed. Their promotion redemptions are kept, so the codes used on them
+// still count towards the codes' usage limits.
+func (m *OrderModel) PurgeDeletedOrders(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from orders where order_deleted_at < $1"
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CancelOrder cancels the order if it is still pending and at version, and
+// puts its books back in stock. It returns the new version, or
+// ErrEditConflict if the order has moved on.
+func (m *OrderModel) CancelOrder(id int, version int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userId int
+	query := `select order_user_id from orders
+		where order_id = $1 and order_version = $2 and order_status = $3 and order_deleted_at is null for update`
+	if err := tx.QueryRowContext(ctx, query, id, version, OrderPending).Scan(&userId); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrEditConflict
+		}
+		return 0, err
+	}
+
+	query = "update orders set order_status = $1, order_version = order_version + 1 where order_id = $2 returning order_version"
+	if err := tx.QueryRowContext(ctx, query, OrderCancelled, id).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	query = `update books set book_stock = book_stock + order_item_quantity, book_version = book_version + 1
+		from order_items where order_item_order_id = $1 and book_id = order_item_book_id`
+	if _, err := tx.ExecContext(ctx, query, id); err != nil {
+		return 0, err
+	}
+
+	if err := recordStatusChange(ctx, tx, id, userId, OrderPending, OrderCancelled); err != nil {
+		return 0, err
+	}
+
+	return version, tx.Commit()
+}
+
+// setOrderStatus moves the order to status, provided it is in one of the
+// statuses in from or from is empty, and records the change. The order is
+// locked first, so the status it is checked against is the one it is moved
+// from. It returns whether the order was updated.
+func setOrderStatus(ctx context.Context, tx *sql.Tx, orderId int, status string, from ...string) (bool, error) {
+	query := "select order_status, order_user_id from orders where order_id = $1 for update"
+
+	var oldStatus string
+	var userId int
+	err := tx.QueryRowContext(ctx, query, orderId).Scan(&oldStatus, &userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	query = `update orders set order_status = $1, order_version = order_version + 1
+		where order_id = $2 and (cardinality($3::varchar[]) = 0 or order_status = any($3))`
+
+	result, err := tx.ExecContext(ctx, query, status, orderId, pq.Array(from))
+	if err != nil {
+		return false, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+
+	return true, recordStatusChange(ctx, tx, orderId, userId, oldStatus, status)
+}
+
+// recordStatusChange records an OrderStatusChanged event if the status
+// changed.
+func recordStatusChange(ctx context.Context, tx *sql.Tx, orderId int, userId int, from string, to string) error {
+	if from == to {
+		return nil
+	}
+	return recordEvent(ctx, tx, OrderStatusChanged{Order_Id: orderId, User_Id: userId, Old_Status: from, New_Status: to})
+}
+
+func (m *OrderModel) GetOrderItems(orderId int) ([]*OrderItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select order_item_book_id, order_item_quantity, order_item_unit_price, order_item_total, order_item_tax, order_currency
+		from order_items join orders on order_id = order_item_order_id where order_item_order_id = $1 order by order_item_book_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []*OrderItem{}
+
+	for rows.Next() {
+		var item OrderItem
+
+		err := rows.Scan(&item.Book_Id, &item.Quantity, &item.Unit_Price.Amount, &item.Total.Amount, &item.Tax.Amount, &item.Unit_Price.Currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		item.Total.Currency, item.Tax.Currency = item.Unit_Price.Currency, item.Unit_Price.Currency
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
 }
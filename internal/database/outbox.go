@@ -0,0 +1,365 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/lib/pq"
+)
+
+type OutboxModel struct {
+	DB *sql.DB
+}
+
+// OutboxChannel is the channel each event's id is sent on with NOTIFY when
+// the transaction that recorded it commits.
+const OutboxChannel = "outbox_events"
+
+// Domain event types. Other services subscribe to them by name, so existing
+// types must not be renamed and their data may only gain fields.
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventBookPriceChanged   = "book.price_changed"
+	EventUserRegistered     = "user.registered"
+)
+
+// EventTypes lists every domain event type.
+var EventTypes = []string{EventOrderCreated, EventOrderStatusChanged, EventBookPriceChanged, EventUserRegistered}
+
+// OutboxEvent is a domain event waiting in the outbox to be published. Data
+// holds one of the event structs below as JSON.
+type OutboxEvent struct {
+	Id             int64           `json:"id"`
+	Type           string          `json:"type"`
+	Aggregate_Type string          `json:"aggregate_type"`
+	Aggregate_Id   int             `json:"aggregate_id"`
+	Data           json.RawMessage `json:"data" swaggertype:"object"`
+	Created_At     time.Time       `json:"created_at"`
+	Attempts       int             `json:"attempts"`
+}
+
+// domainEvent is implemented by the data of each event type.
+type domainEvent interface {
+	eventType() string
+	aggregate() (string, int)
+}
+
+// OrderCreated is published when an order is placed, at checkout or by an
+// admin.
+type OrderCreated struct {
+	Order_Id    int         `json:"order_id"`
+	User_Id     int         `json:"user_id"`
+	Status      string      `json:"status"`
+	Total_Price money.Money `json:"total_price"`
+}
+
+// OrderStatusChanged is published whenever an order moves to another status.
+type OrderStatusChanged struct {
+	Order_Id   int    `json:"order_id"`
+	User_Id    int    `json:"user_id"`
+	Old_Status string `json:"old_status"`
+	New_Status string `json:"new_status"`
+}
+
+// BookPriceChanged is published when a book's own price or its list price in
+// another currency changes. Old_Price is nil when a list price is added and
+// New_Price is nil when one is removed.
+type BookPriceChanged struct {
+	Book_Id   int          `json:"book_id"`
+	Old_Price *money.Money `json:"old_price"`
+	New_Price *money.Money `json:"new_price"`
+}
+
+// UserRegistered is published when a user signs up.
+type UserRegistered struct {
+	User_Id int    `json:"user_id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+}
+
+func (e OrderCreated) eventType() string              { return EventOrderCreated }
+func (e OrderCreated) aggregate() (string, int)       { return "order", e.Order_Id }
+func (e OrderStatusChanged) eventType() string        { return EventOrderStatusChanged }
+func (e OrderStatusChanged) aggregate() (string, int) { return "order", e.Order_Id }
+func (e BookPriceChanged) eventType() string          { return EventBookPriceChanged }
+func (e BookPriceChanged) aggregate() (string, int)   { return "book", e.Book_Id }
+func (e UserRegistered) eventType() string            { return EventUserRegistered }
+func (e UserRegistered) aggregate() (string, int)     { return "user", e.User_Id }
+
+// recordEvent adds the event to the outbox. It must be called with the
+// transaction of the change the event describes, so the event is published
+// if and only if the change is committed.
+func recordEvent(ctx context.Context, tx *sql.Tx, event domainEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	aggregateType, aggregateId := event.aggregate()
+	query := `insert into outbox_events (outbox_event_type, outbox_event_aggregate_type, outbox_event_aggregate_id, outbox_event_data)
+		values ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, query, event.eventType(), aggregateType, aggregateId, data)
+	return err
+}
+
+// recordPriceChange records a BookPriceChanged event if the price changed.
+func recordPriceChange(ctx context.Context, tx *sql.Tx, bookId int, from money.Money, to money.Money) error {
+	if from == to {
+		return nil
+	}
+	return recordEvent(ctx, tx, BookPriceChanged{Book_Id: bookId, Old_Price: &from, New_Price: &to})
+}
+
+const outboxEventColumns = `outbox_event_id, outbox_event_type, outbox_event_aggregate_type, outbox_event_aggregate_id, outbox_event_data,
+	outbox_event_created_at, outbox_event_attempts`
+
+func (event *OutboxEvent) scanFields() []any {
+	return []any{&event.Id, &event.Type, &event.Aggregate_Type, &event.Aggregate_Id, (*[]byte)(&event.Data), &event.Created_At, &event.Attempts}
+}
+
+// ClaimOutboxEvents returns up to limit unpublished events that are due,
+// oldest first, and holds them for the lease: they are not due again until it
+// runs out, so a relay that crashes while publishing them does not lose them.
+// Relays never claim the same event at once.
+func (m *OutboxModel) ClaimOutboxEvents(limit int, lease time.Duration) ([]*OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `with due as (
+			select outbox_event_id from outbox_events
+			where outbox_event_published_at is null and outbox_event_next_attempt_at <= now()
+			order by outbox_event_id limit $1 for update skip locked
+		)
+		update outbox_events set outbox_event_attempts = outbox_event_attempts + 1,
+			outbox_event_next_attempt_at = now() + $2 * interval '1 millisecond'
+		from due where outbox_events.outbox_event_id = due.outbox_event_id
+		returning ` + outboxEventColumns
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Milliseconds())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []*OutboxEvent{}
+
+	for rows.Next() {
+		var event OutboxEvent
+
+		if err := rows.Scan(event.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (m *OutboxModel) GetOutboxEvent(id int64) (*OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + outboxEventColumns + " from outbox_events where outbox_event_id = $1"
+
+	var event OutboxEvent
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(event.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+// OutboxEventFilter selects events recorded after an event. Zero values
+// match everything.
+type OutboxEventFilter struct {
+	After int64
+	Types []string
+	// User_Id matches events whose data names the user.
+	User_Id int
+	Limit   int
+}
+
+// matches returns the conditions selecting the events the filter matches,
+// each starting with " and ", with args extended by their arguments. After
+// and Limit are left to the caller.
+func (filter OutboxEventFilter) matches(args []any) (string, []any) {
+	var conditions string
+	if len(filter.Types) > 0 {
+		args = append(args, pq.Array(filter.Types))
+		conditions += fmt.Sprintf(" and outbox_event_type = any($%d)", len(args))
+	}
+	if filter.User_Id != 0 {
+		args = append(args, strconv.Itoa(filter.User_Id))
+		conditions += fmt.Sprintf(" and outbox_event_data->>'user_id' = $%d", len(args))
+	}
+	return conditions, args
+}
+
+// GetOutboxEvents returns up to filter.Limit events, published or not, with
+// ids above filter.After, oldest first. Events are only kept until they are
+// purged some time after being published.
+func (m *OutboxModel) GetOutboxEvents(filter OutboxEventFilter) ([]*OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, _ := pageBounds(filter.Limit, 1)
+
+	conditions, args := filter.matches([]any{filter.After})
+	query := "select " + outboxEventColumns + " from outbox_events where outbox_event_id > $1" + conditions
+
+	args = append(args, limit)
+	query += fmt.Sprintf(" order by outbox_event_id limit $%d", len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []*OutboxEvent{}
+
+	for rows.Next() {
+		var event OutboxEvent
+
+		if err := rows.Scan(event.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetOutboxLookbackId returns the id to read on from so as not to miss events
+// that committed after the event with the given id. Ids are taken as events
+// are recorded, not as their transactions commit, so an event with a lower id
+// may commit later. The returned id is just below the first event recorded
+// in the window before the given one, which catches every such event whose
+// transaction took less than window. It returns id itself once the event has
+// been purged.
+func (m *OutboxModel) GetOutboxLookbackId(id int64, window time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select coalesce(min(outbox_event_id) - 1, $1) from outbox_events
+		where outbox_event_id <= $1 and outbox_event_created_at >=
+			(select outbox_event_created_at from outbox_events where outbox_event_id = $1) - $2 * interval '1 millisecond'`
+
+	var lookbackId int64
+	err := m.DB.QueryRowContext(ctx, query, id, window.Milliseconds()).Scan(&lookbackId)
+	return lookbackId, err
+}
+
+// GetLatestOutboxId returns the id of the latest committed event, or 0 if
+// there is none.
+func (m *OutboxModel) GetLatestOutboxId() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, "select coalesce(max(outbox_event_id), 0) from outbox_events").Scan(&id)
+	return id, err
+}
+
+// GetOutboxGaps returns, in order, the ids above after and up to upTo that a
+// reader of the events filter matches may still be given: the ids of events
+// it matches and the ids no committed event has, whose events may still be
+// committing. A nil filter matches no events, so only the second kind are
+// returned.
+func (m *OutboxModel) GetOutboxGaps(filter *OutboxEventFilter, after, upTo int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{after, upTo}
+	visible := "outbox_event_id = i"
+	if filter != nil {
+		var conditions string
+		conditions, args = filter.matches(args)
+		visible += " and not coalesce(true" + conditions + ", false)"
+	}
+	query := "select i from generate_series($1::bigint + 1, $2::bigint) i where not exists (select 1 from outbox_events where " + visible + ") order by i"
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// MarkOutboxEventPublished records that the event was delivered.
+func (m *OutboxModel) MarkOutboxEventPublished(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "update outbox_events set outbox_event_published_at = now(), outbox_event_last_error = '' where outbox_event_id = $1"
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// RetryOutboxEvent records why publishing the event failed and makes it due
+// again at the given time.
+func (m *OutboxModel) RetryOutboxEvent(id int64, at time.Time, publishErr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update outbox_events set outbox_event_next_attempt_at = $1, outbox_event_last_error = $2
+		where outbox_event_id = $3 and outbox_event_published_at is null`
+
+	_, err := m.DB.ExecContext(ctx, query, at, publishErr, id)
+	return err
+}
+
+// PurgePublishedOutboxEvents deletes events that were published before the
+// given time and returns how many were deleted.
+func (m *OutboxModel) PurgePublishedOutboxEvents(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := "delete from outbox_events where outbox_event_published_at < $1"
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
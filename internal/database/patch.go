@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// columnChange is a single column to set in a partial update.
+type columnChange struct {
+	column string
+	value  any
+}
+
+// updateColumns sets only the given columns on the row whose idColumn equals
+// id and whose versionColumn equals version, and bumps the version. It returns
+// the new version, or ErrEditConflict if the row has moved on. Table and
+// column names come from the models, never from user input. It runs with ctx
+// so that, inside a transaction, it keeps to the transaction's deadline.
+func updateColumns(ctx context.Context, db queryRower, table string, idColumn string, versionColumn string, id int, version int, changes []columnChange) (int, error) {
+	if len(changes) == 0 {
+		return version, nil
+	}
+
+	sets := make([]string, 0, len(changes)+1)
+	args := make([]any, 0, len(changes)+2)
+	for i, change := range changes {
+		sets = append(sets, fmt.Sprintf("%s = $%d", change.column, i+1))
+		args = append(args, change.value)
+	}
+	sets = append(sets, fmt.Sprintf("%s = %s + 1", versionColumn, versionColumn))
+	args = append(args, id, version)
+
+	query := fmt.Sprintf("update %s set %s where %s = $%d and %s = $%d returning %s",
+		table, strings.Join(sets, ", "), idColumn, len(args)-1, versionColumn, len(args), versionColumn)
+
+	var newVersion int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&newVersion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrEditConflict
+		}
+		return 0, err
+	}
+	return newVersion, nil
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// Payment statuses. Authorized, captured, voided and refunded mirror the
+// provider; declined and failed record attempts that never got that far.
+// Pending holds the order while the provider is being asked.
+const (
+	PaymentPending    = "pending"
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentVoided     = "voided"
+	PaymentRefunded   = "refunded"
+	PaymentDeclined   = "declined"
+	PaymentFailed     = "failed"
+)
+
+var (
+	// ErrOrderNotPayable is returned when an order is no longer pending or
+	// already has a payment that is in progress or went through.
+	ErrOrderNotPayable = errors.New("order is not payable")
+	// ErrPaymentNotRefundable is returned when a payment is not captured or
+	// has less than the amount left to refund.
+	ErrPaymentNotRefundable = errors.New("payment is not refundable")
+)
+
+type PaymentModel struct {
+	DB *sql.DB
+}
+
+type Payment struct {
+	Id                  int         `json:"id"`
+	Order_Id            int         `json:"order_id"`
+	Provider            string      `json:"provider"`
+	Provider_Payment_Id string      `json:"provider_payment_id,omitempty"`
+	Status              string      `json:"status"`
+	Amount              money.Money `json:"amount"`
+	Refunded_Amount     money.Money `json:"refunded_amount"`
+	Failure_Reason      string      `json:"failure_reason,omitempty"`
+	Created_At          time.Time   `json:"created_at"`
+}
+
+const paymentColumns = "payment_id, payment_order_id, payment_provider, coalesce(payment_provider_id, ''), payment_status, payment_amount, payment_refunded_amount, payment_currency, payment_failure_reason, payment_created_at"
+
+func (payment *Payment) scanFields() []any {
+	return []any{&payment.Id, &payment.Order_Id, &payment.Provider, &payment.Provider_Payment_Id, &payment.Status,
+		&payment.Amount.Amount, &payment.Refunded_Amount.Amount, &payment.Amount.Currency, &payment.Failure_Reason, &payment.Created_At}
+}
+
+// scanned fills in the currency of the refunded amount, which is stored once
+// for the payment.
+func (payment *Payment) scanned() {
+	payment.Refunded_Amount.Currency = payment.Amount.Currency
+}
+
+// PaymentEvent is a verified provider webhook translated to its effect on the
+// stored payment.
+type PaymentEvent struct {
+	Provider            string
+	Event_Id            string
+	Type                string
+	Provider_Payment_Id string
+	Status              string
+	// Refunded_Amount is the total refunded so far in minor units of the
+	// payment's currency, for refund events.
+	Refunded_Amount int64
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// StartPayment saves a pending payment for the order before the provider is
+// called. The order is locked while it checks that the order is pending and
+// has no other payment in progress or authorized, so concurrent requests
+// cannot both pay for it. A pending payment older than stale is taken to be
+// from a request that died and no longer holds the order.
+func (m *PaymentModel) StartPayment(payment *Payment, stale time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	query := "select order_status from orders where order_id = $1 and order_deleted_at is null for update"
+	err = tx.QueryRowContext(ctx, query, payment.Order_Id).Scan(&status)
+	if err == sql.ErrNoRows || (err == nil && status != OrderPending) {
+		return ErrOrderNotPayable
+	}
+	if err != nil {
+		return err
+	}
+
+	var paid bool
+	query = `select exists (select 1 from payments where payment_order_id = $1 and (payment_status in ($2, $3)
+		or (payment_status = $4 and payment_created_at > now() - make_interval(secs => $5))))`
+	err = tx.QueryRowContext(ctx, query, payment.Order_Id, PaymentAuthorized, PaymentCaptured, PaymentPending, stale.Seconds()).Scan(&paid)
+	if err != nil {
+		return err
+	}
+	if paid {
+		return ErrOrderNotPayable
+	}
+
+	query = `insert into payments (payment_order_id, payment_provider, payment_status, payment_amount, payment_currency)
+		values ($1, $2, $3, $4, $5) returning payment_id, payment_created_at`
+
+	payment.Status = PaymentPending
+	payment.Refunded_Amount = money.New(0, payment.Amount.Currency)
+	err = tx.QueryRowContext(ctx, query, payment.Order_Id, payment.Provider, payment.Status, payment.Amount.Amount,
+		payment.Amount.Currency).Scan(&payment.Id, &payment.Created_At)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdatePayment saves the provider id, status and failure reason of the
+// payment after a provider call. The refunded amount only changes through
+// ReserveRefund, ReleaseRefund and provider webhooks.
+func (m *PaymentModel) UpdatePayment(payment *Payment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update payments set payment_provider_id = $1, payment_status = $2,
+		payment_failure_reason = $3, payment_updated_at = now() where payment_id = $4`
+
+	_, err := m.DB.ExecContext(ctx, query, nullString(payment.Provider_Payment_Id), payment.Status,
+		payment.Failure_Reason, payment.Id)
+	return err
+}
+
+// ReserveRefund adds amount to the refunded amount of the payment before the
+// provider is asked to refund it. The payment is locked while it checks that
+// it is captured and has at least amount left to refund, so concurrent
+// refunds cannot together refund more than was paid. payment is reloaded
+// either way; it returns ErrPaymentNotRefundable if the checks fail.
+func (m *PaymentModel) ReserveRefund(payment *Payment, amount money.Money) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "select " + paymentColumns + " from payments where payment_id = $1 for update"
+	if err := tx.QueryRowContext(ctx, query, payment.Id).Scan(payment.scanFields()...); err != nil {
+		return err
+	}
+	payment.scanned()
+
+	if payment.Status != PaymentCaptured || payment.Amount.Currency != amount.Currency ||
+		payment.Refunded_Amount.Amount+amount.Amount > payment.Amount.Amount {
+		return ErrPaymentNotRefundable
+	}
+
+	query = `update payments set payment_refunded_amount = payment_refunded_amount + $1, payment_updated_at = now()
+		where payment_id = $2 returning payment_refunded_amount`
+	if err := tx.QueryRowContext(ctx, query, amount.Amount, payment.Id).Scan(&payment.Refunded_Amount.Amount); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReleaseRefund takes back an amount reserved by ReserveRefund after the
+// provider did not refund it.
+func (m *PaymentModel) ReleaseRefund(payment *Payment, amount money.Money) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update payments set payment_refunded_amount = greatest(payment_refunded_amount - $1, 0), payment_updated_at = now()
+		where payment_id = $2 returning payment_refunded_amount`
+
+	return m.DB.QueryRowContext(ctx, query, amount.Amount, payment.Id).Scan(&payment.Refunded_Amount.Amount)
+}
+
+func (m *PaymentModel) GetPayment(id int) (*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + paymentColumns + " from payments where payment_id = $1"
+
+	var payment Payment
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(payment.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	payment.scanned()
+	return &payment, nil
+}
+
+// GetProviderPayment returns the payment the provider knows by
+// providerPaymentId, or nil if there is none.
+func (m *PaymentModel) GetProviderPayment(provider, providerPaymentId string) (*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + paymentColumns + " from payments where payment_provider = $1 and payment_provider_id = $2"
+
+	var payment Payment
+
+	err := m.DB.QueryRowContext(ctx, query, provider, providerPaymentId).Scan(payment.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	payment.scanned()
+	return &payment, nil
+}
+
+func (m *PaymentModel) GetPaymentsForOrder(orderId int) ([]*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + paymentColumns + " from payments where payment_order_id = $1 order by payment_id"
+
+	rows, err := m.DB.QueryContext(ctx, query, orderId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	payments := []*Payment{}
+
+	for rows.Next() {
+		var payment Payment
+
+		err := rows.Scan(payment.scanFields()...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		payment.scanned()
+		payments = append(payments, &payment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// ApplyPaymentEvent records the event and applies it to its payment and order
+// in one transaction. A captured payment moves a pending order to paid and a
+// fully refunded one moves it to refunded. It returns false if the event was
+// already applied, so redelivered webhooks have no further effect. Events for
+// payments we do not know are recorded and otherwise ignored.
+func (m *PaymentModel) ApplyPaymentEvent(event *PaymentEvent) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into payment_events (payment_event_provider, payment_event_id, payment_event_type) values ($1, $2, $3)
+		on conflict (payment_event_provider, payment_event_id) do nothing`
+
+	result, err := tx.ExecContext(ctx, query, event.Provider, event.Event_Id, event.Type)
+	if err != nil {
+		return false, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+
+	var paymentId, orderId int
+	var amount int64
+	query = "select payment_id, payment_order_id, payment_amount from payments where payment_provider = $1 and payment_provider_id = $2 for update"
+	err = tx.QueryRowContext(ctx, query, event.Provider, event.Provider_Payment_Id).Scan(&paymentId, &orderId, &amount)
+	if err == sql.ErrNoRows {
+		return true, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	status := event.Status
+	orderStatus := ""
+	switch status {
+	case PaymentCaptured:
+		orderStatus = OrderPaid
+	case PaymentRefunded:
+		if event.Refunded_Amount < amount {
+			status = PaymentCaptured
+		} else {
+			orderStatus = OrderRefunded
+		}
+	}
+
+	query = `update payments set payment_status = $1, payment_refunded_amount = greatest(payment_refunded_amount, $2),
+		payment_updated_at = now() where payment_id = $3`
+	if _, err := tx.ExecContext(ctx, query, status, event.Refunded_Amount, paymentId); err != nil {
+		return false, err
+	}
+
+	switch orderStatus {
+	case OrderPaid:
+		updated, err := setOrderStatus(ctx, tx, orderId, OrderPaid, OrderPending)
+		if err != nil {
+			return false, err
+		}
+		if updated {
+			if err := insertOrderEvent(ctx, tx, &OrderEvent{Order_Id: orderId, Type: OrderEventPaid}); err != nil {
+				return false, err
+			}
+		}
+	case OrderRefunded:
+		if _, err := setOrderStatus(ctx, tx, orderId, OrderRefunded); err != nil {
+			return false, err
+		}
+		if err := insertOrderEvent(ctx, tx, &OrderEvent{Order_Id: orderId, Type: OrderEventRefunded}); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/hamorrar/bookstore/internal/promotion"
+	"github.com/lib/pq"
+)
+
+type PromotionModel struct {
+	DB *sql.DB
+}
+
+const promotionColumns = `promotion_id, promotion_code, promotion_description, promotion_type, promotion_percent_off,
+	promotion_amount_off, promotion_min_order_total, coalesce(promotion_currency, ''), coalesce(promotion_book_id, 0),
+	promotion_buy_quantity, promotion_get_quantity, promotion_starts_at, promotion_ends_at, promotion_max_uses,
+	promotion_max_uses_per_customer,
+	(select count(*) from promotion_redemptions where promotion_redemption_promotion_id = promotion_id), promotion_version`
+
+// promotionRow holds the nullable amount columns of a promotion while it is
+// scanned.
+type promotionRow struct {
+	p                   *promotion.Promotion
+	amountOff, minTotal sql.NullInt64
+	currency            string
+}
+
+func (r *promotionRow) scanFields() []any {
+	p := r.p
+	return []any{&p.Id, &p.Code, &p.Description, &p.Type, &p.Percent_Off, &r.amountOff, &r.minTotal, &r.currency, &p.Book_Id,
+		&p.Buy_Quantity, &p.Get_Quantity, &p.Starts_At, &p.Ends_At, &p.Max_Uses, &p.Max_Uses_Per_Customer, &p.Uses, &p.Version}
+}
+
+func (r *promotionRow) scanned() {
+	r.p.Amount_Off, r.p.Min_Order_Total = nil, nil
+	if r.amountOff.Valid {
+		amount := money.New(r.amountOff.Int64, r.currency)
+		r.p.Amount_Off = &amount
+	}
+	if r.minTotal.Valid {
+		amount := money.New(r.minTotal.Int64, r.currency)
+		r.p.Min_Order_Total = &amount
+	}
+}
+
+// promotionArgs returns the values of the amount columns of p.
+func promotionArgs(p *promotion.Promotion) (amountOff, minTotal sql.NullInt64, currency sql.NullString) {
+	if p.Amount_Off != nil {
+		amountOff = sql.NullInt64{Int64: p.Amount_Off.Amount, Valid: true}
+		currency = nullString(p.Amount_Off.Currency)
+	}
+	if p.Min_Order_Total != nil {
+		minTotal = sql.NullInt64{Int64: p.Min_Order_Total.Amount, Valid: true}
+		currency = nullString(p.Min_Order_Total.Currency)
+	}
+	return amountOff, minTotal, currency
+}
+
+func (m *PromotionModel) CreatePromotion(p *promotion.Promotion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into promotions (promotion_code, promotion_description, promotion_type, promotion_percent_off, promotion_amount_off,
+			promotion_min_order_total, promotion_currency, promotion_book_id, promotion_buy_quantity, promotion_get_quantity,
+			promotion_starts_at, promotion_ends_at, promotion_max_uses, promotion_max_uses_per_customer)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) returning ` + promotionColumns
+
+	amountOff, minTotal, currency := promotionArgs(p)
+	row := promotionRow{p: p}
+	err := m.DB.QueryRowContext(ctx, query, p.Code, p.Description, p.Type, p.Percent_Off, amountOff, minTotal, currency,
+		nullInt(p.Book_Id), p.Buy_Quantity, p.Get_Quantity, p.Starts_At, p.Ends_At, p.Max_Uses, p.Max_Uses_Per_Customer).Scan(row.scanFields()...)
+	if err != nil {
+		return err
+	}
+	row.scanned()
+	return nil
+}
+
+func (m *PromotionModel) GetPromotion(id int64) (*promotion.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + promotionColumns + " from promotions where promotion_id = $1"
+
+	var p promotion.Promotion
+	row := promotionRow{p: &p}
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(row.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	row.scanned()
+	return &p, nil
+}
+
+func (m *PromotionModel) GetPromotions() ([]*promotion.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + promotionColumns + " from promotions order by promotion_code"
+
+	rows, err := m.DB.QueryContext(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	promotions := []*promotion.Promotion{}
+
+	for rows.Next() {
+		var p promotion.Promotion
+		row := promotionRow{p: &p}
+
+		err := rows.Scan(row.scanFields()...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		row.scanned()
+		promotions = append(promotions, &p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return promotions, nil
+}
+
+func (m *PromotionModel) UpdatePromotion(p *promotion.Promotion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update promotions set promotion_code = $1, promotion_description = $2, promotion_type = $3, promotion_percent_off = $4,
+			promotion_amount_off = $5, promotion_min_order_total = $6, promotion_currency = $7, promotion_book_id = $8,
+			promotion_buy_quantity = $9, promotion_get_quantity = $10, promotion_starts_at = $11, promotion_ends_at = $12,
+			promotion_max_uses = $13, promotion_max_uses_per_customer = $14, promotion_version = promotion_version + 1
+		where promotion_id = $15 and promotion_version = $16 returning ` + promotionColumns
+
+	amountOff, minTotal, currency := promotionArgs(p)
+	row := promotionRow{p: p}
+	err := m.DB.QueryRowContext(ctx, query, p.Code, p.Description, p.Type, p.Percent_Off, amountOff, minTotal, currency,
+		nullInt(p.Book_Id), p.Buy_Quantity, p.Get_Quantity, p.Starts_At, p.Ends_At, p.Max_Uses, p.Max_Uses_Per_Customer,
+		p.Id, p.Version).Scan(row.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+	row.scanned()
+	return nil
+}
+
+// DeletePromotion removes a promotion if it is still at the given version and
+// returns ErrEditConflict otherwise. Orders keep their copy of its discounts.
+func (m *PromotionModel) DeletePromotion(id int64, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "delete from promotions where promotion_id = $1 and promotion_version = $2", id, version)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// applyPromotions applies the promotions with the given codes to an order for
+// the user and returns the outcome. The promotions are locked until tx ends so
+// concurrent orders cannot both take the last use of a code. Codes that do not
+// exist or are used up give a *promotion.NotApplicableError.
+func applyPromotions(ctx context.Context, tx *sql.Tx, codes []string, userId int, lines []promotion.Line, at time.Time) (*promotion.Result, error) {
+	query := "select " + promotionColumns + " from promotions where promotion_code = any($1) order by promotion_code for update"
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]*promotion.Promotion{}
+	for rows.Next() {
+		var p promotion.Promotion
+		row := promotionRow{p: &p}
+		if err := rows.Scan(row.scanFields()...); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		row.scanned()
+		found[p.Code] = &p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var promotions []*promotion.Promotion
+	for _, code := range codes {
+		p := found[code]
+		if p == nil {
+			return nil, &promotion.NotApplicableError{Code: code, Reason: "does not exist"}
+		}
+		if p.Max_Uses > 0 && p.Uses >= p.Max_Uses {
+			return nil, &promotion.NotApplicableError{Code: code, Reason: "has been used up"}
+		}
+		if p.Max_Uses_Per_Customer > 0 {
+			query = "select count(*) from promotion_redemptions where promotion_redemption_promotion_id = $1 and promotion_redemption_user_id = $2"
+			var uses int
+			if err := tx.QueryRowContext(ctx, query, p.Id, userId).Scan(&uses); err != nil {
+				return nil, err
+			}
+			if uses >= p.Max_Uses_Per_Customer {
+				return nil, &promotion.NotApplicableError{Code: code, Reason: "has already been used the maximum number of times"}
+			}
+		}
+		promotions = append(promotions, p)
+	}
+
+	return promotion.Apply(promotions, lines, at)
+}
+
+// insertOrderDiscounts records the discounts of an order and counts a use of
+// each promotion they came from.
+func insertOrderDiscounts(ctx context.Context, db execer, order *Order) error {
+	query := `insert into order_discounts (order_discount_order_id, order_discount_position, order_discount_promotion_id, order_discount_code,
+			order_discount_type, order_discount_description, order_discount_book_id, order_discount_amount)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	redeemed := map[int64]bool{}
+	for i, d := range order.Discounts {
+		promotionId := sql.NullInt64{Int64: d.Promotion_Id, Valid: d.Promotion_Id != 0}
+		if _, err := db.ExecContext(ctx, query, order.Id, i+1, promotionId, d.Code, d.Type, d.Description, nullInt(d.Book_Id), d.Amount.Amount); err != nil {
+			return err
+		}
+
+		if d.Promotion_Id == 0 || redeemed[d.Promotion_Id] {
+			continue
+		}
+		redeemed[d.Promotion_Id] = true
+		if _, err := db.ExecContext(ctx, `insert into promotion_redemptions (promotion_redemption_promotion_id, promotion_redemption_order_id,
+				promotion_redemption_user_id) values ($1, $2, $3)`, d.Promotion_Id, order.Id, order.User_Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDiscounts copies the outcome of applying promotions onto the order.
+func (order *Order) setDiscounts(result *promotion.Result) {
+	if len(result.Discounts) == 0 {
+		return
+	}
+	order.Discounts = result.Discounts
+	order.Discount_Total = money.New(0, result.Subtotal.Currency)
+	for _, d := range result.Discounts {
+		order.Discount_Total, _ = order.Discount_Total.Add(d.Amount)
+	}
+	order.Free_Shipping = result.Free_Shipping
+}
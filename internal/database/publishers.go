@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type PublisherModel struct {
+	DB *sql.DB
+}
+
+// Publisher is a publishing house. Books name at most one publisher.
+type Publisher struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name" binding:"required,max=256"`
+	Website string `json:"website,omitempty" binding:"omitempty,url,max=256"`
+	Version int    `json:"-"`
+}
+
+const publisherColumns = "publisher_id, publisher_name, publisher_website, publisher_version"
+
+func (p *Publisher) scanFields() []any {
+	return []any{&p.Id, &p.Name, &p.Website, &p.Version}
+}
+
+func (m *PublisherModel) CreatePublisher(p *Publisher) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "insert into publishers (publisher_name, publisher_website) values ($1, $2) returning publisher_id, publisher_version"
+
+	return m.DB.QueryRowContext(ctx, query, p.Name, p.Website).Scan(&p.Id, &p.Version)
+}
+
+func (m *PublisherModel) GetPublisher(id int) (*Publisher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + publisherColumns + " from publishers where publisher_id = $1"
+
+	var p Publisher
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(p.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPageOfPublishers returns a page of publishers ordered by name.
+func (m *PublisherModel) GetPageOfPublishers(limit int, page int) ([]*Publisher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+
+	query := "select " + publisherColumns + " from publishers order by publisher_name limit $1 offset $2"
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, (page-1)*limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	publishers := []*Publisher{}
+
+	for rows.Next() {
+		var p Publisher
+
+		if err := rows.Scan(p.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		publishers = append(publishers, &p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return publishers, nil
+}
+
+// UpdatePublisher replaces the publisher if it is still at p.Version. On
+// success p.Version is set to the new version, otherwise ErrEditConflict is
+// returned.
+func (m *PublisherModel) UpdatePublisher(p *Publisher) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "update publishers set publisher_name = $1, publisher_website = $2, publisher_version = publisher_version + 1 where publisher_id = $3 and publisher_version = $4 returning publisher_version"
+
+	err := m.DB.QueryRowContext(ctx, query, p.Name, p.Website, p.Id, p.Version).Scan(&p.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// DeletePublisher removes the publisher if it is still at the given version.
+// It fails with a foreign key violation while books name the publisher.
+func (m *PublisherModel) DeletePublisher(id int, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from publishers where publisher_id = $1 and publisher_version = $2"
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
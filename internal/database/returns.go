@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// Return statuses. A return is requested by the customer, approved or
+// rejected by an admin, received back into stock and finally refunded. It is
+// refunding while the payment provider is asked for the refund, so only one
+// refund is made at a time.
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+	ReturnRefunding = "refunding"
+	ReturnRefunded  = "refunded"
+)
+
+// ReturnItemError is returned by CreateReturn when a book is not part of the
+// order or more copies of it are returned than are left to return.
+type ReturnItemError struct {
+	Book_Id   int
+	Ordered   bool
+	Remaining int
+}
+
+func (e *ReturnItemError) Error() string {
+	if !e.Ordered {
+		return fmt.Sprintf("book %d is not part of the order", e.Book_Id)
+	}
+	return fmt.Sprintf("only %d of book %d can still be returned", e.Remaining, e.Book_Id)
+}
+
+type ReturnModel struct {
+	DB *sql.DB
+}
+
+type Return struct {
+	Id            int           `json:"id"`
+	Order_Id      int           `json:"order_id"`
+	Status        string        `json:"status"`
+	Reason        string        `json:"reason"`
+	Admin_Note    string        `json:"admin_note,omitempty"`
+	Refund_Amount money.Money   `json:"refund_amount"`
+	Items         []*ReturnItem `json:"items"`
+	Created_At    time.Time     `json:"created_at"`
+}
+
+type ReturnItem struct {
+	Book_Id  int `json:"book_id" binding:"required"`
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+const returnColumns = "return_id, return_order_id, return_status, return_reason, return_admin_note, return_refund_amount, return_refund_currency, return_created_at"
+
+func (r *Return) scanFields() []any {
+	return []any{&r.Id, &r.Order_Id, &r.Status, &r.Reason, &r.Admin_Note, &r.Refund_Amount.Amount, &r.Refund_Amount.Currency, &r.Created_At}
+}
+
+// CreateReturn saves a requested return with its items and adds it to the
+// order's history. Each book may appear once in r.Items. The order is locked
+// while the items are checked against what is left to return, books in
+// returns that were not rejected counting as returned, so concurrent returns
+// cannot return more than was ordered. It returns a *ReturnItemError if an
+// item cannot be returned.
+func (m *ReturnModel) CreateReturn(r *Return, actorId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "select order_id from orders where order_id = $1 for update"
+	if _, err := tx.ExecContext(ctx, query, r.Order_Id); err != nil {
+		return err
+	}
+
+	query = `select oi.order_item_book_id, oi.order_item_quantity - coalesce(sum(ri.return_item_quantity), 0) from order_items oi
+		left join returns r on r.return_order_id = oi.order_item_order_id and r.return_status <> $2
+		left join return_items ri on ri.return_item_return_id = r.return_id and ri.return_item_book_id = oi.order_item_book_id
+		where oi.order_item_order_id = $1 group by oi.order_item_book_id, oi.order_item_quantity`
+
+	rows, err := tx.QueryContext(ctx, query, r.Order_Id, ReturnRejected)
+	if err != nil {
+		return err
+	}
+
+	remaining := map[int]int{}
+
+	for rows.Next() {
+		var bookId, quantity int
+		if err := rows.Scan(&bookId, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		remaining[bookId] = quantity
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range r.Items {
+		left, ok := remaining[item.Book_Id]
+		if !ok || item.Quantity > left {
+			return &ReturnItemError{Book_Id: item.Book_Id, Ordered: ok, Remaining: left}
+		}
+	}
+
+	r.Status = ReturnRequested
+	query = `insert into returns (return_order_id, return_status, return_reason, return_refund_currency)
+		select $1, $2, $3, order_currency from orders where order_id = $1 returning return_id, return_refund_currency, return_created_at`
+	if err := tx.QueryRowContext(ctx, query, r.Order_Id, r.Status, r.Reason).Scan(&r.Id, &r.Refund_Amount.Currency, &r.Created_At); err != nil {
+		return err
+	}
+
+	for _, item := range r.Items {
+		query = "insert into return_items (return_item_return_id, return_item_book_id, return_item_quantity) values ($1, $2, $3)"
+		if _, err := tx.ExecContext(ctx, query, r.Id, item.Book_Id, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	event := &OrderEvent{Order_Id: r.Order_Id, Type: OrderEventReturnRequested, Detail: r.Reason, Actor_Id: actorId}
+	if err := insertOrderEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *ReturnModel) getReturnItems(ctx context.Context, returnId int) ([]*ReturnItem, error) {
+	query := "select return_item_book_id, return_item_quantity from return_items where return_item_return_id = $1 order by return_item_book_id"
+
+	rows, err := m.DB.QueryContext(ctx, query, returnId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []*ReturnItem{}
+
+	for rows.Next() {
+		var item ReturnItem
+
+		if err := rows.Scan(&item.Book_Id, &item.Quantity); err != nil {
+			return nil, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (m *ReturnModel) GetReturn(id int) (*Return, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + returnColumns + " from returns where return_id = $1"
+
+	var r Return
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(r.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	r.Items, err = m.getReturnItems(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (m *ReturnModel) GetReturnsForOrder(orderId int) ([]*Return, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + returnColumns + " from returns where return_order_id = $1 order by return_id"
+
+	rows, err := m.DB.QueryContext(ctx, query, orderId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	returns := []*Return{}
+
+	for rows.Next() {
+		var r Return
+
+		err := rows.Scan(r.scanFields()...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		returns = append(returns, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range returns {
+		r.Items, err = m.getReturnItems(ctx, r.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return returns, nil
+}
+
+// TransitionReturn moves the return from the status it was read with to
+// r.Status, saving the admin note and refund amount, and adds the event, if
+// any, to the order's history. When an approved return is received its books
+// are put back in stock. It returns ErrEditConflict if the return is no
+// longer in from.
+func (m *ReturnModel) TransitionReturn(r *Return, from string, event *OrderEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `update returns set return_status = $1, return_admin_note = $2, return_refund_amount = $3, return_refund_currency = $4,
+		return_updated_at = now() where return_id = $5 and return_status = $6`
+
+	result, err := tx.ExecContext(ctx, query, r.Status, r.Admin_Note, r.Refund_Amount.Amount, r.Refund_Amount.Currency, r.Id, from)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(result); err != nil {
+		return err
+	}
+
+	if r.Status == ReturnReceived && from == ReturnApproved {
+		for _, item := range r.Items {
+			query = "update books set book_stock = book_stock + $1, book_version = book_version + 1 where book_id = $2"
+			if _, err := tx.ExecContext(ctx, query, item.Quantity, item.Book_Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	if event != nil {
+		if err := insertOrderEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,460 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/shipping"
+)
+
+// ErrOrderNotShippable is returned by CreateShipment when the order is not
+// paid or already fully shipped.
+var ErrOrderNotShippable = errors.New("order is not shippable")
+
+// ShipmentItemError is returned by CreateShipment when a book is not part of
+// the order or more copies of it are shipped than are left to ship.
+type ShipmentItemError struct {
+	Book_Id   int
+	Ordered   bool
+	Remaining int
+}
+
+func (e *ShipmentItemError) Error() string {
+	if !e.Ordered {
+		return fmt.Sprintf("book %d is not part of the order", e.Book_Id)
+	}
+	return fmt.Sprintf("only %d of book %d are left to ship", e.Remaining, e.Book_Id)
+}
+
+type ShipmentModel struct {
+	DB *sql.DB
+}
+
+// Shipment is a parcel sent out for an order. An order can be split over
+// several shipments, each holding some of its books. Status is one of the
+// shipping tracking statuses and Events is the shipment's tracking history,
+// oldest first.
+type Shipment struct {
+	Id              int                      `json:"id"`
+	Order_Id        int                      `json:"order_id"`
+	Carrier         string                   `json:"carrier"`
+	Tracking_Number string                   `json:"tracking_number"`
+	Status          string                   `json:"status"`
+	Items           []*ShipmentItem          `json:"items"`
+	Shipped_At      time.Time                `json:"shipped_at"`
+	Delivered_At    *time.Time               `json:"delivered_at,omitempty"`
+	Events          []shipping.TrackingEvent `json:"events"`
+	Version         int                      `json:"-"`
+}
+
+type ShipmentItem struct {
+	Book_Id  int `json:"book_id" binding:"required"`
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+const shipmentColumns = `shipment_id, shipment_order_id, shipment_carrier, shipment_tracking_number, shipment_status,
+	shipment_shipped_at, shipment_delivered_at, shipment_version`
+
+// shipmentRow scans a shipment with its nullable delivery time.
+type shipmentRow struct {
+	Shipment
+	deliveredAt sql.NullTime
+}
+
+func (r *shipmentRow) scanFields() []any {
+	return []any{&r.Id, &r.Order_Id, &r.Carrier, &r.Tracking_Number, &r.Status, &r.Shipped_At, &r.deliveredAt, &r.Version}
+}
+
+func (r *shipmentRow) shipment() *Shipment {
+	s := r.Shipment
+	if r.deliveredAt.Valid {
+		s.Delivered_At = &r.deliveredAt.Time
+	}
+	return &s
+}
+
+// CreateShipment saves a shipment with its items, adds it to the order's
+// history and moves the order on to Partially Shipped or Shipped. The order is
+// locked while its remaining books are counted, so concurrent shipments
+// cannot ship more than was ordered. It returns ErrOrderNotShippable if the
+// order cannot be shipped and a *ShipmentItemError if an item cannot.
+func (m *ShipmentModel) CreateShipment(s *Shipment, actorId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	query := "select order_status from orders where order_id = $1 for update"
+	if err := tx.QueryRowContext(ctx, query, s.Order_Id).Scan(&status); err != nil {
+		return err
+	}
+	if status != OrderPaid && status != OrderPartiallyShipped {
+		return ErrOrderNotShippable
+	}
+
+	query = `select oi.order_item_book_id, oi.order_item_quantity - coalesce(sum(si.shipment_item_quantity), 0) from order_items oi
+		left join shipments s on s.shipment_order_id = oi.order_item_order_id
+		left join shipment_items si on si.shipment_item_shipment_id = s.shipment_id and si.shipment_item_book_id = oi.order_item_book_id
+		where oi.order_item_order_id = $1 group by oi.order_item_book_id, oi.order_item_quantity`
+
+	rows, err := tx.QueryContext(ctx, query, s.Order_Id)
+	if err != nil {
+		return err
+	}
+
+	remaining := map[int]int{}
+
+	for rows.Next() {
+		var bookId, quantity int
+		if err := rows.Scan(&bookId, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		remaining[bookId] = quantity
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range s.Items {
+		left, ok := remaining[item.Book_Id]
+		if !ok || item.Quantity > left {
+			return &ShipmentItemError{Book_Id: item.Book_Id, Ordered: ok, Remaining: left}
+		}
+	}
+
+	s.Status = shipping.StatusInTransit
+	query = `insert into shipments (shipment_order_id, shipment_carrier, shipment_tracking_number, shipment_status)
+		values ($1, $2, $3, $4) returning shipment_id, shipment_shipped_at, shipment_version`
+	if err := tx.QueryRowContext(ctx, query, s.Order_Id, s.Carrier, s.Tracking_Number, s.Status).Scan(&s.Id, &s.Shipped_At, &s.Version); err != nil {
+		return err
+	}
+
+	for _, item := range s.Items {
+		query = "insert into shipment_items (shipment_item_shipment_id, shipment_item_book_id, shipment_item_quantity) values ($1, $2, $3)"
+		if _, err := tx.ExecContext(ctx, query, s.Id, item.Book_Id, item.Quantity); err != nil {
+			return err
+		}
+	}
+	s.Events = []shipping.TrackingEvent{}
+
+	event := &OrderEvent{Order_Id: s.Order_Id, Type: OrderEventShipmentCreated, Detail: s.Carrier + " " + s.Tracking_Number, Actor_Id: actorId}
+	if err := insertOrderEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := advanceOrderStatus(ctx, tx, s.Order_Id, actorId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *ShipmentModel) getShipmentItems(ctx context.Context, shipmentId int) ([]*ShipmentItem, error) {
+	query := "select shipment_item_book_id, shipment_item_quantity from shipment_items where shipment_item_shipment_id = $1 order by shipment_item_book_id"
+
+	rows, err := m.DB.QueryContext(ctx, query, shipmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []*ShipmentItem{}
+
+	for rows.Next() {
+		var item ShipmentItem
+
+		if err := rows.Scan(&item.Book_Id, &item.Quantity); err != nil {
+			return nil, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (m *ShipmentModel) getShipmentEvents(ctx context.Context, shipmentId int) ([]shipping.TrackingEvent, error) {
+	query := `select coalesce(shipment_event_carrier_event_id, ''), shipment_event_status, shipment_event_description, shipment_event_location, shipment_event_occurred_at
+		from shipment_events where shipment_event_shipment_id = $1 order by shipment_event_occurred_at, shipment_event_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, shipmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []shipping.TrackingEvent{}
+
+	for rows.Next() {
+		var e shipping.TrackingEvent
+
+		if err := rows.Scan(&e.Id, &e.Status, &e.Description, &e.Location, &e.Occurred_At); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (m *ShipmentModel) loadDetails(ctx context.Context, s *Shipment) error {
+	var err error
+	if s.Items, err = m.getShipmentItems(ctx, s.Id); err != nil {
+		return err
+	}
+	s.Events, err = m.getShipmentEvents(ctx, s.Id)
+	return err
+}
+
+func (m *ShipmentModel) GetShipment(id int) (*Shipment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + shipmentColumns + " from shipments where shipment_id = $1"
+
+	var row shipmentRow
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(row.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	s := row.shipment()
+	if err := m.loadDetails(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *ShipmentModel) GetShipmentsForOrder(orderId int) ([]*Shipment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + shipmentColumns + " from shipments where shipment_order_id = $1 order by shipment_id"
+
+	rows, err := m.DB.QueryContext(ctx, query, orderId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	shipments := []*Shipment{}
+
+	for rows.Next() {
+		var row shipmentRow
+
+		err := rows.Scan(row.scanFields()...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shipments = append(shipments, row.shipment())
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range shipments {
+		if err := m.loadDetails(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return shipments, nil
+}
+
+// UpdateShipment saves the carrier, tracking number and status of a shipment
+// an admin edited. When the status changed, event is added to its tracking
+// history and the order moves on if that completes its delivery. It returns
+// ErrEditConflict if the shipment changed since s.Version was read.
+func (m *ShipmentModel) UpdateShipment(s *Shipment, event *shipping.TrackingEvent, actorId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if event != nil && event.Status == shipping.StatusDelivered {
+		s.Delivered_At = &event.Occurred_At
+	}
+
+	query := `update shipments set shipment_carrier = $1, shipment_tracking_number = $2, shipment_status = $3, shipment_delivered_at = $4,
+		shipment_updated_at = now(), shipment_version = shipment_version + 1
+		where shipment_id = $5 and shipment_version = $6 returning shipment_version`
+
+	err = tx.QueryRowContext(ctx, query, s.Carrier, s.Tracking_Number, s.Status, s.Delivered_At, s.Id, s.Version).Scan(&s.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	detail := s.Carrier + " " + s.Tracking_Number
+	if event != nil {
+		if _, err := insertShipmentEvent(ctx, tx, s.Id, *event); err != nil {
+			return err
+		}
+		s.Events = append(s.Events, *event)
+		detail += ": " + s.Status
+	}
+
+	orderEvent := &OrderEvent{Order_Id: s.Order_Id, Type: OrderEventShipmentUpdated, Detail: detail, Actor_Id: actorId}
+	if err := insertOrderEvent(ctx, tx, orderEvent); err != nil {
+		return err
+	}
+
+	if err := advanceOrderStatus(ctx, tx, s.Order_Id, actorId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ApplyTrackingEvents stores the events fetched from the carrier that the
+// shipment does not have yet and moves the shipment to the status they lead
+// to, moving the order on if that completes its delivery. Events that would
+// move the shipment backwards are kept in its history but leave the status
+// alone. Afterwards s holds the shipment's whole history. It returns
+// ErrEditConflict if the shipment's status changed since it was read.
+func (m *ShipmentModel) ApplyTrackingEvents(s *Shipment, events []shipping.TrackingEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	from, status := s.Status, s.Status
+	var deliveredAt *time.Time
+	for _, e := range events {
+		added, err := insertShipmentEvent(ctx, tx, s.Id, e)
+		if err != nil {
+			return err
+		}
+		if added && shipping.CanMove(status, e.Status) {
+			status = e.Status
+			if status == shipping.StatusDelivered {
+				deliveredAt = &e.Occurred_At
+			}
+		}
+	}
+
+	if status != from {
+		query := `update shipments set shipment_status = $1, shipment_delivered_at = $2, shipment_updated_at = now(), shipment_version = shipment_version + 1
+			where shipment_id = $3 and shipment_status = $4 returning shipment_version`
+
+		err := tx.QueryRowContext(ctx, query, status, deliveredAt, s.Id, from).Scan(&s.Version)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrEditConflict
+			}
+			return err
+		}
+		s.Status, s.Delivered_At = status, deliveredAt
+
+		event := &OrderEvent{Order_Id: s.Order_Id, Type: OrderEventShipmentUpdated, Detail: s.Carrier + " " + s.Tracking_Number + ": " + status}
+		if err := insertOrderEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		if err := advanceOrderStatus(ctx, tx, s.Order_Id, 0); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.Events, err = m.getShipmentEvents(ctx, s.Id)
+	return err
+}
+
+// insertShipmentEvent adds an event to a shipment's history. Events from the
+// carrier are only added once; it reports whether the event was new.
+func insertShipmentEvent(ctx context.Context, db execer, shipmentId int, e shipping.TrackingEvent) (bool, error) {
+	query := `insert into shipment_events (shipment_event_shipment_id, shipment_event_carrier_event_id, shipment_event_status,
+		shipment_event_description, shipment_event_location, shipment_event_occurred_at)
+		values ($1, $2, $3, $4, $5, $6) on conflict do nothing`
+
+	result, err := db.ExecContext(ctx, query, shipmentId, nullString(e.Id), e.Status, e.Description, e.Location, e.Occurred_At)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// advanceOrderStatus moves a paid order on to Partially Shipped while some of
+// its books have not been shipped, to Shipped once all of them have and to
+// Delivered once every shipment has arrived, adding the change to the order's
+// history. Orders in any other status, such as Refunded, are left alone.
+func advanceOrderStatus(ctx context.Context, tx *sql.Tx, orderId int, actorId int) error {
+	query := `select
+		(select coalesce(sum(order_item_quantity), 0) from order_items where order_item_order_id = $1),
+		(select coalesce(sum(si.shipment_item_quantity), 0) from shipment_items si
+			join shipments s on s.shipment_id = si.shipment_item_shipment_id where s.shipment_order_id = $1),
+		(select count(*) from shipments where shipment_order_id = $1 and shipment_status <> $2)`
+
+	var ordered, shipped, undelivered int
+	if err := tx.QueryRowContext(ctx, query, orderId, shipping.StatusDelivered).Scan(&ordered, &shipped, &undelivered); err != nil {
+		return err
+	}
+
+	var status, eventType string
+	switch {
+	case shipped == 0:
+		return nil
+	case shipped < ordered:
+		status = OrderPartiallyShipped
+	case undelivered == 0:
+		status, eventType = OrderDelivered, OrderEventDelivered
+	default:
+		status, eventType = OrderShipped, OrderEventShipped
+	}
+
+	from := slices.DeleteFunc([]string{OrderPaid, OrderPartiallyShipped, OrderShipped}, func(s string) bool { return s == status })
+	updated, err := setOrderStatus(ctx, tx, orderId, status, from...)
+	if err != nil || !updated || eventType == "" {
+		return err
+	}
+
+	return insertOrderEvent(ctx, tx, &OrderEvent{Order_Id: orderId, Type: eventType, Actor_Id: actorId})
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/tax"
+	"github.com/lib/pq"
+)
+
+type TaxRateModel struct {
+	DB *sql.DB
+}
+
+const taxRateColumns = "tax_rate_id, tax_rate_region, tax_rate_category, tax_rate_name, tax_rate_rate::text, tax_rate_effective_at"
+
+func scanTaxRate(rule *tax.Rule) []any {
+	return []any{&rule.Id, &rule.Region, &rule.Category, &rule.Name, &rule.Rate, &rule.Effective_At}
+}
+
+func (m *TaxRateModel) CreateTaxRate(rule *tax.Rule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into tax_rates (tax_rate_region, tax_rate_category, tax_rate_name, tax_rate_rate, tax_rate_effective_at)
+		values ($1, $2, $3, $4, $5) returning ` + taxRateColumns
+
+	return m.DB.QueryRowContext(ctx, query, rule.Region, rule.Category, rule.Name, rule.Rate, rule.Effective_At).Scan(scanTaxRate(rule)...)
+}
+
+func (m *TaxRateModel) GetTaxRate(id int64) (*tax.Rule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + taxRateColumns + " from tax_rates where tax_rate_id = $1"
+
+	var rule tax.Rule
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(scanTaxRate(&rule)...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// GetTaxRates returns the rules for the given regions, or every rule if none
+// are given, ordered by region and category with the latest effective first.
+func (m *TaxRateModel) GetTaxRates(regions ...string) ([]tax.Rule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + taxRateColumns + ` from tax_rates where cardinality($1::text[]) = 0 or tax_rate_region = any($1)
+		order by tax_rate_region, tax_rate_category, tax_rate_effective_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(regions))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	rules := []tax.Rule{}
+
+	for rows.Next() {
+		var rule tax.Rule
+
+		err := rows.Scan(scanTaxRate(&rule)...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// HasTaxRates reports whether any tax rule exists.
+func (m *TaxRateModel) HasTaxRates() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, "select exists (select 1 from tax_rates)").Scan(&exists)
+	return exists, err
+}
+
+// GetTaxTable returns a tax table with the rules for a region and its country.
+func (m *TaxRateModel) GetTaxTable(region string) (*tax.Table, error) {
+	regions := []string{region}
+	if country, _, ok := strings.Cut(region, "-"); ok {
+		regions = append(regions, country)
+	}
+
+	rules, err := m.GetTaxRates(regions...)
+	if err != nil {
+		return nil, err
+	}
+	return tax.NewTable(rules), nil
+}
+
+// DeleteTaxRate removes a rule that has not taken effect yet. Rules that did
+// are kept as history. It returns false if there is no such rule.
+func (m *TaxRateModel) DeleteTaxRate(id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from tax_rates where tax_rate_id = $1 and tax_rate_effective_at > now()"
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -16,33 +16,54 @@ type User struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"-"`
 	Role     string `json:"role" binding:"required"`
+	Version  int    `json:"-"`
 }
 
+const userColumns = "user_id, user_email, user_password, user_role, user_version"
+
+func (user *User) scanFields() []any {
+	return []any{&user.Id, &user.Email, &user.Password, &user.Role, &user.Version}
+}
+
+// CreateUser registers the user and records a UserRegistered event.
 func (m *UserModel) CreateUser(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "insert into users (user_email, user_password, user_role) values ($1, $2, $3) returning user_id"
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "insert into users (user_email, user_password, user_role) values ($1, $2, $3) returning user_id, user_version"
 
-	err := m.DB.QueryRowContext(ctx, query, user.Email, user.Password, user.Role).Scan(&user.Id)
+	err = tx.QueryRowContext(ctx, query, user.Email, user.Password, user.Role).Scan(&user.Id, &user.Version)
 
 	if err != nil {
 		return err
 	}
-	return nil
+
+	if err := recordEvent(ctx, tx, UserRegistered{User_Id: user.Id, Email: user.Email, Role: user.Role}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (m *UserModel) DeleteUser(id int) error {
+// DeleteUser soft deletes the user if it is still at the given version and
+// returns ErrEditConflict otherwise. A deleted user can no longer log in but
+// their orders are kept.
+func (m *UserModel) DeleteUser(id int, version int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "delete from users where user_id = $1"
+	query := "update users set user_deleted_at = now(), user_version = user_version + 1 where user_id = $1 and user_version = $2 and user_deleted_at is null"
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
-	return nil
+	return checkAffected(result)
 }
 
 func (m *UserModel) getUser(query string, args ...interface{}) (*User, error) {
@@ -51,7 +72,7 @@ func (m *UserModel) getUser(query string, args ...interface{}) (*User, error) {
 
 	var user User
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Id, &user.Email, &user.Password, &user.Role)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(user.scanFields()...)
 
 	if err != nil {
 		fmt.Println("error in internal db users:", err)
@@ -77,7 +98,7 @@ func (m *UserModel) GetPageOfUsers(limit int, page int) ([]*User, error) {
 
 	offset := (page - 1) * limit
 
-	query := "select * from users order by user_id limit $1 offset $2"
+	query := "select " + userColumns + " from users where user_deleted_at is null order by user_id limit $1 offset $2"
 
 	rows, err := m.DB.QueryContext(ctx, query, limit, offset)
 
@@ -92,7 +113,7 @@ func (m *UserModel) GetPageOfUsers(limit int, page int) ([]*User, error) {
 	for rows.Next() {
 		var user User
 
-		err := rows.Scan(&user.Id, &user.Email, &user.Password, &user.Role)
+		err := rows.Scan(user.scanFields()...)
 
 		if err != nil {
 			return nil, err
@@ -112,7 +133,7 @@ func (m *UserModel) GetAllUsers() ([]*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "select * from users"
+	query := "select " + userColumns + " from users where user_deleted_at is null"
 
 	rows, err := m.DB.QueryContext(ctx, query)
 
@@ -127,7 +148,7 @@ func (m *UserModel) GetAllUsers() ([]*User, error) {
 	for rows.Next() {
 		var user User
 
-		err := rows.Scan(&user.Id, &user.Email, &user.Password, &user.Role)
+		err := rows.Scan(user.scanFields()...)
 
 		if err != nil {
 			return nil, err
@@ -144,26 +165,93 @@ func (m *UserModel) GetAllUsers() ([]*User, error) {
 }
 
 func (m *UserModel) GetUserByEmail(email string) (*User, error) {
-	query := "select * from users where user_email = $1"
+	query := "select " + userColumns + " from users where user_email = $1 and user_deleted_at is null"
 	return m.getUser(query, email)
 }
 
 func (m *UserModel) GetUserById(id int) (*User, error) {
-	query := "select * from users where user_id = $1"
+	query := "select " + userColumns + " from users where user_id = $1 and user_deleted_at is null"
 	return m.getUser(query, id)
 }
 
+// RestoreUser undeletes a soft deleted user and returns it, or nil if there is
+// no deleted user with that id.
+func (m *UserModel) RestoreUser(id int) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "update users set user_deleted_at = null, user_version = user_version + 1 where user_id = $1 and user_deleted_at is not null returning " + userColumns
+
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(user.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// PurgeDeletedUsers removes users soft deleted before the given time and
+// returns how many were removed. Users who still have orders are kept so the
+// orders keep their customer.
+func (m *UserModel) PurgeDeletedUsers(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from users where user_deleted_at < $1 and not exists (select 1 from orders where order_user_id = user_id)"
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpdateUser replaces the user if it is still at user.Version. On success
+// user.Version is set to the new version, otherwise ErrEditConflict is
+// returned.
 func (m *UserModel) UpdateUser(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "UPDATE users SET user_email = $1, user_password = $2, user_role = $3 where user_id = $4"
+	query := "UPDATE users SET user_email = $1, user_password = $2, user_role = $3, user_version = user_version + 1 where user_id = $4 and user_version = $5 and user_deleted_at is null returning user_version"
 
-	_, err := m.DB.ExecContext(ctx, query, user.Email, user.Password, user.Role, user.Id)
+	err := m.DB.QueryRowContext(ctx, query, user.Email, user.Password, user.Role, user.Id, user.Version).Scan(&user.Version)
 
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
 		return err
 	}
 
 	return nil
 }
+
+// PatchUser writes only the columns of patched that differ from existing,
+// provided the row is still at existing.Version. patched.Version is set to the
+// resulting version. The password is not part of the JSON representation so
+// it is never patched.
+func (m *UserModel) PatchUser(existing *User, patched *User) error {
+	var changes []columnChange
+	if patched.Email != existing.Email {
+		changes = append(changes, columnChange{"user_email", patched.Email})
+	}
+	if patched.Role != existing.Role {
+		changes = append(changes, columnChange{"user_role", patched.Role})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	version, err := updateColumns(ctx, m.DB, "users", "user_id", "user_version", existing.Id, existing.Version, changes)
+	if err != nil {
+		return err
+	}
+	patched.Version = version
+	return nil
+}
@@ -0,0 +1,458 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Webhook delivery statuses. A pending delivery is waiting for its job to
+// send it, or to try again; a failed one ran out of attempts or its
+// subscription was disabled.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookSubscription asks for the domain events of the Event_Types, or of
+// every type if there are none, to be posted to Url. It belongs to the
+// partner User_Id and is only sent events about that user, such as their
+// orders, and events about no user in particular. Failures counts the
+// attempts that failed in a row; once there are too many the subscription is
+// disabled with a Disabled_Reason. The Secret signs every delivery and is
+// never sent back after the subscription is created.
+type WebhookSubscription struct {
+	Id              int       `json:"id"`
+	User_Id         int       `json:"user_id"`
+	Url             string    `json:"url"`
+	Event_Types     []string  `json:"event_types"`
+	Secret          string    `json:"-"`
+	Description     string    `json:"description,omitempty"`
+	Enabled         bool      `json:"enabled"`
+	Failures        int       `json:"failures"`
+	Disabled_Reason string    `json:"disabled_reason,omitempty"`
+	Created_At      time.Time `json:"created_at"`
+	Version         int       `json:"-"`
+}
+
+const webhookSubscriptionColumns = `webhook_subscription_id, webhook_subscription_user_id, webhook_subscription_url, webhook_subscription_event_types, webhook_subscription_secret,
+	webhook_subscription_description, webhook_subscription_enabled, webhook_subscription_failures, webhook_subscription_disabled_reason,
+	webhook_subscription_created_at, webhook_subscription_version`
+
+func (s *WebhookSubscription) scanFields() []any {
+	return []any{&s.Id, &s.User_Id, &s.Url, pq.Array(&s.Event_Types), &s.Secret, &s.Description, &s.Enabled, &s.Failures, &s.Disabled_Reason,
+		&s.Created_At, &s.Version}
+}
+
+// WebhookDelivery is one event sent, or to be sent, to one subscription.
+// Payload is the event as it is posted. Log holds every attempt, oldest
+// first, when the delivery is fetched on its own.
+type WebhookDelivery struct {
+	Id              int64                     `json:"id"`
+	Subscription_Id int                       `json:"subscription_id"`
+	Event_Id        int64                     `json:"event_id"`
+	Event_Type      string                    `json:"event_type"`
+	Payload         json.RawMessage           `json:"payload" swaggertype:"object"`
+	Redelivery_Of   int64                     `json:"redelivery_of,omitempty"`
+	Status          string                    `json:"status"`
+	Attempts        int                       `json:"attempts"`
+	Response_Status int                       `json:"response_status,omitempty"`
+	Error           string                    `json:"error,omitempty"`
+	Created_At      time.Time                 `json:"created_at"`
+	Delivered_At    *time.Time                `json:"delivered_at,omitempty"`
+	Log             []*WebhookDeliveryAttempt `json:"log,omitempty"`
+}
+
+const webhookDeliveryColumns = `webhook_delivery_id, webhook_delivery_subscription_id, webhook_delivery_event_id, webhook_delivery_event_type,
+	webhook_delivery_payload, coalesce(webhook_delivery_redelivery_of, 0), webhook_delivery_status, webhook_delivery_attempts,
+	coalesce(webhook_delivery_response_status, 0), webhook_delivery_error, webhook_delivery_created_at, webhook_delivery_delivered_at`
+
+func (d *WebhookDelivery) scanFields() []any {
+	return []any{&d.Id, &d.Subscription_Id, &d.Event_Id, &d.Event_Type, (*[]byte)(&d.Payload), &d.Redelivery_Of, &d.Status, &d.Attempts,
+		&d.Response_Status, &d.Error, &d.Created_At, &d.Delivered_At}
+}
+
+// WebhookDeliveryAttempt is one try at sending a delivery. Response_Status is
+// zero when no response came back, and Error then says why.
+type WebhookDeliveryAttempt struct {
+	Response_Status int       `json:"response_status,omitempty"`
+	Response_Body   string    `json:"response_body,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Duration_Ms     int       `json:"duration_ms"`
+	Attempted_At    time.Time `json:"attempted_at"`
+}
+
+// WebhookDeliveryFilter selects a subscription's deliveries. Zero values
+// match everything.
+type WebhookDeliveryFilter struct {
+	Subscription_Id int
+	Status          string
+	Event_Type      string
+	Limit           int
+	Page            int
+}
+
+func (m *WebhookModel) CreateWebhookSubscription(s *WebhookSubscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into webhook_subscriptions (webhook_subscription_user_id, webhook_subscription_url, webhook_subscription_event_types,
+			webhook_subscription_secret, webhook_subscription_description)
+		values ($1, $2, $3, $4, $5) returning ` + webhookSubscriptionColumns
+
+	return m.DB.QueryRowContext(ctx, query, s.User_Id, s.Url, pq.Array(s.Event_Types), s.Secret, s.Description).Scan(s.scanFields()...)
+}
+
+func (m *WebhookModel) GetWebhookSubscription(id int) (*WebhookSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + webhookSubscriptionColumns + " from webhook_subscriptions where webhook_subscription_id = $1"
+
+	var s WebhookSubscription
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(s.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetPageOfWebhookSubscriptions returns a page of subscriptions, oldest
+// first.
+func (m *WebhookModel) GetPageOfWebhookSubscriptions(limit int, page int) ([]*WebhookSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, offset := pageBounds(limit, page)
+
+	query := "select " + webhookSubscriptionColumns + " from webhook_subscriptions order by webhook_subscription_id limit $1 offset $2"
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	subscriptions := []*WebhookSubscription{}
+
+	for rows.Next() {
+		var s WebhookSubscription
+
+		if err := rows.Scan(s.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// UpdateWebhookSubscription replaces the subscription if it is still at
+// s.Version. Saving an enabled subscription clears its failures. On success s
+// is reloaded, otherwise ErrEditConflict is returned.
+func (m *WebhookModel) UpdateWebhookSubscription(s *WebhookSubscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update webhook_subscriptions set webhook_subscription_url = $1, webhook_subscription_event_types = $2,
+			webhook_subscription_secret = $3, webhook_subscription_description = $4, webhook_subscription_enabled = $5,
+			webhook_subscription_failures = case when $5 then 0 else webhook_subscription_failures end,
+			webhook_subscription_disabled_reason = $6, webhook_subscription_user_id = $7,
+			webhook_subscription_version = webhook_subscription_version + 1
+		where webhook_subscription_id = $8 and webhook_subscription_version = $9
+		returning ` + webhookSubscriptionColumns
+
+	err := m.DB.QueryRowContext(ctx, query, s.Url, pq.Array(s.Event_Types), s.Secret, s.Description, s.Enabled, s.Disabled_Reason,
+		s.User_Id, s.Id, s.Version).Scan(s.scanFields()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEditConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteWebhookSubscription removes the subscription, with its deliveries, if
+// it is still at the given version.
+func (m *WebhookModel) DeleteWebhookSubscription(id int, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from webhook_subscriptions where webhook_subscription_id = $1 and webhook_subscription_version = $2"
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// CreateWebhookDeliveries adds a pending delivery of the event for every
+// enabled subscription that wants its type. An event whose data names a
+// user_id only goes to that user's subscriptions, and none go to users who
+// have been deleted. It returns the ids of the
+// event's deliveries that are still pending. Calling it again for the same
+// event adds nothing new, so an event published twice is delivered once.
+func (m *WebhookModel) CreateWebhookDeliveries(eventId int64, eventType string, payload []byte) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `with created as (
+			insert into webhook_deliveries (webhook_delivery_subscription_id, webhook_delivery_event_id, webhook_delivery_event_type, webhook_delivery_payload)
+			select webhook_subscription_id, $1, $2, $3 from webhook_subscriptions
+			join users on user_id = webhook_subscription_user_id
+			where webhook_subscription_enabled and user_deleted_at is null
+				and (cardinality(webhook_subscription_event_types) = 0 or $2 = any(webhook_subscription_event_types))
+				and coalesce($3::jsonb->'data'->>'user_id', webhook_subscription_user_id::text) = webhook_subscription_user_id::text
+			on conflict (webhook_delivery_subscription_id, webhook_delivery_event_id) where webhook_delivery_redelivery_of is null do nothing
+			returning webhook_delivery_id
+		)
+		select webhook_delivery_id from created
+		union
+		select webhook_delivery_id from webhook_deliveries
+		where webhook_delivery_event_id = $1 and webhook_delivery_redelivery_of is null and webhook_delivery_status = $4
+		order by webhook_delivery_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, eventId, eventType, payload, WebhookDeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RedeliverWebhookDelivery adds a pending copy of the delivery, to be sent
+// again from the start, and returns it. It returns nil if there is no such
+// delivery.
+func (m *WebhookModel) RedeliverWebhookDelivery(id int64) (*WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `insert into webhook_deliveries (webhook_delivery_subscription_id, webhook_delivery_event_id, webhook_delivery_event_type,
+			webhook_delivery_payload, webhook_delivery_redelivery_of)
+		select webhook_delivery_subscription_id, webhook_delivery_event_id, webhook_delivery_event_type, webhook_delivery_payload, webhook_delivery_id
+		from webhook_deliveries where webhook_delivery_id = $1
+		returning ` + webhookDeliveryColumns
+
+	var d WebhookDelivery
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(d.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetWebhookDelivery returns the delivery with its log of attempts.
+func (m *WebhookModel) GetWebhookDelivery(id int64) (*WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + webhookDeliveryColumns + " from webhook_deliveries where webhook_delivery_id = $1"
+
+	var d WebhookDelivery
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(d.scanFields()...)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	query = `select coalesce(webhook_delivery_attempt_response_status, 0), webhook_delivery_attempt_response_body, webhook_delivery_attempt_error,
+			webhook_delivery_attempt_duration_ms, webhook_delivery_attempt_at
+		from webhook_delivery_attempts where webhook_delivery_attempt_delivery_id = $1 order by webhook_delivery_attempt_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a WebhookDeliveryAttempt
+		if err := rows.Scan(&a.Response_Status, &a.Response_Body, &a.Error, &a.Duration_Ms, &a.Attempted_At); err != nil {
+			return nil, err
+		}
+		d.Log = append(d.Log, &a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// GetWebhookDeliveries returns a page of deliveries, newest first, without
+// their logs.
+func (m *WebhookModel) GetWebhookDeliveries(filter WebhookDeliveryFilter) ([]*WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	limit, offset := pageBounds(filter.Limit, filter.Page)
+
+	var args []any
+	query := "select " + webhookDeliveryColumns + " from webhook_deliveries where true"
+
+	if filter.Subscription_Id != 0 {
+		args = append(args, filter.Subscription_Id)
+		query += fmt.Sprintf(" and webhook_delivery_subscription_id = $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" and webhook_delivery_status = $%d", len(args))
+	}
+	if filter.Event_Type != "" {
+		args = append(args, filter.Event_Type)
+		query += fmt.Sprintf(" and webhook_delivery_event_type = $%d", len(args))
+	}
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" order by webhook_delivery_id desc limit $%d offset $%d", len(args)-1, len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var d WebhookDelivery
+
+		if err := rows.Scan(d.scanFields()...); err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt logs an attempt at the pending delivery and updates
+// the delivery and its subscription to match. An attempt without an error
+// marks the delivery succeeded and clears the subscription's failures. A
+// failed attempt adds to them, and once there are disableAfter in a row it
+// disables the subscription as a new version. The delivery then fails if the
+// attempt was final or the subscription is disabled, and stays pending
+// otherwise. It returns the delivery's new status.
+func (m *WebhookModel) RecordWebhookAttempt(deliveryId int64, attempt *WebhookDeliveryAttempt, final bool, disableAfter int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	query := `insert into webhook_delivery_attempts (webhook_delivery_attempt_delivery_id, webhook_delivery_attempt_response_status,
+			webhook_delivery_attempt_response_body, webhook_delivery_attempt_error, webhook_delivery_attempt_duration_ms)
+		values ($1, $2, $3, $4, $5) returning webhook_delivery_attempt_at`
+
+	err = tx.QueryRowContext(ctx, query, deliveryId, nullInt(attempt.Response_Status), attempt.Response_Body, attempt.Error,
+		attempt.Duration_Ms).Scan(&attempt.Attempted_At)
+	if err != nil {
+		return "", err
+	}
+
+	var enabled bool
+	if attempt.Error == "" {
+		query = `update webhook_subscriptions set webhook_subscription_failures = 0
+			where webhook_subscription_id = (select webhook_delivery_subscription_id from webhook_deliveries where webhook_delivery_id = $1)
+			returning webhook_subscription_enabled`
+		err = tx.QueryRowContext(ctx, query, deliveryId).Scan(&enabled)
+	} else {
+		query = `update webhook_subscriptions set webhook_subscription_failures = webhook_subscription_failures + 1,
+				webhook_subscription_enabled = webhook_subscription_enabled and webhook_subscription_failures + 1 < $2,
+				webhook_subscription_disabled_reason = case
+					when webhook_subscription_enabled and webhook_subscription_failures + 1 >= $2
+					then format('disabled after %s failed attempts in a row; the last failed with: %s', $2::int, $3::text)
+					else webhook_subscription_disabled_reason end,
+				webhook_subscription_version = webhook_subscription_version
+					+ case when webhook_subscription_enabled and webhook_subscription_failures + 1 >= $2 then 1 else 0 end
+			where webhook_subscription_id = (select webhook_delivery_subscription_id from webhook_deliveries where webhook_delivery_id = $1)
+			returning webhook_subscription_enabled`
+		err = tx.QueryRowContext(ctx, query, deliveryId, disableAfter, attempt.Error).Scan(&enabled)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	status := WebhookDeliveryPending
+	switch {
+	case attempt.Error == "":
+		status = WebhookDeliverySucceeded
+	case final || !enabled:
+		status = WebhookDeliveryFailed
+	}
+
+	query = `update webhook_deliveries set webhook_delivery_status = $1, webhook_delivery_attempts = webhook_delivery_attempts + 1,
+			webhook_delivery_response_status = $2, webhook_delivery_error = $3,
+			webhook_delivery_delivered_at = case when $4 then now() end
+		where webhook_delivery_id = $5`
+
+	_, err = tx.ExecContext(ctx, query, status, nullInt(attempt.Response_Status), attempt.Error, status == WebhookDeliverySucceeded, deliveryId)
+	if err != nil {
+		return "", err
+	}
+
+	return status, tx.Commit()
+}
+
+// FailWebhookDelivery gives up on the pending delivery without another
+// attempt, with reason as its error.
+func (m *WebhookModel) FailWebhookDelivery(id int64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "update webhook_deliveries set webhook_delivery_status = $1, webhook_delivery_error = $2 where webhook_delivery_id = $3 and webhook_delivery_status = $4"
+
+	_, err := m.DB.ExecContext(ctx, query, WebhookDeliveryFailed, reason, id, WebhookDeliveryPending)
+	return err
+}
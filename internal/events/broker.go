@@ -0,0 +1,241 @@
+package events
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/database"
+	"github.com/lib/pq"
+)
+
+const (
+	// subscriptionBuffer is how many events a subscriber may fall behind by
+	// before it is dropped.
+	subscriptionBuffer = 64
+	// catchUpBatchSize is how many missed events are read at once after the
+	// connection to the database comes back.
+	catchUpBatchSize = 100
+)
+
+// Lookback is how long a transaction may take to record an event and commit
+// for the event still to be found by readers that resume after a later
+// event. Outbox ids are taken when events are recorded, so an event can
+// commit after one with a higher id; resuming reads again from the events
+// recorded within Lookback before the last one seen. The models' transactions
+// time out after a few seconds, so a minute leaves plenty of room.
+const Lookback = time.Minute
+
+// Broker pushes events to subscribers in this process as soon as the
+// transaction that recorded them commits, without waiting for the relay.
+// Postgres announces the id of every new outbox event on
+// database.OutboxChannel, so events recorded through any instance reach the
+// subscribers of every instance. Delivery is best effort: a subscriber that
+// falls behind is dropped, and is expected to subscribe again and read what
+// it missed from the outbox. After the connection to the database comes back
+// the events of the last Lookback are passed on again, so a subscriber may be
+// given an event twice.
+type Broker struct {
+	model *database.OutboxModel
+	dsn   string
+	ready chan struct{}
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	lastId int64
+}
+
+// Subscription receives the events its match function accepts.
+type Subscription struct {
+	broker *Broker
+	match  func(Event) bool
+	events chan Event
+}
+
+// NewBroker returns a broker that listens through its own connection to the
+// database at dsn and loads events through model.
+func NewBroker(model *database.OutboxModel, dsn string) *Broker {
+	return &Broker{
+		model: model,
+		dsn:   dsn,
+		ready: make(chan struct{}),
+		subs:  map[*Subscription]struct{}{},
+	}
+}
+
+// Ready returns a channel that is closed once the broker is listening.
+func (b *Broker) Ready() <-chan struct{} {
+	return b.ready
+}
+
+// Run listens for new events and passes them to subscribers until ctx is
+// done, when every subscription is closed. Events announced while the
+// connection was down are read from the outbox once it is back.
+func (b *Broker) Run(ctx context.Context) {
+	connected := make(chan struct{})
+	var once sync.Once
+	listener := pq.NewListener(b.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnected:
+			once.Do(func() { close(connected) })
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("listening for events: %v", err)
+		}
+	})
+	defer listener.Close()
+	defer b.closeAll()
+
+	if err := listener.Listen(database.OutboxChannel); err != nil {
+		log.Printf("listening for events: %v", err)
+		return
+	}
+	go func() {
+		select {
+		case <-connected:
+			close(b.ready)
+		case <-ctx.Done():
+		}
+	}()
+
+	// pq only notices a dead connection when it is used
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			go listener.Ping()
+		case n := <-listener.Notify:
+			// nil is sent after reconnecting, when notifications may have
+			// been lost
+			if n == nil {
+				b.catchUp()
+				continue
+			}
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				log.Printf("listening for events: unexpected notification %q", n.Extra)
+				continue
+			}
+			b.announce(id)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events match accepts. Its channel
+// is closed when the subscription is dropped for falling behind or the
+// broker stops; either way the subscriber must stop reading from it.
+func (b *Broker) Subscribe(match func(Event) bool) *Subscription {
+	sub := &Subscription{broker: b, match: match, events: make(chan Event, subscriptionBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Events returns the channel events are sent on.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s)
+}
+
+// announce loads the newly committed event and passes it on.
+func (b *Broker) announce(id int64) {
+	b.mu.Lock()
+	idle := len(b.subs) == 0
+	if idle {
+		b.lastId = max(b.lastId, id)
+	}
+	b.mu.Unlock()
+	if idle {
+		return
+	}
+
+	e, err := b.model.GetOutboxEvent(id)
+	if err != nil {
+		log.Printf("loading event %d: %v", id, err)
+		return
+	}
+	// purged already
+	if e == nil {
+		return
+	}
+	b.dispatch(NewEvent(e))
+}
+
+// catchUp passes on the events recorded after the last one seen, and those
+// recorded shortly before it that may have committed after it.
+func (b *Broker) catchUp() {
+	b.mu.Lock()
+	after := b.lastId
+	b.mu.Unlock()
+	if after == 0 {
+		return
+	}
+
+	lookbackId, err := b.model.GetOutboxLookbackId(after, Lookback)
+	if err != nil {
+		log.Printf("catching up on events after %d: %v", after, err)
+		return
+	}
+	after = lookbackId
+
+	for {
+		missed, err := b.model.GetOutboxEvents(database.OutboxEventFilter{After: after, Limit: catchUpBatchSize})
+		if err != nil {
+			log.Printf("catching up on events after %d: %v", after, err)
+			return
+		}
+		for _, e := range missed {
+			b.dispatch(NewEvent(e))
+			after = e.Id
+		}
+		if len(missed) < catchUpBatchSize {
+			return
+		}
+	}
+}
+
+func (b *Broker) dispatch(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastId = max(b.lastId, e.Id)
+	for sub := range b.subs {
+		if !sub.match(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// drop removes the subscription and closes its channel. b.mu must be held.
+func (b *Broker) drop(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+func (b *Broker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
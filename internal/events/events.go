@@ -0,0 +1,45 @@
+// Package events relays domain events from the outbox table to other
+// services. Models record an event in the same transaction as the change it
+// describes; a Relay then hands each event to an EventPublisher until the
+// publisher accepts it. Delivery is at least once: an event may be published
+// again after a crash or a failed acknowledgement, so consumers must ignore
+// event ids they have already seen. A Broker also pushes new events straight
+// to subscribers in the process, such as clients streaming order updates.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/database"
+)
+
+// Event is a domain event as it is published.
+type Event struct {
+	Id             int64           `json:"id"`
+	Type           string          `json:"type"`
+	Aggregate_Type string          `json:"aggregate_type"`
+	Aggregate_Id   int             `json:"aggregate_id"`
+	Occurred_At    time.Time       `json:"occurred_at"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// EventPublisher delivers events to other services. Publish returns nil only
+// once the event is safely delivered; on an error the event is published
+// again later.
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// NewEvent returns the outbox event as it is published.
+func NewEvent(e *database.OutboxEvent) Event {
+	return Event{
+		Id:             e.Id,
+		Type:           e.Type,
+		Aggregate_Type: e.Aggregate_Type,
+		Aggregate_Id:   e.Aggregate_Id,
+		Occurred_At:    e.Created_At,
+		Data:           e.Data,
+	}
+}
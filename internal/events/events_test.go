@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEvent = Event{
+	Id:             7,
+	Type:           "order.created",
+	Aggregate_Type: "order",
+	Aggregate_Id:   3,
+	Occurred_At:    time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC),
+	Data:           json.RawMessage(`{"order_id":3}`),
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	require.NoError(t, m.Publish(context.Background(), testEvent))
+	require.NoError(t, m.Publish(context.Background(), testEvent))
+	assert.Equal(t, []Event{testEvent, testEvent}, m.Events())
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	f, err := NewFile(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Publish(context.Background(), testEvent))
+	require.NoError(t, f.Close())
+
+	// events are appended to what is there
+	f, err = NewFile(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Publish(context.Background(), testEvent))
+	require.NoError(t, f.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"id":7,"type":"order.created","aggregate_type":"order","aggregate_id":3,
+		"occurred_at":"2025-03-01T12:00:00Z","data":{"order_id":3}}`, lines[1])
+}
+
+func TestHTTP(t *testing.T) {
+	status := http.StatusAccepted
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	h := NewHTTP(server.URL, server.Client())
+	require.NoError(t, h.Publish(context.Background(), testEvent))
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "7", got.Header.Get("Event-Id"))
+	assert.Equal(t, "order.created", got.Header.Get("Event-Type"))
+
+	var decoded Event
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, testEvent, decoded)
+
+	status = http.StatusServiceUnavailable
+	assert.ErrorContains(t, h.Publish(context.Background(), testEvent), "503 Service Unavailable")
+}
+
+type failing struct{}
+
+func (failing) Publish(ctx context.Context, event Event) error {
+	return errors.New("unavailable")
+}
+
+func TestMulti(t *testing.T) {
+	first, second := NewMemory(), NewMemory()
+	require.NoError(t, Multi{first, second}.Publish(context.Background(), testEvent))
+	assert.Equal(t, []Event{testEvent}, first.Events())
+	assert.Equal(t, []Event{testEvent}, second.Events())
+
+	// publishing stops at the first failure
+	assert.EqualError(t, Multi{first, failing{}, second}.Publish(context.Background(), testEvent), "unavailable")
+	assert.Len(t, first.Events(), 2)
+	assert.Len(t, second.Events(), 1)
+}
+
+func TestBroker_Dispatch(t *testing.T) {
+	b := NewBroker(nil, "")
+	orders := b.Subscribe(func(e Event) bool { return e.Aggregate_Type == "order" })
+	books := b.Subscribe(func(e Event) bool { return e.Aggregate_Type == "book" })
+
+	b.dispatch(testEvent)
+	assert.Equal(t, testEvent, <-orders.Events())
+	assert.Empty(t, books.Events())
+
+	// a subscriber that falls behind is dropped
+	for range subscriptionBuffer + 1 {
+		b.dispatch(testEvent)
+	}
+	for range orders.Events() {
+	}
+	_, ok := <-orders.Events()
+	assert.False(t, ok)
+
+	b.dispatch(testEvent)
+	assert.Empty(t, orders.Events())
+
+	books.Close()
+	books.Close()
+	_, ok = <-books.Events()
+	assert.False(t, ok)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, retryDelay(1))
+	assert.Equal(t, 4*time.Second, retryDelay(3))
+	assert.Equal(t, maxRetryDelay, retryDelay(15))
+	assert.Equal(t, maxRetryDelay, retryDelay(100))
+}
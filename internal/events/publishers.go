@@ -0,0 +1,126 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Memory keeps published events in memory. It is meant for development and
+// tests; events are lost when the process exits.
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(ctx context.Context, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+// Events returns the events published so far, oldest first.
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+// File appends each event as a line of JSON to a file, which other tools can
+// tail. Every event is synced to disk before it counts as published.
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFile opens the file at path for appending, creating it if needed.
+func NewFile(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("events: opening %s: %w", path, err)
+	}
+	return &File{file: file}, nil
+}
+
+func (f *File) Publish(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// HTTP posts each event as JSON to a URL. Any 2xx response means the event
+// was delivered. The event id and type are also sent in the Event-Id and
+// Event-Type headers so receivers can deduplicate and route without parsing
+// the body.
+type HTTP struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewHTTP(url string, client *http.Client) *HTTP {
+	return &HTTP{URL: url, Client: client}
+}
+
+func (h *HTTP) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Event-Id", strconv.FormatInt(event.Id, 10))
+	req.Header.Set("Event-Type", event.Type)
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("events: %s answered %s", h.URL, resp.Status)
+	}
+	return nil
+}
+
+// Multi publishes each event to every publisher in turn. An event counts as
+// published only once all of them accept it, so when one fails the event is
+// published again to those before it as well.
+type Multi []EventPublisher
+
+func (m Multi) Publish(ctx context.Context, event Event) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
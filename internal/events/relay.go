@@ -0,0 +1,94 @@
+package events
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/database"
+)
+
+const (
+	// relayBatchSize is how many events are claimed at once.
+	relayBatchSize = 100
+	// relayLease is how long claimed events are held before another relay
+	// may publish them, in case this one crashed.
+	relayLease = time.Minute
+	// maxRetryDelay bounds the wait before publishing a failed event again.
+	maxRetryDelay = 10 * time.Minute
+)
+
+// Relay publishes the events in the outbox.
+type Relay struct {
+	model     *database.OutboxModel
+	publisher EventPublisher
+	interval  time.Duration
+}
+
+// NewRelay returns a relay that looks for new events every interval.
+func NewRelay(model *database.OutboxModel, publisher EventPublisher, interval time.Duration) *Relay {
+	return &Relay{model: model, publisher: publisher, interval: interval}
+}
+
+// Run publishes events as they come in until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayPending(ctx); err != nil {
+			log.Printf("relaying events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes the events that are due, oldest first, until none
+// are left, and returns how many were published. An event the publisher
+// fails on is retried with a growing delay while later events go ahead, so
+// events are only in order while publishing succeeds.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	published := 0
+	for ctx.Err() == nil {
+		claimed, err := r.model.ClaimOutboxEvents(relayBatchSize, relayLease)
+		if err != nil {
+			return published, err
+		}
+		if len(claimed) == 0 {
+			return published, nil
+		}
+		slices.SortFunc(claimed, func(a, b *database.OutboxEvent) int { return cmp.Compare(a.Id, b.Id) })
+
+		for _, e := range claimed {
+			if err := r.publisher.Publish(ctx, NewEvent(e)); err != nil {
+				log.Printf("publishing event %d (%s): %v", e.Id, e.Type, err)
+				if err := r.model.RetryOutboxEvent(e.Id, time.Now().Add(retryDelay(e.Attempts)), err.Error()); err != nil {
+					return published, err
+				}
+				continue
+			}
+
+			if err := r.model.MarkOutboxEventPublished(e.Id); err != nil {
+				return published, err
+			}
+			published++
+		}
+	}
+	return published, nil
+}
+
+// retryDelay is how long to wait before publishing an event again after the
+// given number of attempts: a second, doubling up to maxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	if attempts > 20 {
+		return maxRetryDelay
+	}
+	return min(time.Second<<max(attempts-1, 0), maxRetryDelay)
+}
@@ -0,0 +1,237 @@
+// Package export writes streams of records as JSON, JSON Lines, CSV or
+// Parquet, one record at a time so memory does not grow with the export.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported formats.
+const (
+	JSON    = "json"
+	NDJSON  = "ndjson"
+	CSV     = "csv"
+	Parquet = "parquet"
+)
+
+// rowGroupSize is how many records a Parquet writer buffers before it writes
+// them out as a row group.
+const rowGroupSize = 10000
+
+var contentTypes = map[string]string{
+	JSON:    "application/json; charset=utf-8",
+	NDJSON:  "application/x-ndjson",
+	CSV:     "text/csv",
+	Parquet: "application/vnd.apache.parquet",
+}
+
+// mediaTypes maps the media types clients ask for to formats.
+var mediaTypes = map[string]string{
+	"application/json":               JSON,
+	"application/x-ndjson":           NDJSON,
+	"application/ndjson":             NDJSON,
+	"application/jsonl":              NDJSON,
+	"application/x-jsonlines":        NDJSON,
+	"text/csv":                       CSV,
+	"application/vnd.apache.parquet": Parquet,
+	"application/x-parquet":          Parquet,
+}
+
+// IsFormat reports whether format is supported.
+func IsFormat(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// ContentType returns the media type a format is served as.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Negotiate picks the first supported format listed in an Accept header and
+// falls back to JSON.
+func Negotiate(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if format, ok := mediaTypes[mediaType]; ok {
+			return format
+		}
+	}
+	return JSON
+}
+
+// Writer writes records of type T. Close must be called to complete the
+// output; it does not close the underlying writer.
+type Writer[T any] interface {
+	Write(record T) error
+	Close() error
+}
+
+// NewWriter returns a Writer for the format. JSON and NDJSON records are
+// encoded with encoding/json. CSV and Parquet records must be flat structs
+// whose fields are named by parquet tags; CSV uses the same names for its
+// header, leaves optional zero values empty and writes times as RFC 3339.
+func NewWriter[T any](format string, w io.Writer) (Writer[T], error) {
+	switch format {
+	case JSON:
+		return &jsonWriter[T]{w: w}, nil
+	case NDJSON:
+		return &ndjsonWriter[T]{enc: json.NewEncoder(w)}, nil
+	case CSV:
+		return newCSVWriter[T](w)
+	case Parquet:
+		return &parquetWriter[T]{w: parquet.NewGenericWriter[T](w, parquet.Compression(&parquet.Snappy), parquet.MaxRowsPerRowGroup(rowGroupSize))}, nil
+	}
+	return nil, fmt.Errorf("export: unknown format %q", format)
+}
+
+// jsonWriter writes a JSON array, which is [] when there are no records.
+type jsonWriter[T any] struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonWriter[T]) Write(record T) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if j.count == 0 {
+		sep = "["
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonWriter[T]) Close() error {
+	end := "]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+type ndjsonWriter[T any] struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter[T]) Write(record T) error { return n.enc.Encode(record) }
+func (n *ndjsonWriter[T]) Close() error         { return nil }
+
+type parquetWriter[T any] struct {
+	w *parquet.GenericWriter[T]
+}
+
+func (p *parquetWriter[T]) Write(record T) error {
+	_, err := p.w.Write([]T{record})
+	return err
+}
+
+func (p *parquetWriter[T]) Close() error { return p.w.Close() }
+
+// csvField is a struct field written as a CSV column.
+type csvField struct {
+	index    int
+	optional bool
+}
+
+type csvWriter[T any] struct {
+	w       *csv.Writer
+	header  []string
+	fields  []csvField
+	started bool
+	record  []string
+}
+
+func newCSVWriter[T any](w io.Writer) (*csvWriter[T], error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("export: CSV records must be structs, got %s", t)
+	}
+
+	c := &csvWriter[T]{w: csv.NewWriter(w)}
+	for i := range t.NumField() {
+		tag, ok := t.Field(i).Tag.Lookup("parquet")
+		name, options, _ := strings.Cut(tag, ",")
+		if !ok || name == "-" {
+			continue
+		}
+		c.header = append(c.header, name)
+		c.fields = append(c.fields, csvField{index: i, optional: strings.Contains(options, "optional")})
+	}
+	c.record = make([]string, len(c.fields))
+	return c, nil
+}
+
+// start writes the header before the first record, or on Close if there are
+// none, so nothing is written before the first record is ready.
+func (c *csvWriter[T]) start() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	return c.w.Write(c.header)
+}
+
+func (c *csvWriter[T]) Write(record T) error {
+	if err := c.start(); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(record)
+	for i, f := range c.fields {
+		field := v.Field(f.index)
+		if f.optional && field.IsZero() {
+			c.record[i] = ""
+			continue
+		}
+		c.record[i] = formatCSV(field)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter[T]) Close() error {
+	if err := c.start(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatCSV(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.String:
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
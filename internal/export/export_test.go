@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	Id         int       `parquet:"id" json:"id"`
+	Name       string    `parquet:"name" json:"name"`
+	Parent_Id  int       `parquet:"parent_id,optional" json:"parent_id,omitempty"`
+	Active     bool      `parquet:"active" json:"active"`
+	Created_At time.Time `parquet:"created_at,timestamp(millisecond)" json:"created_at"`
+}
+
+var records = []record{
+	{Id: 1, Name: "plain", Active: true, Created_At: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	{Id: 2, Name: "needs, quoting", Parent_Id: 1},
+}
+
+func write(t *testing.T, format string, records []record) string {
+	var buf bytes.Buffer
+	w, err := NewWriter[record](format, &buf)
+	require.NoError(t, err)
+	for _, r := range records {
+		require.NoError(t, w.Write(r))
+	}
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestCSV(t *testing.T) {
+	assert.Equal(t, "id,name,parent_id,active,created_at\n"+
+		"1,plain,,true,2024-01-02T03:04:05Z\n"+
+		"2,\"needs, quoting\",1,false,\n", write(t, CSV, records))
+
+	assert.Equal(t, "id,name,parent_id,active,created_at\n", write(t, CSV, nil))
+}
+
+func TestJSON(t *testing.T) {
+	assert.Equal(t, `[{"id":1,"name":"plain","active":true,"created_at":"2024-01-02T03:04:05Z"},`+
+		`{"id":2,"name":"needs, quoting","parent_id":1,"active":false,"created_at":"0001-01-01T00:00:00Z"}]`+"\n", write(t, JSON, records))
+
+	assert.Equal(t, "[]\n", write(t, JSON, nil))
+}
+
+func TestNDJSON(t *testing.T) {
+	assert.Equal(t, `{"id":1,"name":"plain","active":true,"created_at":"2024-01-02T03:04:05Z"}`+"\n"+
+		`{"id":2,"name":"needs, quoting","parent_id":1,"active":false,"created_at":"0001-01-01T00:00:00Z"}`+"\n", write(t, NDJSON, records))
+
+	assert.Equal(t, "", write(t, NDJSON, nil))
+}
+
+func TestParquet(t *testing.T) {
+	out := write(t, Parquet, records)
+
+	got, err := parquet.Read[record](bytes.NewReader([]byte(out)), int64(len(out)))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "needs, quoting", got[1].Name)
+	assert.Equal(t, 1, got[1].Parent_Id)
+	assert.True(t, records[0].Created_At.Equal(got[0].Created_At))
+}
+
+func TestNegotiate(t *testing.T) {
+	assert.Equal(t, CSV, Negotiate("text/csv"))
+	assert.Equal(t, NDJSON, Negotiate("application/x-ndjson; charset=utf-8"))
+	assert.Equal(t, Parquet, Negotiate("text/html, application/vnd.apache.parquet;q=0.9"))
+	assert.Equal(t, JSON, Negotiate("*/*"))
+	assert.Equal(t, JSON, Negotiate(""))
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter[record]("xlsx", &bytes.Buffer{})
+	assert.Error(t, err)
+	assert.False(t, IsFormat("xlsx"))
+	assert.True(t, IsFormat(Parquet))
+}
@@ -0,0 +1,116 @@
+// Package isbn validates International Standard Book Numbers and converts
+// between their 10 and 13 digit forms.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalid is returned for strings that are not a valid ISBN-10 or ISBN-13.
+var ErrInvalid = errors.New("isbn: invalid ISBN")
+
+// Clean removes the hyphens and spaces ISBNs are often printed with and upper
+// cases a trailing x.
+func Clean(s string) string {
+	s = strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s))
+	return strings.ToUpper(s)
+}
+
+// Valid10 reports whether s, once cleaned, is an ISBN-10 with a correct check
+// digit.
+func Valid10(s string) bool {
+	s = Clean(s)
+	if len(s) != 10 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var d int
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			d = int(s[i] - '0')
+		case s[i] == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * d
+	}
+	return sum%11 == 0
+}
+
+// Valid13 reports whether s, once cleaned, is an ISBN-13 with a correct check
+// digit.
+func Valid13(s string) bool {
+	s = Clean(s)
+	if len(s) != 13 || !digits(s) {
+		return false
+	}
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return false
+	}
+	return check13(s[:12]) == s[12]
+}
+
+// To13 returns the ISBN-13 of an ISBN-10 or ISBN-13, with no hyphens.
+func To13(s string) (string, error) {
+	s = Clean(s)
+	switch {
+	case Valid13(s):
+		return s, nil
+	case Valid10(s):
+		body := "978" + s[:9]
+		return body + string(check13(body)), nil
+	}
+	return "", ErrInvalid
+}
+
+// To10 returns the ISBN-10 of an ISBN-10 or ISBN-13, with no hyphens. Only
+// ISBN-13s starting with 978 have one; for the others it returns false.
+func To10(s string) (string, bool) {
+	s = Clean(s)
+	if Valid10(s) {
+		return s, true
+	}
+	if !Valid13(s) || !strings.HasPrefix(s, "978") {
+		return "", false
+	}
+	body := s[3:12]
+	return body + string(check10(body)), true
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// check13 returns the check digit of the first 12 digits of an ISBN-13.
+func check13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// check10 returns the check digit of the first 9 digits of an ISBN-10.
+func check10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(body[i]-'0')
+	}
+	c := (11 - sum%11) % 11
+	if c == 10 {
+		return 'X'
+	}
+	return byte('0' + c)
+}
@@ -0,0 +1,52 @@
+package isbn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		isbn    string
+		valid10 bool
+		valid13 bool
+	}{
+		{"0306406152", true, false},
+		{"0-306-40615-2", true, false},
+		{"0306406153", false, false},
+		{"080442957x", true, false},
+		{"9780306406157", false, true},
+		{"978-0-306-40615-7", false, true},
+		{"9780306406158", false, false},
+		{"9791034304578", false, true},
+		{"1234567890123", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.isbn, func(t *testing.T) {
+			assert.Equal(t, tt.valid10, Valid10(tt.isbn))
+			assert.Equal(t, tt.valid13, Valid13(tt.isbn))
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	got, err := To13("0-306-40615-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "9780306406157", got)
+
+	got, err = To13("080442957X")
+	assert.NoError(t, err)
+	assert.Equal(t, "9780804429573", got)
+
+	_, err = To13("0306406153")
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	ten, ok := To10("9780804429573")
+	assert.True(t, ok)
+	assert.Equal(t, "080442957X", ten)
+
+	_, ok = To10("9791034304578")
+	assert.False(t, ok, "979 ISBNs have no ISBN-10")
+}
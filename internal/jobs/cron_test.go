@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpec(t *testing.T) {
+	for _, spec := range []string{"* * * * *", "*/15 0-6,22 1 1-12/2 1-5", "@hourly", "@daily", "@weekly", "@monthly", "@every 90s", "0 0 * * 7"} {
+		_, err := ParseSpec(spec)
+		assert.NoError(t, err, spec)
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every 1ms", "@every soon"} {
+		_, err := ParseSpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSpecNext(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2025, time.January, 15, 10, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.January, 15, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, time.January, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2025, time.January, 15, 10, 40, 0, 0, time.UTC)},
+		{"15 9 * * 1-5", time.Date(2025, time.January, 16, 9, 15, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, time.January, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		// either day matches when both are restricted
+		{"0 0 20 * 5", time.Date(2025, time.January, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"@every 1h", time.Date(2025, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{"@every 25m", time.Date(2025, time.January, 15, 10, 50, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			spec, err := ParseSpec(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, spec.Next(from))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range []time.Duration{minBackoff, minBackoff, 2 * minBackoff, 4 * minBackoff} {
+		got := backoff(attempts)
+		assert.LessOrEqual(t, got, want)
+		assert.Greater(t, got, want*4/5)
+	}
+	assert.LessOrEqual(t, backoff(50), maxBackoff)
+	assert.Greater(t, backoff(50), maxBackoff*4/5)
+}
@@ -0,0 +1,413 @@
+// Package jobs runs background work queued in Postgres. Handlers are
+// registered per job type; a pool of workers claims due jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED, so any number of servers can share the
+// queue. Failed jobs are retried with exponential backoff until they run out
+// of attempts and are left dead for an admin to look at. Workers hold a
+// lease on the jobs they run and renew it while the job runs; jobs whose
+// lease runs out, because their worker crashed, are picked up again.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/database"
+)
+
+// Config tunes a Queue.
+type Config struct {
+	// Workers is how many jobs run at once. With none, jobs are only queued.
+	Workers int
+	// PollInterval is how often idle workers look for due jobs.
+	PollInterval time.Duration
+	// Lease is how long a job stays with its worker without a heartbeat
+	// before it is recovered.
+	Lease time.Duration
+}
+
+// Backoff bounds for retries.
+const (
+	minBackoff = 10 * time.Second
+	maxBackoff = time.Hour
+)
+
+var (
+	// ErrUnknownType is returned when queueing a job no handler is
+	// registered for.
+	ErrUnknownType = errors.New("jobs: no handler is registered for the job type")
+	// ErrCancelled is the cause of a handler's context being done when
+	// cancelling the job was requested.
+	ErrCancelled = errors.New("jobs: the job was cancelled")
+
+	errLeaseLost = errors.New("jobs: the lease on the job was lost")
+)
+
+// permanentError marks an error that retrying will not fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails for good instead of being retried.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Job is a job being run, handed to its handler.
+type Job struct {
+	*database.Job
+	q *Queue
+}
+
+// SetProgress records how far along the job is, as a percentage, with an
+// optional message such as "300 of 1000 rows".
+func (j *Job) SetProgress(percent int, message string) error {
+	return j.q.model.SetJobProgress(j.Id, j.q.worker, percent, message)
+}
+
+type handler struct {
+	run         func(ctx context.Context, job *Job) (any, error)
+	maxAttempts int
+	timeout     time.Duration
+}
+
+// Option configures how jobs of a type run.
+type Option func(*handler)
+
+// MaxAttempts sets how many times a job is tried before it is dead. The
+// default is 3.
+func MaxAttempts(n int) Option {
+	return func(h *handler) { h.maxAttempts = max(n, 1) }
+}
+
+// Timeout cancels an attempt that runs longer than d.
+func Timeout(d time.Duration) Option {
+	return func(h *handler) { h.timeout = d }
+}
+
+// Handle registers fn to run jobs of the type. The job's payload is decoded
+// into P, and whatever fn returns is stored as the job's result. Handlers
+// should stop when ctx is done, which happens when the job is cancelled,
+// times out or the server shuts down. Handle must be called before Run.
+func Handle[P any](q *Queue, jobType string, fn func(ctx context.Context, job *Job, payload P) (any, error), opts ...Option) {
+	h := &handler{maxAttempts: 3}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.run = func(ctx context.Context, job *Job) (any, error) {
+		var payload P
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, Permanent(fmt.Errorf("decoding payload: %w", err))
+		}
+		return fn(ctx, job, payload)
+	}
+	q.handlers[jobType] = h
+	q.types = append(q.types, jobType)
+}
+
+type schedule struct {
+	name    string
+	spec    *Spec
+	jobType string
+	payload any
+}
+
+// Queue queues jobs and runs them on a pool of workers.
+type Queue struct {
+	model     *database.JobModel
+	config    Config
+	worker    string
+	handlers  map[string]*handler
+	types     []string
+	schedules []schedule
+	wake      chan struct{}
+}
+
+// NewQueue returns a queue storing its jobs through model.
+func NewQueue(model *database.JobModel, config Config) *Queue {
+	host, _ := os.Hostname()
+	return &Queue{
+		model:    model,
+		config:   config,
+		worker:   fmt.Sprintf("%s-%d-%d", host, os.Getpid(), rand.Uint32()),
+		handlers: map[string]*handler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// EnqueueOption sets up a queued job.
+type EnqueueOption func(*database.Job)
+
+// RunAt delays the job until t.
+func RunAt(t time.Time) EnqueueOption {
+	return func(job *database.Job) { job.Run_At = t }
+}
+
+// UniqueKey stops the job from being queued if a job with the same key
+// exists, in which case Enqueue returns database.ErrJobExists.
+func UniqueKey(key string) EnqueueOption {
+	return func(job *database.Job) { job.Unique_Key = key }
+}
+
+// CreatedBy records the user who asked for the job.
+func CreatedBy(userId int) EnqueueOption {
+	return func(job *database.Job) { job.Created_By = userId }
+}
+
+// Enqueue queues a job of the type with the payload encoded as JSON.
+func (q *Queue) Enqueue(jobType string, payload any, opts ...EnqueueOption) (*database.Job, error) {
+	h, ok := q.handlers[jobType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, jobType)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &database.Job{Type: jobType, Payload: data, Max_Attempts: h.maxAttempts}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	if err := q.model.CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	// wake an idle worker rather than wait for the next poll
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Schedule queues a job of the type whenever spec fires, in UTC. Every
+// server may run the same schedules; each firing is queued once. Schedule
+// must be called before Run.
+func (q *Queue) Schedule(name string, spec string, jobType string, payload any) error {
+	s, err := ParseSpec(spec)
+	if err != nil {
+		return err
+	}
+	if _, ok := q.handlers[jobType]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownType, jobType)
+	}
+	q.schedules = append(q.schedules, schedule{name: name, spec: s, jobType: jobType, payload: payload})
+	return nil
+}
+
+// Run starts the workers, the scheduler and the recovery of abandoned jobs,
+// and blocks until ctx is done and running jobs have stopped. Jobs cut short
+// by shutting down are queued again without using up an attempt.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range q.config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+
+	for _, s := range q.schedules {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.schedule(ctx, s)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.recover(ctx)
+	}()
+
+	wg.Wait()
+}
+
+// RunPending runs due jobs one after another until none are left. It is
+// meant for tests and tools that do not run the worker pool.
+func (q *Queue) RunPending(ctx context.Context) error {
+	for {
+		job, err := q.model.ClaimJob(q.types, q.worker, q.config.Lease)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return nil
+		}
+		q.run(ctx, job)
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.RunPending(ctx); err != nil {
+			log.Printf("claiming job: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *Queue) schedule(ctx context.Context, s schedule) {
+	for {
+		next := s.spec.Next(time.Now().UTC())
+		if next.IsZero() {
+			log.Printf("schedule %s never fires", s.name)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		key := fmt.Sprintf("schedule:%s:%d", s.name, next.Unix())
+		_, err := q.Enqueue(s.jobType, s.payload, UniqueKey(key), RunAt(next))
+		if err != nil && !errors.Is(err, database.ErrJobExists) {
+			log.Printf("queueing scheduled job %s: %v", s.name, err)
+		}
+	}
+}
+
+func (q *Queue) recover(ctx context.Context) {
+	ticker := time.NewTicker(q.config.Lease / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := q.model.RecoverJobs()
+		if err != nil {
+			log.Printf("recovering abandoned jobs: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("recovered %d abandoned jobs", n)
+		}
+	}
+}
+
+// run runs a claimed job and records how it ended.
+func (q *Queue) run(ctx context.Context, dbJob *database.Job) {
+	h := q.handlers[dbJob.Type]
+	job := &Job{Job: dbJob, q: q}
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if h.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		jobCtx, cancelTimeout = context.WithTimeout(jobCtx, h.timeout)
+		defer cancelTimeout()
+	}
+
+	done := make(chan struct{})
+	go q.heartbeat(job, cancel, done)
+
+	result, err := runHandler(jobCtx, h, job)
+	close(done)
+
+	var finish error
+	switch cause := context.Cause(jobCtx); {
+	case errors.Is(cause, errLeaseLost):
+		log.Printf("job %d (%s) was recovered from this worker while it ran", job.Id, job.Type)
+		return
+	case err == nil:
+		var data []byte
+		if data, err = json.Marshal(result); err != nil {
+			finish = q.model.FinishJob(job.Id, q.worker, database.JobDead, nil, fmt.Sprintf("encoding result: %v", err))
+			break
+		}
+		finish = q.model.FinishJob(job.Id, q.worker, database.JobSucceeded, data, "")
+	case errors.Is(cause, ErrCancelled):
+		finish = q.model.FinishJob(job.Id, q.worker, database.JobCancelled, nil, "")
+	case ctx.Err() != nil:
+		finish = q.model.ReleaseJob(job.Id, q.worker)
+	case errors.As(err, new(permanentError)) || job.Attempts >= job.Max_Attempts:
+		finish = q.model.FinishJob(job.Id, q.worker, database.JobDead, nil, err.Error())
+	default:
+		finish = q.model.RetryJob(job.Id, q.worker, time.Now().Add(backoff(job.Attempts)), err.Error())
+	}
+
+	if finish != nil {
+		log.Printf("recording the end of job %d (%s): %v", job.Id, job.Type, finish)
+	}
+}
+
+// runHandler runs the handler, turning a panic into a permanent error so one
+// bad job does not take the worker down.
+func runHandler(ctx context.Context, h *handler, job *Job) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %d (%s) panicked: %v\n%s", job.Id, job.Type, r, debug.Stack())
+			err = Permanent(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	return h.run(ctx, job)
+}
+
+// heartbeat renews the job's lease until done is closed, and cancels the job
+// when cancelling it is requested or the lease is lost.
+func (q *Queue) heartbeat(job *Job, cancel context.CancelCauseFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(q.config.Lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		cancelRequested, err := q.model.HeartbeatJob(job.Id, q.worker, q.config.Lease)
+		switch {
+		case errors.Is(err, database.ErrJobLost):
+			cancel(errLeaseLost)
+			return
+		case err != nil:
+			log.Printf("renewing lease on job %d: %v", job.Id, err)
+		case cancelRequested:
+			cancel(ErrCancelled)
+			return
+		}
+	}
+}
+
+// backoff is how long to wait before another attempt after the given number
+// of failed attempts: doubling from minBackoff up to maxBackoff, with jitter
+// so that jobs failing together do not retry together.
+func backoff(attempts int) time.Duration {
+	d := maxBackoff
+	if attempts < 20 {
+		d = min(minBackoff<<max(attempts-1, 0), maxBackoff)
+	}
+	return d - time.Duration(rand.Int64N(int64(d)/5))
+}
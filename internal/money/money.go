@@ -0,0 +1,265 @@
+// Package money represents amounts of money as integer minor units of an ISO
+// 4217 currency, so prices never pass through floating point.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency existing prices were converted to.
+const DefaultCurrency = "USD"
+
+var (
+	// ErrCurrencyMismatch is returned when combining amounts of different
+	// currencies.
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+	// ErrUnknownCurrency is returned for currency codes not in the table.
+	ErrUnknownCurrency = errors.New("money: unknown currency")
+)
+
+// minorUnits is the number of decimal places of each supported currency.
+var minorUnits = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MXN": 2,
+	"NZD": 2,
+	"SEK": 2,
+	"USD": 2,
+}
+
+// Money is an amount in the minor units of a currency, for example cents for
+// USD or yen for JPY. Amounts must not be negative in requests.
+type Money struct {
+	Amount   int64  `json:"amount" binding:"min=0"`
+	Currency string `json:"currency" binding:"required,currency"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// IsCurrency reports whether code is a supported ISO 4217 currency code.
+func IsCurrency(code string) bool {
+	_, ok := minorUnits[code]
+	return ok
+}
+
+// MinorUnits returns the number of decimal places of the currency.
+func MinorUnits(currency string) (int, error) {
+	units, ok := minorUnits[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return units, nil
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Cmp compares m to other, returning -1, 0 or +1.
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Mul multiplies m by a whole quantity.
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// MulRat multiplies m by num/den and rounds the result to the nearest minor
+// unit, halves away from zero. It is used for percentages and rates, for
+// example MulRat(825, 10000) for 8.25%.
+func (m Money) MulRat(num, den int64) Money {
+	r := new(big.Rat).SetFrac(big.NewInt(m.Amount), big.NewInt(1))
+	r.Mul(r, big.NewRat(num, den))
+	return Money{Amount: roundHalfAway(r), Currency: m.Currency}
+}
+
+// roundHalfAway rounds r to an integer, halves away from zero.
+func roundHalfAway(r *big.Rat) int64 {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+// Allocate splits m in proportion to ratios without losing minor units. The
+// remainder left by rounding down is handed out one unit at a time from the
+// first share, so the shares always add up to m.
+func (m Money) Allocate(ratios ...int64) []Money {
+	var total int64
+	for _, ratio := range ratios {
+		total += ratio
+	}
+
+	shares := make([]Money, len(ratios))
+	if total == 0 {
+		for i := range shares {
+			shares[i] = Money{Currency: m.Currency}
+		}
+		return shares
+	}
+
+	remainder := m.Amount
+	for i, ratio := range ratios {
+		shares[i] = Money{Amount: m.Amount * ratio / total, Currency: m.Currency}
+		remainder -= shares[i].Amount
+	}
+
+	step := int64(1)
+	if remainder < 0 {
+		step = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(shares) {
+		if ratios[i] == 0 {
+			continue
+		}
+		shares[i].Amount += step
+		remainder -= step
+	}
+	return shares
+}
+
+// String formats m in major units followed by the currency code, such as
+// "12.99 USD".
+func (m Money) String() string {
+	units, ok := minorUnits[m.Currency]
+	if !ok || units == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := fmt.Sprintf("%0*d", units+1, amount)
+	return fmt.Sprintf("%s%s.%s %s", sign, digits[:len(digits)-units], digits[len(digits)-units:], m.Currency)
+}
+
+// Parse reads an amount in the format produced by String. The amount may not
+// have more decimal places than the currency has minor units.
+func Parse(s string) (Money, error) {
+	value, currency, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return Money{}, fmt.Errorf("money: %q is not an amount followed by a currency", s)
+	}
+
+	units, err := MinorUnits(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if len(fraction) > units {
+		return Money{}, fmt.Errorf("money: %s has at most %d decimal places, got %q", currency, units, value)
+	}
+	fraction += strings.Repeat("0", units-len(fraction))
+
+	negative := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+	if whole == "" || strings.ContainsAny(whole+fraction, "+-") {
+		return Money{}, fmt.Errorf("money: invalid amount %q", value)
+	}
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// maxRateDecimals is the precision exchange rates are kept at.
+const maxRateDecimals = 10
+
+// ParseRate reads a positive decimal exchange rate such as "0.9215".
+func ParseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("money: invalid exchange rate %q", s)
+	}
+	return rate, nil
+}
+
+// FormatRate formats rate as a decimal with at most ten decimal places and
+// no trailing zeros.
+func FormatRate(rate *big.Rat) string {
+	s := rate.FloatString(maxRateDecimals)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Convert converts m into currency at rate, the price of one major unit of
+// m's currency in major units of currency, rounding to the nearest minor unit
+// of currency, halves away from zero.
+func (m Money) Convert(currency string, rate *big.Rat) (Money, error) {
+	from, err := MinorUnits(m.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	to, err := MinorUnits(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	r := new(big.Rat).SetFrac(big.NewInt(m.Amount), big.NewInt(1))
+	r.Mul(r, rate)
+	scale := new(big.Rat).SetFrac(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(to)), nil), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(from)), nil))
+	r.Mul(r, scale)
+	return Money{Amount: roundHalfAway(r), Currency: currency}, nil
+}
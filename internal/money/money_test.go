@@ -0,0 +1,117 @@
+package money
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddSub(t *testing.T) {
+	sum, err := New(1050, "USD").Add(New(275, "USD"))
+	require.NoError(t, err)
+	assert.Equal(t, New(1325, "USD"), sum)
+
+	diff, err := New(1050, "USD").Sub(New(1100, "USD"))
+	require.NoError(t, err)
+	assert.Equal(t, New(-50, "USD"), diff)
+
+	_, err = New(1, "USD").Add(New(1, "EUR"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestMulRat(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{1000, 825, 10000, 83},   // 82.5 rounds up
+		{1000, 824, 10000, 82},   // 82.4 rounds down
+		{-1000, 825, 10000, -83}, // halves round away from zero
+		{199, 1, 3, 66},
+		{200, 1, 3, 67},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, New(tt.want, "USD"), New(tt.amount, "USD").MulRat(tt.num, tt.den))
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	shares := New(100, "USD").Allocate(1, 1, 1)
+	assert.Equal(t, []Money{New(34, "USD"), New(33, "USD"), New(33, "USD")}, shares)
+
+	shares = New(5, "USD").Allocate(0, 1, 1)
+	assert.Equal(t, []Money{New(0, "USD"), New(3, "USD"), New(2, "USD")}, shares)
+
+	shares = New(-5, "USD").Allocate(1, 1)
+	assert.Equal(t, []Money{New(-3, "USD"), New(-2, "USD")}, shares)
+}
+
+func TestStringAndParse(t *testing.T) {
+	tests := []struct {
+		money Money
+		text  string
+	}{
+		{New(1299, "USD"), "12.99 USD"},
+		{New(5, "USD"), "0.05 USD"},
+		{New(-5, "EUR"), "-0.05 EUR"},
+		{New(1500, "JPY"), "1500 JPY"},
+		{New(1234, "KWD"), "1.234 KWD"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.text, tt.money.String())
+
+		parsed, err := Parse(tt.text)
+		require.NoError(t, err)
+		assert.Equal(t, tt.money, parsed)
+	}
+
+	parsed, err := Parse("12.5 USD")
+	require.NoError(t, err)
+	assert.Equal(t, New(1250, "USD"), parsed)
+
+	for _, bad := range []string{"12.999 USD", "12 XXX", "12", "1.2.3 USD", "abc USD", "--1 USD"} {
+		_, err := Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		from     Money
+		currency string
+		rate     string
+		want     Money
+	}{
+		{New(1000, "USD"), "EUR", "0.92", New(920, "EUR")},
+		{New(1999, "USD"), "EUR", "0.9215", New(1842, "EUR")}, // 1842.08
+		{New(1000, "USD"), "JPY", "149.5", New(1495, "JPY")},
+		{New(1495, "JPY"), "USD", "0.0066889632", New(1000, "USD")},
+		{New(1000, "USD"), "KWD", "0.3075", New(3075, "KWD")},
+	}
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		require.NoError(t, err)
+		got, err := tt.from.Convert(tt.currency, rate)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.rate)
+	}
+
+	_, err := New(1, "USD").Convert("XXX", big.NewRat(1, 1))
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestRates(t *testing.T) {
+	for _, bad := range []string{"0", "-1.5", "abc", "1/3", "1e3", ""} {
+		_, err := ParseRate(bad)
+		assert.Error(t, err, bad)
+	}
+
+	rate, err := ParseRate("0.9200")
+	require.NoError(t, err)
+	assert.Equal(t, "0.92", FormatRate(rate))
+	assert.Equal(t, "1.0869565217", FormatRate(new(big.Rat).Inv(rate)))
+	assert.Equal(t, "150", FormatRate(big.NewRat(150, 1)))
+}
@@ -0,0 +1,257 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// Payment methods understood by the fake provider. Any other method is
+// treated like FakeMethodOK.
+const (
+	FakeMethodOK = "fake_ok"
+	// FakeMethodDecline makes Authorize fail with ErrDeclined.
+	FakeMethodDecline = "fake_decline"
+	// FakeMethodTimeout makes Authorize hang until the context is done and
+	// then fail with ErrTimeout.
+	FakeMethodTimeout = "fake_timeout"
+	// FakeMethodDuplicateWebhook sends every webhook for the payment twice.
+	FakeMethodDuplicateWebhook = "fake_duplicate_webhook"
+)
+
+const fakeSignatureHeader = "Fake-Signature"
+
+// Webhook is a signed webhook as the fake provider would send it.
+type Webhook struct {
+	Body   []byte
+	Header http.Header
+}
+
+type fakePayment struct {
+	method   string
+	amount   money.Money
+	captured money.Money
+	refunded money.Money
+	status   Status
+}
+
+// fakeRefund is a refund made with an idempotency key.
+type fakeRefund struct {
+	providerPaymentId string
+	amount            money.Money
+}
+
+// Fake is an in-memory provider for local use and tests. Ids are handed out
+// in sequence so runs are reproducible. Webhooks are signed with the secret
+// and recorded; when WebhookURL is set they are also posted there.
+type Fake struct {
+	WebhookURL string
+
+	secret   []byte
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+	refunds  map[string]fakeRefund
+	webhooks []Webhook
+	nextId   int
+	nextEvt  int
+}
+
+func NewFake(secret string) *Fake {
+	return &Fake{
+		secret:   []byte(secret),
+		payments: map[string]*fakePayment{},
+		refunds:  map[string]fakeRefund{},
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	switch req.Payment_Method {
+	case FakeMethodDecline:
+		return nil, ErrDeclined
+	case FakeMethodTimeout:
+		<-ctx.Done()
+		return nil, ErrTimeout
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextId++
+	id := fmt.Sprintf("fake_pay_%d", f.nextId)
+	f.payments[id] = &fakePayment{
+		method:   req.Payment_Method,
+		amount:   req.Amount,
+		captured: money.New(0, req.Amount.Currency),
+		refunded: money.New(0, req.Amount.Currency),
+		status:   StatusAuthorized,
+	}
+
+	return &Result{Provider_Payment_Id: id, Status: StatusAuthorized}, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, providerPaymentId string, amount money.Money) (*Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[providerPaymentId]
+	if !ok {
+		return nil, fmt.Errorf("fake: unknown payment %q", providerPaymentId)
+	}
+	if p.status != StatusAuthorized {
+		return nil, fmt.Errorf("fake: cannot capture a %s payment", p.status)
+	}
+	if cmp, err := amount.Cmp(p.amount); err != nil || cmp > 0 {
+		return nil, fmt.Errorf("fake: cannot capture %s of an authorization for %s", amount, p.amount)
+	}
+
+	p.captured = amount
+	p.status = StatusCaptured
+	f.emit(providerPaymentId, p, EventCaptured, p.captured)
+
+	return &Result{Provider_Payment_Id: providerPaymentId, Status: p.status}, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, providerPaymentId string, amount money.Money, key string) (*Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[providerPaymentId]
+	if !ok {
+		return nil, fmt.Errorf("fake: unknown payment %q", providerPaymentId)
+	}
+	if prev, ok := f.refunds[key]; ok && key != "" {
+		if prev != (fakeRefund{providerPaymentId, amount}) {
+			return nil, fmt.Errorf("fake: refund key %q was used for another refund", key)
+		}
+		return &Result{Provider_Payment_Id: providerPaymentId, Status: p.status}, nil
+	}
+	if p.status != StatusCaptured && p.status != StatusRefunded {
+		return nil, fmt.Errorf("fake: cannot refund a %s payment", p.status)
+	}
+	remaining, _ := p.captured.Sub(p.refunded)
+	if cmp, err := amount.Cmp(remaining); err != nil || !amount.IsPositive() || cmp > 0 {
+		return nil, fmt.Errorf("fake: cannot refund %s of %s remaining", amount, remaining)
+	}
+
+	p.refunded, _ = p.refunded.Add(amount)
+	if key != "" {
+		f.refunds[key] = fakeRefund{providerPaymentId, amount}
+	}
+	if p.refunded == p.captured {
+		p.status = StatusRefunded
+	}
+	f.emit(providerPaymentId, p, EventRefunded, p.refunded)
+
+	return &Result{Provider_Payment_Id: providerPaymentId, Status: p.status}, nil
+}
+
+func (f *Fake) Void(ctx context.Context, providerPaymentId string) (*Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[providerPaymentId]
+	if !ok {
+		return nil, fmt.Errorf("fake: unknown payment %q", providerPaymentId)
+	}
+	if p.status != StatusAuthorized {
+		return nil, fmt.Errorf("fake: cannot void a %s payment", p.status)
+	}
+
+	p.status = StatusVoided
+	f.emit(providerPaymentId, p, EventVoided, money.New(0, p.amount.Currency))
+
+	return &Result{Provider_Payment_Id: providerPaymentId, Status: p.status}, nil
+}
+
+func (f *Fake) VerifyWebhook(header http.Header, body []byte) (*Event, error) {
+	signature, err := hex.DecodeString(header.Get(fakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, f.sign(body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("fake: decoding webhook: %w", err)
+	}
+	return &event, nil
+}
+
+// Webhooks returns every webhook sent so far, oldest first.
+func (f *Fake) Webhooks() []Webhook {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Webhook(nil), f.webhooks...)
+}
+
+// SignedWebhook builds a webhook for an arbitrary event, for tests that need
+// events the fake would not send by itself.
+func (f *Fake) SignedWebhook(event Event) Webhook {
+	body, _ := json.Marshal(event)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(fakeSignatureHeader, hex.EncodeToString(f.sign(body)))
+	return Webhook{Body: body, Header: header}
+}
+
+func (f *Fake) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// emit records a webhook for the payment. It must be called with f.mu held.
+func (f *Fake) emit(providerPaymentId string, p *fakePayment, eventType EventType, amount money.Money) {
+	f.nextEvt++
+	webhook := f.SignedWebhook(Event{
+		Id:                  fmt.Sprintf("fake_evt_%d", f.nextEvt),
+		Type:                eventType,
+		Provider_Payment_Id: providerPaymentId,
+		Amount:              amount,
+	})
+
+	copies := 1
+	if p.method == FakeMethodDuplicateWebhook {
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		f.webhooks = append(f.webhooks, webhook)
+		if f.WebhookURL != "" {
+			go f.deliver(webhook)
+		}
+	}
+}
+
+// deliver posts the webhook to WebhookURL after a short delay, like a real
+// provider would once the API call has returned.
+func (f *Fake) deliver(webhook Webhook) {
+	time.Sleep(100 * time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodPost, f.WebhookURL, bytes.NewReader(webhook.Body))
+	if err != nil {
+		log.Printf("fake payment provider: %v", err)
+		return
+	}
+	req.Header = webhook.Header.Clone()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("fake payment provider: delivering webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,127 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func usd(cents int64) money.Money {
+	return money.New(cents, "USD")
+}
+
+func TestFake_CaptureSendsSignedWebhook(t *testing.T) {
+	fake := NewFake("secret")
+	ctx := context.Background()
+
+	result, err := fake.Authorize(ctx, AuthorizeRequest{Reference: "1", Amount: usd(10), Payment_Method: FakeMethodOK})
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Provider_Payment_Id: "fake_pay_1", Status: StatusAuthorized}, result)
+
+	result, err = fake.Capture(ctx, result.Provider_Payment_Id, usd(10))
+	require.NoError(t, err)
+	assert.Equal(t, StatusCaptured, result.Status)
+
+	webhooks := fake.Webhooks()
+	require.Len(t, webhooks, 1)
+
+	event, err := fake.VerifyWebhook(webhooks[0].Header, webhooks[0].Body)
+	require.NoError(t, err)
+	assert.Equal(t, &Event{Id: "fake_evt_1", Type: EventCaptured, Provider_Payment_Id: "fake_pay_1", Amount: usd(10)}, event)
+}
+
+func TestFake_Decline(t *testing.T) {
+	fake := NewFake("secret")
+
+	_, err := fake.Authorize(context.Background(), AuthorizeRequest{Amount: usd(10), Payment_Method: FakeMethodDecline})
+	assert.ErrorIs(t, err, ErrDeclined)
+}
+
+func TestFake_Timeout(t *testing.T) {
+	fake := NewFake("secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := fake.Authorize(ctx, AuthorizeRequest{Amount: usd(10), Payment_Method: FakeMethodTimeout})
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestFake_DuplicateWebhook(t *testing.T) {
+	fake := NewFake("secret")
+	ctx := context.Background()
+
+	result, err := fake.Authorize(ctx, AuthorizeRequest{Amount: usd(10), Payment_Method: FakeMethodDuplicateWebhook})
+	require.NoError(t, err)
+	_, err = fake.Capture(ctx, result.Provider_Payment_Id, usd(10))
+	require.NoError(t, err)
+
+	webhooks := fake.Webhooks()
+	require.Len(t, webhooks, 2)
+	assert.Equal(t, webhooks[0].Body, webhooks[1].Body)
+}
+
+func TestFake_Refund(t *testing.T) {
+	fake := NewFake("secret")
+	ctx := context.Background()
+
+	result, err := fake.Authorize(ctx, AuthorizeRequest{Amount: usd(10)})
+	require.NoError(t, err)
+	_, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(5), "")
+	assert.Error(t, err, "refunding before capture")
+
+	_, err = fake.Capture(ctx, result.Provider_Payment_Id, usd(10))
+	require.NoError(t, err)
+
+	result, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(4), "")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCaptured, result.Status)
+
+	_, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(7), "")
+	assert.Error(t, err, "refunding more than is left")
+
+	result, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(6), "")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRefunded, result.Status)
+}
+
+func TestFake_Refund_Key(t *testing.T) {
+	fake := NewFake("secret")
+	ctx := context.Background()
+
+	result, err := fake.Authorize(ctx, AuthorizeRequest{Amount: usd(10)})
+	require.NoError(t, err)
+	_, err = fake.Capture(ctx, result.Provider_Payment_Id, usd(10))
+	require.NoError(t, err)
+
+	_, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(6), "return-1")
+	require.NoError(t, err)
+	// a retry is answered without refunding again
+	result, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(6), "return-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCaptured, result.Status)
+
+	_, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(5), "return-1")
+	assert.Error(t, err, "reusing a key for another amount")
+
+	_, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(5), "return-2")
+	assert.Error(t, err, "refunding more than is left")
+	result, err = fake.Refund(ctx, result.Provider_Payment_Id, usd(4), "return-2")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRefunded, result.Status)
+}
+
+func TestFake_VerifyWebhook_InvalidSignature(t *testing.T) {
+	fake := NewFake("secret")
+	webhook := NewFake("other secret").SignedWebhook(Event{Id: "evt", Type: EventCaptured})
+
+	_, err := fake.VerifyWebhook(webhook.Header, webhook.Body)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = fake.VerifyWebhook(http.Header{}, webhook.Body)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
@@ -0,0 +1,83 @@
+// Package payment defines how the API talks to a payment provider. Handlers
+// only use the Provider interface so the real provider can be swapped for the
+// fake one in development and tests.
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+var (
+	// ErrDeclined is returned when the provider refuses the payment.
+	ErrDeclined = errors.New("payment declined")
+	// ErrTimeout is returned when the provider did not answer in time. The
+	// outcome of the call is unknown.
+	ErrTimeout = errors.New("payment provider timed out")
+	// ErrInvalidSignature is returned when a webhook was not signed by the
+	// provider.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Status is the state of a payment at the provider.
+type Status string
+
+const (
+	StatusAuthorized Status = "authorized"
+	StatusCaptured   Status = "captured"
+	StatusVoided     Status = "voided"
+	StatusRefunded   Status = "refunded"
+)
+
+// EventType is the kind of change a webhook reports.
+type EventType string
+
+const (
+	EventCaptured EventType = "payment.captured"
+	EventRefunded EventType = "payment.refunded"
+	EventVoided   EventType = "payment.voided"
+	EventFailed   EventType = "payment.failed"
+)
+
+type AuthorizeRequest struct {
+	// Reference identifies the payment on our side, e.g. the order id.
+	Reference      string
+	Amount         money.Money
+	Payment_Method string
+}
+
+// Result is the provider's view of a payment after a call.
+type Result struct {
+	Provider_Payment_Id string
+	Status              Status
+}
+
+// Event is a verified webhook from the provider.
+type Event struct {
+	Id                  string    `json:"id"`
+	Type                EventType `json:"type"`
+	Provider_Payment_Id string    `json:"payment_id"`
+	// Amount is the total captured or refunded so far.
+	Amount money.Money `json:"amount"`
+}
+
+// Provider moves money for orders. Every call is made with a context that
+// carries the deadline for the provider to answer; a provider that does not
+// answer in time returns ErrTimeout.
+type Provider interface {
+	// Name identifies the provider in stored payments.
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	Capture(ctx context.Context, providerPaymentId string, amount money.Money) (*Result, error)
+	// Refund refunds amount of a captured payment. Refunds made with the same
+	// non-empty key are only made once: repeating one, e.g. after a timeout,
+	// returns the payment's result without moving money again.
+	Refund(ctx context.Context, providerPaymentId string, amount money.Money, key string) (*Result, error)
+	Void(ctx context.Context, providerPaymentId string) (*Result, error)
+	// VerifyWebhook checks the webhook was sent by the provider and decodes
+	// it. It returns ErrInvalidSignature for anything else.
+	VerifyWebhook(header http.Header, body []byte) (*Event, error)
+}
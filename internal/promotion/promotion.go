@@ -0,0 +1,264 @@
+// Package promotion works out the discounts that promotion codes give on an
+// order. Usage limits depend on past orders and are checked by the caller;
+// everything else about whether a code applies is decided here.
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// Promotion types, in the order they are applied.
+const (
+	TypeBuyXGetY     = "buy_x_get_y"
+	TypePercentOff   = "percent_off"
+	TypeFixedAmount  = "fixed_amount"
+	TypeFreeShipping = "free_shipping"
+)
+
+var typeOrder = map[string]int{TypeBuyXGetY: 0, TypePercentOff: 1, TypeFixedAmount: 2, TypeFreeShipping: 3}
+
+// Promotion is a discount customers get by entering Code. Book_Id limits
+// percent_off and buy_x_get_y to one book. Starts_At and Ends_At bound when the
+// code can be used, Min_Order_Total is compared with the order before
+// discounts and a Max_Uses of zero means no limit. Uses is how often the code
+// has been redeemed.
+type Promotion struct {
+	Id                    int64        `json:"id"`
+	Code                  string       `json:"code" binding:"required,promo_code"`
+	Description           string       `json:"description" binding:"max=200"`
+	Type                  string       `json:"type" binding:"required,oneof=buy_x_get_y percent_off fixed_amount free_shipping"`
+	Percent_Off           int          `json:"percent_off,omitempty" binding:"min=0,max=100"`
+	Amount_Off            *money.Money `json:"amount_off,omitempty" binding:"omitempty"`
+	Book_Id               int          `json:"book_id,omitempty" binding:"min=0"`
+	Buy_Quantity          int          `json:"buy_quantity,omitempty" binding:"min=0"`
+	Get_Quantity          int          `json:"get_quantity,omitempty" binding:"min=0"`
+	Min_Order_Total       *money.Money `json:"min_order_total,omitempty" binding:"omitempty"`
+	Starts_At             *time.Time   `json:"starts_at,omitempty"`
+	Ends_At               *time.Time   `json:"ends_at,omitempty"`
+	Max_Uses              int          `json:"max_uses,omitempty" binding:"min=0"`
+	Max_Uses_Per_Customer int          `json:"max_uses_per_customer,omitempty" binding:"min=0"`
+	Uses                  int          `json:"uses"`
+	Version               int          `json:"-"`
+}
+
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// IsCode reports whether code is a valid promotion code: 3 to 32 upper case
+// letters, digits, dashes or underscores.
+func IsCode(code string) bool {
+	return codePattern.MatchString(code)
+}
+
+// NormalizeCode upper cases a code as entered by a customer.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks the fields that depend on the promotion's type.
+func (p *Promotion) Validate() error {
+	switch p.Type {
+	case TypePercentOff:
+		if p.Percent_Off < 1 {
+			return errors.New("percent_off must be between 1 and 100")
+		}
+	case TypeFixedAmount:
+		if p.Amount_Off == nil || !p.Amount_Off.IsPositive() {
+			return errors.New("amount_off must be a positive amount")
+		}
+	case TypeBuyXGetY:
+		if p.Buy_Quantity < 1 || p.Get_Quantity < 1 {
+			return errors.New("buy_quantity and get_quantity must be at least 1")
+		}
+	}
+	if p.Amount_Off != nil && p.Min_Order_Total != nil && p.Amount_Off.Currency != p.Min_Order_Total.Currency {
+		return errors.New("amount_off and min_order_total must be in the same currency")
+	}
+	if p.Starts_At != nil && p.Ends_At != nil && !p.Ends_At.After(*p.Starts_At) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// NotApplicableError is returned when a code cannot be used on an order.
+type NotApplicableError struct {
+	Code   string
+	Reason string
+}
+
+func (e *NotApplicableError) Error() string {
+	return fmt.Sprintf("promotion %s %s", e.Code, e.Reason)
+}
+
+// Line is an order line before discounts.
+type Line struct {
+	Book_Id    int
+	Quantity   int
+	Unit_Price money.Money
+}
+
+// Discount is what one promotion took off an order. Book_Id is set for
+// discounts on a single book.
+type Discount struct {
+	Promotion_Id int64       `json:"promotion_id,omitempty"`
+	Code         string      `json:"code"`
+	Type         string      `json:"type"`
+	Description  string      `json:"description"`
+	Book_Id      int         `json:"book_id,omitempty"`
+	Amount       money.Money `json:"amount"`
+}
+
+// Result is the outcome of applying promotions to an order. Line_Totals are
+// the line prices after every discount, which is what tax is charged on.
+type Result struct {
+	Subtotal      money.Money
+	Discounts     []Discount
+	Total         money.Money
+	Line_Totals   []money.Money
+	Free_Shipping bool
+}
+
+// Apply applies the promotions to the lines of an order placed at the given
+// time. The stacking policy is fixed so the same codes always give the same
+// total: at most one promotion of each type, applied buy_x_get_y first, then
+// percent_off on what is left, then fixed_amount, then free_shipping. Order
+// wide discounts are spread over the lines in proportion to their prices and
+// no discount takes the order below zero.
+func Apply(promotions []*Promotion, lines []Line, at time.Time) (*Result, error) {
+	if len(lines) == 0 {
+		return nil, errors.New("promotion: no lines")
+	}
+	currency := lines[0].Unit_Price.Currency
+
+	result := &Result{Subtotal: money.New(0, currency), Line_Totals: make([]money.Money, len(lines))}
+	for i, line := range lines {
+		result.Line_Totals[i] = line.Unit_Price.Mul(int64(line.Quantity))
+		var err error
+		if result.Subtotal, err = result.Subtotal.Add(result.Line_Totals[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := append([]*Promotion(nil), promotions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return typeOrder[sorted[i].Type] < typeOrder[sorted[j].Type]
+	})
+
+	for i, p := range sorted {
+		if i > 0 && sorted[i-1].Type == p.Type {
+			return nil, &NotApplicableError{Code: p.Code, Reason: "cannot be combined with " + sorted[i-1].Code}
+		}
+		if err := checkEligible(p, result.Subtotal, at); err != nil {
+			return nil, err
+		}
+
+		discounts, err := apply(p, lines, result)
+		if err != nil {
+			return nil, err
+		}
+		result.Discounts = append(result.Discounts, discounts...)
+	}
+
+	result.Total = money.New(0, currency)
+	for _, total := range result.Line_Totals {
+		result.Total, _ = result.Total.Add(total)
+	}
+	return result, nil
+}
+
+func checkEligible(p *Promotion, subtotal money.Money, at time.Time) error {
+	if p.Starts_At != nil && at.Before(*p.Starts_At) {
+		return &NotApplicableError{Code: p.Code, Reason: "has not started yet"}
+	}
+	if p.Ends_At != nil && !at.Before(*p.Ends_At) {
+		return &NotApplicableError{Code: p.Code, Reason: "has expired"}
+	}
+	if p.Amount_Off != nil && p.Amount_Off.Currency != subtotal.Currency {
+		return &NotApplicableError{Code: p.Code, Reason: "is only for orders in " + p.Amount_Off.Currency}
+	}
+	if p.Min_Order_Total != nil {
+		if cmp, err := subtotal.Cmp(*p.Min_Order_Total); err != nil {
+			return &NotApplicableError{Code: p.Code, Reason: "is only for orders in " + p.Min_Order_Total.Currency}
+		} else if cmp < 0 {
+			return &NotApplicableError{Code: p.Code, Reason: "needs an order of at least " + p.Min_Order_Total.String()}
+		}
+	}
+	return nil
+}
+
+// apply takes one promotion off result.Line_Totals and returns its discounts.
+func apply(p *Promotion, lines []Line, result *Result) ([]Discount, error) {
+	discount := Discount{Promotion_Id: p.Id, Code: p.Code, Type: p.Type, Description: p.Description, Book_Id: p.Book_Id}
+
+	switch p.Type {
+	case TypeBuyXGetY:
+		var discounts []Discount
+		for i, line := range lines {
+			if p.Book_Id != 0 && line.Book_Id != p.Book_Id {
+				continue
+			}
+			free := int64(line.Quantity/(p.Buy_Quantity+p.Get_Quantity)) * int64(p.Get_Quantity)
+			if free == 0 {
+				continue
+			}
+			d := discount
+			d.Book_Id = line.Book_Id
+			d.Amount = line.Unit_Price.Mul(free)
+			result.Line_Totals[i], _ = result.Line_Totals[i].Sub(d.Amount)
+			discounts = append(discounts, d)
+		}
+		if len(discounts) == 0 {
+			return nil, &NotApplicableError{Code: p.Code, Reason: fmt.Sprintf("needs %d copies of a book", p.Buy_Quantity+p.Get_Quantity)}
+		}
+		return discounts, nil
+
+	case TypePercentOff:
+		eligible := make([]int64, len(lines))
+		base := money.New(0, result.Subtotal.Currency)
+		for i, line := range lines {
+			if p.Book_Id == 0 || line.Book_Id == p.Book_Id {
+				eligible[i] = result.Line_Totals[i].Amount
+				base.Amount += eligible[i]
+			}
+		}
+		if base.IsZero() {
+			return nil, &NotApplicableError{Code: p.Code, Reason: "does not apply to any book in the order"}
+		}
+		discount.Amount = base.MulRat(int64(p.Percent_Off), 100)
+		spread(result.Line_Totals, discount.Amount, eligible)
+		return []Discount{discount}, nil
+
+	case TypeFixedAmount:
+		remaining := money.New(0, result.Subtotal.Currency)
+		weights := make([]int64, len(lines))
+		for i, total := range result.Line_Totals {
+			weights[i] = total.Amount
+			remaining.Amount += total.Amount
+		}
+		discount.Amount = *p.Amount_Off
+		if cmp, _ := discount.Amount.Cmp(remaining); cmp > 0 {
+			discount.Amount = remaining
+		}
+		spread(result.Line_Totals, discount.Amount, weights)
+		return []Discount{discount}, nil
+
+	case TypeFreeShipping:
+		result.Free_Shipping = true
+		discount.Amount = money.New(0, result.Subtotal.Currency)
+		return []Discount{discount}, nil
+	}
+	return nil, fmt.Errorf("promotion: unknown type %q", p.Type)
+}
+
+// spread takes amount off the line totals in proportion to weights.
+func spread(totals []money.Money, amount money.Money, weights []int64) {
+	for i, share := range amount.Allocate(weights...) {
+		totals[i], _ = totals[i].Sub(share)
+	}
+}
@@ -0,0 +1,113 @@
+package promotion
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func usd(amount int64) *money.Money {
+	m := money.New(amount, "USD")
+	return &m
+}
+
+func TestApply(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	lines := []Line{
+		{Book_Id: 1, Quantity: 3, Unit_Price: money.New(1000, "USD")},
+		{Book_Id: 2, Quantity: 1, Unit_Price: money.New(500, "USD")},
+	}
+
+	bogo := &Promotion{Id: 1, Code: "BOGO", Type: TypeBuyXGetY, Book_Id: 1, Buy_Quantity: 2, Get_Quantity: 1}
+	tenOff := &Promotion{Id: 2, Code: "TENOFF", Type: TypePercentOff, Percent_Off: 10}
+	fiveDollars := &Promotion{Id: 3, Code: "FIVE", Type: TypeFixedAmount, Amount_Off: usd(500)}
+	shipping := &Promotion{Id: 4, Code: "SHIP", Type: TypeFreeShipping}
+
+	tests := []struct {
+		name      string
+		promos    []*Promotion
+		total     int64
+		discounts []int64
+	}{
+		{"none", nil, 3500, nil},
+		{"buy two get one", []*Promotion{bogo}, 2500, []int64{1000}},
+		{"percent off", []*Promotion{tenOff}, 3150, []int64{350}},
+		{"fixed amount", []*Promotion{fiveDollars}, 3000, []int64{500}},
+		// Applied in type order whatever order the codes were given in.
+		{"stacked", []*Promotion{shipping, fiveDollars, tenOff, bogo}, 1750, []int64{1000, 250, 500, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Apply(tt.promos, lines, now)
+			require.NoError(t, err)
+			assert.Equal(t, money.New(3500, "USD"), result.Subtotal)
+			assert.Equal(t, money.New(tt.total, "USD"), result.Total)
+			require.Len(t, result.Discounts, len(tt.discounts))
+			for i, d := range result.Discounts {
+				assert.Equal(t, money.New(tt.discounts[i], "USD"), d.Amount)
+			}
+
+			var sum int64
+			for _, total := range result.Line_Totals {
+				sum += total.Amount
+			}
+			assert.Equal(t, tt.total, sum)
+		})
+	}
+}
+
+func TestApply_FixedAmountCappedAtTotal(t *testing.T) {
+	lines := []Line{{Book_Id: 1, Quantity: 1, Unit_Price: money.New(300, "USD")}}
+
+	result, err := Apply([]*Promotion{{Code: "FIVE", Type: TypeFixedAmount, Amount_Off: usd(500)}}, lines, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, money.New(300, "USD"), result.Discounts[0].Amount)
+	assert.True(t, result.Total.IsZero())
+}
+
+func TestApply_NotApplicable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	lines := []Line{{Book_Id: 1, Quantity: 2, Unit_Price: money.New(1000, "USD")}}
+
+	tests := []struct {
+		name   string
+		promos []*Promotion
+		reason string
+	}{
+		{"not started", []*Promotion{{Code: "A", Type: TypeFreeShipping, Starts_At: &later}}, "has not started yet"},
+		{"expired", []*Promotion{{Code: "A", Type: TypeFreeShipping, Ends_At: &earlier}}, "has expired"},
+		{"minimum total", []*Promotion{{Code: "A", Type: TypeFreeShipping, Min_Order_Total: usd(5000)}}, "needs an order of at least 50.00 USD"},
+		{"other currency", []*Promotion{{Code: "A", Type: TypeFixedAmount, Amount_Off: &money.Money{Amount: 500, Currency: "EUR"}}}, "is only for orders in EUR"},
+		{"not enough copies", []*Promotion{{Code: "A", Type: TypeBuyXGetY, Buy_Quantity: 2, Get_Quantity: 1}}, "needs 3 copies of a book"},
+		{"other book", []*Promotion{{Code: "A", Type: TypePercentOff, Percent_Off: 10, Book_Id: 2}}, "does not apply to any book in the order"},
+		{"same type", []*Promotion{
+			{Code: "A", Type: TypePercentOff, Percent_Off: 10},
+			{Code: "B", Type: TypePercentOff, Percent_Off: 20},
+		}, "cannot be combined with A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply(tt.promos, lines, now)
+			var notApplicable *NotApplicableError
+			require.True(t, errors.As(err, &notApplicable), "got %v", err)
+			assert.Equal(t, tt.reason, notApplicable.Reason)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, (&Promotion{Type: TypePercentOff, Percent_Off: 10}).Validate())
+	assert.Error(t, (&Promotion{Type: TypePercentOff}).Validate())
+	assert.Error(t, (&Promotion{Type: TypeFixedAmount}).Validate())
+	assert.Error(t, (&Promotion{Type: TypeBuyXGetY, Buy_Quantity: 2}).Validate())
+	assert.Error(t, (&Promotion{Type: TypeFixedAmount, Amount_Off: usd(500), Min_Order_Total: &money.Money{Amount: 1, Currency: "EUR"}}).Validate())
+
+	assert.True(t, IsCode("SPRING-10"))
+	assert.False(t, IsCode("spring10"))
+	assert.Equal(t, "SPRING10", NormalizeCode(" spring10 "))
+}
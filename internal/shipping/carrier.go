@@ -0,0 +1,115 @@
+package shipping
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracking statuses, in the order a shipment normally goes through them.
+// A shipment can run into an exception at any point before delivery.
+const (
+	StatusInTransit      = "in_transit"
+	StatusOutForDelivery = "out_for_delivery"
+	StatusDelivered      = "delivered"
+	StatusException      = "exception"
+)
+
+// TrackingEvent is one scan or status update from a carrier. Id is unique per
+// shipment at the carrier so events fetched twice are only stored once.
+type TrackingEvent struct {
+	Id          string    `json:"id,omitempty"`
+	Status      string    `json:"status"`
+	Description string    `json:"description"`
+	Location    string    `json:"location,omitempty"`
+	Occurred_At time.Time `json:"occurred_at"`
+}
+
+// CarrierClient fetches tracking updates from shipping carriers. Calls are
+// made with a context that carries the deadline for the carrier to answer.
+type CarrierClient interface {
+	// Track returns every event the carrier has for the tracking number,
+	// oldest first.
+	Track(ctx context.Context, carrier, trackingNumber string) ([]TrackingEvent, error)
+}
+
+// FakeTrackingDelivered is a tracking number prefix that makes the fake
+// carrier report the shipment delivered as soon as it is first tracked.
+const FakeTrackingDelivered = "FAKE-DELIVERED-"
+
+// FakeCarrier is an in-memory carrier for local use and tests. A tracking
+// number is picked up the first time it is tracked; further events are added
+// with Push.
+type FakeCarrier struct {
+	mu      sync.Mutex
+	events  map[string][]TrackingEvent
+	nextEvt int
+	now     func() time.Time
+}
+
+func NewFakeCarrier() *FakeCarrier {
+	return &FakeCarrier{events: map[string][]TrackingEvent{}, now: time.Now}
+}
+
+func (f *FakeCarrier) Track(ctx context.Context, carrier, trackingNumber string) ([]TrackingEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := carrier + "/" + trackingNumber
+	if _, ok := f.events[key]; !ok {
+		f.add(key, StatusInTransit, "Picked up by "+carrier)
+		if strings.HasPrefix(trackingNumber, FakeTrackingDelivered) {
+			f.add(key, StatusDelivered, "Delivered")
+		}
+	}
+	return append([]TrackingEvent(nil), f.events[key]...), nil
+}
+
+// Push adds an event to a tracking number as if the carrier had scanned it.
+func (f *FakeCarrier) Push(carrier, trackingNumber, status, description string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := carrier + "/" + trackingNumber
+	if _, ok := f.events[key]; !ok {
+		f.add(key, StatusInTransit, "Picked up by "+carrier)
+	}
+	f.add(key, status, description)
+}
+
+func (f *FakeCarrier) add(key, status, description string) {
+	f.nextEvt++
+	f.events[key] = append(f.events[key], TrackingEvent{
+		Id:          fmt.Sprintf("fake_evt_%d", f.nextEvt),
+		Status:      status,
+		Description: description,
+		Occurred_At: f.now().UTC(),
+	})
+}
+
+var statusRank = map[string]int{StatusInTransit: 1, StatusOutForDelivery: 2, StatusDelivered: 3, StatusException: 0}
+
+// IsStatus reports whether status is a tracking status.
+func IsStatus(status string) bool {
+	_, ok := statusRank[status]
+	return ok
+}
+
+// CanMove reports whether a shipment in status from may move to status to.
+// Shipments only move forward, except that one not yet delivered can run into
+// an exception and move on from it again.
+func CanMove(from, to string) bool {
+	if from == to || from == StatusDelivered || !IsStatus(to) {
+		return false
+	}
+	if from == StatusException || to == StatusException {
+		return true
+	}
+	return statusRank[to] > statusRank[from]
+}
@@ -0,0 +1,46 @@
+package shipping
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeCarrier(t *testing.T) {
+	fake := NewFakeCarrier()
+	ctx := context.Background()
+
+	events, err := fake.Track(ctx, "UPS", "1Z999")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, StatusInTransit, events[0].Status)
+
+	fake.Push("UPS", "1Z999", StatusOutForDelivery, "Out for delivery")
+	events, err = fake.Track(ctx, "UPS", "1Z999")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, StatusOutForDelivery, events[1].Status)
+	assert.NotEqual(t, events[0].Id, events[1].Id)
+
+	events, err = fake.Track(ctx, "UPS", FakeTrackingDelivered+"1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusDelivered, events[len(events)-1].Status)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = fake.Track(cancelled, "UPS", "1Z999")
+	assert.Error(t, err)
+}
+
+func TestCanMove(t *testing.T) {
+	assert.True(t, CanMove(StatusInTransit, StatusOutForDelivery))
+	assert.True(t, CanMove(StatusInTransit, StatusDelivered))
+	assert.True(t, CanMove(StatusOutForDelivery, StatusException))
+	assert.True(t, CanMove(StatusException, StatusInTransit))
+	assert.False(t, CanMove(StatusOutForDelivery, StatusInTransit))
+	assert.False(t, CanMove(StatusDelivered, StatusException))
+	assert.False(t, CanMove(StatusInTransit, StatusInTransit))
+	assert.False(t, CanMove(StatusInTransit, "lost"))
+}
@@ -0,0 +1,126 @@
+// Package shipping works out what it costs to ship an order, checks the
+// postal codes of the addresses it goes to and tracks shipments with
+// carriers. Checkout only uses the RateCalculator interface and tracking only
+// the CarrierClient interface, so both can be swapped through configuration.
+package shipping
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// Parcel is what is shipped for an order: how many items, their total weight
+// and where they go.
+type Parcel struct {
+	Country      string
+	Postal_Code  string
+	Items        int
+	Weight_Grams int
+}
+
+// RateCalculator quotes the cost of shipping a parcel. It returns an
+// *UnavailableError when the parcel cannot be shipped to its country.
+type RateCalculator interface {
+	Quote(parcel Parcel) (money.Money, error)
+}
+
+// UnavailableError is returned when there is no rate for a country.
+type UnavailableError struct {
+	Country string
+}
+
+func (e *UnavailableError) Error() string {
+	return "shipping: no rate for " + e.Country
+}
+
+// Rate is a base charge plus a charge per unit, which is a kilogram or an
+// item depending on the calculator.
+type Rate struct {
+	Base     money.Money
+	Per_Unit money.Money
+}
+
+// Zones holds the rate for each destination country. The "*" entry covers
+// every country without a rate of its own.
+type Zones map[string]Rate
+
+func (z Zones) find(country string) (Rate, error) {
+	if rate, ok := z[country]; ok {
+		return rate, nil
+	}
+	if rate, ok := z["*"]; ok {
+		return rate, nil
+	}
+	return Rate{}, &UnavailableError{Country: country}
+}
+
+func (r Rate) quote(units int) (money.Money, error) {
+	return r.Base.Add(r.Per_Unit.Mul(int64(units)))
+}
+
+// ByWeight charges the base rate plus the per unit rate for every started
+// kilogram.
+type ByWeight struct {
+	Zones Zones
+}
+
+func (c ByWeight) Quote(parcel Parcel) (money.Money, error) {
+	rate, err := c.Zones.find(parcel.Country)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return rate.quote((parcel.Weight_Grams + 999) / 1000)
+}
+
+// ByItemCount charges the base rate for the first item and the per unit rate
+// for every other item.
+type ByItemCount struct {
+	Zones Zones
+}
+
+func (c ByItemCount) Quote(parcel Parcel) (money.Money, error) {
+	rate, err := c.Zones.find(parcel.Country)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return rate.quote(max(parcel.Items-1, 0))
+}
+
+// postalCodes holds the postal code formats of the countries that are
+// checked. Codes are compared upper case with surrounding space removed.
+var postalCodes = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"IE": regexp.MustCompile(`^[A-Z]\d[\dW] ?[A-Z\d]{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"IN": regexp.MustCompile(`^\d{6}$`),
+	"BR": regexp.MustCompile(`^\d{5}-?\d{3}$`),
+}
+
+// otherPostalCode is the loose format used for countries not listed above.
+var otherPostalCode = regexp.MustCompile(`^[A-Z\d][A-Z\d -]{1,9}$`)
+
+// CheckPostalCode reports an error if code is not a postal code of the
+// country, which is an ISO 3166 alpha-2 code.
+func CheckPostalCode(country, code string) error {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	pattern, ok := postalCodes[country]
+	if !ok {
+		pattern = otherPostalCode
+	}
+	if !pattern.MatchString(code) {
+		return fmt.Errorf("%q is not a valid postal code for %s", code, country)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package shipping
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuote(t *testing.T) {
+	zones := Zones{
+		"US": {Base: money.New(499, "USD"), Per_Unit: money.New(100, "USD")},
+		"*":  {Base: money.New(1500, "USD"), Per_Unit: money.New(500, "USD")},
+	}
+
+	tests := []struct {
+		name       string
+		calculator RateCalculator
+		parcel     Parcel
+		want       int64
+	}{
+		{"one item", ByItemCount{zones}, Parcel{Country: "US", Items: 1}, 499},
+		{"more items", ByItemCount{zones}, Parcel{Country: "US", Items: 3}, 699},
+		{"other country", ByItemCount{zones}, Parcel{Country: "DE", Items: 2}, 2000},
+		{"started kilograms", ByWeight{zones}, Parcel{Country: "US", Weight_Grams: 1200}, 699},
+		{"weightless", ByWeight{zones}, Parcel{Country: "US"}, 499},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.calculator.Quote(tt.parcel)
+			require.NoError(t, err)
+			assert.Equal(t, money.New(tt.want, "USD"), got)
+		})
+	}
+
+	_, err := ByWeight{Zones{"US": zones["US"]}}.Quote(Parcel{Country: "DE"})
+	var unavailable *UnavailableError
+	require.True(t, errors.As(err, &unavailable))
+	assert.Equal(t, "DE", unavailable.Country)
+}
+
+func TestCheckPostalCode(t *testing.T) {
+	for _, good := range [][2]string{{"US", "94103"}, {"US", "94103-1234"}, {"CA", "k1a 0b1"}, {"GB", "SW1A 1AA"}, {"DE", "10115"}, {"NZ", "6011"}} {
+		assert.NoError(t, CheckPostalCode(good[0], good[1]), good)
+	}
+	for _, bad := range [][2]string{{"US", "9410"}, {"CA", "12345"}, {"GB", "12345"}, {"DE", "1011"}, {"NZ", "!"}} {
+		assert.Error(t, CheckPostalCode(bad[0], bad[1]), bad)
+	}
+}
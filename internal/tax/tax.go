@@ -0,0 +1,138 @@
+// Package tax works out the tax on order lines. Checkout only uses the
+// Calculator interface; Table is the implementation driven by a table of
+// rates per region, book category and effective date.
+package tax
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+)
+
+// Rule is one row of a tax table: the rate charged in a region on books of a
+// category from Effective_At until a later rule for the same region and
+// category takes over. A rule with an empty Category applies to every category
+// without a rule of its own, and a rate of zero exempts the category.
+type Rule struct {
+	Id           int64     `json:"id"`
+	Region       string    `json:"region" binding:"required,tax_region"`
+	Category     string    `json:"category" binding:"max=32"`
+	Name         string    `json:"name" binding:"required,max=64"`
+	Rate         string    `json:"rate" binding:"required,tax_rate"`
+	Effective_At time.Time `json:"effective_at"`
+}
+
+// Line is an order line to be taxed. Amount is the line price before tax.
+type Line struct {
+	Book_Id  int
+	Category string
+	Amount   money.Money
+}
+
+// LineTax is the tax on one order line and the rule it was charged under.
+type LineTax struct {
+	Book_Id        int         `json:"book_id"`
+	Rule_Id        int64       `json:"rule_id,omitempty"`
+	Name           string      `json:"name"`
+	Region         string      `json:"region"`
+	Category       string      `json:"category,omitempty"`
+	Rate           string      `json:"rate"`
+	Taxable_Amount money.Money `json:"taxable_amount"`
+	Tax_Amount     money.Money `json:"tax_amount"`
+}
+
+// Calculator works out the tax on order lines shipped to a region at a given
+// time. Lines that no rate applies to are left out of the result.
+type Calculator interface {
+	Calculate(region string, at time.Time, lines []Line) ([]LineTax, error)
+}
+
+var regionPattern = regexp.MustCompile(`^[A-Z]{2}(-[A-Z0-9]{1,3})?$`)
+
+// IsRegion reports whether region is an ISO 3166 country code, optionally
+// followed by a subdivision such as "US-CA".
+func IsRegion(region string) bool {
+	return regionPattern.MatchString(region)
+}
+
+// ParseRate reads a tax rate given as a decimal fraction between 0 and 1, such
+// as "0.0725" for 7.25%.
+func ParseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") || rate.Sign() < 0 || rate.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("tax: invalid rate %q", s)
+	}
+	return rate, nil
+}
+
+// Table is a Calculator over a fixed set of rules. A subdivision such as
+// "US-CA" falls back to the rules of its country when it has none of its own.
+type Table struct {
+	rules []Rule
+}
+
+func NewTable(rules []Rule) *Table {
+	return &Table{rules: append([]Rule(nil), rules...)}
+}
+
+func (t *Table) Calculate(region string, at time.Time, lines []Line) ([]LineTax, error) {
+	taxes := []LineTax{}
+	for _, line := range lines {
+		rule := t.rule(region, line.Category, at)
+		if rule == nil {
+			continue
+		}
+
+		rate, err := ParseRate(rule.Rate)
+		if err != nil {
+			return nil, err
+		}
+
+		taxes = append(taxes, LineTax{
+			Book_Id:        line.Book_Id,
+			Rule_Id:        rule.Id,
+			Name:           rule.Name,
+			Region:         rule.Region,
+			Category:       rule.Category,
+			Rate:           rule.Rate,
+			Taxable_Amount: line.Amount,
+			Tax_Amount:     line.Amount.MulRat(rate.Num().Int64(), rate.Denom().Int64()),
+		})
+	}
+	return taxes, nil
+}
+
+// rule finds the rule for a category in the region, or its country, in effect
+// at the given time. A rule for the category beats one for every category.
+func (t *Table) rule(region string, category string, at time.Time) *Rule {
+	regions := []string{region}
+	if country, _, ok := strings.Cut(region, "-"); ok {
+		regions = append(regions, country)
+	}
+
+	for _, r := range regions {
+		for _, c := range []string{category, ""} {
+			var found *Rule
+			for i := range t.rules {
+				rule := &t.rules[i]
+				if rule.Region != r || rule.Category != c || rule.Effective_At.After(at) {
+					continue
+				}
+				if found == nil || rule.Effective_At.After(found.Effective_At) {
+					found = rule
+				}
+			}
+			if found != nil {
+				return found
+			}
+			if c == "" {
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package tax
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hamorrar/bookstore/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestTableCalculate(t *testing.T) {
+	table := NewTable([]Rule{
+		{Id: 1, Region: "US-CA", Name: "CA sales tax", Rate: "0.0725", Effective_At: day("2020-01-01")},
+		{Id: 2, Region: "US-CA", Name: "CA sales tax", Rate: "0.08", Effective_At: day("2030-01-01")},
+		{Id: 3, Region: "US", Name: "Federal", Rate: "0.05", Effective_At: day("2020-01-01")},
+		{Id: 4, Region: "GB", Name: "VAT", Rate: "0.2", Effective_At: day("2020-01-01")},
+		{Id: 5, Region: "GB", Category: "book", Name: "VAT", Rate: "0", Effective_At: day("2020-01-01")},
+	})
+
+	lines := []Line{
+		{Book_Id: 1, Category: "book", Amount: money.New(1000, "USD")},
+		{Book_Id: 2, Category: "ebook", Amount: money.New(999, "USD")},
+	}
+
+	tests := []struct {
+		name   string
+		region string
+		at     time.Time
+		want   []int64 // tax per line
+		rules  []int64
+	}{
+		{"subdivision rule", "US-CA", day("2024-06-01"), []int64{73, 72}, []int64{1, 1}}, // 72.5 and 72.43
+		{"later rule takes over", "US-CA", day("2030-06-01"), []int64{80, 80}, []int64{2, 2}},
+		{"falls back to country", "US-NY", day("2024-06-01"), []int64{50, 50}, []int64{3, 3}},
+		{"category exemption", "GB", day("2024-06-01"), []int64{0, 200}, []int64{5, 4}},
+		{"no rule yet", "GB", day("2019-06-01"), nil, nil},
+		{"unknown region", "FR", day("2024-06-01"), nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taxes, err := table.Calculate(tt.region, tt.at, lines)
+			require.NoError(t, err)
+			require.Len(t, taxes, len(tt.want))
+			for i, tax := range taxes {
+				assert.Equal(t, money.New(tt.want[i], "USD"), tax.Tax_Amount)
+				assert.Equal(t, tt.rules[i], tax.Rule_Id)
+				assert.Equal(t, lines[i].Amount, tax.Taxable_Amount)
+			}
+		})
+	}
+}
+
+func TestParseRateAndRegion(t *testing.T) {
+	for _, good := range []string{"0", "0.0725", "1"} {
+		_, err := ParseRate(good)
+		assert.NoError(t, err, good)
+	}
+	for _, bad := range []string{"-0.1", "1.5", "abc", "1/3", ""} {
+		_, err := ParseRate(bad)
+		assert.Error(t, err, bad)
+	}
+
+	assert.True(t, IsRegion("US"))
+	assert.True(t, IsRegion("US-CA"))
+	assert.False(t, IsRegion("us-ca"))
+	assert.False(t, IsRegion("USA"))
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/hamorrar/bookstore/internal/database"
@@ -17,10 +16,8 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func SetupDB() database.Models {
-	DB_DSN := os.Getenv("DB_DSN")
-
-	db, err := sql.Open("postgres", DB_DSN)
+func SetupDB(dsn string) database.Models {
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -59,6 +56,14 @@ func StringToJSON(str string) map[string]interface{} {
 	return res
 }
 
+func StringToJSONArray(str string) []map[string]interface{} {
+	var res []map[string]interface{}
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		log.Fatalf("could not unmarshal expected: %v", err.Error())
+	}
+	return res
+}
+
 func RegisterCustomer(client *http.Client, url string) (*http.Response, error) {
 	payload := `{"email":"user1@gmail.com", "password":"password1", "role":"Customer"}`
 	resp, err := client.Post(url+"/auth/register", "application/json", strings.NewReader(payload))
@@ -88,7 +93,7 @@ func LoginAdmin(client *http.Client, url string) (*http.Response, error) {
 }
 
 func MakeABook(client *http.Client, url string) (*http.Response, error) {
-	payload := `{"title":"Title1", "author":"First","price":1}`
+	payload := `{"title":"Title1", "author":"First","price":{"amount":1,"currency":"USD"}}`
 	resp, err := client.Post(url+"/books", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -97,7 +102,7 @@ func MakeABook(client *http.Client, url string) (*http.Response, error) {
 }
 
 func MakeAnOrder(client *http.Client, url string) (*http.Response, error) {
-	payload := `{"user_id":1, "status":"Pending","total_price":1}`
+	payload := `{"user_id":1, "status":"Pending","total_price":{"amount":1,"currency":"USD"}}`
 	resp, err := client.Post(url+"/orders", "application/json", strings.NewReader(payload))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -0,0 +1,138 @@
+// Package webhook signs and sends webhook requests, and verifies them on the
+// receiving end.
+//
+// Every request is a POST of a JSON body with three headers: Webhook-Id,
+// which stays the same across retries of a delivery so receivers can ignore
+// repeats; Webhook-Timestamp, the Unix time in seconds when the request was
+// sent; and Webhook-Signature, "v1=" followed by the hex encoded HMAC-SHA256
+// of the timestamp, a dot and the body, keyed with the subscription's secret.
+// Signing the timestamp lets receivers reject requests replayed later.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	IdHeader        = "Webhook-Id"
+	TimestampHeader = "Webhook-Timestamp"
+	SignatureHeader = "Webhook-Signature"
+
+	signaturePrefix = "v1="
+	// maxResponseBody is how much of a response is kept for the delivery log.
+	maxResponseBody = 1024
+)
+
+var (
+	// ErrInvalidSignature is returned by Verify when the request was not
+	// signed with the secret.
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	// ErrStaleTimestamp is returned by Verify when the request was signed
+	// too long ago, or too far in the future.
+	ErrStaleTimestamp = errors.New("webhook: timestamp outside the tolerance")
+)
+
+// Sign returns the Webhook-Signature header value for body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return signaturePrefix + hex.EncodeToString(mac(secret, timestamp.Unix(), body))
+}
+
+func mac(secret string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Verify checks that the request with header and body was signed with secret
+// no more than tolerance away from now.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	hexSignature, ok := strings.CutPrefix(header.Get(SignatureHeader), signaturePrefix)
+	if !ok {
+		return ErrInvalidSignature
+	}
+	signature, err := hex.DecodeString(hexSignature)
+	if err != nil || !hmac.Equal(signature, mac(secret, timestamp, body)) {
+		return ErrInvalidSignature
+	}
+
+	if d := now.Sub(time.Unix(timestamp, 0)); d > tolerance || d < -tolerance {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
+
+// Request is a webhook to send.
+type Request struct {
+	URL    string
+	Secret string
+	// Id identifies the delivery; it is the same on every attempt.
+	Id   string
+	Body []byte
+	// Header holds any other headers to send.
+	Header http.Header
+}
+
+// Result is what came of sending a webhook. Err is nil only for a 2xx
+// response.
+type Result struct {
+	Status   int
+	Body     string
+	Duration time.Duration
+	Err      error
+}
+
+// Send signs and posts the request with client.
+func Send(ctx context.Context, client *http.Client, r Request) Result {
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(r.Body))
+	if err != nil {
+		return Result{Err: err}
+	}
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdHeader, r.Id)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(r.Secret, start, r.Body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start), Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result := Result{Status: resp.StatusCode, Body: text(body), Duration: time.Since(start)}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Err = fmt.Errorf("webhook: %s answered %s", r.URL, resp.Status)
+	}
+	return result
+}
+
+// text returns body as valid UTF-8 without NUL bytes, so it can be stored
+// in a text column even when the read stopped half way through a rune.
+func text(body []byte) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(string(body), ""), "\x00", "")
+}
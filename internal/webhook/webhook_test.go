@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	signature := Sign("secret", time.Unix(1700000000, 0), []byte(`{"a":1}`))
+	assert.Equal(t, "v1=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686", signature)
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"a":1}`)
+	header := http.Header{}
+	header.Set(TimestampHeader, "1700000000")
+	header.Set(SignatureHeader, Sign("secret", now, body))
+
+	assert.NoError(t, Verify("secret", header, body, 5*time.Minute, now.Add(time.Minute)))
+	assert.ErrorIs(t, Verify("other", header, body, 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"a":2}`), 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, body, 5*time.Minute, now.Add(10*time.Minute)), ErrStaleTimestamp)
+
+	// the timestamp is signed, so it cannot be moved forward
+	header.Set(TimestampHeader, "1700000600")
+	assert.ErrorIs(t, Verify("secret", header, body, 5*time.Minute, now.Add(10*time.Minute)), ErrInvalidSignature)
+
+	assert.ErrorIs(t, Verify("secret", http.Header{}, body, 5*time.Minute, now), ErrInvalidSignature)
+}
+
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	header := http.Header{}
+	header.Set("Event-Type", "order.created")
+	result := Send(context.Background(), ts.Client(), Request{URL: ts.URL, Secret: "secret", Id: "7", Body: []byte(`{"a":1}`), Header: header})
+	require.NoError(t, result.Err)
+	assert.Equal(t, http.StatusOK, result.Status)
+	assert.Equal(t, "ok", result.Body)
+
+	assert.Equal(t, `{"a":1}`, string(gotBody))
+	assert.Equal(t, "7", got.Header.Get(IdHeader))
+	assert.Equal(t, "order.created", got.Header.Get("Event-Type"))
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.NoError(t, Verify("secret", got.Header, gotBody, time.Minute, time.Now()))
+}
+
+func TestSend_Failure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Repeat("é", maxResponseBody)))
+	}))
+	defer ts.Close()
+
+	result := Send(context.Background(), ts.Client(), Request{URL: ts.URL, Secret: "secret", Id: "7", Body: []byte(`{}`)})
+	assert.Error(t, result.Err)
+	assert.Equal(t, http.StatusServiceUnavailable, result.Status)
+	assert.Equal(t, strings.Repeat("é", maxResponseBody/2), result.Body)
+
+	ts.Close()
+	result = Send(context.Background(), ts.Client(), Request{URL: ts.URL, Secret: "secret", Id: "7", Body: []byte(`{}`)})
+	assert.Error(t, result.Err)
+	assert.Zero(t, result.Status)
+}